@@ -64,8 +64,8 @@ func current(cmd *cobra.Command, args []string) {
 
 	row := []string{
 		name,
-		format.Time(plan.UpdatedAt),
-		format.Time(plan.CreatedAt),
+		format.Time(plan.UpdatedAt.Time),
+		format.Time(plan.CreatedAt.Time),
 		// strconv.Itoa(plan.ActiveBranches),
 		lib.CurrentBranch,
 		strconv.Itoa(branch.ContextTokens) + " 🪙",
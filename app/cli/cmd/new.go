@@ -15,6 +15,7 @@ import (
 )
 
 var name string
+var workingBranch string
 
 // newCmd represents the new command
 var newCmd = &cobra.Command{
@@ -29,6 +30,7 @@ var newCmd = &cobra.Command{
 func init() {
 	RootCmd.AddCommand(newCmd)
 	newCmd.Flags().StringVarP(&name, "name", "n", "", "Name of the new plan")
+	newCmd.Flags().StringVar(&workingBranch, "branch", "", "Git branch the plan's changes will be applied to")
 }
 
 func new(cmd *cobra.Command, args []string) {
@@ -36,7 +38,7 @@ func new(cmd *cobra.Command, args []string) {
 	lib.MustResolveOrCreateProject()
 
 	term.StartSpinner("")
-	res, apiErr := api.Client.CreatePlan(lib.CurrentProjectId, shared.CreatePlanRequest{Name: name})
+	res, apiErr := api.Client.CreatePlan(lib.CurrentProjectId, shared.CreatePlanRequest{Name: name, Branch: workingBranch})
 	term.StopSpinner()
 
 	if apiErr != nil {
@@ -68,11 +70,11 @@ func new(cmd *cobra.Command, args []string) {
 		term.OutputErrorAndExit("Error setting current plan: %v", err)
 	}
 
-	if name == "" {
-		name = "draft"
-	}
+	fmt.Printf("✅ Started new plan %s and set it to current plan\n", color.New(color.Bold, term.ColorHiGreen).Sprint(res.Name))
 
-	fmt.Printf("✅ Started new plan %s and set it to current plan\n", color.New(color.Bold, term.ColorHiGreen).Sprint(name))
+	if res.WasRenamed {
+		fmt.Printf("A plan named %s already exists, so this one was named %s\n", color.New(color.Bold).Sprint(res.RequestedName), color.New(color.Bold).Sprint(res.Name))
+	}
 
 	fmt.Println()
 	term.PrintCmds("", "load", "tell", "plans", "current")
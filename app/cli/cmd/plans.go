@@ -182,8 +182,8 @@ func plans(cmd *cobra.Command, args []string) {
 			row := []string{
 				num,
 				name,
-				format.Time(p.UpdatedAt),
-				// format.Time(p.CreatedAt),
+				format.Time(p.UpdatedAt.Time),
+				// format.Time(p.CreatedAt.Time),
 				// strconv.Itoa(p.ActiveBranches),
 				currentBranch.Name,
 				strconv.Itoa(currentBranch.ContextTokens) + " 🪙",
@@ -64,6 +64,8 @@ func ps(cmd *cobra.Command, args []string) {
 			status = "Error " + format.Time(finishedAt)
 		case shared.PlanStatusStopped:
 			status = "Stopped " + format.Time(finishedAt)
+		case shared.PlanStatusInterrupted:
+			status = "Interrupted " + format.Time(finishedAt)
 		case shared.PlanStatusMissingFile:
 			status = "Missing file"
 		}
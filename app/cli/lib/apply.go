@@ -71,6 +71,30 @@ func MustApplyPlan(planId, branch string, autoConfirm bool) {
 	currentPlanFiles := currentPlanState.CurrentPlanFiles
 	isRepo := fs.ProjectRootIsGitRepo()
 
+	if isRepo {
+		plan, apiErr := api.Client.GetPlan(planId)
+
+		if apiErr != nil {
+			term.StopSpinner()
+			term.OutputErrorAndExit("Error getting plan: %v", apiErr.Msg)
+		}
+
+		if plan.WorkingBranch != "" {
+			gitBranch, err := GitCurrentBranch()
+
+			if err != nil {
+				term.StopSpinner()
+				term.OutputErrorAndExit("Error getting current git branch: %v", err)
+			}
+
+			if gitBranch != plan.WorkingBranch {
+				term.StopSpinner()
+				fmt.Printf("This plan applies to the git branch %s, but %s is checked out. Check out %s before applying.\n", plan.WorkingBranch, gitBranch, plan.WorkingBranch)
+				os.Exit(1)
+			}
+		}
+	}
+
 	toApply := currentPlanFiles.Files
 
 	if len(toApply) == 0 {
@@ -88,6 +88,18 @@ func GitCommit(repoDir, commitMsg string, paths []string, lockMutex bool) error
 	return nil
 }
 
+func GitCurrentBranch() (string, error) {
+	gitMutex.Lock()
+	defer gitMutex.Unlock()
+
+	res, err := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("error getting current branch: %v, output: %s", err, string(res))
+	}
+
+	return strings.TrimSpace(string(res)), nil
+}
+
 func CheckUncommittedChanges() (bool, error) {
 	gitMutex.Lock()
 	defer gitMutex.Unlock()
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/plandex/plandex/shared"
+)
+
+type AuditOutboxEvent struct {
+	Id            string    `db:"id"`
+	OrgId         string    `db:"org_id"`
+	Event         []byte    `db:"event"`
+	Attempts      int       `db:"attempts"`
+	NextAttemptAt time.Time `db:"next_attempt_at"`
+	LastError     *string   `db:"last_error"`
+	CreatedAt     time.Time `db:"created_at"`
+}
+
+func (e *AuditOutboxEvent) PlanEvent() (*shared.PlanEvent, error) {
+	var event shared.PlanEvent
+	err := json.Unmarshal(e.Event, &event)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling audit event: %v", err)
+	}
+	return &event, nil
+}
+
+// queueAuditEventTx adds the event to the outbox as part of tx, if the org has an audit webhook
+func queueAuditEventTx(tx *sql.Tx, event *shared.PlanEvent) error {
+	bytes, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error marshalling audit event: %v", err)
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO audit_outbox (org_id, event) SELECT id, $2 FROM orgs WHERE id = $1 AND audit_webhook_url IS NOT NULL",
+		event.OrgId, bytes,
+	)
+
+	if err != nil {
+		return fmt.Errorf("error queueing audit event: %v", err)
+	}
+
+	return nil
+}
+
+// ClaimDueAuditEvents returns up to limit events that are due for delivery and leases them to the
+// caller for lease. Concurrent claims, including from other hosts, get different events, and a
+// claimed event isn't handed out again until its lease passes, so a host that dies mid-delivery
+// only delays it. The lease should cover delivering the whole batch.
+func ClaimDueAuditEvents(limit int, lease time.Duration) ([]*AuditOutboxEvent, error) {
+	var events []*AuditOutboxEvent
+	err := Conn.Select(&events, fmt.Sprintf(`UPDATE audit_outbox SET next_attempt_at = NOW() + INTERVAL '%d seconds'
+		WHERE id IN (
+			SELECT id FROM audit_outbox WHERE next_attempt_at <= NOW() ORDER BY created_at LIMIT $1 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`, int(lease.Seconds())), limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("error claiming audit events: %v", err)
+	}
+
+	return events, nil
+}
+
+func DeleteAuditEvent(id string) error {
+	_, err := Conn.Exec("DELETE FROM audit_outbox WHERE id = $1", id)
+
+	if err != nil {
+		return fmt.Errorf("error deleting audit event: %v", err)
+	}
+
+	return nil
+}
+
+// RetryAuditEvent records a failed delivery and schedules the next attempt after backoff
+func RetryAuditEvent(id string, deliveryErr error, backoff time.Duration) error {
+	_, err := Conn.Exec(
+		fmt.Sprintf("UPDATE audit_outbox SET attempts = attempts + 1, last_error = $2, next_attempt_at = NOW() + INTERVAL '%d seconds' WHERE id = $1", int(backoff.Seconds())),
+		id, deliveryErr.Error(),
+	)
+
+	if err != nil {
+		return fmt.Errorf("error scheduling audit event retry: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,277 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// in-process cache of the authorization lookups every request makes: org membership and
+// permissions per (user, org), and project existence per (org, project). Only positive results
+// are cached, so accepting an invite or creating a project takes effect right away. Anything that
+// takes access away must call the matching Invalidate func after it commits. Like the plan cache,
+// invalidations are local to this host, so the TTL is kept short to bound how long another host
+// can keep granting access that was removed.
+
+const defaultAuthCacheSize = 10000
+const defaultAuthCacheTTL = 5 * time.Second
+
+type AuthCacheStats struct {
+	Size   int
+	Hits   int64
+	Misses int64
+}
+
+type authCacheEntry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+type authCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]authCacheEntry
+	// bumped on every invalidation so a lookup that raced with a removal doesn't cache the old result
+	generation uint64
+	hits       int64
+	misses     int64
+}
+
+var authCacheInstance *authCache
+
+func init() {
+	size := defaultAuthCacheSize
+	ttl := defaultAuthCacheTTL
+
+	if s := os.Getenv("PLANDEX_AUTH_CACHE_SIZE"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			panic(fmt.Errorf("PLANDEX_AUTH_CACHE_SIZE must be an integer >= 0, got: %s", s))
+		}
+		size = n
+	}
+
+	if s := os.Getenv("PLANDEX_AUTH_CACHE_TTL"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			panic(fmt.Errorf("PLANDEX_AUTH_CACHE_TTL must be a non-negative duration like 5s, got: %s", s))
+		}
+		ttl = d
+	}
+
+	authCacheInstance = newAuthCache(size, ttl)
+}
+
+func newAuthCache(size int, ttl time.Duration) *authCache {
+	return &authCache{
+		size:    size,
+		ttl:     ttl,
+		entries: map[string]authCacheEntry{},
+	}
+}
+
+func (c *authCache) enabled() bool {
+	return c.size > 0 && c.ttl > 0
+}
+
+// get returns the cached value, or nil and the current generation to pass to put
+func (c *authCache) get(key string) (interface{}, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[key]; ok {
+		if time.Now().Before(entry.expiresAt) {
+			c.hits++
+			return entry.value, c.generation
+		}
+		delete(c.entries, key)
+	}
+
+	c.misses++
+	return nil, c.generation
+}
+
+func (c *authCache) put(key string, value interface{}, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	now := time.Now()
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.size {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+
+		// everything is still live, so start over rather than tracking recency; entries only
+		// last a few seconds anyway
+		if len(c.entries) >= c.size {
+			c.entries = map[string]authCacheEntry{}
+		}
+	}
+
+	c.entries[key] = authCacheEntry{
+		value:     value,
+		expiresAt: now.Add(c.ttl),
+	}
+}
+
+func (c *authCache) invalidate(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+
+	for _, key := range keys {
+		delete(c.entries, key)
+	}
+}
+
+func (c *authCache) stats() AuthCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return AuthCacheStats{
+		Size:   len(c.entries),
+		Hits:   c.hits,
+		Misses: c.misses,
+	}
+}
+
+func orgMembershipCacheKey(userId, orgId string) string {
+	return "membership:" + orgId + ":" + userId
+}
+
+func userPermissionsCacheKey(userId, orgId string) string {
+	return "permissions:" + orgId + ":" + userId
+}
+
+func projectCacheKey(orgId, projectId string) string {
+	return "project:" + orgId + ":" + projectId
+}
+
+// ValidateOrgMembershipCached is ValidateOrgMembership served from the auth cache when the user
+// was recently found to be a member
+func ValidateOrgMembershipCached(userId, orgId string) (bool, error) {
+	if !authCacheInstance.enabled() {
+		return ValidateOrgMembership(userId, orgId)
+	}
+
+	key := orgMembershipCacheKey(userId, orgId)
+
+	cached, generation := authCacheInstance.get(key)
+	if cached != nil {
+		return true, nil
+	}
+
+	isMember, err := ValidateOrgMembership(userId, orgId)
+	if err != nil {
+		return false, err
+	}
+
+	if isMember {
+		authCacheInstance.put(key, true, generation)
+	}
+
+	return isMember, nil
+}
+
+// GetUserPermissionsCached is GetUserPermissions served from the auth cache when possible.
+// Callers get their own copy of the slice.
+func GetUserPermissionsCached(userId, orgId string) ([]string, error) {
+	if !authCacheInstance.enabled() {
+		return GetUserPermissions(userId, orgId)
+	}
+
+	key := userPermissionsCacheKey(userId, orgId)
+
+	cached, generation := authCacheInstance.get(key)
+	if cached != nil {
+		return append([]string{}, cached.([]string)...), nil
+	}
+
+	permissions, err := GetUserPermissions(userId, orgId)
+	if err != nil {
+		return nil, err
+	}
+
+	authCacheInstance.put(key, append([]string{}, permissions...), generation)
+
+	return permissions, nil
+}
+
+// ProjectExistsCached is ProjectExists served from the auth cache when the project was recently
+// found
+func ProjectExistsCached(orgId, projectId string) (bool, error) {
+	if !authCacheInstance.enabled() {
+		return ProjectExists(orgId, projectId)
+	}
+
+	key := projectCacheKey(orgId, projectId)
+
+	cached, generation := authCacheInstance.get(key)
+	if cached != nil {
+		return true, nil
+	}
+
+	exists, err := ProjectExists(orgId, projectId)
+	if err != nil {
+		return false, err
+	}
+
+	if exists {
+		authCacheInstance.put(key, true, generation)
+	}
+
+	return exists, nil
+}
+
+// InvalidateOrgUserAuthCache drops a user's cached membership and permissions for an org. Call it
+// after removing the user or changing their role.
+func InvalidateOrgUserAuthCache(orgId, userId string) {
+	authCacheInstance.invalidate(orgMembershipCacheKey(userId, orgId), userPermissionsCacheKey(userId, orgId))
+}
+
+func GetAuthCacheStats() AuthCacheStats {
+	return authCacheInstance.stats()
+}
+
+const cacheStatsLogInterval = 5 * time.Minute
+
+// StartCacheStatsLogger periodically logs plan and auth cache hit rates, so the db lookups they
+// save can be measured. Intervals with no lookups aren't logged.
+func StartCacheStatsLogger() {
+	go func() {
+		var lastPlan PlanCacheStats
+		var lastAuth AuthCacheStats
+
+		for {
+			time.Sleep(cacheStatsLogInterval)
+
+			planStats := GetPlanCacheStats()
+			authStats := GetAuthCacheStats()
+
+			planHits, planMisses := planStats.Hits-lastPlan.Hits, planStats.Misses-lastPlan.Misses
+			authHits, authMisses := authStats.Hits-lastAuth.Hits, authStats.Misses-lastAuth.Misses
+
+			lastPlan = planStats
+			lastAuth = authStats
+
+			if planHits+planMisses+authHits+authMisses == 0 {
+				continue
+			}
+
+			log.Printf("Cache stats for the last %s | plan cache: %d hits, %d misses, %d entries | auth cache: %d hits, %d misses, %d entries\n",
+				cacheStatsLogInterval, planHits, planMisses, planStats.Size, authHits, authMisses, authStats.Size)
+		}
+	}()
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAuthCacheExpires(t *testing.T) {
+	c := newAuthCache(10, time.Millisecond)
+
+	_, gen := c.get("a")
+	c.put("a", true, gen)
+
+	time.Sleep(5 * time.Millisecond)
+
+	if v, _ := c.get("a"); v != nil {
+		t.Errorf("expected a to have expired")
+	}
+}
+
+func TestAuthCacheSkipsPutAfterInvalidation(t *testing.T) {
+	c := newAuthCache(10, time.Minute)
+
+	// a lookup misses, then the user is removed before the lookup caches what it loaded
+	_, gen := c.get("a")
+	c.invalidate("a")
+	c.put("a", true, gen)
+
+	if v, _ := c.get("a"); v != nil {
+		t.Errorf("expected stale result not to be cached")
+	}
+
+	stats := c.stats()
+	if stats.Hits != 0 || stats.Misses != 2 {
+		t.Errorf("expected 0 hits and 2 misses, got %d and %d", stats.Hits, stats.Misses)
+	}
+}
+
+func TestAuthCacheStaysWithinSize(t *testing.T) {
+	c := newAuthCache(2, time.Minute)
+
+	for _, key := range []string{"a", "b", "c"} {
+		_, gen := c.get(key)
+		c.put(key, true, gen)
+	}
+
+	if size := c.stats().Size; size > 2 {
+		t.Errorf("expected at most 2 entries, got %d", size)
+	}
+
+	if v, _ := c.get("c"); v == nil {
+		t.Errorf("expected c to be cached")
+	}
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 
@@ -9,15 +10,21 @@ import (
 	"github.com/plandex/plandex/shared"
 )
 
+var ErrBranchNotFound = errors.New("branch not found")
+var ErrBranchExists = errors.New("a branch with that name already exists")
+var ErrBranchRunning = errors.New("branch has a running plan")
+
 func CreateBranch(plan *Plan, parentBranch *Branch, name string, tx *sql.Tx) (*Branch, error) {
 
-	query := `INSERT INTO branches (org_id, owner_id, plan_id, parent_branch_id, name, status, context_tokens, convo_tokens) 
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	query := `INSERT INTO branches (org_id, owner_id, plan_id, parent_branch_id, name, status, context_tokens, convo_tokens, context_files, context_bytes) 
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 	RETURNING id, created_at, updated_at`
 
 	var (
 		contextTokens  int
 		convoTokens    int
+		contextFiles   int
+		contextBytes   int64
 		parentBranchId *string
 	)
 
@@ -26,6 +33,8 @@ func CreateBranch(plan *Plan, parentBranch *Branch, name string, tx *sql.Tx) (*B
 
 		contextTokens = parentBranch.ContextTokens
 		convoTokens = parentBranch.ConvoTokens
+		contextFiles = parentBranch.ContextFiles
+		contextBytes = parentBranch.ContextBytes
 	}
 
 	branch := &Branch{
@@ -50,6 +59,8 @@ func CreateBranch(plan *Plan, parentBranch *Branch, name string, tx *sql.Tx) (*B
 			branch.Status,
 			contextTokens,
 			convoTokens,
+			contextFiles,
+			contextBytes,
 		).Scan(
 			&branch.Id,
 			&branch.CreatedAt,
@@ -66,6 +77,8 @@ func CreateBranch(plan *Plan, parentBranch *Branch, name string, tx *sql.Tx) (*B
 			branch.Status,
 			contextTokens,
 			convoTokens,
+			contextFiles,
+			contextBytes,
 		).Scan(
 			&branch.Id,
 			&branch.CreatedAt,
@@ -201,5 +214,84 @@ func DeleteBranch(orgId, planId, branch string) error {
 		return fmt.Errorf("error committing transaction: %v", err)
 	}
 
+	InvalidatePlanCache(planId)
+
 	return nil
 }
+
+// RenameBranch renames a branch and its git branch. Streams are keyed by branch name, so their
+// history follows it. Returns ErrBranchNotFound, ErrBranchExists if newName is taken, or
+// ErrBranchRunning if a plan is running on the branch. The caller must hold a write lock on the
+// branch.
+func RenameBranch(orgId, planId, branch, newName string) (*Branch, error) {
+	tx, err := Conn.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+
+	// Ensure that rollback is attempted in case of failure
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Printf("transaction rollback error: %v\n", rbErr)
+			} else {
+				log.Println("transaction rolled back")
+			}
+		}
+	}()
+
+	var existing []*Branch
+	err = tx.Select(&existing, "SELECT * FROM branches WHERE plan_id = $1 AND name = ANY($2) FOR UPDATE", planId, pq.Array([]string{branch, newName}))
+	if err != nil {
+		return nil, fmt.Errorf("error getting branches: %v", err)
+	}
+
+	var renamed *Branch
+	for _, b := range existing {
+		if b.Name == newName {
+			err = ErrBranchExists
+			return nil, err
+		}
+		renamed = b
+	}
+
+	if renamed == nil {
+		err = ErrBranchNotFound
+		return nil, err
+	}
+
+	for _, status := range reconcileRunningStatuses {
+		if string(renamed.Status) == status {
+			err = ErrBranchRunning
+			return nil, err
+		}
+	}
+
+	err = tx.QueryRow("UPDATE branches SET name = $1 WHERE id = $2 RETURNING updated_at", newName, renamed.Id).Scan(&renamed.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error renaming branch: %v", err)
+	}
+	renamed.Name = newName
+
+	_, err = tx.Exec("UPDATE model_streams SET branch = $1 WHERE plan_id = $2 AND branch = $3", newName, planId, branch)
+	if err != nil {
+		return nil, fmt.Errorf("error renaming branch streams: %v", err)
+	}
+
+	err = GitRenameBranch(orgId, planId, branch, newName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		if gitErr := GitRenameBranch(orgId, planId, newName, branch); gitErr != nil {
+			log.Printf("Error restoring git branch name after failed commit: %v\n", gitErr)
+		}
+		return nil, fmt.Errorf("error committing transaction: %v", err)
+	}
+
+	InvalidatePlanCache(planId)
+
+	return renamed, nil
+}
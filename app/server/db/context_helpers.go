@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -293,7 +294,7 @@ func LoadContexts(params LoadContextsParams) (*shared.LoadContextResponse, []*Co
 		}
 	}
 
-	err = AddPlanContextTokens(planId, branchName, tokensAdded)
+	err = AddPlanContextTokens(orgId, planId, branchName, tokensAdded)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error adding plan context tokens: %v", err)
 	}
@@ -483,7 +484,7 @@ func UpdateContexts(params UpdateContextsParams) (*shared.UpdateContextResponse,
 		}
 	}
 
-	err = AddPlanContextTokens(planId, branchName, tokensDiff)
+	err = AddPlanContextTokens(orgId, planId, branchName, tokensDiff)
 	if err != nil {
 		return nil, fmt.Errorf("error adding plan context tokens: %v", err)
 	}
@@ -498,6 +499,19 @@ func UpdateContexts(params UpdateContextsParams) (*shared.UpdateContextResponse,
 }
 
 func invalidateConflictedResults(orgId, planId string, filesToLoad map[string]string) error {
+	paths := make([]string, 0, len(filesToLoad))
+	for path := range filesToLoad {
+		paths = append(paths, path)
+	}
+
+	return invalidateConflictedFiles(orgId, planId, paths, func(path string) (string, error) {
+		return filesToLoad[path], nil
+	})
+}
+
+// invalidateConflictedFiles is invalidateConflictedResults for bodies that aren't in memory.
+// getBody is only called for paths with pending results.
+func invalidateConflictedFiles(orgId, planId string, paths []string, getBody func(path string) (string, error)) error {
 	descriptions, err := GetConvoMessageDescriptions(orgId, planId)
 	if err != nil {
 		return fmt.Errorf("error getting pending build descriptions: %v", err)
@@ -513,6 +527,19 @@ func invalidateConflictedResults(orgId, planId string, filesToLoad map[string]st
 		return fmt.Errorf("error getting current plan state: %v", err)
 	}
 
+	filesToLoad := map[string]string{}
+	for _, path := range paths {
+		if currentPlan.PlanResult.FileResultsByPath[path] == nil {
+			continue
+		}
+
+		body, err := getBody(path)
+		if err != nil {
+			return fmt.Errorf("error getting body for %s: %v", path, err)
+		}
+		filesToLoad[path] = body
+	}
+
 	conflictPaths := currentPlan.PlanResult.FileResultsByPath.ConflictedPaths(filesToLoad)
 
 	// log.Println("invalidateConflictedResults - Conflicted paths:", conflictPaths)
@@ -573,3 +600,20 @@ func invalidateConflictedResults(orgId, planId string, filesToLoad map[string]st
 
 	return nil
 }
+
+// GetPlanContextByPath returns the file context loaded from filePath, or nil if there isn't one
+func GetPlanContextByPath(orgId, planId, filePath string) (*Context, error) {
+	contexts, err := GetPlanContexts(orgId, planId, false)
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting contexts: %v", err)
+	}
+
+	for _, context := range contexts {
+		if context.FilePath != "" && path.Clean(filepath.ToSlash(context.FilePath)) == filePath {
+			return GetContext(orgId, planId, context.Id, true)
+		}
+	}
+
+	return nil, nil
+}
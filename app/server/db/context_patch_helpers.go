@@ -0,0 +1,181 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+
+	"github.com/plandex/plandex/shared"
+)
+
+var ErrInvalidContextPatch = errors.New("invalid context patch")
+
+type PatchContextsParams struct {
+	Req        *shared.PatchContextRequest
+	OrgId      string
+	Plan       *Plan
+	BranchName string
+	UserId     string
+}
+
+// PatchContexts applies add, update, and remove operations on file contexts. Every operation is
+// checked, and the token budget enforced on the combined result, before anything is written.
+// Paths must already be cleaned. Callers hold a write lock on the branch and commit the result.
+func PatchContexts(params PatchContextsParams) (*shared.PatchContextResponse, error) {
+	orgId := params.OrgId
+	plan := params.Plan
+	planId := plan.Id
+	branchName := params.BranchName
+
+	branch, err := GetDbBranch(planId, branchName)
+	if err != nil {
+		return nil, fmt.Errorf("error getting branch: %v", err)
+	}
+
+	if branch == nil {
+		return nil, fmt.Errorf("branch not found")
+	}
+
+	settings, err := GetPlanSettings(plan, true)
+	if err != nil {
+		return nil, fmt.Errorf("error getting settings: %v", err)
+	}
+
+	maxTokens := settings.GetPlannerEffectiveMaxTokens()
+
+	contexts, err := GetPlanContexts(orgId, planId, false)
+	if err != nil {
+		return nil, fmt.Errorf("error getting contexts: %v", err)
+	}
+
+	byPath := map[string]*Context{}
+	for _, context := range contexts {
+		if context.ContextType == shared.ContextFileType {
+			byPath[path.Clean(filepath.ToSlash(context.FilePath))] = context
+		}
+	}
+
+	var toStore []*Context
+	var added []*Context
+	toRemove := map[string]*Context{}
+	filesToLoad := map[string]string{}
+	tokensDiff := 0
+	var numUpdated, numRemoved int
+
+	for _, op := range params.Req.Operations {
+		existing := byPath[op.Path]
+
+		if op.Op == shared.ContextPatchOpAdd && existing != nil {
+			return nil, fmt.Errorf("%w: '%s' is already in context", ErrInvalidContextPatch, op.Path)
+		}
+
+		if op.Op != shared.ContextPatchOpAdd && existing == nil {
+			return nil, fmt.Errorf("%w: '%s' isn't in context", ErrInvalidContextPatch, op.Path)
+		}
+
+		if op.Op == shared.ContextPatchOpRemove {
+			toRemove[existing.Id] = existing
+			tokensDiff -= existing.NumTokens
+			numRemoved++
+			continue
+		}
+
+		numTokens, err := shared.GetNumTokens(op.Content)
+		if err != nil {
+			return nil, fmt.Errorf("error getting num tokens: %v", err)
+		}
+
+		hash := sha256.Sum256([]byte(op.Content))
+
+		context := existing
+		if context == nil {
+			context = &Context{
+				// Id generated by db layer
+				OrgId:       orgId,
+				OwnerId:     params.UserId,
+				PlanId:      planId,
+				ContextType: shared.ContextFileType,
+				Name:        op.Path,
+				FilePath:    op.Path,
+			}
+			added = append(added, context)
+		} else {
+			tokensDiff -= context.NumTokens
+			numUpdated++
+		}
+
+		context.Body = op.Content
+		context.Sha = hex.EncodeToString(hash[:])
+		context.NumTokens = numTokens
+		tokensDiff += numTokens
+
+		toStore = append(toStore, context)
+		filesToLoad[op.Path] = op.Content
+	}
+
+	totalTokens := branch.ContextTokens + tokensDiff
+
+	// a patch that shrinks the context is always allowed, even if it's still over the limit
+	if tokensDiff > 0 && totalTokens > maxTokens {
+		return &shared.PatchContextResponse{
+			TokensDiff:        tokensDiff,
+			TotalTokens:       totalTokens,
+			MaxTokens:         maxTokens,
+			MaxTokensExceeded: true,
+		}, nil
+	}
+
+	err = invalidateConflictedResults(orgId, planId, filesToLoad)
+	if err != nil {
+		return nil, fmt.Errorf("error invalidating conflicted results: %v", err)
+	}
+
+	if len(toRemove) > 0 {
+		var removeList []*Context
+		for _, context := range toRemove {
+			removeList = append(removeList, context)
+		}
+
+		err = ContextRemove(removeList)
+		if err != nil {
+			return nil, fmt.Errorf("error removing contexts: %v", err)
+		}
+	}
+
+	for _, context := range toStore {
+		err = StoreContext(context)
+		if err != nil {
+			return nil, fmt.Errorf("error storing context: %v", err)
+		}
+	}
+
+	err = AddPlanContextTokens(orgId, planId, branchName, tokensDiff)
+	if err != nil {
+		return nil, fmt.Errorf("error adding plan context tokens: %v", err)
+	}
+
+	// contexts are ordered by creation, so new ones go at the end
+	var apiContexts []*shared.Context
+	for _, context := range contexts {
+		if toRemove[context.Id] == nil {
+			apiContexts = append(apiContexts, context.ToApi())
+		}
+	}
+	for _, context := range added {
+		apiContexts = append(apiContexts, context.ToApi())
+	}
+	for _, context := range apiContexts {
+		context.Body = ""
+	}
+
+	return &shared.PatchContextResponse{
+		Contexts:    apiContexts,
+		TokensDiff:  tokensDiff,
+		TotalTokens: totalTokens,
+		MaxTokens:   maxTokens,
+		Msg:         shared.SummaryForPatchContext(len(added), numUpdated, numRemoved, tokensDiff, totalTokens),
+	}, nil
+}
@@ -0,0 +1,38 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// getContextDirStats counts a plan's contexts and the bytes their bodies take up on disk. A
+// missing dir has no contexts.
+func getContextDirStats(dir string) (int, int64, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("error reading context dir: %v", err)
+	}
+
+	var files int
+	var bytes int64
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".body") {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return 0, 0, fmt.Errorf("error getting context file info: %v", err)
+		}
+
+		files++
+		bytes += info.Size()
+	}
+
+	return files, bytes, nil
+}
@@ -0,0 +1,36 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetContextDirStats(t *testing.T) {
+	dir := t.TempDir()
+
+	for name, body := range map[string]string{
+		"a.meta": "{}",
+		"a.body": "hello",
+		"b.meta": "{}",
+		"b.body": "abc",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, bytes, err := getContextDirStats(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if files != 2 || bytes != 8 {
+		t.Errorf("expected 2 files and 8 bytes, got %d and %d", files, bytes)
+	}
+
+	files, bytes, err = getContextDirStats(filepath.Join(dir, "missing"))
+	if err != nil || files != 0 || bytes != 0 {
+		t.Errorf("expected no stats for a missing dir, got %d, %d, %v", files, bytes, err)
+	}
+}
@@ -0,0 +1,355 @@
+package db
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/plandex/plandex/shared"
+)
+
+const defaultMaxContextUploadBytes = 10 * 1024 * 1024
+
+// MaxContextUploadFiles caps the files in a single upload request
+const MaxContextUploadFiles = 100
+
+// MaxContextUploadBytes caps the size of each uploaded file, set with
+// PLANDEX_MAX_CONTEXT_UPLOAD_BYTES
+var MaxContextUploadBytes int64 = defaultMaxContextUploadBytes
+
+var ErrContextUploadTooLarge = errors.New("context file is too large")
+var ErrTooManyContextUploads = fmt.Errorf("an upload can have at most %d files", MaxContextUploadFiles)
+
+// bodies are processed in chunks of about this size, split at line starts
+const contextUploadChunkSize = 64 * 1024
+
+func init() {
+	if s := os.Getenv("PLANDEX_MAX_CONTEXT_UPLOAD_BYTES"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n <= 0 {
+			panic(fmt.Errorf("PLANDEX_MAX_CONTEXT_UPLOAD_BYTES must be an integer > 0, got: %s", s))
+		}
+		MaxContextUploadBytes = n
+	}
+}
+
+type ContextUpload struct {
+	FilePath        string
+	Body            io.Reader
+	ForceSkipIgnore bool
+}
+
+type UploadContextsParams struct {
+	OrgId      string
+	Plan       *Plan
+	BranchName string
+	UserId     string
+	// returns the next file to upload, or io.EOF when there are no more. Each file's body is
+	// read to the end before the next is requested.
+	NextFile func() (*ContextUpload, error)
+}
+
+// UploadContexts stores file contexts as their bodies are read, so memory use doesn't grow with
+// file size. It's otherwise like LoadContexts, but since token counts aren't known until a body
+// has been read, everything is stored first and removed again if the plan's max tokens would be
+// exceeded. Anything stored is also removed if a later file fails. The caller must hold a write
+// lock on the branch.
+func UploadContexts(params UploadContextsParams) (*shared.LoadContextResponse, []*Context, error) {
+	var dbContexts []*Context
+	var err error
+
+	defer func() {
+		if err != nil && len(dbContexts) > 0 {
+			if removeErr := ContextRemove(dbContexts); removeErr != nil {
+				log.Printf("Error removing uploaded contexts after failed upload: %v\n", removeErr)
+			}
+		}
+	}()
+
+	tokensAdded := 0
+
+	for {
+		var upload *ContextUpload
+		upload, err = params.NextFile()
+
+		if err == io.EOF {
+			err = nil
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(dbContexts) >= MaxContextUploadFiles {
+			err = ErrTooManyContextUploads
+			return nil, nil, err
+		}
+
+		context := &Context{
+			OrgId:           params.OrgId,
+			OwnerId:         params.UserId,
+			PlanId:          params.Plan.Id,
+			ContextType:     shared.ContextFileType,
+			Name:            upload.FilePath,
+			FilePath:        upload.FilePath,
+			ForceSkipIgnore: upload.ForceSkipIgnore,
+		}
+
+		err = StoreStreamedContext(context, upload.Body, MaxContextUploadBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		dbContexts = append(dbContexts, context)
+		tokensAdded += context.NumTokens
+	}
+
+	branch, err := GetDbBranch(params.Plan.Id, params.BranchName)
+	if err != nil {
+		err = fmt.Errorf("error getting branch: %v", err)
+		return nil, nil, err
+	}
+	totalTokens := branch.ContextTokens + tokensAdded
+
+	settings, err := GetPlanSettings(params.Plan, true)
+	if err != nil {
+		err = fmt.Errorf("error getting settings: %v", err)
+		return nil, nil, err
+	}
+
+	maxTokens := settings.GetPlannerEffectiveMaxTokens()
+
+	if totalTokens > maxTokens {
+		err = ContextRemove(dbContexts)
+		if err != nil {
+			err = fmt.Errorf("error removing uploaded contexts: %v", err)
+			return nil, nil, err
+		}
+
+		return &shared.LoadContextResponse{
+			TokensAdded:       tokensAdded,
+			TotalTokens:       totalTokens,
+			MaxTokens:         maxTokens,
+			MaxTokensExceeded: true,
+		}, nil, nil
+	}
+
+	// only files with pending results are checked for conflicts, so only their bodies are read
+	// back. They're compared as stored, escaped fences and all, like other stored bodies.
+	contextIdsByPath := map[string]string{}
+	var paths []string
+	for _, context := range dbContexts {
+		contextIdsByPath[context.FilePath] = context.Id
+		paths = append(paths, context.FilePath)
+	}
+
+	err = invalidateConflictedFiles(params.OrgId, params.Plan.Id, paths, func(filePath string) (string, error) {
+		stored, err := GetContext(params.OrgId, params.Plan.Id, contextIdsByPath[filePath], true)
+		if err != nil {
+			return "", err
+		}
+		return stored.Body, nil
+	})
+	if err != nil {
+		err = fmt.Errorf("error invalidating conflicted results: %v", err)
+		return nil, nil, err
+	}
+
+	err = AddPlanContextTokens(params.OrgId, params.Plan.Id, params.BranchName, tokensAdded)
+	if err != nil {
+		err = fmt.Errorf("error adding plan context tokens: %v", err)
+		return nil, nil, err
+	}
+
+	var apiContexts []*shared.Context
+	for _, context := range dbContexts {
+		apiContexts = append(apiContexts, context.ToApi())
+	}
+
+	commitMsg := shared.SummaryForLoadContext(apiContexts, tokensAdded, totalTokens)
+
+	if len(apiContexts) > 1 {
+		commitMsg += "\n\n" + shared.TableForLoadContext(apiContexts)
+	}
+
+	return &shared.LoadContextResponse{
+		TokensAdded: tokensAdded,
+		TotalTokens: totalTokens,
+		Msg:         commitMsg,
+	}, dbContexts, nil
+}
+
+// StoreStreamedContext is StoreContext for a body read from src. The body is written as it's
+// read, with the same escaping, and its sha and token count are worked out along the way.
+// Returns ErrContextUploadTooLarge, leaving nothing behind, if src has more than maxBytes.
+func StoreStreamedContext(context *Context, src io.Reader, maxBytes int64) error {
+	contextDir := getPlanContextDir(context.OrgId, context.PlanId)
+
+	err := os.MkdirAll(contextDir, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("error creating context dir: %v", err)
+	}
+
+	ts := time.Now().UTC()
+	context.Id = uuid.New().String()
+	context.CreatedAt = ts
+	context.UpdatedAt = ts
+
+	bodyPath := filepath.Join(contextDir, context.Id+".body")
+	metaPath := filepath.Join(contextDir, context.Id+".meta")
+
+	// the meta is written last, and the branch is write-locked, so a partial body is never read
+	f, err := os.Create(bodyPath)
+	if err != nil {
+		return fmt.Errorf("error creating context body file: %v", err)
+	}
+
+	cleanup := func() {
+		f.Close()
+		if err := os.Remove(bodyPath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error removing partial context body %s: %v\n", bodyPath, err)
+		}
+	}
+
+	bw := newContextBodyWriter(f)
+
+	// read one byte past the cap to tell a file of exactly maxBytes from a larger one
+	n, err := io.Copy(bw, io.LimitReader(src, maxBytes+1))
+	if err == nil && n > maxBytes {
+		err = ErrContextUploadTooLarge
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		cleanup()
+		if err == ErrContextUploadTooLarge {
+			return err
+		}
+		return fmt.Errorf("error writing context body: %v", err)
+	}
+
+	err = f.Close()
+	if err != nil {
+		cleanup()
+		return fmt.Errorf("error closing context body file: %v", err)
+	}
+
+	context.Sha = hex.EncodeToString(bw.hash.Sum(nil))
+	context.NumTokens = bw.numTokens
+	context.Body = ""
+
+	data, err := json.MarshalIndent(context, "", "  ")
+	if err != nil {
+		cleanup()
+		return fmt.Errorf("failed to marshal context: %v", err)
+	}
+
+	if err = os.WriteFile(metaPath, data, 0644); err != nil {
+		cleanup()
+		return fmt.Errorf("failed to write context meta to file %s: %v", metaPath, err)
+	}
+
+	return nil
+}
+
+// contextBodyWriter hashes, counts tokens for, and escapes a context body as it's written.
+// Escaping and token counting both need whole lines: the fence patterns can't span a newline,
+// and the tokenizer never joins a newline with a following non-space character. So writes are
+// buffered and processed up to the last newline followed by one. A body without such a split
+// point, like a single giant line, is buffered until Flush, which is bounded by the upload cap.
+type contextBodyWriter struct {
+	w         io.Writer
+	hash      hash.Hash
+	buf       []byte
+	numTokens int
+	// buf before this index has no split point
+	scanned int
+}
+
+func newContextBodyWriter(w io.Writer) *contextBodyWriter {
+	return &contextBodyWriter{w: w, hash: sha256.New()}
+}
+
+func (bw *contextBodyWriter) Write(p []byte) (int, error) {
+	bw.buf = append(bw.buf, p...)
+
+	if len(bw.buf) < contextUploadChunkSize {
+		return len(p), nil
+	}
+
+	split := contextBodySplitPoint(bw.buf, bw.scanned)
+	if split == 0 {
+		// the last byte could still be a split point once more is written
+		bw.scanned = len(bw.buf) - 1
+		return len(p), nil
+	}
+
+	err := bw.process(bw.buf[:split])
+	if err != nil {
+		return 0, err
+	}
+	bw.buf = append(bw.buf[:0], bw.buf[split:]...)
+	bw.scanned = 0
+
+	return len(p), nil
+}
+
+// Flush processes whatever is still buffered. Call it once, after the last Write.
+func (bw *contextBodyWriter) Flush() error {
+	err := bw.process(bw.buf)
+	bw.buf = nil
+	return err
+}
+
+func (bw *contextBodyWriter) process(chunk []byte) error {
+	if len(chunk) == 0 {
+		return nil
+	}
+
+	bw.hash.Write(chunk)
+
+	numTokens, err := shared.GetNumTokens(string(chunk))
+	if err != nil {
+		return fmt.Errorf("error getting num tokens: %v", err)
+	}
+	bw.numTokens += numTokens
+
+	_, err = io.WriteString(bw.w, escapeContextBody(string(chunk)))
+	return err
+}
+
+// contextBodySplitPoint returns the index just past the last newline at or after from in buf
+// that's followed by a non-space character, or 0 if there isn't one
+func contextBodySplitPoint(buf []byte, from int) int {
+	for i := len(buf) - 2; i >= from; i-- {
+		i = bytes.LastIndexByte(buf[:i+1], '\n')
+		if i < from {
+			return 0
+		}
+		switch buf[i+1] {
+		case ' ', '\t', '\n', '\r', '\v', '\f':
+			continue
+		}
+		return i + 1
+	}
+	return 0
+}
+
+// escapeContextBody escapes fences the same way StoreContext does
+func escapeContextBody(body string) string {
+	body = strings.ReplaceAll(body, "\\`\\`\\`", "\\\\`\\\\`\\\\`")
+	return strings.ReplaceAll(body, "```", "\\`\\`\\`")
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestContextBodySplitPoint(t *testing.T) {
+	tests := []struct {
+		buf  string
+		from int
+		want int
+	}{
+		{"abc", 0, 0},
+		{"abc\n", 0, 0},
+		{"abc\ndef", 0, 4},
+		{"abc\ndef\nghi", 0, 8},
+		// newlines followed by whitespace can be joined with it by the tokenizer
+		{"abc\n  def", 0, 0},
+		{"abc\n\ndef", 0, 5},
+		{"a\nb\n\tc", 0, 2},
+		{"a\nb\nc", 3, 4},
+		{"a\nb\nc", 4, 0},
+	}
+
+	for _, tt := range tests {
+		if got := contextBodySplitPoint([]byte(tt.buf), tt.from); got != tt.want {
+			t.Errorf("contextBodySplitPoint(%q, %d) = %d, want %d", tt.buf, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestEscapeContextBodyByChunk(t *testing.T) {
+	body := "intro\n```go\ncode\n```\nescaped \\`\\`\\` already\n```\nend"
+
+	whole := escapeContextBody(body)
+
+	// escaping chunks split at line starts gives the same result as escaping the whole body
+	var chunked strings.Builder
+	rest := body
+	for {
+		split := contextBodySplitPoint([]byte(rest), 0)
+		if split == 0 {
+			chunked.WriteString(escapeContextBody(rest))
+			break
+		}
+		chunked.WriteString(escapeContextBody(rest[:split]))
+		rest = rest[split:]
+	}
+
+	if chunked.String() != whole {
+		t.Errorf("chunked escaping differs:\n%s\nwant:\n%s", chunked.String(), whole)
+	}
+
+	if strings.Contains(whole, "```") {
+		t.Errorf("expected fences to be escaped, got %s", whole)
+	}
+}
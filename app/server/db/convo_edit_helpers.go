@@ -0,0 +1,168 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/plandex/plandex/shared"
+	"github.com/sashabaranov/go-openai"
+)
+
+var ErrConvoMessageNotFound = errors.New("convo message not found")
+
+// UpdateConvoMessage replaces a message's content, keeping its place in the convo, and commits
+// the change. Summaries that covered the message are dropped so they're regenerated from the
+// edited convo.
+func UpdateConvoMessage(orgId, planId, branch, messageId, content string) (*ConvoMessage, error) {
+	if _, err := uuid.Parse(messageId); err != nil {
+		return nil, ErrConvoMessageNotFound
+	}
+
+	_, err := os.Stat(filepath.Join(getPlanConversationDir(orgId, planId), messageId+".json"))
+	if os.IsNotExist(err) {
+		return nil, ErrConvoMessageNotFound
+	}
+
+	msg, err := GetConvoMessage(orgId, planId, messageId)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := shared.GetNumTokens(content)
+	if err != nil {
+		return nil, fmt.Errorf("error getting num tokens: %v", err)
+	}
+
+	msg.Message = content
+	msg.Tokens = tokens
+
+	err = writeConvoMessageFile(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	err = afterConvoEdit(orgId, planId, branch, msg.CreatedAt, fmt.Sprintf("✏️ Edited message #%d", msg.Num))
+	if err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// DeleteConvoMessage deletes a message and, with cascade, the assistant replies that follow it up
+// to the next user message. The rest of the convo is renumbered and the change is committed.
+// Returns the ids of the deleted messages.
+func DeleteConvoMessage(orgId, planId, branch, messageId string, cascade bool) ([]string, error) {
+	if _, err := uuid.Parse(messageId); err != nil {
+		return nil, ErrConvoMessageNotFound
+	}
+
+	convo, err := GetPlanConvo(orgId, planId)
+	if err != nil {
+		return nil, err
+	}
+
+	toDelete := convoMessagesToDelete(convo, messageId, cascade)
+	if len(toDelete) == 0 {
+		return nil, ErrConvoMessageNotFound
+	}
+
+	convoDir := getPlanConversationDir(orgId, planId)
+	deleted := map[string]bool{}
+	var deletedIds []string
+
+	for _, msg := range toDelete {
+		err = os.Remove(filepath.Join(convoDir, msg.Id+".json"))
+		if err != nil {
+			return nil, fmt.Errorf("error removing convo message: %v", err)
+		}
+		deleted[msg.Id] = true
+		deletedIds = append(deletedIds, msg.Id)
+	}
+
+	var remaining []*ConvoMessage
+	for _, msg := range convo {
+		if !deleted[msg.Id] {
+			remaining = append(remaining, msg)
+		}
+	}
+
+	for i, msg := range remaining {
+		if msg.Num == i+1 {
+			continue
+		}
+		msg.Num = i + 1
+		err = writeConvoMessageFile(msg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = Conn.Exec("UPDATE plans SET total_replies = $1 WHERE id = $2", countReplies(remaining), planId)
+	if err != nil {
+		return nil, fmt.Errorf("error updating plan total replies: %v", err)
+	}
+	InvalidatePlanCache(planId)
+
+	desc := "🗑️ Deleted message"
+	if len(toDelete) > 1 {
+		desc = fmt.Sprintf("🗑️ Deleted %d messages", len(toDelete))
+	}
+
+	err = afterConvoEdit(orgId, planId, branch, toDelete[0].CreatedAt, fmt.Sprintf("%s from #%d", desc, toDelete[0].Num))
+	if err != nil {
+		return nil, err
+	}
+
+	return deletedIds, nil
+}
+
+// convoMessagesToDelete returns the message with messageId and, with cascade, the assistant
+// messages right after it, in order. convo must be in chronological order. Nil if the message
+// isn't in the convo.
+func convoMessagesToDelete(convo []*ConvoMessage, messageId string, cascade bool) []*ConvoMessage {
+	for i, msg := range convo {
+		if msg.Id != messageId {
+			continue
+		}
+
+		res := []*ConvoMessage{msg}
+		if cascade {
+			for _, next := range convo[i+1:] {
+				if next.Role != openai.ChatMessageRoleAssistant {
+					break
+				}
+				res = append(res, next)
+			}
+		}
+		return res
+	}
+
+	return nil
+}
+
+// afterConvoEdit drops the summaries that covered the convo from since on, resyncs the branch's
+// token counts, and commits. Summaries are shared by every branch of the plan, so another branch
+// may have to regenerate one too.
+func afterConvoEdit(orgId, planId, branch string, since time.Time, commitMsg string) error {
+	_, err := Conn.Exec("DELETE FROM convo_summaries WHERE plan_id = $1 AND latest_convo_message_created_at >= $2", planId, since)
+	if err != nil {
+		return fmt.Errorf("error deleting convo summaries: %v", err)
+	}
+
+	err = SyncPlanTokens(orgId, planId, branch)
+	if err != nil {
+		return fmt.Errorf("error syncing plan tokens: %v", err)
+	}
+
+	err = GitAddAndCommit(orgId, planId, branch, commitMsg)
+	if err != nil {
+		return fmt.Errorf("error committing convo edit: %v", err)
+	}
+
+	return nil
+}
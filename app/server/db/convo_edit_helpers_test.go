@@ -0,0 +1,52 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestConvoMessagesToDelete(t *testing.T) {
+	convo := []*ConvoMessage{
+		{Id: "1", Role: openai.ChatMessageRoleUser},
+		{Id: "2", Role: openai.ChatMessageRoleAssistant},
+		{Id: "3", Role: openai.ChatMessageRoleAssistant},
+		{Id: "4", Role: openai.ChatMessageRoleUser},
+		{Id: "5", Role: openai.ChatMessageRoleAssistant},
+	}
+
+	ids := func(msgs []*ConvoMessage) []string {
+		res := []string{}
+		for _, msg := range msgs {
+			res = append(res, msg.Id)
+		}
+		return res
+	}
+
+	tests := []struct {
+		id      string
+		cascade bool
+		want    []string
+	}{
+		{"1", false, []string{"1"}},
+		{"1", true, []string{"1", "2", "3"}},
+		{"2", true, []string{"2", "3"}},
+		{"4", true, []string{"4", "5"}},
+		{"5", true, []string{"5"}},
+		{"6", true, []string{}},
+	}
+
+	for _, tt := range tests {
+		got := ids(convoMessagesToDelete(convo, tt.id, tt.cascade))
+		if len(got) != len(tt.want) {
+			t.Errorf("%s cascade=%v: expected %v, got %v", tt.id, tt.cascade, tt.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s cascade=%v: expected %v, got %v", tt.id, tt.cascade, tt.want, got)
+				break
+			}
+		}
+	}
+}
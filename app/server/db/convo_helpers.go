@@ -67,6 +67,68 @@ func GetPlanConvo(orgId, planId string) ([]*ConvoMessage, error) {
 	return convo, nil
 }
 
+// ConvoMessageRef is just enough of a convo message to order and page through a convo without
+// holding every message in memory
+type ConvoMessageRef struct {
+	Id        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ListPlanConvoRefs returns the plan's convo messages in chronological order, without their content
+func ListPlanConvoRefs(orgId, planId string) ([]*ConvoMessageRef, error) {
+	var refs []*ConvoMessageRef
+	convoDir := getPlanConversationDir(orgId, planId)
+
+	files, err := os.ReadDir(convoDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return refs, nil
+		}
+
+		return nil, fmt.Errorf("error reading convo dir: %v", err)
+	}
+
+	for _, file := range files {
+		bytes, err := os.ReadFile(filepath.Join(convoDir, file.Name()))
+
+		if err != nil {
+			return nil, fmt.Errorf("error reading convo file: %v", err)
+		}
+
+		var ref ConvoMessageRef
+		err = json.Unmarshal(bytes, &ref)
+
+		if err != nil {
+			return nil, fmt.Errorf("error unmarshalling convo file: %v", err)
+		}
+
+		refs = append(refs, &ref)
+	}
+
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].CreatedAt.Before(refs[j].CreatedAt)
+	})
+
+	return refs, nil
+}
+
+func GetConvoMessage(orgId, planId, messageId string) (*ConvoMessage, error) {
+	bytes, err := os.ReadFile(filepath.Join(getPlanConversationDir(orgId, planId), messageId+".json"))
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading convo file: %v", err)
+	}
+
+	var convoMessage ConvoMessage
+	err = json.Unmarshal(bytes, &convoMessage)
+
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling convo file: %v", err)
+	}
+
+	return &convoMessage, nil
+}
+
 func StoreConvoMessage(message *ConvoMessage, currentUserId, branch string, commit bool) (string, error) {
 	convoDir := getPlanConversationDir(message.OrgId, message.PlanId)
 
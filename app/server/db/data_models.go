@@ -3,6 +3,7 @@ package db
 import (
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/plandex/plandex/shared"
 )
 
@@ -21,12 +22,26 @@ type AuthToken struct {
 }
 
 type Org struct {
-	Id                 string  `db:"id"`
-	Name               string  `db:"name"`
-	Domain             *string `db:"domain"`
-	AutoAddDomainUsers bool    `db:"auto_add_domain_users"`
-	OwnerId            string  `db:"owner_id"`
-	IsTrial            bool    `db:"is_trial"`
+	Id                       string  `db:"id"`
+	Name                     string  `db:"name"`
+	Domain                   *string `db:"domain"`
+	AutoAddDomainUsers       bool    `db:"auto_add_domain_users"`
+	OwnerId                  string  `db:"owner_id"`
+	IsTrial                  bool    `db:"is_trial"`
+	DefaultProjectId         *string `db:"default_project_id"`
+	MaxPlanNameSuffix        *int    `db:"max_plan_name_suffix"`
+	MaxPlansPerName          *int    `db:"max_plans_per_name"`
+	AutoArchiveAfterDays     *int    `db:"auto_archive_after_days"`
+	AutoDeleteAfterDays      *int    `db:"auto_delete_after_days"`
+	RequiredNamePrefix       *string `db:"required_name_prefix"`
+	AutoPrefix               bool    `db:"auto_prefix"`
+	CaseInsensitivePlanNames bool    `db:"case_insensitive_plan_names"`
+	ProjectScopedPlanNames   bool    `db:"project_scoped_plan_names"`
+	// json-encoded shared.PlanSettings, nil if the org has no defaults
+	DefaultPlanSettings []byte  `db:"default_plan_settings"`
+	AuditWebhookUrl     *string `db:"audit_webhook_url"`
+	// read with GetOrCreateOrgAuditWebhookSecret, which sets it if it's missing
+	AuditWebhookSecret *string `db:"audit_webhook_secret"`
 
 	CreatedAt time.Time `db:"created_at"`
 	UpdatedAt time.Time `db:"updated_at"`
@@ -39,6 +54,33 @@ func (org *Org) ToApi() *shared.Org {
 	}
 }
 
+func (org *Org) SettingsToApi() (*shared.OrgSettings, error) {
+	defaultPlanSettings, err := org.GetDefaultPlanSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	settings := &shared.OrgSettings{
+		DefaultProjectId:         org.DefaultProjectId,
+		MaxPlanNameSuffix:        MaxPlanNameSuffix,
+		MaxPlansPerName:          org.MaxPlansPerName,
+		AutoArchiveAfterDays:     org.AutoArchiveAfterDays,
+		AutoDeleteAfterDays:      org.AutoDeleteAfterDays,
+		RequiredNamePrefix:       org.RequiredNamePrefix,
+		AutoPrefix:               org.AutoPrefix,
+		CaseInsensitivePlanNames: org.CaseInsensitivePlanNames,
+		ProjectScopedPlanNames:   org.ProjectScopedPlanNames,
+		DefaultPlanSettings:      defaultPlanSettings,
+		AuditWebhookUrl:          org.AuditWebhookUrl,
+	}
+
+	if org.MaxPlanNameSuffix != nil {
+		settings.MaxPlanNameSuffix = *org.MaxPlanNameSuffix
+	}
+
+	return settings, nil
+}
+
 type User struct {
 	Id               string    `db:"id"`
 	Name             string    `db:"name"`
@@ -105,46 +147,160 @@ func (orgUser *OrgUser) ToApi() *shared.OrgUser {
 }
 
 type Project struct {
-	Id        string    `db:"id"`
-	OrgId     string    `db:"org_id"`
-	Name      string    `db:"name"`
-	CreatedAt time.Time `db:"created_at"`
-	UpdatedAt time.Time `db:"updated_at"`
+	Id                    string                `db:"id"`
+	OrgId                 string                `db:"org_id"`
+	Name                  string                `db:"name"`
+	DefaultPlanVisibility shared.PlanVisibility `db:"default_plan_visibility"`
+	CreatedAt             time.Time             `db:"created_at"`
+	UpdatedAt             time.Time             `db:"updated_at"`
 }
 
 func (project *Project) ToApi() *shared.Project {
 	return &shared.Project{
-		Id:   project.Id,
-		Name: project.Name,
+		Id:                    project.Id,
+		Name:                  project.Name,
+		DefaultPlanVisibility: project.DefaultPlanVisibility,
 	}
 }
 
 type Plan struct {
-	Id              string     `db:"id"`
-	OrgId           string     `db:"org_id"`
-	OwnerId         string     `db:"owner_id"`
-	ProjectId       string     `db:"project_id"`
-	Name            string     `db:"name"`
-	SharedWithOrgAt *time.Time `db:"shared_with_org_at,omitempty"`
-	TotalReplies    int        `db:"total_replies"`
-	ActiveBranches  int        `db:"active_branches"`
-	ArchivedAt      *time.Time `db:"archived_at,omitempty"`
-	CreatedAt       time.Time  `db:"created_at"`
-	UpdatedAt       time.Time  `db:"updated_at"`
+	Id                  string         `db:"id"`
+	OrgId               string         `db:"org_id"`
+	OwnerId             string         `db:"owner_id"`
+	ProjectId           string         `db:"project_id"`
+	Name                string         `db:"name"`
+	Description         string         `db:"description"`
+	Tags                pq.StringArray `db:"tags"`
+	Pinned              bool           `db:"pinned"`
+	CaseInsensitiveName bool           `db:"case_insensitive_name"`
+	ProjectScopedName   bool           `db:"project_scoped_name"`
+	SharedWithOrgAt     *time.Time     `db:"shared_with_org_at,omitempty"`
+	TotalReplies        int            `db:"total_replies"`
+	ActiveBranches      int            `db:"active_branches"`
+	ArchivedAt          *time.Time     `db:"archived_at,omitempty"`
+	CreatedAt           time.Time      `db:"created_at"`
+	UpdatedAt           time.Time      `db:"updated_at"`
+
+	// maintained by a trigger for full-text search; never set directly
+	SearchVector *string `db:"search_vector"`
+
+	NotifyOnComplete bool                     `db:"notify_on_complete"`
+	NotifyOnError    bool                     `db:"notify_on_error"`
+	NotifyChannel    shared.PlanNotifyChannel `db:"notify_channel"`
+	NotifyWebhookUrl *string                  `db:"notify_webhook_url"`
+	// read with GetOrCreatePlanWebhookSecret, which sets it if it's missing
+	NotifyWebhookSecret *string `db:"notify_webhook_secret"`
+
+	// the git branch in the user's repo that the plan's changes are applied to
+	WorkingBranch *string `db:"working_branch"`
+
+	// a caller-chosen key, unique in the project, for matching the plan up with the caller's records
+	ExternalKey *string `db:"external_key"`
 }
 
 func (plan *Plan) ToApi() *shared.Plan {
-	return &shared.Plan{
+	apiPlan := &shared.Plan{
 		Id:              plan.Id,
 		OwnerId:         plan.OwnerId,
 		ProjectId:       plan.ProjectId,
 		Name:            plan.Name,
-		SharedWithOrgAt: plan.SharedWithOrgAt,
+		Description:     plan.Description,
+		Tags:            plan.Tags,
+		Pinned:          plan.Pinned,
+		SharedWithOrgAt: shared.NewTimestampPtr(plan.SharedWithOrgAt),
 		TotalReplies:    plan.TotalReplies,
 		ActiveBranches:  plan.ActiveBranches,
-		ArchivedAt:      plan.ArchivedAt,
-		CreatedAt:       plan.CreatedAt,
-		UpdatedAt:       plan.UpdatedAt,
+		ArchivedAt:      shared.NewTimestampPtr(plan.ArchivedAt),
+		CreatedAt:       shared.NewTimestamp(plan.CreatedAt),
+		UpdatedAt:       shared.NewTimestamp(plan.UpdatedAt),
+		Notifications:   plan.notificationsToApi(),
+	}
+
+	if plan.ExternalKey != nil {
+		apiPlan.ExternalKey = *plan.ExternalKey
+	}
+
+	if plan.WorkingBranch != nil {
+		apiPlan.WorkingBranch = *plan.WorkingBranch
+	}
+
+	return apiPlan
+}
+
+func (plan *Plan) notificationsToApi() *shared.PlanNotifications {
+	if !plan.NotifyOnComplete && !plan.NotifyOnError {
+		return nil
+	}
+
+	res := &shared.PlanNotifications{
+		OnComplete: plan.NotifyOnComplete,
+		OnError:    plan.NotifyOnError,
+		Channel:    plan.NotifyChannel,
+	}
+	if plan.NotifyWebhookUrl != nil {
+		res.WebhookUrl = *plan.NotifyWebhookUrl
+	}
+
+	return res
+}
+
+type PlanShareLink struct {
+	Id        string     `db:"id"`
+	OrgId     string     `db:"org_id"`
+	PlanId    string     `db:"plan_id"`
+	CreatorId string     `db:"creator_id"`
+	TokenHash string     `db:"token_hash"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	RevokedAt *time.Time `db:"revoked_at"`
+	CreatedAt time.Time  `db:"created_at"`
+}
+
+func (link *PlanShareLink) ToApi() *shared.PlanShareLink {
+	return &shared.PlanShareLink{
+		Id:        link.Id,
+		PlanId:    link.PlanId,
+		CreatorId: link.CreatorId,
+		ExpiresAt: shared.NewTimestamp(link.ExpiresAt),
+		CreatedAt: shared.NewTimestamp(link.CreatedAt),
+	}
+}
+
+type PlanApiKey struct {
+	Id        string         `db:"id"`
+	OrgId     string         `db:"org_id"`
+	PlanId    string         `db:"plan_id"`
+	CreatorId string         `db:"creator_id"`
+	Name      string         `db:"name"`
+	Scopes    pq.StringArray `db:"scopes"`
+	TokenHash string         `db:"token_hash"`
+	ExpiresAt time.Time      `db:"expires_at"`
+	RevokedAt *time.Time     `db:"revoked_at"`
+	CreatedAt time.Time      `db:"created_at"`
+}
+
+func (key *PlanApiKey) HasScope(scope shared.PlanApiKeyScope) bool {
+	for _, s := range key.Scopes {
+		if s == string(scope) {
+			return true
+		}
+	}
+	return false
+}
+
+func (key *PlanApiKey) ToApi() *shared.PlanApiKey {
+	scopes := []shared.PlanApiKeyScope{}
+	for _, s := range key.Scopes {
+		scopes = append(scopes, shared.PlanApiKeyScope(s))
+	}
+
+	return &shared.PlanApiKey{
+		Id:        key.Id,
+		PlanId:    key.PlanId,
+		CreatorId: key.CreatorId,
+		Name:      key.Name,
+		Scopes:    scopes,
+		ExpiresAt: shared.NewTimestamp(key.ExpiresAt),
+		CreatedAt: shared.NewTimestamp(key.CreatedAt),
 	}
 }
 
@@ -158,6 +314,8 @@ type Branch struct {
 	Status          shared.PlanStatus `db:"status"`
 	Error           *string           `db:"error"`
 	ContextTokens   int               `db:"context_tokens"`
+	ContextFiles    int               `db:"context_files"`
+	ContextBytes    int64             `db:"context_bytes"`
 	ConvoTokens     int               `db:"convo_tokens"`
 	SharedWithOrgAt *time.Time        `db:"shared_with_org_at,omitempty"`
 	ArchivedAt      *time.Time        `db:"archived_at,omitempty"`
@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/url"
 	"os"
+	"strconv"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
@@ -36,19 +37,34 @@ func Connect() error {
 		}
 	}
 
-	Conn, err = sqlx.Connect("postgres", dbUrl)
+	pool, err := getPoolConfig()
 	if err != nil {
 		return err
 	}
 
-	log.Println("connected to database")
+	// runtime params apply to every pooled connection, unlike a SET on whichever connection runs it
+	params := map[string]string{"timezone": "UTC"}
+	if pool.statementTimeout > 0 {
+		params["statement_timeout"] = strconv.FormatInt(pool.statementTimeout.Milliseconds(), 10)
+	}
 
-	_, err = Conn.Exec("SET TIMEZONE='UTC';")
+	dbUrl, err = withRuntimeParams(dbUrl, params)
+	if err != nil {
+		return err
+	}
 
+	Conn, err = sqlx.Connect("postgres", dbUrl)
 	if err != nil {
-		return fmt.Errorf("error setting timezone: %v", err)
+		return err
 	}
 
+	Conn.SetMaxOpenConns(pool.maxOpenConns)
+	Conn.SetMaxIdleConns(pool.maxIdleConns)
+	Conn.SetConnMaxLifetime(pool.connMaxLifetime)
+	Conn.SetConnMaxIdleTime(pool.connMaxIdleTime)
+
+	log.Printf("connected to database, max open conns: %d, max idle conns: %d\n", pool.maxOpenConns, pool.maxIdleConns)
+
 	return nil
 }
 
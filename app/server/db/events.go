@@ -0,0 +1,121 @@
+package db
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/plandex/plandex/shared"
+)
+
+// in-process bus for plan lifecycle events
+// events are only delivered to subscribers on the host that published them
+
+const planEventBufferSize = 100
+
+type planEventSubscription struct {
+	projectId string
+	ch        chan *shared.PlanEvent
+}
+
+var planEventSubscriptions = map[string]*planEventSubscription{}
+var planEventMu sync.Mutex
+
+// SubscribePlanEvents returns a subscription id and a channel that receives events for plans
+// in the given project. An empty projectId subscribes to events for all projects.
+func SubscribePlanEvents(projectId string) (string, <-chan *shared.PlanEvent) {
+	planEventMu.Lock()
+	defer planEventMu.Unlock()
+
+	id := uuid.New().String()
+	sub := &planEventSubscription{
+		projectId: projectId,
+		ch:        make(chan *shared.PlanEvent, planEventBufferSize),
+	}
+	planEventSubscriptions[id] = sub
+
+	return id, sub.ch
+}
+
+func UnsubscribePlanEvents(id string) {
+	planEventMu.Lock()
+	defer planEventMu.Unlock()
+
+	sub, ok := planEventSubscriptions[id]
+	if !ok {
+		return
+	}
+
+	close(sub.ch)
+	delete(planEventSubscriptions, id)
+}
+
+func hasPlanEventSubscribers() bool {
+	planEventMu.Lock()
+	defer planEventMu.Unlock()
+	return len(planEventSubscriptions) > 0
+}
+
+// PublishPlanEvent never blocks -- if a subscriber's buffer is full, the event is dropped for that subscriber
+func PublishPlanEvent(event *shared.PlanEvent) {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+
+	planEventMu.Lock()
+	defer planEventMu.Unlock()
+
+	for id, sub := range planEventSubscriptions {
+		if sub.projectId != "" && sub.projectId != event.ProjectId {
+			continue
+		}
+
+		select {
+		case sub.ch <- event:
+		default:
+			log.Printf("Plan event subscriber %s buffer full, dropping %s event for plan %s\n", id, event.Type, event.PlanId)
+		}
+	}
+}
+
+func publishPlanEventForPlan(eventType shared.PlanEventType, plan *Plan) {
+	PublishPlanEvent(&shared.PlanEvent{
+		Type:      eventType,
+		OrgId:     plan.OrgId,
+		ProjectId: plan.ProjectId,
+		PlanId:    plan.Id,
+		OwnerId:   plan.OwnerId,
+		Name:      plan.Name,
+	})
+}
+
+func planCreatedEvent(plan *Plan, creation PlanCreation) *shared.PlanEvent {
+	return &shared.PlanEvent{
+		Type:        shared.PlanEventCreated,
+		OrgId:       plan.OrgId,
+		ProjectId:   plan.ProjectId,
+		PlanId:      plan.Id,
+		OwnerId:     plan.OwnerId,
+		Name:        plan.Name,
+		CreatedAt:   plan.CreatedAt,
+		ActorId:     creation.ActorId,
+		ExternalKey: creation.ExternalKey,
+	}
+}
+
+func PublishPlanDeleted(plan *Plan) {
+	publishPlanEventForPlan(shared.PlanEventDeleted, plan)
+}
+
+func PublishPlanRenamed(plan *Plan) {
+	publishPlanEventForPlan(shared.PlanEventRenamed, plan)
+}
+
+func PublishPlanArchived(plan *Plan) {
+	publishPlanEventForPlan(shared.PlanEventArchived, plan)
+}
+
+func PublishPlanUnarchived(plan *Plan) {
+	publishPlanEventForPlan(shared.PlanEventUnarchived, plan)
+}
@@ -1,9 +1,12 @@
 package db
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 var BaseDir string
@@ -64,8 +67,128 @@ func DeletePlanDir(orgId, planId string) error {
 	return nil
 }
 
+// DeletePlanDirs removes the dirs for all the given plans concurrently. It attempts every
+// deletion even if some fail so that one bad dir doesn't leave the rest orphaned on disk.
+func DeletePlanDirs(orgId string, planIds []string) error {
+	errCh := make(chan error, len(planIds))
+	for _, planId := range planIds {
+		go func(planId string) {
+			errCh <- DeletePlanDir(orgId, planId)
+		}(planId)
+	}
+
+	var errs []error
+	for i := 0; i < len(planIds); i++ {
+		err := <-errCh
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("error deleting %d of %d plan dirs: %v", len(errs), len(planIds), errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// TrashPlanDir moves the plan dir into the org's trash dir so it can be restored if deleting the
+// plan row fails. Returns "" if the plan has no dir.
+func TrashPlanDir(orgId, planId string) (string, error) {
+	dir := getPlanDir(orgId, planId)
+
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return "", nil
+	}
+
+	trashDir := getOrgTrashDir(orgId)
+	err := os.MkdirAll(trashDir, os.ModePerm)
+	if err != nil {
+		return "", fmt.Errorf("error creating trash dir: %v", err)
+	}
+
+	trashPath := filepath.Join(trashDir, fmt.Sprintf("%s-%d", planId, time.Now().UnixNano()))
+	err = os.Rename(dir, trashPath)
+	if err != nil {
+		return "", fmt.Errorf("error moving plan dir to trash: %v", err)
+	}
+
+	return trashPath, nil
+}
+
+func RestoreTrashedPlanDir(orgId, planId, trashPath string) error {
+	if trashPath == "" {
+		return nil
+	}
+
+	dir := getPlanDir(orgId, planId)
+
+	// the shard dir may have been removed since the plan was trashed
+	err := os.MkdirAll(filepath.Dir(dir), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("error creating plan dir parent: %v", err)
+	}
+
+	err = os.Rename(trashPath, dir)
+	if err != nil {
+		return fmt.Errorf("error restoring plan dir from trash: %v", err)
+	}
+
+	return nil
+}
+
+func PurgeTrashedPlanDir(trashPath string) error {
+	if trashPath == "" {
+		return nil
+	}
+
+	err := os.RemoveAll(trashPath)
+	if err != nil {
+		return fmt.Errorf("error removing trashed plan dir: %v", err)
+	}
+
+	return nil
+}
+
+// PlanDirSize returns the total size in bytes of the files in a plan's dir, including its git
+// repo. A missing dir has size 0.
+func PlanDirSize(orgId, planId string) (int64, error) {
+	dir := getPlanDir(orgId, planId)
+
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+
+		return nil
+	})
+
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("error getting plan dir size: %v", err)
+	}
+
+	return size, nil
+}
+
+func getOrgTrashDir(orgId string) string {
+	return filepath.Join(BaseDir, "orgs", orgId, "trash")
+}
+
 func getPlanDir(orgId, planId string) string {
-	return filepath.Join(BaseDir, "orgs", orgId, "plans", planId)
+	return planDirLayout.planDir(getOrgPlansDir(orgId), planId)
 }
 
 func getPlanContextDir(orgId, planId string) string {
@@ -0,0 +1,190 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeletePlanDirs(t *testing.T) {
+	origBaseDir := BaseDir
+	BaseDir = t.TempDir()
+	defer func() { BaseDir = origBaseDir }()
+
+	orgId := "org"
+	planIds := []string{"plan-1", "plan-2", "plan-3"}
+	keepId := "plan-keep"
+
+	for _, planId := range append(planIds, keepId) {
+		err := os.MkdirAll(getPlanContextDir(orgId, planId), os.ModePerm)
+		if err != nil {
+			t.Fatalf("error creating plan dir: %v", err)
+		}
+	}
+
+	err := DeletePlanDirs(orgId, planIds)
+	if err != nil {
+		t.Fatalf("error deleting plan dirs: %v", err)
+	}
+
+	for _, planId := range planIds {
+		if _, err := os.Stat(getPlanDir(orgId, planId)); !os.IsNotExist(err) {
+			t.Errorf("plan dir for %s still exists after delete", planId)
+		}
+	}
+
+	if _, err := os.Stat(getPlanDir(orgId, keepId)); err != nil {
+		t.Errorf("plan dir for %s should not have been deleted: %v", keepId, err)
+	}
+}
+
+func TestDeletePlanDirsEmpty(t *testing.T) {
+	err := DeletePlanDirs("org", nil)
+	if err != nil {
+		t.Errorf("expected no error for empty plan ids, got %v", err)
+	}
+}
+
+func TestTrashPlanDir(t *testing.T) {
+	origBaseDir := BaseDir
+	BaseDir = t.TempDir()
+	defer func() { BaseDir = origBaseDir }()
+
+	orgId := "org"
+	planId := "plan"
+
+	err := os.MkdirAll(getPlanContextDir(orgId, planId), os.ModePerm)
+	if err != nil {
+		t.Fatalf("error creating plan dir: %v", err)
+	}
+
+	trashPath, err := TrashPlanDir(orgId, planId)
+	if err != nil {
+		t.Fatalf("error trashing plan dir: %v", err)
+	}
+
+	if _, err := os.Stat(getPlanDir(orgId, planId)); !os.IsNotExist(err) {
+		t.Errorf("plan dir still exists after trashing")
+	}
+
+	err = RestoreTrashedPlanDir(orgId, planId, trashPath)
+	if err != nil {
+		t.Fatalf("error restoring plan dir: %v", err)
+	}
+
+	if _, err := os.Stat(getPlanContextDir(orgId, planId)); err != nil {
+		t.Errorf("plan dir not restored: %v", err)
+	}
+
+	trashPath, err = TrashPlanDir(orgId, planId)
+	if err != nil {
+		t.Fatalf("error trashing plan dir: %v", err)
+	}
+
+	err = PurgeTrashedPlanDir(trashPath)
+	if err != nil {
+		t.Fatalf("error purging trashed plan dir: %v", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(trashPath))
+	if err != nil {
+		t.Fatalf("error reading trash dir: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected empty trash dir, got %d entries", len(entries))
+	}
+}
+
+func TestTrashPlanDirMissing(t *testing.T) {
+	origBaseDir := BaseDir
+	BaseDir = t.TempDir()
+	defer func() { BaseDir = origBaseDir }()
+
+	trashPath, err := TrashPlanDir("org", "missing")
+	if err != nil || trashPath != "" {
+		t.Errorf("expected no-op for missing plan dir, got %q, %v", trashPath, err)
+	}
+}
+
+func TestPlanDirSize(t *testing.T) {
+	origBaseDir := BaseDir
+	BaseDir = t.TempDir()
+	defer func() { BaseDir = origBaseDir }()
+
+	orgId := "org"
+	planId := "plan"
+
+	size, err := PlanDirSize(orgId, planId)
+	if err != nil || size != 0 {
+		t.Errorf("expected 0 for missing plan dir, got %d, %v", size, err)
+	}
+
+	err = os.MkdirAll(getPlanContextDir(orgId, planId), os.ModePerm)
+	if err != nil {
+		t.Fatalf("error creating plan dir: %v", err)
+	}
+
+	files := map[string]int{
+		filepath.Join(getPlanDir(orgId, planId), "settings.json"): 10,
+		filepath.Join(getPlanContextDir(orgId, planId), "a.body"): 25,
+	}
+	for path, n := range files {
+		err = os.WriteFile(path, make([]byte, n), 0644)
+		if err != nil {
+			t.Fatalf("error writing %s: %v", path, err)
+		}
+	}
+
+	size, err = PlanDirSize(orgId, planId)
+	if err != nil {
+		t.Fatalf("error getting plan dir size: %v", err)
+	}
+	if size != 35 {
+		t.Errorf("expected size 35, got %d", size)
+	}
+}
+
+func TestTrashPlanDirs(t *testing.T) {
+	origBaseDir := BaseDir
+	BaseDir = t.TempDir()
+	defer func() { BaseDir = origBaseDir }()
+
+	orgId := "org"
+	planIds := []string{"plan-1", "plan-2", "no-dir"}
+
+	for _, planId := range planIds[:2] {
+		if err := os.MkdirAll(getPlanContextDir(orgId, planId), os.ModePerm); err != nil {
+			t.Fatalf("error creating plan dir: %v", err)
+		}
+	}
+
+	trashPaths, err := TrashPlanDirs(orgId, planIds)
+	if err != nil {
+		t.Fatalf("error trashing plan dirs: %v", err)
+	}
+
+	if len(trashPaths) != 2 {
+		t.Errorf("expected trash paths only for plans with dirs, got %v", trashPaths)
+	}
+
+	RestoreTrashedPlanDirs(orgId, trashPaths)
+
+	for _, planId := range planIds[:2] {
+		if _, err := os.Stat(getPlanContextDir(orgId, planId)); err != nil {
+			t.Errorf("plan dir for %s not restored: %v", planId, err)
+		}
+	}
+
+	trashPaths, err = TrashPlanDirs(orgId, planIds)
+	if err != nil {
+		t.Fatalf("error trashing plan dirs: %v", err)
+	}
+
+	PurgeTrashedPlanDirs(trashPaths)
+
+	for planId, trashPath := range trashPaths {
+		if _, err := os.Stat(trashPath); !os.IsNotExist(err) {
+			t.Errorf("trashed dir for %s not purged", planId)
+		}
+	}
+}
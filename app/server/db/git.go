@@ -83,6 +83,18 @@ func GitAddAndCommit(orgId, planId, branch, message string) error {
 // 	return nil
 // }
 
+// GitHasChanges reports whether the plan's working tree has anything to commit
+func GitHasChanges(orgId, planId string) (bool, error) {
+	dir := getPlanDir(orgId, planId)
+
+	res, err := exec.Command("git", "-C", dir, "status", "--porcelain").CombinedOutput()
+	if err != nil {
+		return false, fmt.Errorf("error getting git status for dir: %s, err: %v, output: %s", dir, err, string(res))
+	}
+
+	return strings.TrimSpace(string(res)) != "", nil
+}
+
 func GitRewindToSha(orgId, planId, branch, sha string) error {
 	dir := getPlanDir(orgId, planId)
 
@@ -148,6 +160,18 @@ func GitCreateBranch(orgId, planId, branch, newBranch string) error {
 	return nil
 }
 
+func GitRenameBranch(orgId, planId, branchName, newName string) error {
+	dir := getPlanDir(orgId, planId)
+
+	// without -M, this fails rather than overwriting an existing branch
+	res, err := exec.Command("git", "-C", dir, "branch", "-m", branchName, newName).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error renaming git branch for dir: %s, err: %v, output: %s", dir, err, string(res))
+	}
+
+	return nil
+}
+
 func GitDeleteBranch(orgId, planId, branchName string) error {
 	dir := getPlanDir(orgId, planId)
 
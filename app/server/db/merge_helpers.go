@@ -0,0 +1,284 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// matches the ".2", ".3", etc. suffixes added by CreatePlanHandler on name collisions
+var planNameSuffixRegex = regexp.MustCompile(`^(.+)\.([2-9]|[1-9][0-9]+)$`)
+
+func PlanBaseName(name string) string {
+	matches := planNameSuffixRegex.FindStringSubmatch(name)
+	if matches == nil {
+		return name
+	}
+	return matches[1]
+}
+
+// GroupPlansByBaseName returns groups of 2 or more plans that share a base name, ignoring
+// draft plans. Groups are sorted by base name and plans within a group by created_at.
+func GroupPlansByBaseName(plans []*Plan) map[string][]*Plan {
+	byBaseName := map[string][]*Plan{}
+	for _, plan := range plans {
+		if plan.Name == "draft" {
+			continue
+		}
+		baseName := PlanBaseName(plan.Name)
+		byBaseName[baseName] = append(byBaseName[baseName], plan)
+	}
+
+	for baseName, plans := range byBaseName {
+		if len(plans) < 2 {
+			delete(byBaseName, baseName)
+			continue
+		}
+		sort.Slice(plans, func(i, j int) bool {
+			return plans[i].CreatedAt.Before(plans[j].CreatedAt)
+		})
+	}
+
+	return byBaseName
+}
+
+func ListProjectPlans(projectId string, archived bool) ([]*Plan, error) {
+	qs := "SELECT * FROM plans WHERE project_id = $1"
+
+	if archived {
+		qs += " AND archived_at IS NOT NULL"
+	} else {
+		qs += " AND archived_at IS NULL"
+	}
+
+	qs += " ORDER BY updated_at DESC"
+
+	var plans []*Plan
+	err := Conn.Select(&plans, qs, projectId)
+
+	if err != nil {
+		return nil, fmt.Errorf("error listing project plans: %v", err)
+	}
+
+	return plans, nil
+}
+
+type MergePlansParams struct {
+	OrgId  string
+	Target *Plan
+	// plans are merged into the target in the order given
+	Sources []*Plan
+	Branch  string
+}
+
+type MergePlansResult struct {
+	SnapshotSha      string
+	NumContexts      int
+	NumConvoMessages int
+}
+
+// MergePlansIntoTarget copies context and convo from each source plan into the target plan
+// and commits the result. The caller must hold a write lock on the target repo (which also
+// checks out the branch).
+// The target's latest commit before the merge is returned as SnapshotSha so the merge can be
+// undone by rewinding to it.
+func MergePlansIntoTarget(params MergePlansParams) (*MergePlansResult, error) {
+	orgId := params.OrgId
+	target := params.Target
+	branch := params.Branch
+
+	snapshotSha, _, err := GetLatestCommit(orgId, target.Id, branch)
+	if err != nil {
+		return nil, fmt.Errorf("error getting snapshot commit: %v", err)
+	}
+
+	targetContexts, err := GetPlanContexts(orgId, target.Id, false)
+	if err != nil {
+		return nil, fmt.Errorf("error getting target contexts: %v", err)
+	}
+
+	targetConvo, err := GetPlanConvo(orgId, target.Id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting target convo: %v", err)
+	}
+
+	existingFilePaths := map[string]bool{}
+	for _, context := range targetContexts {
+		if context.FilePath != "" {
+			existingFilePaths[context.FilePath] = true
+		}
+	}
+
+	nextNum := 1
+	var lastCreatedAt time.Time
+	for _, msg := range targetConvo {
+		if msg.Num >= nextNum {
+			nextNum = msg.Num + 1
+		}
+		if msg.CreatedAt.After(lastCreatedAt) {
+			lastCreatedAt = msg.CreatedAt
+		}
+	}
+
+	res := &MergePlansResult{SnapshotSha: snapshotSha}
+
+	for _, source := range params.Sources {
+		sourceContexts, err := GetPlanContexts(orgId, source.Id, false)
+		if err != nil {
+			return nil, fmt.Errorf("error getting contexts for plan %s: %v", source.Id, err)
+		}
+
+		for _, context := range sourceContexts {
+			// the target's version of a file wins over any duplicates from the sources
+			if context.FilePath != "" && existingFilePaths[context.FilePath] {
+				continue
+			}
+
+			err = copyContextToPlan(context, orgId, target.Id)
+			if err != nil {
+				return nil, fmt.Errorf("error copying context %s: %v", context.Id, err)
+			}
+
+			if context.FilePath != "" {
+				existingFilePaths[context.FilePath] = true
+			}
+			res.NumContexts++
+		}
+
+		sourceConvo, err := GetPlanConvo(orgId, source.Id)
+		if err != nil {
+			return nil, fmt.Errorf("error getting convo for plan %s: %v", source.Id, err)
+		}
+
+		for _, msg := range sourceConvo {
+			msg.Id = uuid.New().String()
+			msg.PlanId = target.Id
+			msg.Num = nextNum
+			nextNum++
+
+			// convo is ordered by created_at, so keep merged messages after the target's
+			if !msg.CreatedAt.After(lastCreatedAt) {
+				msg.CreatedAt = lastCreatedAt.Add(time.Millisecond)
+			}
+			lastCreatedAt = msg.CreatedAt
+
+			err = writeConvoMessageFile(msg)
+			if err != nil {
+				return nil, fmt.Errorf("error copying convo message: %v", err)
+			}
+			res.NumConvoMessages++
+		}
+	}
+
+	err = SyncPlanTokens(orgId, target.Id, branch)
+	if err != nil {
+		return nil, fmt.Errorf("error syncing plan tokens: %v", err)
+	}
+
+	msg := fmt.Sprintf("🔀 Merged %d plan(s) | %d context | %d messages", len(params.Sources), res.NumContexts, res.NumConvoMessages)
+
+	err = GitAddAndCommit(orgId, target.Id, branch, msg)
+	if err != nil {
+		return nil, fmt.Errorf("error committing merge: %v", err)
+	}
+
+	log.Println(msg)
+
+	return res, nil
+}
+
+func ArchivePlans(plans []*Plan) error {
+	var planIds []string
+	for _, plan := range plans {
+		planIds = append(planIds, plan.Id)
+	}
+
+	_, err := Conn.Exec("UPDATE plans SET archived_at = NOW() WHERE id = ANY($1) AND archived_at IS NULL", pq.Array(planIds))
+
+	if err != nil {
+		return fmt.Errorf("error archiving plans: %v", err)
+	}
+
+	InvalidatePlanCache(planIds...)
+
+	for _, plan := range plans {
+		PublishPlanArchived(plan)
+	}
+
+	return nil
+}
+
+// copyContextToPlan copies the raw meta and body files rather than going through StoreContext,
+// which would escape the already-escaped body a second time
+func copyContextToPlan(context *Context, orgId, planId string) error {
+	srcDir := getPlanContextDir(context.OrgId, context.PlanId)
+
+	body, err := os.ReadFile(filepath.Join(srcDir, context.Id+".body"))
+	if err != nil {
+		return fmt.Errorf("error reading context body: %v", err)
+	}
+
+	return writeCopiedContext(context, body, orgId, planId)
+}
+
+// writeCopiedContext writes context and its raw body to the plan under a new id
+func writeCopiedContext(context *Context, body []byte, orgId, planId string) error {
+	destDir := getPlanContextDir(orgId, planId)
+
+	copied := *context
+	copied.Id = uuid.New().String()
+	copied.OrgId = orgId
+	copied.PlanId = planId
+	copied.Body = ""
+
+	meta, err := json.MarshalIndent(copied, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling context meta: %v", err)
+	}
+
+	err = os.MkdirAll(destDir, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("error creating context dir: %v", err)
+	}
+
+	err = os.WriteFile(filepath.Join(destDir, copied.Id+".body"), body, 0644)
+	if err != nil {
+		return fmt.Errorf("error writing context body: %v", err)
+	}
+
+	err = os.WriteFile(filepath.Join(destDir, copied.Id+".meta"), meta, 0644)
+	if err != nil {
+		return fmt.Errorf("error writing context meta: %v", err)
+	}
+
+	return nil
+}
+
+func writeConvoMessageFile(msg *ConvoMessage) error {
+	convoDir := getPlanConversationDir(msg.OrgId, msg.PlanId)
+
+	bytes, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("error marshalling convo message: %v", err)
+	}
+
+	err = os.MkdirAll(convoDir, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("error creating convo dir: %v", err)
+	}
+
+	err = os.WriteFile(filepath.Join(convoDir, msg.Id+".json"), bytes, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("error writing convo message: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,203 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/sashabaranov/go-openai"
+)
+
+var ErrInvalidConvoCopyMode = errors.New("convo mode must be 'full', 'none', or 'last:N' with N >= 1")
+
+// ConvoCopyMode is how much of the convo a copy keeps. The zero value keeps all of it.
+type ConvoCopyMode struct {
+	Truncate bool
+	// with Truncate, the number of most recent messages kept; 0 keeps none
+	KeepLast int
+}
+
+// ParseConvoCopyMode parses "full" (or ""), "none", or "last:N"
+func ParseConvoCopyMode(mode string) (ConvoCopyMode, error) {
+	switch mode {
+	case "", "full":
+		return ConvoCopyMode{}, nil
+	case "none":
+		return ConvoCopyMode{Truncate: true}, nil
+	}
+
+	nStr, ok := strings.CutPrefix(mode, "last:")
+	if !ok {
+		return ConvoCopyMode{}, ErrInvalidConvoCopyMode
+	}
+
+	n, err := strconv.Atoi(nStr)
+	if err != nil || n < 1 {
+		return ConvoCopyMode{}, ErrInvalidConvoCopyMode
+	}
+
+	return ConvoCopyMode{Truncate: true, KeepLast: n}, nil
+}
+
+// apply keeps the last KeepLast messages of a convo ordered oldest first, renumbered from 1 so
+// the copy reads as a convo of its own
+func (mode ConvoCopyMode) apply(convo []*ConvoMessage) []*ConvoMessage {
+	if !mode.Truncate {
+		return convo
+	}
+
+	if len(convo) > mode.KeepLast {
+		convo = convo[len(convo)-mode.KeepLast:]
+	}
+
+	for i, msg := range convo {
+		msg.Num = i + 1
+	}
+
+	return convo
+}
+
+func countReplies(convo []*ConvoMessage) int {
+	n := 0
+	for _, msg := range convo {
+		if msg.Role == openai.ChatMessageRoleAssistant {
+			n++
+		}
+	}
+	return n
+}
+
+type MigratePlanParams struct {
+	Source *Plan
+	// already created in the target org and project, with its owner mapped
+	Target *Plan
+	// maps user ids in the source org to user ids in the target org
+	UserIds map[string]string
+	// owns anything whose user has no mapping
+	DefaultUserId string
+	// for copies within an org, where users don't need mapping
+	KeepUserIds bool
+	// the zero value copies the whole convo
+	Convo ConvoCopyMode
+}
+
+type MigratePlanResult struct {
+	NumContexts      int
+	NumConvoMessages int
+}
+
+// MapMigratedUserId returns the target org user for a source org user, falling back to
+// defaultUserId when there's no mapping. Empty ids stay empty.
+func MapMigratedUserId(userIds map[string]string, userId, defaultUserId string) string {
+	if userId == "" {
+		return ""
+	}
+	if mapped, ok := userIds[userId]; ok && mapped != "" {
+		return mapped
+	}
+	return defaultUserId
+}
+
+// MigratePlanToOrg copies the source plan's main branch context, convo, settings, and metadata
+// into the target plan, mapping owners and message authors to target org users, and commits
+// the result. The caller must hold a read lock on the source repo. Nothing else knows the
+// target's id yet, so it isn't locked.
+func MigratePlanToOrg(params MigratePlanParams) (*MigratePlanResult, error) {
+	return copyPlanToTarget(params, "📦 Migrated")
+}
+
+// CopyPlan is MigratePlanToOrg for a target in the source's org, usually with KeepUserIds set
+func CopyPlan(params MigratePlanParams) (*MigratePlanResult, error) {
+	return copyPlanToTarget(params, "📋 Copied")
+}
+
+func copyPlanToTarget(params MigratePlanParams, verb string) (*MigratePlanResult, error) {
+	source := params.Source
+	target := params.Target
+	res := &MigratePlanResult{}
+
+	mapUserId := func(userId string) string {
+		if params.KeepUserIds {
+			return userId
+		}
+		return MapMigratedUserId(params.UserIds, userId, params.DefaultUserId)
+	}
+
+	contexts, err := GetPlanContexts(source.OrgId, source.Id, false)
+	if err != nil {
+		return nil, fmt.Errorf("error getting source contexts: %v", err)
+	}
+
+	for _, context := range contexts {
+		context.OwnerId = mapUserId(context.OwnerId)
+
+		err = copyContextToPlan(context, target.OrgId, target.Id)
+		if err != nil {
+			return nil, fmt.Errorf("error copying context %s: %v", context.Id, err)
+		}
+		res.NumContexts++
+	}
+
+	convo, err := GetPlanConvo(source.OrgId, source.Id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting source convo: %v", err)
+	}
+
+	totalReplies := source.TotalReplies
+	if params.Convo.Truncate {
+		convo = params.Convo.apply(convo)
+		totalReplies = countReplies(convo)
+	}
+
+	for _, msg := range convo {
+		msg.Id = uuid.New().String()
+		msg.OrgId = target.OrgId
+		msg.PlanId = target.Id
+		msg.UserId = mapUserId(msg.UserId)
+
+		err = writeConvoMessageFile(msg)
+		if err != nil {
+			return nil, fmt.Errorf("error copying convo message: %v", err)
+		}
+		res.NumConvoMessages++
+	}
+
+	settings, err := GetPlanSettings(source, false)
+	if err != nil {
+		return nil, fmt.Errorf("error getting source settings: %v", err)
+	}
+
+	err = StorePlanSettings(target, settings)
+	if err != nil {
+		return nil, fmt.Errorf("error storing settings: %v", err)
+	}
+
+	_, err = Conn.Exec(
+		"UPDATE plans SET description = $1, tags = $2, pinned = $3, total_replies = $4 WHERE id = $5",
+		source.Description, source.Tags, source.Pinned, totalReplies, target.Id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error copying plan metadata: %v", err)
+	}
+
+	InvalidatePlanCache(target.Id)
+
+	err = SyncPlanTokens(target.OrgId, target.Id, "main")
+	if err != nil {
+		return nil, fmt.Errorf("error syncing plan tokens: %v", err)
+	}
+
+	msg := fmt.Sprintf("%s from plan %s | %d context | %d messages", verb, source.Id, res.NumContexts, res.NumConvoMessages)
+
+	err = GitAddAndCommit(target.OrgId, target.Id, "main", msg)
+	if err != nil {
+		return nil, fmt.Errorf("error committing copied plan: %v", err)
+	}
+
+	log.Println(msg)
+
+	return res, nil
+}
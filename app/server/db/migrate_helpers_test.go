@@ -0,0 +1,100 @@
+package db
+
+import "testing"
+
+func TestMapMigratedUserId(t *testing.T) {
+	userIds := map[string]string{
+		"alice": "alice-new",
+		"bob":   "",
+	}
+
+	tests := []struct {
+		userId string
+		want   string
+	}{
+		{userId: "alice", want: "alice-new"},
+		// an empty mapping counts as missing
+		{userId: "bob", want: "admin"},
+		{userId: "carol", want: "admin"},
+		{userId: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		got := MapMigratedUserId(userIds, tt.userId, "admin")
+		if got != tt.want {
+			t.Errorf("MapMigratedUserId(%q) = %q, want %q", tt.userId, got, tt.want)
+		}
+	}
+}
+
+func TestParseConvoCopyMode(t *testing.T) {
+	tests := []struct {
+		mode    string
+		want    ConvoCopyMode
+		wantErr bool
+	}{
+		{mode: "", want: ConvoCopyMode{}},
+		{mode: "full", want: ConvoCopyMode{}},
+		{mode: "none", want: ConvoCopyMode{Truncate: true}},
+		{mode: "last:3", want: ConvoCopyMode{Truncate: true, KeepLast: 3}},
+		{mode: "last:0", wantErr: true},
+		{mode: "last:-1", wantErr: true},
+		{mode: "last:", wantErr: true},
+		{mode: "last:x", wantErr: true},
+		{mode: "first:2", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseConvoCopyMode(tt.mode)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseConvoCopyMode(%q) should have failed", tt.mode)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseConvoCopyMode(%q) = %+v, %v, want %+v", tt.mode, got, err, tt.want)
+		}
+	}
+}
+
+func TestConvoCopyModeApply(t *testing.T) {
+	newConvo := func() []*ConvoMessage {
+		return []*ConvoMessage{
+			{Id: "a", Num: 1, Role: "user"},
+			{Id: "b", Num: 2, Role: "assistant"},
+			{Id: "c", Num: 3, Role: "user"},
+			{Id: "d", Num: 4, Role: "assistant"},
+		}
+	}
+
+	tests := []struct {
+		mode        ConvoCopyMode
+		wantIds     string
+		wantReplies int
+	}{
+		{mode: ConvoCopyMode{}, wantIds: "abcd", wantReplies: 2},
+		{mode: ConvoCopyMode{Truncate: true}, wantIds: "", wantReplies: 0},
+		{mode: ConvoCopyMode{Truncate: true, KeepLast: 3}, wantIds: "bcd", wantReplies: 2},
+		{mode: ConvoCopyMode{Truncate: true, KeepLast: 10}, wantIds: "abcd", wantReplies: 2},
+	}
+
+	for _, tt := range tests {
+		convo := tt.mode.apply(newConvo())
+
+		ids := ""
+		for i, msg := range convo {
+			ids += msg.Id
+			if msg.Num != i+1 {
+				t.Errorf("%+v: message %s has num %d, want %d", tt.mode, msg.Id, msg.Num, i+1)
+			}
+		}
+
+		if ids != tt.wantIds {
+			t.Errorf("%+v: got messages %q, want %q", tt.mode, ids, tt.wantIds)
+		}
+		if n := countReplies(convo); n != tt.wantReplies {
+			t.Errorf("%+v: got %d replies, want %d", tt.mode, n, tt.wantReplies)
+		}
+	}
+}
@@ -212,3 +212,30 @@ func ListOrgRoles(orgId string) ([]*OrgRole, error) {
 
 	return orgRoles, nil
 }
+
+// UpdateOrgSettings only updates the columns present in updates
+func UpdateOrgSettings(orgId string, updates map[string]interface{}) error {
+	if len(updates) == 0 {
+		return nil
+	}
+
+	var sets []string
+	var args []interface{}
+	i := 1
+	for col, val := range updates {
+		sets = append(sets, fmt.Sprintf("%s = $%d", col, i))
+		args = append(args, val)
+		i++
+	}
+	args = append(args, orgId)
+
+	query := fmt.Sprintf("UPDATE orgs SET %s WHERE id = $%d", strings.Join(sets, ", "), i)
+
+	_, err := Conn.Exec(query, args...)
+
+	if err != nil {
+		return fmt.Errorf("error updating org settings: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/plandex/plandex/shared"
+)
+
+// a new plan's dir is created before its row is committed, so recently modified dirs are left
+// alone in case they belong to a plan that's still being created
+const orphanedPlanDirGracePeriod = 10 * time.Minute
+
+// ListOrphanedPlanDirs returns the org's plan dirs that have no plan row, with their sizes.
+func ListOrphanedPlanDirs(orgId string) ([]*shared.OrphanedPlanDir, error) {
+	return findOrphanedPlanDirs(getOrgPlansDir(orgId), planDirLayout, getExistingPlanIds, time.Now())
+}
+
+// ReapOrphanedPlanDirs deletes the org's orphaned plan dirs and returns what was deleted. With
+// dryRun, it only returns what would be deleted. A dir that fails to delete is logged and left
+// out of the result rather than stopping the rest.
+func ReapOrphanedPlanDirs(orgId string, dryRun bool) ([]*shared.OrphanedPlanDir, error) {
+	orphaned, err := ListOrphanedPlanDirs(orgId)
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return orphaned, nil
+	}
+
+	reaped := []*shared.OrphanedPlanDir{}
+	for _, dir := range orphaned {
+		err := DeletePlanDir(orgId, dir.PlanId)
+		if err != nil {
+			log.Printf("Error deleting orphaned plan dir %s: %v\n", dir.PlanId, err)
+			continue
+		}
+		reaped = append(reaped, dir)
+	}
+
+	if len(reaped) > 0 {
+		log.Printf("Deleted %d orphaned plan dirs for org %s\n", len(reaped), orgId)
+	}
+
+	return reaped, nil
+}
+
+func getExistingPlanIds(planIds []string) (map[string]bool, error) {
+	var existing []string
+	// compared as text since names that aren't uuids can't have a row, and shouldn't fail the cast
+	err := Conn.Select(&existing, "SELECT id::text FROM plans WHERE id::text = ANY($1)", pq.Array(planIds))
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting plans: %v", err)
+	}
+
+	res := make(map[string]bool, len(existing))
+	for _, id := range existing {
+		res[id] = true
+	}
+
+	return res, nil
+}
+
+func findOrphanedPlanDirs(plansDir string, layout PlanDirLayout, getExisting func(planIds []string) (map[string]bool, error), now time.Time) ([]*shared.OrphanedPlanDir, error) {
+	entries, err := layout.readPlanDirs(plansDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []string
+	paths := map[string]string{}
+	modifiedAt := map[string]time.Time{}
+
+	for _, entry := range entries {
+		if now.Sub(entry.info.ModTime()) < orphanedPlanDirGracePeriod {
+			continue
+		}
+
+		candidates = append(candidates, entry.planId)
+		paths[entry.planId] = entry.path
+		modifiedAt[entry.planId] = entry.info.ModTime()
+	}
+
+	orphaned := []*shared.OrphanedPlanDir{}
+
+	if len(candidates) == 0 {
+		return orphaned, nil
+	}
+
+	existing, err := getExisting(candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, planId := range candidates {
+		if existing[planId] {
+			continue
+		}
+
+		size, err := getDirSize(paths[planId])
+		if err != nil {
+			return nil, err
+		}
+
+		orphaned = append(orphaned, &shared.OrphanedPlanDir{
+			PlanId:     planId,
+			Bytes:      size,
+			ModifiedAt: modifiedAt[planId],
+		})
+	}
+
+	return orphaned, nil
+}
+
+func getDirSize(dir string) (int64, error) {
+	var size int64
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.Type().IsRegular() {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, fmt.Errorf("error getting size of %s: %v", dir, err)
+	}
+
+	return size, nil
+}
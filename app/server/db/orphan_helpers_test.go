@@ -0,0 +1,61 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFindOrphanedPlanDirs(t *testing.T) {
+	plansDir := t.TempDir()
+	old := time.Now().Add(-time.Hour)
+
+	for _, name := range []string{"orphan", "existing", "recent"} {
+		dir := filepath.Join(plansDir, name, "context")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "a.body"), []byte("12345"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if name != "recent" {
+			if err := os.Chtimes(filepath.Join(plansDir, name), old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// stray files in the plans dir aren't plan dirs
+	if err := os.WriteFile(filepath.Join(plansDir, "stray"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var checked []string
+	getExisting := func(planIds []string) (map[string]bool, error) {
+		checked = planIds
+		return map[string]bool{"existing": true}, nil
+	}
+
+	orphaned, err := findOrphanedPlanDirs(plansDir, PlanDirLayoutFlat, getExisting, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(checked) != 2 {
+		t.Errorf("expected only dirs past the grace period to be checked, got %v", checked)
+	}
+
+	if len(orphaned) != 1 || orphaned[0].PlanId != "orphan" {
+		t.Fatalf("expected only orphan, got %v", orphaned)
+	}
+
+	if orphaned[0].Bytes != 5 {
+		t.Errorf("expected 5 bytes, got %d", orphaned[0].Bytes)
+	}
+
+	orphaned, err = findOrphanedPlanDirs(filepath.Join(plansDir, "missing"), PlanDirLayoutFlat, getExisting, time.Now())
+	if err != nil || len(orphaned) != 0 {
+		t.Errorf("expected no orphans for a missing plans dir, got %v, %v", orphaned, err)
+	}
+}
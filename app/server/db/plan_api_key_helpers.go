@@ -0,0 +1,101 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PlanApiKeyPrefix distinguishes plan api keys from user auth tokens, which are uuids
+const PlanApiKeyPrefix = "pxpk_"
+
+const planApiKeyTokenBytes = 32
+
+func hashPlanApiKeyToken(token string) string {
+	hashBytes := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hashBytes[:])
+}
+
+func IsPlanApiKeyToken(token string) bool {
+	return strings.HasPrefix(token, PlanApiKeyPrefix)
+}
+
+// CreatePlanApiKey returns the plaintext token, which is never stored
+func CreatePlanApiKey(orgId, planId, creatorId, name string, scopes []string, expiresAt time.Time) (*PlanApiKey, string, error) {
+	tokenBytes := make([]byte, planApiKeyTokenBytes)
+	_, err := rand.Read(tokenBytes)
+	if err != nil {
+		return nil, "", fmt.Errorf("error generating plan api key token: %v", err)
+	}
+	token := PlanApiKeyPrefix + hex.EncodeToString(tokenBytes)
+
+	key := PlanApiKey{
+		OrgId:     orgId,
+		PlanId:    planId,
+		CreatorId: creatorId,
+		Name:      name,
+		Scopes:    pq.StringArray(scopes),
+		TokenHash: hashPlanApiKeyToken(token),
+		ExpiresAt: expiresAt,
+	}
+
+	err = Conn.QueryRow(
+		"INSERT INTO plan_api_keys (org_id, plan_id, creator_id, name, scopes, token_hash, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at",
+		orgId, planId, creatorId, name, key.Scopes, key.TokenHash, expiresAt,
+	).Scan(&key.Id, &key.CreatedAt)
+
+	if err != nil {
+		return nil, "", fmt.Errorf("error creating plan api key: %v", err)
+	}
+
+	return &key, token, nil
+}
+
+func ListActivePlanApiKeys(planId string) ([]*PlanApiKey, error) {
+	var keys []*PlanApiKey
+	err := Conn.Select(&keys, "SELECT * FROM plan_api_keys WHERE plan_id = $1 AND revoked_at IS NULL AND expires_at > NOW() ORDER BY created_at DESC", planId)
+
+	if err != nil {
+		return nil, fmt.Errorf("error listing plan api keys: %v", err)
+	}
+
+	return keys, nil
+}
+
+// RevokePlanApiKey returns false if there's no active key with that id for the plan
+func RevokePlanApiKey(planId, keyId string) (bool, error) {
+	res, err := Conn.Exec("UPDATE plan_api_keys SET revoked_at = NOW() WHERE id = $1 AND plan_id = $2 AND revoked_at IS NULL", keyId, planId)
+
+	if err != nil {
+		return false, fmt.Errorf("error revoking plan api key: %v", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %v", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// ValidatePlanApiKey returns the key if the token is an active plan api key, nil otherwise
+func ValidatePlanApiKey(token string) (*PlanApiKey, error) {
+	var key PlanApiKey
+	err := Conn.Get(&key, "SELECT * FROM plan_api_keys WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW()", hashPlanApiKeyToken(token))
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error validating plan api key: %v", err)
+	}
+
+	return &key, nil
+}
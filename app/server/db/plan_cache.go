@@ -0,0 +1,222 @@
+package db
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// in-process LRU of plan rows for read-heavy paths like GetPlanHandler
+// entries keep the row's updated_at, so a cached plan can be compared against client versions
+// every write to the plans table must call InvalidatePlanCache (or ClearPlanCache) after it
+// commits. Invalidations are local to this host, so the TTL bounds how stale an entry can be
+// after a write on another host.
+
+const defaultPlanCacheSize = 1000
+const defaultPlanCacheTTL = 10 * time.Second
+
+type planCacheEntry struct {
+	planId    string
+	plan      Plan
+	expiresAt time.Time
+}
+
+type PlanCacheStats struct {
+	Size   int
+	Hits   int64
+	Misses int64
+}
+
+type planCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	lru     *list.List
+	// bumped on every invalidation so a read that raced with a write doesn't cache the old row
+	generation uint64
+	hits       int64
+	misses     int64
+}
+
+var planCacheInstance *planCache
+
+func init() {
+	size := defaultPlanCacheSize
+	ttl := defaultPlanCacheTTL
+
+	if s := os.Getenv("PLANDEX_PLAN_CACHE_SIZE"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			panic(fmt.Errorf("PLANDEX_PLAN_CACHE_SIZE must be an integer >= 0, got: %s", s))
+		}
+		size = n
+	}
+
+	if s := os.Getenv("PLANDEX_PLAN_CACHE_TTL"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			panic(fmt.Errorf("PLANDEX_PLAN_CACHE_TTL must be a non-negative duration like 10s, got: %s", s))
+		}
+		ttl = d
+	}
+
+	planCacheInstance = newPlanCache(size, ttl)
+}
+
+func newPlanCache(size int, ttl time.Duration) *planCache {
+	return &planCache{
+		size:    size,
+		ttl:     ttl,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+func (c *planCache) enabled() bool {
+	return c.size > 0 && c.ttl > 0
+}
+
+// get returns a copy of the cached plan, or nil and the current generation to pass to put
+func (c *planCache) get(planId string) (*Plan, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[planId]; ok {
+		entry := el.Value.(*planCacheEntry)
+		if time.Now().Before(entry.expiresAt) {
+			c.lru.MoveToFront(el)
+			c.hits++
+			return clonePlan(&entry.plan), c.generation
+		}
+		c.remove(el)
+	}
+
+	c.misses++
+	return nil, c.generation
+}
+
+func (c *planCache) put(plan *Plan, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	if el, ok := c.entries[plan.Id]; ok {
+		c.remove(el)
+	}
+
+	entry := &planCacheEntry{
+		planId:    plan.Id,
+		plan:      *clonePlan(plan),
+		expiresAt: time.Now().Add(c.ttl),
+	}
+	c.entries[plan.Id] = c.lru.PushFront(entry)
+
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *planCache) invalidate(planIds []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+
+	for _, planId := range planIds {
+		if el, ok := c.entries[planId]; ok {
+			c.remove(el)
+		}
+	}
+}
+
+func (c *planCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.entries = map[string]*list.Element{}
+	c.lru.Init()
+}
+
+func (c *planCache) remove(el *list.Element) {
+	entry := c.lru.Remove(el).(*planCacheEntry)
+	delete(c.entries, entry.planId)
+}
+
+// clonePlan deep copies so callers can't modify a cached entry through slices or pointers
+func clonePlan(plan *Plan) *Plan {
+	res := *plan
+
+	if plan.Tags != nil {
+		res.Tags = append(pq.StringArray{}, plan.Tags...)
+	}
+
+	for _, ptr := range []**time.Time{&res.SharedWithOrgAt, &res.ArchivedAt} {
+		if *ptr != nil {
+			t := **ptr
+			*ptr = &t
+		}
+	}
+
+	if plan.SearchVector != nil {
+		v := *plan.SearchVector
+		res.SearchVector = &v
+	}
+
+	return &res
+}
+
+func (c *planCache) stats() PlanCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return PlanCacheStats{
+		Size:   c.lru.Len(),
+		Hits:   c.hits,
+		Misses: c.misses,
+	}
+}
+
+// GetPlanCached is GetPlan served from the plan cache when possible. Callers get their own copy
+// of the plan and can modify it freely.
+func GetPlanCached(planId string) (*Plan, error) {
+	if !planCacheInstance.enabled() {
+		return GetPlan(planId)
+	}
+
+	plan, generation := planCacheInstance.get(planId)
+	if plan != nil {
+		return plan, nil
+	}
+
+	plan, err := GetPlan(planId)
+	if err != nil {
+		return nil, err
+	}
+
+	planCacheInstance.put(plan, generation)
+
+	return plan, nil
+}
+
+func InvalidatePlanCache(planIds ...string) {
+	planCacheInstance.invalidate(planIds)
+}
+
+// ClearPlanCache drops every entry, for writes that touch plans across an org
+func ClearPlanCache() {
+	planCacheInstance.clear()
+}
+
+func GetPlanCacheStats() PlanCacheStats {
+	return planCacheInstance.stats()
+}
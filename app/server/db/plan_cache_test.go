@@ -0,0 +1,84 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestPlanCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newPlanCache(2, time.Minute)
+
+	for _, id := range []string{"a", "b"} {
+		_, gen := c.get(id)
+		c.put(&Plan{Id: id}, gen)
+	}
+
+	// touch a so b is the least recently used
+	if plan, _ := c.get("a"); plan == nil {
+		t.Fatalf("expected a to be cached")
+	}
+
+	_, gen := c.get("c")
+	c.put(&Plan{Id: "c"}, gen)
+
+	if plan, _ := c.get("b"); plan != nil {
+		t.Errorf("expected b to be evicted")
+	}
+	if plan, _ := c.get("a"); plan == nil {
+		t.Errorf("expected a to still be cached")
+	}
+
+	stats := c.stats()
+	if stats.Size != 2 {
+		t.Errorf("expected size 2, got %d", stats.Size)
+	}
+}
+
+func TestPlanCacheExpires(t *testing.T) {
+	c := newPlanCache(10, time.Millisecond)
+
+	_, gen := c.get("a")
+	c.put(&Plan{Id: "a"}, gen)
+
+	time.Sleep(5 * time.Millisecond)
+
+	if plan, _ := c.get("a"); plan != nil {
+		t.Errorf("expected a to have expired")
+	}
+}
+
+func TestPlanCacheSkipsPutAfterInvalidation(t *testing.T) {
+	c := newPlanCache(10, time.Minute)
+
+	// a read misses, then a write invalidates before the read caches what it loaded
+	_, gen := c.get("a")
+	c.invalidate([]string{"a"})
+	c.put(&Plan{Id: "a", Name: "stale"}, gen)
+
+	if plan, _ := c.get("a"); plan != nil {
+		t.Errorf("expected stale read not to be cached")
+	}
+}
+
+func TestPlanCacheReturnsCopies(t *testing.T) {
+	c := newPlanCache(10, time.Minute)
+
+	_, gen := c.get("a")
+	c.put(&Plan{Id: "a", Tags: pq.StringArray{"x"}}, gen)
+
+	plan, _ := c.get("a")
+	plan.Name = "changed"
+	plan.Tags[0] = "changed"
+
+	cached, _ := c.get("a")
+	if cached.Name != "" || cached.Tags[0] != "x" {
+		t.Errorf("cached plan was modified through a returned copy: %+v", cached)
+	}
+
+	stats := c.stats()
+	if stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("expected 2 hits and 1 miss, got %+v", stats)
+	}
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/plandex/plandex/shared"
+)
+
+// CompactPlan removes what a plan's dir holds that nothing can reach anymore: context bodies
+// whose meta was never written, and git objects only kept alive by the reflog, like versions
+// dropped by a rewind. Nothing reachable from a branch is touched, so every listed version can
+// still be restored. The caller must hold a write lock on the plan and make sure it isn't running.
+func CompactPlan(orgId, planId string) (*shared.CompactPlanResponse, error) {
+	dir := getPlanDir(orgId, planId)
+
+	before, err := PlanDirSize(orgId, planId)
+	if err != nil {
+		return nil, err
+	}
+
+	removed, err := removeOrphanedContextBodies(getPlanContextDir(orgId, planId), time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := exec.Command("git", "-C", dir, "reflog", "expire", "--expire=now", "--all").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("error expiring reflog for dir: %s, err: %v, output: %s", dir, err, string(res))
+	}
+
+	res, err = exec.Command("git", "-C", dir, "gc", "--prune=now", "--quiet").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("error running git gc for dir: %s, err: %v, output: %s", dir, err, string(res))
+	}
+
+	after, err := PlanDirSize(orgId, planId)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &shared.CompactPlanResponse{
+		BytesBefore:          before,
+		BytesAfter:           after,
+		RemovedContextBodies: removed,
+	}
+
+	// packing can make a small repo slightly bigger
+	if before > after {
+		resp.BytesReclaimed = before - after
+	}
+
+	log.Printf("Compacted plan %s: %d -> %d bytes, removed %d context bodies\n", planId, before, after, removed)
+
+	return resp, nil
+}
+
+// removeOrphanedContextBodies deletes .body files with no .meta. A streamed upload writes the
+// body before the meta, so recently modified bodies are left alone in case they're still being
+// written.
+func removeOrphanedContextBodies(contextDir string, now time.Time) (int, error) {
+	entries, err := os.ReadDir(contextDir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error reading context dir: %v", err)
+	}
+
+	hasMeta := map[string]bool{}
+	for _, entry := range entries {
+		if id, ok := strings.CutSuffix(entry.Name(), ".meta"); ok {
+			hasMeta[id] = true
+		}
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".body")
+		if !ok || hasMeta[id] || !entry.Type().IsRegular() {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return removed, fmt.Errorf("error getting context body info: %v", err)
+		}
+
+		if now.Sub(info.ModTime()) < orphanedPlanDirGracePeriod {
+			continue
+		}
+
+		err = os.Remove(filepath.Join(contextDir, entry.Name()))
+		if err != nil && !os.IsNotExist(err) {
+			return removed, fmt.Errorf("error removing orphaned context body: %v", err)
+		}
+		removed++
+	}
+
+	return removed, nil
+}
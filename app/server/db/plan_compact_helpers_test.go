@@ -0,0 +1,46 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRemoveOrphanedContextBodies(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-time.Hour)
+
+	for _, name := range []string{"kept.body", "kept.meta", "orphan.body", "recent.body"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if name != "recent.body" {
+			if err := os.Chtimes(path, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	removed, err := removeOrphanedContextBodies(dir, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if removed != 1 {
+		t.Errorf("expected 1 body removed, got %d", removed)
+	}
+
+	for name, want := range map[string]bool{"kept.body": true, "kept.meta": true, "orphan.body": false, "recent.body": true} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if exists := err == nil; exists != want {
+			t.Errorf("%s: exists = %v, want %v", name, exists, want)
+		}
+	}
+
+	removed, err = removeOrphanedContextBodies(filepath.Join(dir, "missing"), time.Now())
+	if err != nil || removed != 0 {
+		t.Errorf("expected nothing removed for a missing dir, got %d, %v", removed, err)
+	}
+}
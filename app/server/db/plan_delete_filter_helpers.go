@@ -0,0 +1,165 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// the most plans a single delete by filter removes; callers repeat the request for the rest
+const MaxPlansDeletedByFilter = 100
+
+var ErrPlanDeleteTokenMismatch = errors.New("plans matching the filter changed since the dry run")
+
+type PlanDeleteFilter struct {
+	// nil matches both archived and unarchived plans
+	Archived *bool
+	// plans last updated before this time
+	OlderThan  *time.Time
+	NamePrefix *string
+}
+
+// query returns the conditions for the owner's plans in the project matching the filter, with
+// their args starting at $1
+func (f PlanDeleteFilter) query(projectId, userId string) (string, []interface{}) {
+	conds := []string{"project_id = $1", "owner_id = $2"}
+	args := []interface{}{projectId, userId}
+
+	if f.Archived != nil {
+		if *f.Archived {
+			conds = append(conds, "archived_at IS NOT NULL")
+		} else {
+			conds = append(conds, "archived_at IS NULL")
+		}
+	}
+
+	if f.OlderThan != nil {
+		args = append(args, *f.OlderThan)
+		conds = append(conds, fmt.Sprintf("updated_at < $%d", len(args)))
+	}
+
+	if f.NamePrefix != nil && *f.NamePrefix != "" {
+		args = append(args, escapeLike(*f.NamePrefix)+"%")
+		conds = append(conds, fmt.Sprintf(`name LIKE $%d ESCAPE '\'`, len(args)))
+	}
+
+	return strings.Join(conds, " AND "), args
+}
+
+// PlanDeleteConfirmationToken identifies a set of plans to delete. A dry run returns it, and
+// the delete only goes ahead if the token still matches, so plans that started matching after
+// the dry run aren't deleted without being reviewed.
+func PlanDeleteConfirmationToken(userId string, planIds []string) string {
+	ids := append([]string{}, planIds...)
+	sort.Strings(ids)
+
+	sum := sha256.Sum256([]byte(userId + "\n" + strings.Join(ids, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// ListOwnerPlansByFilter returns up to MaxPlansDeletedByFilter of the owner's plans in the
+// project matching the filter, oldest first, and whether more match
+func ListOwnerPlansByFilter(projectId, userId string, filter PlanDeleteFilter) ([]*Plan, bool, error) {
+	cond, args := filter.query(projectId, userId)
+
+	var plans []*Plan
+	err := Conn.Select(&plans, fmt.Sprintf("SELECT * FROM plans WHERE %s ORDER BY created_at, id LIMIT %d", cond, MaxPlansDeletedByFilter+1), args...)
+
+	if err != nil {
+		return nil, false, fmt.Errorf("error listing plans: %v", err)
+	}
+
+	if len(plans) > MaxPlansDeletedByFilter {
+		return plans[:MaxPlansDeletedByFilter], true, nil
+	}
+
+	return plans, false, nil
+}
+
+// DeleteOwnerPlansByFilter deletes the plans ListOwnerPlansByFilter would return in a single
+// transaction, as long as they still match token. Returns ErrPlanDeleteTokenMismatch without
+// deleting anything otherwise. Like DeleteOwnerPlans, dirs go through the trash and tombstones
+// are recorded, so a failed purge is only logged and the deleted plans are still returned.
+func DeleteOwnerPlansByFilter(orgId, projectId, userId string, filter PlanDeleteFilter, token string) ([]*Plan, bool, error) {
+	tx, err := Conn.Beginx()
+	if err != nil {
+		return nil, false, fmt.Errorf("error starting transaction: %v", err)
+	}
+
+	var trashPaths map[string]string
+
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Printf("transaction rollback error: %v\n", rbErr)
+			}
+			RestoreTrashedPlanDirs(orgId, trashPaths)
+		}
+	}()
+
+	cond, args := filter.query(projectId, userId)
+
+	var plans []*Plan
+	err = tx.Select(&plans, fmt.Sprintf("SELECT * FROM plans WHERE %s ORDER BY created_at, id LIMIT %d FOR UPDATE", cond, MaxPlansDeletedByFilter+1), args...)
+
+	if err != nil {
+		return nil, false, fmt.Errorf("error listing plans: %v", err)
+	}
+
+	hasMore := len(plans) > MaxPlansDeletedByFilter
+	if hasMore {
+		plans = plans[:MaxPlansDeletedByFilter]
+	}
+
+	ids := make([]string, len(plans))
+	for i, plan := range plans {
+		ids[i] = plan.Id
+	}
+
+	if PlanDeleteConfirmationToken(userId, ids) != token {
+		err = ErrPlanDeleteTokenMismatch
+		return nil, false, err
+	}
+
+	trashPaths, err = TrashPlanDirs(orgId, ids)
+	if err != nil {
+		return nil, false, err
+	}
+
+	_, err = tx.Exec("DELETE FROM plans WHERE id = ANY($1)", pq.Array(ids))
+
+	if err != nil {
+		return nil, false, fmt.Errorf("error deleting plans: %v", err)
+	}
+
+	err = recordPlanTombstonesTx(tx.Tx, orgId, userId, ids)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, false, fmt.Errorf("error committing transaction: %v", err)
+	}
+
+	InvalidatePlanCache(ids...)
+
+	for _, plan := range plans {
+		PublishPlanDeleted(plan)
+	}
+
+	PurgeTrashedPlanDirs(trashPaths)
+
+	if len(ids) > 0 {
+		log.Println("Deleted", len(ids), "plans by filter")
+	}
+
+	return plans, hasMore, nil
+}
@@ -0,0 +1,44 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlanDeleteConfirmationToken(t *testing.T) {
+	token := PlanDeleteConfirmationToken("user", []string{"b", "a"})
+
+	if token != PlanDeleteConfirmationToken("user", []string{"a", "b"}) {
+		t.Errorf("expected the token not to depend on id order")
+	}
+
+	if token == PlanDeleteConfirmationToken("user", []string{"a", "b", "c"}) {
+		t.Errorf("expected a different token when another plan matches")
+	}
+
+	if token == PlanDeleteConfirmationToken("other-user", []string{"a", "b"}) {
+		t.Errorf("expected a different token for another user")
+	}
+}
+
+func TestPlanDeleteFilterQuery(t *testing.T) {
+	archived := true
+	olderThan := time.Now()
+	prefix := "tmp_"
+
+	cond, args := PlanDeleteFilter{Archived: &archived, OlderThan: &olderThan, NamePrefix: &prefix}.query("project", "user")
+
+	want := `project_id = $1 AND owner_id = $2 AND archived_at IS NOT NULL AND updated_at < $3 AND name LIKE $4 ESCAPE '\'`
+	if cond != want {
+		t.Errorf("got cond %q, want %q", cond, want)
+	}
+
+	if len(args) != 4 || args[3] != `tmp\_%` {
+		t.Errorf("unexpected args: %v", args)
+	}
+
+	cond, args = PlanDeleteFilter{}.query("project", "user")
+	if cond != "project_id = $1 AND owner_id = $2" || len(args) != 2 {
+		t.Errorf("expected only the owner conditions for an empty filter, got %q %v", cond, args)
+	}
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PlanDeleteRetryWindow is how long after a plan is deleted that deleting it again, like a retry
+// or a double click, succeeds rather than reporting the plan missing
+const PlanDeleteRetryWindow = 10 * time.Minute
+
+// DeletePlanWithTombstone deletes the plan's row and records who deleted it, so a repeat delete
+// within PlanDeleteRetryWindow can be told apart from a plan that never existed. Returns false
+// if there was no plan to delete. Tombstones older than the window are cleared out along the
+// way.
+func DeletePlanWithTombstone(orgId, planId, userId string) (bool, error) {
+	tx, err := Conn.Begin()
+	if err != nil {
+		return false, fmt.Errorf("error starting transaction: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Printf("transaction rollback error: %v\n", rbErr)
+			}
+		}
+	}()
+
+	res, err := tx.Exec("DELETE FROM plans WHERE id = $1 AND org_id = $2", planId, orgId)
+	if err != nil {
+		return false, fmt.Errorf("error deleting plan: %v", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %v", err)
+	}
+
+	if rowsAffected == 0 {
+		err = tx.Rollback()
+		if err != nil {
+			return false, fmt.Errorf("error rolling back transaction: %v", err)
+		}
+		return false, nil
+	}
+
+	err = recordPlanTombstonesTx(tx, orgId, userId, []string{planId})
+	if err != nil {
+		return false, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, fmt.Errorf("error committing transaction: %v", err)
+	}
+
+	InvalidatePlanCache(planId)
+
+	return true, nil
+}
+
+// WasPlanRecentlyDeleted is true if userId deleted the plan in the org within
+// PlanDeleteRetryWindow. Only the user who deleted it gets a match, so a missing plan id doesn't
+// tell anyone else whether it existed.
+func WasPlanRecentlyDeleted(orgId, planId, userId string) (bool, error) {
+	var exists bool
+	err := Conn.QueryRow(`SELECT EXISTS (
+		SELECT 1 FROM deleted_plans
+		WHERE plan_id = $1 AND org_id = $2 AND deleted_by = $3
+		AND deleted_at > NOW() - $4 * INTERVAL '1 second'
+	)`, planId, orgId, userId, int(PlanDeleteRetryWindow.Seconds())).Scan(&exists)
+
+	if err != nil {
+		return false, fmt.Errorf("error checking plan tombstone: %v", err)
+	}
+
+	return exists, nil
+}
+
+// recordPlanTombstonesTx records that userId deleted the plans, for WasPlanRecentlyDeleted, and
+// clears out tombstones older than PlanDeleteRetryWindow
+func recordPlanTombstonesTx(tx *sql.Tx, orgId, userId string, planIds []string) error {
+	_, err := tx.Exec("DELETE FROM deleted_plans WHERE deleted_at < NOW() - $1 * INTERVAL '1 second'", int(PlanDeleteRetryWindow.Seconds()))
+	if err != nil {
+		return fmt.Errorf("error clearing old plan tombstones: %v", err)
+	}
+
+	if len(planIds) == 0 {
+		return nil
+	}
+
+	_, err = tx.Exec(`INSERT INTO deleted_plans (plan_id, org_id, deleted_by) SELECT unnest($1::uuid[]), $2, $3
+		ON CONFLICT (plan_id) DO UPDATE SET org_id = EXCLUDED.org_id, deleted_by = EXCLUDED.deleted_by, deleted_at = NOW()`, pq.Array(planIds), orgId, userId)
+	if err != nil {
+		return fmt.Errorf("error recording plan tombstones: %v", err)
+	}
+
+	return nil
+}
+
+// TrashPlanDirs is TrashPlanDir for several plans, returning each moved dir's trash path by plan
+// id. If any move fails, the dirs already moved are put back.
+func TrashPlanDirs(orgId string, planIds []string) (map[string]string, error) {
+	trashPaths := map[string]string{}
+
+	for _, planId := range planIds {
+		trashPath, err := TrashPlanDir(orgId, planId)
+
+		if err != nil {
+			RestoreTrashedPlanDirs(orgId, trashPaths)
+			return nil, fmt.Errorf("error moving dir for plan %s to trash: %v", planId, err)
+		}
+
+		if trashPath != "" {
+			trashPaths[planId] = trashPath
+		}
+	}
+
+	return trashPaths, nil
+}
+
+// RestoreTrashedPlanDirs puts back dirs moved by TrashPlanDirs. Failures are logged with where
+// the dir is, since the plan's row is still there and only the dir needs moving back.
+func RestoreTrashedPlanDirs(orgId string, trashPaths map[string]string) {
+	for planId, trashPath := range trashPaths {
+		if err := RestoreTrashedPlanDir(orgId, planId, trashPath); err != nil {
+			log.Printf("Error restoring plan dir for plan %s from %s; move it back manually: %v\n", planId, trashPath, err)
+		}
+	}
+}
+
+// PurgeTrashedPlanDirs removes dirs moved by TrashPlanDirs once their plans are deleted. The
+// plans are gone at that point, so failures are logged rather than returned.
+func PurgeTrashedPlanDirs(trashPaths map[string]string) {
+	for planId, trashPath := range trashPaths {
+		if err := PurgeTrashedPlanDir(trashPath); err != nil {
+			log.Printf("Error purging trashed dir for deleted plan %s at %s; remove it manually: %v\n", planId, trashPath, err)
+		}
+	}
+}
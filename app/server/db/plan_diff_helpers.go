@@ -0,0 +1,139 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/plandex/plandex/shared"
+)
+
+var ErrUnknownCommit = errors.New("commit not found in plan history")
+
+// only hex shas, so a user-supplied value can't be read as a git option or revision expression
+var gitShaRegex = regexp.MustCompile(`^[0-9a-f]{4,40}$`)
+
+// GetPlanFilesAtSha returns the file contexts that were loaded as of a commit in the plan's
+// repo, bodies unescaped, by path. The sha can be abbreviated, as it is in the plan's log.
+func GetPlanFilesAtSha(orgId, planId, sha string) (map[string]string, error) {
+	dir := getPlanDir(orgId, planId)
+
+	fullSha, err := resolvePlanCommit(dir, sha)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := exec.Command("git", "-C", dir, "ls-tree", "--name-only", fullSha, "context/").Output()
+	if err != nil {
+		return nil, fmt.Errorf("error listing context files at %s: %v", sha, err)
+	}
+
+	files := map[string]string{}
+
+	for _, name := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if !strings.HasSuffix(name, ".meta") {
+			continue
+		}
+
+		metaBytes, err := exec.Command("git", "-C", dir, "show", fullSha+":"+name).Output()
+		if err != nil {
+			return nil, fmt.Errorf("error reading context meta %s at %s: %v", name, sha, err)
+		}
+
+		var context Context
+		err = json.Unmarshal(metaBytes, &context)
+		if err != nil {
+			return nil, fmt.Errorf("error unmarshalling context meta %s at %s: %v", name, sha, err)
+		}
+
+		if context.ContextType != shared.ContextFileType {
+			continue
+		}
+
+		bodyBytes, err := exec.Command("git", "-C", dir, "show", fullSha+":"+strings.TrimSuffix(name, ".meta")+".body").Output()
+		if err != nil {
+			return nil, fmt.Errorf("error reading context body %s at %s: %v", name, sha, err)
+		}
+
+		files[filepath.ToSlash(filepath.Clean(context.FilePath))] = strings.ReplaceAll(string(bodyBytes), "\\`\\`\\`", "```")
+	}
+
+	return files, nil
+}
+
+// resolvePlanCommit returns the full sha of a commit in the plan's repo, or ErrUnknownCommit
+func resolvePlanCommit(dir, sha string) (string, error) {
+	if !gitShaRegex.MatchString(sha) {
+		return "", ErrUnknownCommit
+	}
+
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "--verify", "--quiet", sha+"^{commit}").Output()
+	if err != nil {
+		return "", ErrUnknownCommit
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// GitDiffFile returns a unified diff between two versions of a file, with a/ and b/ prefixed
+// paths like git's own output. A nil before diffs against an empty file, for new files.
+func GitDiffFile(filePath string, before *string, after string) (string, error) {
+	if !filepath.IsLocal(filePath) {
+		return "", fmt.Errorf("invalid file path: %s", filePath)
+	}
+
+	tempDir, err := os.MkdirTemp("", "plandex-diff-*")
+	if err != nil {
+		return "", fmt.Errorf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	left := "/dev/null"
+	if before != nil {
+		left = filepath.Join("a", filePath)
+		err = writeDiffFile(filepath.Join(tempDir, left), *before)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	right := filepath.Join("b", filePath)
+	err = writeDiffFile(filepath.Join(tempDir, right), after)
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	cmd := exec.Command("git", "diff", "--no-index", "--no-color", "--no-prefix", "--", left, right)
+	cmd.Dir = tempDir
+	cmd.Stdout = &out
+	err = cmd.Run()
+
+	// exit code 1 just means there are differences
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		return "", fmt.Errorf("error diffing %s: %v", filePath, err)
+	}
+
+	return out.String(), nil
+}
+
+func writeDiffFile(path, content string) error {
+	err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("error creating diff dir: %v", err)
+	}
+
+	err = os.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		return fmt.Errorf("error writing diff file: %v", err)
+	}
+
+	return nil
+}
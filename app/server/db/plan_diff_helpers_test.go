@@ -0,0 +1,97 @@
+package db
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/plandex/plandex/shared"
+)
+
+func TestGetPlanFilesAtSha(t *testing.T) {
+	origBaseDir := BaseDir
+	BaseDir = t.TempDir()
+	defer func() { BaseDir = origBaseDir }()
+
+	orgId := "org"
+	planId := "plan"
+
+	err := InitPlan(orgId, planId)
+	if err != nil {
+		t.Fatalf("error initializing plan: %v", err)
+	}
+
+	err = InitGitRepo(orgId, planId)
+	if err != nil {
+		t.Fatalf("error initializing git repo: %v", err)
+	}
+
+	for _, context := range []*Context{
+		{OrgId: orgId, PlanId: planId, ContextType: shared.ContextFileType, FilePath: "src/main.go", Body: "package main\n```\n"},
+		{OrgId: orgId, PlanId: planId, ContextType: shared.ContextNoteType, Body: "a note"},
+	} {
+		err = StoreContext(context)
+		if err != nil {
+			t.Fatalf("error storing context: %v", err)
+		}
+	}
+
+	err = GitAddAndCommit(orgId, planId, "main", "load context")
+	if err != nil {
+		t.Fatalf("error committing: %v", err)
+	}
+
+	out, err := exec.Command("git", "-C", getPlanDir(orgId, planId), "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		t.Fatalf("error getting sha: %v", err)
+	}
+	sha := strings.TrimSpace(string(out))
+
+	files, err := GetPlanFilesAtSha(orgId, planId, sha)
+	if err != nil {
+		t.Fatalf("error getting files at sha: %v", err)
+	}
+
+	if len(files) != 1 || files["src/main.go"] != "package main\n```\n" {
+		t.Errorf("expected only the unescaped file context, got %v", files)
+	}
+
+	for _, invalid := range []string{"0000000", "HEAD", "--all", "abc^"} {
+		if _, err := GetPlanFilesAtSha(orgId, planId, invalid); err != ErrUnknownCommit {
+			t.Errorf("expected ErrUnknownCommit for %q, got %v", invalid, err)
+		}
+	}
+}
+
+func TestGitDiffFile(t *testing.T) {
+	before := "one\ntwo\n"
+
+	diff, err := GitDiffFile("src/main.go", &before, "one\nthree\n")
+	if err != nil {
+		t.Fatalf("error diffing: %v", err)
+	}
+
+	for _, line := range []string{"--- a/src/main.go", "+++ b/src/main.go", "-two", "+three"} {
+		if !strings.Contains(diff, line+"\n") {
+			t.Errorf("expected diff to contain %q, got:\n%s", line, diff)
+		}
+	}
+
+	diff, err = GitDiffFile("new.go", nil, "package main\n")
+	if err != nil {
+		t.Fatalf("error diffing new file: %v", err)
+	}
+
+	if !strings.Contains(diff, "--- /dev/null\n") || !strings.Contains(diff, "+package main\n") {
+		t.Errorf("expected a diff against /dev/null, got:\n%s", diff)
+	}
+
+	diff, err = GitDiffFile("same.go", &before, before)
+	if err != nil || diff != "" {
+		t.Errorf("expected no diff for unchanged file, got %q, %v", diff, err)
+	}
+
+	if _, err := GitDiffFile("../escape.go", nil, ""); err == nil {
+		t.Errorf("expected an error for a path outside the diff dir")
+	}
+}
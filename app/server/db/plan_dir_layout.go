@@ -0,0 +1,208 @@
+package db
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// PlanDirLayout is how plan dirs are arranged under an org's plans dir. Every plan dir path goes
+// through getPlanDir, which follows the layout set with PLANDEX_PLAN_DIR_LAYOUT.
+type PlanDirLayout string
+
+const (
+	// orgs/{orgId}/plans/{planId}
+	PlanDirLayoutFlat PlanDirLayout = "flat"
+	// orgs/{orgId}/plans/{shard}/{planId}, where shard is the first 2 hex chars of the plan id's
+	// sha1, so an org's plans are spread across up to 256 dirs instead of filling one
+	PlanDirLayoutSharded PlanDirLayout = "sharded"
+)
+
+const planDirShardLen = 2
+
+var planDirLayout = PlanDirLayoutFlat
+
+func init() {
+	if s := os.Getenv("PLANDEX_PLAN_DIR_LAYOUT"); s != "" {
+		layout := PlanDirLayout(s)
+		if layout != PlanDirLayoutFlat && layout != PlanDirLayoutSharded {
+			panic(fmt.Errorf("PLANDEX_PLAN_DIR_LAYOUT must be '%s' or '%s', got: %s", PlanDirLayoutFlat, PlanDirLayoutSharded, s))
+		}
+		planDirLayout = layout
+	}
+}
+
+func getOrgPlansDir(orgId string) string {
+	return filepath.Join(BaseDir, "orgs", orgId, "plans")
+}
+
+func (layout PlanDirLayout) planDir(plansDir, planId string) string {
+	if layout == PlanDirLayoutSharded {
+		return filepath.Join(plansDir, planDirShard(planId), planId)
+	}
+	return filepath.Join(plansDir, planId)
+}
+
+func planDirShard(planId string) string {
+	sum := sha1.Sum([]byte(planId))
+	return hex.EncodeToString(sum[:])[:planDirShardLen]
+}
+
+// isPlanDirShard tells shard dirs apart from plan dirs in a plans dir. Plan ids are uuids, so
+// they're never this short.
+func isPlanDirShard(name string) bool {
+	if len(name) != planDirShardLen {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+type planDirEntry struct {
+	planId string
+	path   string
+	info   os.FileInfo
+}
+
+// readPlanDirs lists the plan dirs in plansDir that are laid out with layout. Dirs in another
+// layout are left out, so they're only picked up once RelayoutPlanDirs moves them.
+func (layout PlanDirLayout) readPlanDirs(plansDir string) ([]planDirEntry, error) {
+	entries, err := os.ReadDir(plansDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading plans dir: %v", err)
+	}
+
+	var res []planDirEntry
+
+	for _, entry := range entries {
+		if !entry.IsDir() || isPlanDirShard(entry.Name()) != (layout == PlanDirLayoutSharded) {
+			continue
+		}
+
+		if layout == PlanDirLayoutFlat {
+			info, err := entry.Info()
+			if err != nil {
+				return nil, fmt.Errorf("error getting info for plan dir %s: %v", entry.Name(), err)
+			}
+			res = append(res, planDirEntry{entry.Name(), filepath.Join(plansDir, entry.Name()), info})
+			continue
+		}
+
+		shardDir := filepath.Join(plansDir, entry.Name())
+		shardEntries, err := os.ReadDir(shardDir)
+		if err != nil {
+			return nil, fmt.Errorf("error reading plan dir shard %s: %v", entry.Name(), err)
+		}
+
+		for _, shardEntry := range shardEntries {
+			if !shardEntry.IsDir() {
+				continue
+			}
+			info, err := shardEntry.Info()
+			if err != nil {
+				return nil, fmt.Errorf("error getting info for plan dir %s: %v", shardEntry.Name(), err)
+			}
+			res = append(res, planDirEntry{shardEntry.Name(), filepath.Join(shardDir, shardEntry.Name()), info})
+		}
+	}
+
+	return res, nil
+}
+
+// RelayoutPlanDirs moves every org's plan dirs that aren't in the configured layout into it, so
+// switching PLANDEX_PLAN_DIR_LAYOUT doesn't strand existing plans. It's run on startup before
+// any requests are served, and does nothing once every dir is in place. A dir whose destination
+// already exists is left where it is and reported. Returns the number of dirs moved.
+func RelayoutPlanDirs() (int, error) {
+	return relayoutPlanDirs(planDirLayout)
+}
+
+func relayoutPlanDirs(layout PlanDirLayout) (int, error) {
+	orgsDir := filepath.Join(BaseDir, "orgs")
+
+	orgEntries, err := os.ReadDir(orgsDir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error reading orgs dir: %v", err)
+	}
+
+	from := PlanDirLayoutSharded
+	if layout == PlanDirLayoutSharded {
+		from = PlanDirLayoutFlat
+	}
+
+	moved := 0
+	var errs []error
+
+	for _, orgEntry := range orgEntries {
+		if !orgEntry.IsDir() {
+			continue
+		}
+		plansDir := getOrgPlansDir(orgEntry.Name())
+
+		dirs, err := from.readPlanDirs(plansDir)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, dir := range dirs {
+			dest := layout.planDir(plansDir, dir.planId)
+
+			ok, err := movePlanDir(dir.path, dest)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if !ok {
+				continue
+			}
+			moved++
+
+			// an emptied shard dir is removed so going back to flat leaves nothing behind. Remove
+			// fails if it isn't empty yet, which is expected.
+			if from == PlanDirLayoutSharded {
+				os.Remove(filepath.Dir(dir.path))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return moved, fmt.Errorf("error moving %d plan dirs into the %s layout: %v", len(errs), layout, errors.Join(errs...))
+	}
+
+	return moved, nil
+}
+
+// movePlanDir returns false if src was already gone, like when another host sharing the base
+// dir moved it first
+func movePlanDir(src, dest string) (bool, error) {
+	if _, err := os.Stat(dest); err == nil {
+		return false, fmt.Errorf("can't move plan dir %s, %s already exists", src, dest)
+	} else if !os.IsNotExist(err) {
+		return false, fmt.Errorf("error checking plan dir %s: %v", dest, err)
+	}
+
+	err := os.MkdirAll(filepath.Dir(dest), os.ModePerm)
+	if err != nil {
+		return false, fmt.Errorf("error creating plan dir parent %s: %v", filepath.Dir(dest), err)
+	}
+
+	err = os.Rename(src, dest)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error moving plan dir %s: %v", src, err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRelayoutPlanDirs(t *testing.T) {
+	origBaseDir := BaseDir
+	BaseDir = t.TempDir()
+	defer func() { BaseDir = origBaseDir }()
+
+	orgId := "org"
+	planIds := []string{
+		"3f2b8c1e-6a4d-4e2b-9c1a-0f5e6d7c8b9a",
+		"9a1c2e3f-4b5d-4c6e-8f70-1a2b3c4d5e6f",
+	}
+	plansDir := getOrgPlansDir(orgId)
+
+	for _, planId := range planIds {
+		dir := PlanDirLayoutFlat.planDir(plansDir, planId)
+		if err := os.MkdirAll(filepath.Join(dir, "context"), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	moved, err := relayoutPlanDirs(PlanDirLayoutSharded)
+	if err != nil || moved != 2 {
+		t.Fatalf("expected 2 dirs moved, got %d, %v", moved, err)
+	}
+
+	for _, planId := range planIds {
+		if _, err := os.Stat(filepath.Join(PlanDirLayoutSharded.planDir(plansDir, planId), "context")); err != nil {
+			t.Errorf("expected %s in the sharded layout: %v", planId, err)
+		}
+	}
+
+	dirs, err := PlanDirLayoutSharded.readPlanDirs(plansDir)
+	if err != nil || len(dirs) != 2 {
+		t.Errorf("expected 2 sharded plan dirs, got %v, %v", dirs, err)
+	}
+
+	// running again with everything in place is a no-op
+	moved, err = relayoutPlanDirs(PlanDirLayoutSharded)
+	if err != nil || moved != 0 {
+		t.Errorf("expected nothing moved, got %d, %v", moved, err)
+	}
+
+	moved, err = relayoutPlanDirs(PlanDirLayoutFlat)
+	if err != nil || moved != 2 {
+		t.Fatalf("expected 2 dirs moved back, got %d, %v", moved, err)
+	}
+
+	entries, err := os.ReadDir(plansDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("expected only the 2 plan dirs with shard dirs removed, got %d entries", len(entries))
+	}
+}
+
+func TestRelayoutPlanDirsLeavesConflicts(t *testing.T) {
+	origBaseDir := BaseDir
+	BaseDir = t.TempDir()
+	defer func() { BaseDir = origBaseDir }()
+
+	planId := "3f2b8c1e-6a4d-4e2b-9c1a-0f5e6d7c8b9a"
+	plansDir := getOrgPlansDir("org")
+
+	for _, layout := range []PlanDirLayout{PlanDirLayoutFlat, PlanDirLayoutSharded} {
+		if err := os.MkdirAll(layout.planDir(plansDir, planId), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	moved, err := relayoutPlanDirs(PlanDirLayoutSharded)
+	if err == nil || moved != 0 {
+		t.Errorf("expected a conflict error and nothing moved, got %d, %v", moved, err)
+	}
+
+	if _, err := os.Stat(PlanDirLayoutFlat.planDir(plansDir, planId)); err != nil {
+		t.Errorf("expected the conflicting dir to be left in place: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// WritePlanToArchive adds the plan's metadata as plan.json and its files, minus the git repo,
+// to tw under dir. Files are streamed, not read into memory. The caller must hold a read lock
+// on the plan.
+func WritePlanToArchive(tw *tar.Writer, plan *Plan, dir string) error {
+	meta, err := json.MarshalIndent(plan.ToApi(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling plan: %v", err)
+	}
+
+	err = WriteArchiveFile(tw, path.Join(dir, "plan.json"), meta, time.Now())
+	if err != nil {
+		return err
+	}
+
+	planDir := getPlanDir(plan.OrgId, plan.Id)
+
+	return filepath.WalkDir(planDir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("error walking plan dir: %v", err)
+		}
+
+		if entry.IsDir() {
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(planDir, filePath)
+		if err != nil {
+			return fmt.Errorf("error getting relative path: %v", err)
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("error getting file info: %v", err)
+		}
+
+		err = tw.WriteHeader(&tar.Header{
+			Name:    path.Join(dir, filepath.ToSlash(rel)),
+			Mode:    0644,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		if err != nil {
+			return fmt.Errorf("error writing archive header: %v", err)
+		}
+
+		f, err := os.Open(filePath)
+		if err != nil {
+			return fmt.Errorf("error opening plan file: %v", err)
+		}
+		defer f.Close()
+
+		// the header has the size from stat, so copy exactly that much
+		_, err = io.CopyN(tw, f, info.Size())
+		if err != nil {
+			return fmt.Errorf("error writing plan file %s to archive: %v", rel, err)
+		}
+
+		return nil
+	})
+}
+
+func WriteArchiveFile(tw *tar.Writer, name string, body []byte, modTime time.Time) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(body)),
+		ModTime: modTime,
+	})
+	if err != nil {
+		return fmt.Errorf("error writing archive header: %v", err)
+	}
+
+	_, err = tw.Write(body)
+	if err != nil {
+		return fmt.Errorf("error writing %s to archive: %v", name, err)
+	}
+
+	return nil
+}
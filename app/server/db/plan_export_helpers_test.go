@@ -0,0 +1,76 @@
+package db
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestWritePlanToArchive(t *testing.T) {
+	origBaseDir := BaseDir
+	BaseDir = t.TempDir()
+	defer func() { BaseDir = origBaseDir }()
+
+	plan := &Plan{Id: "plan", OrgId: "org", Name: "plan"}
+
+	err := InitPlan(plan.OrgId, plan.Id)
+	if err != nil {
+		t.Fatalf("error initializing plan: %v", err)
+	}
+
+	err = InitGitRepo(plan.OrgId, plan.Id)
+	if err != nil {
+		t.Fatalf("error initializing git repo: %v", err)
+	}
+
+	err = StoreContext(&Context{Id: "ctx", OrgId: plan.OrgId, PlanId: plan.Id, Body: "body"})
+	if err != nil {
+		t.Fatalf("error storing context: %v", err)
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+
+	err = WritePlanToArchive(tw, plan, "export/plan")
+	if err != nil {
+		t.Fatalf("error writing archive: %v", err)
+	}
+
+	err = tw.Close()
+	if err != nil {
+		t.Fatalf("error closing archive: %v", err)
+	}
+
+	files := map[string]string{}
+	tr := tar.NewReader(&buf)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("error reading archive: %v", err)
+		}
+
+		body, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("error reading archive file: %v", err)
+		}
+		files[header.Name] = string(body)
+	}
+
+	if files["export/plan/context/ctx.body"] != "body" {
+		t.Errorf("expected context body in archive, got %v", files)
+	}
+
+	if _, ok := files["export/plan/plan.json"]; !ok {
+		t.Errorf("expected plan.json in archive")
+	}
+
+	for name := range files {
+		if bytes.Contains([]byte(name), []byte("/.git/")) {
+			t.Errorf("git repo shouldn't be archived, found %s", name)
+		}
+	}
+}
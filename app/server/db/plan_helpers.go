@@ -3,10 +3,12 @@ package db
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,6 +17,25 @@ import (
 	"github.com/sashabaranov/go-openai"
 )
 
+var ErrPlanIdExists = errors.New("plan id already in use")
+
+var ErrExternalKeyExists = errors.New("a plan with this external key already exists in the project")
+
+// ErrDraftExists is a violation of plans_one_draft_idx, from a concurrent draft creation or
+// unarchiving a draft when there's already another one
+var ErrDraftExists = errors.New("an unarchived draft plan already exists")
+
+// ErrPlanNameTaken is a violation of one of the plan name indexes, from another plan being
+// created with the same name since it was checked
+var ErrPlanNameTaken = errors.New("plan name already taken")
+
+var planNameIndexes = []string{
+	"plans_name_unique_idx",
+	"plans_name_case_insensitive_idx",
+	"plans_name_project_scoped_idx",
+	"plans_name_project_scoped_case_insensitive_idx",
+}
+
 func CreatePlan(orgId, projectId, userId, name string) (*Plan, error) {
 	// start a transaction
 	tx, err := Conn.Begin()
@@ -33,9 +54,40 @@ func CreatePlan(orgId, projectId, userId, name string) (*Plan, error) {
 		}
 	}()
 
-	query := `INSERT INTO plans (org_id, owner_id, project_id, name) 
-	VALUES ($1, $2, $3, $4)
-	RETURNING id, created_at, updated_at`
+	plan, err := CreatePlanTx(tx, orgId, projectId, userId, "", name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// commit the transaction
+	err = CommitCreatedPlan(tx, plan, PlanCreation{ActorId: userId})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// CreatePlanTx inserts the plan and its main branch, bumps the owner's non-draft plan count for
+// named plans, and initializes the plan dir, all as part of tx. Finish with CommitCreatedPlan,
+// or remove the dir with DeletePlanDir if tx is rolled back after this returns successfully.
+// planId is optional and must already be validated as a uuid; ErrPlanIdExists is returned if
+// it's taken.
+func CreatePlanTx(tx *sql.Tx, orgId, projectId, userId, planId, name string) (*Plan, error) {
+	// a leftover dir for a caller-chosen id would otherwise be picked up by the new plan
+	if planId != "" {
+		if _, err := os.Stat(getPlanDir(orgId, planId)); err == nil {
+			return nil, ErrPlanIdExists
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error checking plan dir: %v", err)
+		}
+	}
+
+	query := `INSERT INTO plans (id, org_id, owner_id, project_id, name, case_insensitive_name, project_scoped_name) 
+	VALUES (COALESCE(NULLIF($5, '')::uuid, uuid_generate_v4()), $1, $2, $3, $4, (SELECT case_insensitive_plan_names FROM orgs WHERE id = $1), (SELECT project_scoped_plan_names FROM orgs WHERE id = $1))
+	RETURNING id, case_insensitive_name, project_scoped_name, created_at, updated_at`
 
 	plan := &Plan{
 		OrgId:     orgId,
@@ -44,18 +96,35 @@ func CreatePlan(orgId, projectId, userId, name string) (*Plan, error) {
 		Name:      name,
 	}
 
-	err = tx.QueryRow(
+	err := tx.QueryRow(
 		query,
 		orgId,
 		userId,
 		projectId,
 		name,
+		planId,
 	).Scan(
 		&plan.Id,
+		&plan.CaseInsensitiveName,
+		&plan.ProjectScopedName,
 		&plan.CreatedAt,
 		&plan.UpdatedAt,
 	)
 
+	if IsNonUniqueErrOn(err, "plans_pkey") {
+		return nil, ErrPlanIdExists
+	}
+
+	if IsNonUniqueErrOn(err, "plans_one_draft_idx") {
+		return nil, ErrDraftExists
+	}
+
+	for _, index := range planNameIndexes {
+		if IsNonUniqueErrOn(err, index) {
+			return nil, ErrPlanNameTaken
+		}
+	}
+
 	if err != nil {
 		return nil, fmt.Errorf("error creating plan: %v", err)
 	}
@@ -68,23 +137,99 @@ func CreatePlan(orgId, projectId, userId, name string) (*Plan, error) {
 
 	log.Println("Created branch main")
 
+	if name != "draft" {
+		err = IncNumNonDraftPlans(userId, tx)
+
+		if err != nil {
+			return nil, fmt.Errorf("error incrementing num non draft plans: %v", err)
+		}
+	}
+
+	// the dir is created last so that none of the db steps above can leave it orphaned
 	err = InitPlan(orgId, plan.Id)
 
 	if err != nil {
+		if rmErr := DeletePlanDir(orgId, plan.Id); rmErr != nil {
+			log.Printf("Error removing partially initialized plan dir: %v\n", rmErr)
+		}
 		return nil, fmt.Errorf("error initializing plan dir: %v", err)
 	}
 
 	log.Println("Initialized plan dir")
 
-	// commit the transaction
-	if err := tx.Commit(); err != nil {
-		return nil, fmt.Errorf("error committing transaction: %v", err)
+	return plan, nil
+}
+
+// SetPlanExternalKeyTx stores a new plan's external key as part of the tx that creates it.
+// Returns ErrExternalKeyExists if another plan in the project has it.
+func SetPlanExternalKeyTx(tx *sql.Tx, plan *Plan, externalKey string) error {
+	_, err := tx.Exec("UPDATE plans SET external_key = $1 WHERE id = $2", externalKey, plan.Id)
+
+	if IsNonUniqueErrOn(err, "plans_external_key_idx") {
+		return ErrExternalKeyExists
 	}
 
-	return plan, nil
+	if err != nil {
+		return fmt.Errorf("error setting plan external key: %v", err)
+	}
+
+	plan.ExternalKey = &externalKey
+
+	return nil
 }
 
-func ListOwnedPlans(projectIds []string, userId string, archived bool) ([]*Plan, error) {
+// GetPlanByExternalKey returns nil if no plan in the project has the key
+func GetPlanByExternalKey(projectId, externalKey string) (*Plan, error) {
+	var plan Plan
+
+	err := Conn.Get(&plan, "SELECT * FROM plans WHERE project_id = $1 AND external_key = $2", projectId, externalKey)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting plan by external key: %v", err)
+	}
+
+	return &plan, nil
+}
+
+// PlanCreation is who created a plan and why, for the created event
+type PlanCreation struct {
+	ActorId     string
+	ExternalKey string
+}
+
+// CommitCreatedPlan queues the created event for the org's audit webhook, commits a tx used with
+// CreatePlanTx, and publishes the created event. If either step fails, the plan dir is removed
+// and the caller should roll back tx.
+func CommitCreatedPlan(tx *sql.Tx, plan *Plan, creation PlanCreation) error {
+	event := planCreatedEvent(plan, creation)
+
+	// queued in the same tx so the audit log gets every plan that's created, and only those
+	err := queueAuditEventTx(tx, event)
+
+	if err == nil {
+		err = tx.Commit()
+		if err != nil {
+			err = fmt.Errorf("error committing transaction: %v", err)
+		}
+	}
+
+	if err != nil {
+		if rmErr := DeletePlanDir(plan.OrgId, plan.Id); rmErr != nil {
+			log.Printf("Error removing plan dir after failed commit: %v\n", rmErr)
+		}
+		return err
+	}
+
+	PublishPlanEvent(event)
+
+	return nil
+}
+
+func ListOwnedPlans(projectIds []string, userId string, archived bool, sort PlanSort) ([]*Plan, error) {
 	qs := "SELECT * FROM plans WHERE project_id = ANY($1) AND owner_id = $2"
 	qargs := []interface{}{pq.Array(projectIds), userId}
 
@@ -94,7 +239,7 @@ func ListOwnedPlans(projectIds []string, userId string, archived bool) ([]*Plan,
 		qs += " AND archived_at IS NULL"
 	}
 
-	qs += " ORDER BY updated_at DESC"
+	qs += sort.orderBy()
 
 	var plans []*Plan
 	err := Conn.Select(&plans, qs, qargs...)
@@ -106,8 +251,95 @@ func ListOwnedPlans(projectIds []string, userId string, archived bool) ([]*Plan,
 	return plans, nil
 }
 
-func AddPlanContextTokens(planId, branch string, addTokens int) error {
-	_, err := Conn.Exec("UPDATE branches SET context_tokens = context_tokens + $1 WHERE plan_id = $2 AND name = $3", addTokens, planId, branch)
+// ListPlansForOwners is like ListOwnedPlans for several owners at once
+func ListPlansForOwners(projectIds, ownerIds []string, archived bool, sort PlanSort) ([]*Plan, error) {
+	qs := "SELECT * FROM plans WHERE project_id = ANY($1) AND owner_id = ANY($2)"
+
+	if archived {
+		qs += " AND archived_at IS NOT NULL"
+	} else {
+		qs += " AND archived_at IS NULL"
+	}
+
+	qs += sort.orderBy()
+
+	var plans []*Plan
+	err := Conn.Select(&plans, qs, pq.Array(projectIds), pq.Array(ownerIds))
+
+	if err != nil {
+		return nil, fmt.Errorf("error listing plans: %v", err)
+	}
+
+	return plans, nil
+}
+
+// ListAllPlans is like ListOwnedPlans but includes plans from every owner
+func ListAllPlans(projectIds []string, archived bool, sort PlanSort) ([]*Plan, error) {
+	qs := "SELECT * FROM plans WHERE project_id = ANY($1)"
+
+	if archived {
+		qs += " AND archived_at IS NOT NULL"
+	} else {
+		qs += " AND archived_at IS NULL"
+	}
+
+	qs += sort.orderBy()
+
+	var plans []*Plan
+	err := Conn.Select(&plans, qs, pq.Array(projectIds))
+
+	if err != nil {
+		return nil, fmt.Errorf("error listing plans: %v", err)
+	}
+
+	return plans, nil
+}
+
+// ListRecentOrgPlans returns up to limit named plans created in the org since the given time,
+// newest first, and whether there are more. Unless includeUnshared is set, only plans owned by
+// userId or shared with the org are included. beforeId continues from the last plan of a
+// previous page.
+func ListRecentOrgPlans(orgId, userId string, includeUnshared bool, since time.Time, beforeId string, limit int) ([]*Plan, bool, error) {
+	qs := "SELECT * FROM plans WHERE org_id = $1 AND created_at >= $2 AND name != 'draft'"
+	qargs := []interface{}{orgId, since}
+
+	if !includeUnshared {
+		qargs = append(qargs, userId)
+		qs += fmt.Sprintf(" AND (owner_id = $%d OR shared_with_org_at IS NOT NULL)", len(qargs))
+	}
+
+	if beforeId != "" {
+		qargs = append(qargs, beforeId)
+		n := len(qargs)
+		qs += fmt.Sprintf(" AND (created_at, id) < (SELECT created_at, id FROM plans WHERE id = $%d)", n)
+	}
+
+	qs += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT %d", limit+1)
+
+	var plans []*Plan
+	err := Conn.Select(&plans, qs, qargs...)
+
+	if err != nil {
+		return nil, false, fmt.Errorf("error listing recent plans: %v", err)
+	}
+
+	if len(plans) > limit {
+		return plans[:limit], true, nil
+	}
+
+	return plans, false, nil
+}
+
+// AddPlanContextTokens also refreshes the branch's context file count and size from disk, since
+// every path that changes a branch's context goes through here or SyncPlanTokens. The caller
+// must hold a write lock on the branch.
+func AddPlanContextTokens(orgId, planId, branch string, addTokens int) error {
+	files, bytes, err := getContextDirStats(getPlanContextDir(orgId, planId))
+	if err != nil {
+		return err
+	}
+
+	_, err = Conn.Exec("UPDATE branches SET context_tokens = context_tokens + $1, context_files = $2, context_bytes = $3 WHERE plan_id = $4 AND name = $5", addTokens, files, bytes, planId, branch)
 	if err != nil {
 		return fmt.Errorf("error updating plan tokens: %v", err)
 	}
@@ -136,8 +368,11 @@ func AddPlanConvoMessage(msg *ConvoMessage, branch string) error {
 		_, err := Conn.Exec("UPDATE plans SET total_replies = total_replies + 1 WHERE id = $1", msg.PlanId)
 		if err != nil {
 			errCh <- fmt.Errorf("error updating plan total replies: %v", err)
+			return
 		}
 
+		InvalidatePlanCache(msg.PlanId)
+
 		errCh <- nil
 	}()
 
@@ -185,7 +420,12 @@ func SyncPlanTokens(orgId, planId, branch string) error {
 		convoTokens += msg.Tokens
 	}
 
-	_, err := Conn.Exec("UPDATE branches SET context_tokens = $1, convo_tokens = $2 WHERE plan_id = $3 AND name = $4", contextTokens, convoTokens, planId, branch)
+	files, bytes, err := getContextDirStats(getPlanContextDir(orgId, planId))
+	if err != nil {
+		return err
+	}
+
+	_, err = Conn.Exec("UPDATE branches SET context_tokens = $1, convo_tokens = $2, context_files = $3, context_bytes = $4 WHERE plan_id = $5 AND name = $6", contextTokens, convoTokens, files, bytes, planId, branch)
 
 	if err != nil {
 		return fmt.Errorf("error updating plan tokens: %v", err)
@@ -200,7 +440,7 @@ func GetPlan(planId string) (*Plan, error) {
 	err := Conn.Get(&plan, "SELECT * FROM plans WHERE id = $1", planId)
 
 	if err != nil {
-		return nil, fmt.Errorf("error getting plan: %v", err)
+		return nil, fmt.Errorf("error getting plan: %w", err)
 	}
 
 	return &plan, nil
@@ -213,9 +453,31 @@ func SetPlanStatus(planId, branch string, status shared.PlanStatus, errStr strin
 		return fmt.Errorf("error setting plan status: %v", err)
 	}
 
+	// avoid the extra query when nobody is listening
+	if hasPlanEventSubscribers() {
+		plan, err := GetPlan(planId)
+		if err != nil {
+			log.Printf("Error getting plan for status event: %v\n", err)
+			return nil
+		}
+
+		PublishPlanEvent(&shared.PlanEvent{
+			Type:      shared.PlanEventStatus,
+			OrgId:     plan.OrgId,
+			ProjectId: plan.ProjectId,
+			PlanId:    plan.Id,
+			OwnerId:   plan.OwnerId,
+			Name:      plan.Name,
+			Branch:    branch,
+			Status:    status,
+			Error:     errStr,
+		})
+	}
+
 	return nil
 }
 
+// call InvalidatePlanCache after tx commits
 func RenamePlan(planId string, name string, tx *sql.Tx) error {
 	_, err := tx.Exec("UPDATE plans SET name = $1 WHERE id = $2", name, planId)
 
@@ -226,6 +488,46 @@ func RenamePlan(planId string, name string, tx *sql.Tx) error {
 	return nil
 }
 
+// LockPlanForUpdate locks the plan row until tx is committed or rolled back and returns its updated_at
+func LockPlanForUpdate(planId string, tx *sql.Tx) (time.Time, error) {
+	var updatedAt time.Time
+	err := tx.QueryRow("SELECT updated_at FROM plans WHERE id = $1 FOR UPDATE", planId).Scan(&updatedAt)
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error locking plan: %w", err)
+	}
+
+	return updatedAt, nil
+}
+
+// UpdatePlan only updates the columns present in updates. Call InvalidatePlanCache after tx commits.
+func UpdatePlan(planId string, updates map[string]interface{}, tx *sql.Tx) error {
+	if len(updates) == 0 {
+		return nil
+	}
+
+	var sets []string
+	var args []interface{}
+	i := 1
+	for col, val := range updates {
+		sets = append(sets, fmt.Sprintf("%s = $%d", col, i))
+		args = append(args, val)
+		i++
+	}
+	args = append(args, planId)
+
+	query := fmt.Sprintf("UPDATE plans SET %s WHERE id = $%d", strings.Join(sets, ", "), i)
+
+	_, err := tx.Exec(query, args...)
+
+	if err != nil {
+		return fmt.Errorf("error updating plan: %v", err)
+	}
+
+	return nil
+}
+
+// call InvalidatePlanCache after tx commits
 func IncActiveBranches(planId string, inc int, tx *sql.Tx) error {
 	_, err := tx.Exec("UPDATE plans SET active_branches = active_branches + $1 WHERE id = $2", inc, planId)
 
@@ -278,8 +580,58 @@ func StoreDescription(description *ConvoMessageDescription) error {
 	return nil
 }
 
+// CountPlansInProject counts the project's named plans, archived ones included. Drafts aren't
+// counted since they're replaced whenever a new one is created. Pass tx to count as part of a
+// transaction that holds LockProjectPlanCreationTx.
+func CountPlansInProject(projectId string, tx *sql.Tx) (int, error) {
+	query := "SELECT COUNT(*) FROM plans WHERE project_id = $1 AND name != 'draft'"
+
+	var count int
+	var err error
+	if tx == nil {
+		err = Conn.QueryRow(query, projectId).Scan(&count)
+	} else {
+		err = tx.QueryRow(query, projectId).Scan(&count)
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("error counting plans in project: %v", err)
+	}
+
+	return count, nil
+}
+
+// GetFirstPlanInProject returns the project's oldest named plan, or nil if it has none
+func GetFirstPlanInProject(projectId string) (*Plan, error) {
+	var plan Plan
+	err := Conn.Get(&plan, "SELECT * FROM plans WHERE project_id = $1 AND name != 'draft' ORDER BY created_at, id LIMIT 1", projectId)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting first plan in project: %v", err)
+	}
+
+	return &plan, nil
+}
+
+// LockProjectPlanCreationTx serializes conditional plan creation in a project until tx ends, so
+// two callers can't both see an empty project and create a plan. Creates that don't check the
+// project first don't take the lock.
+func LockProjectPlanCreationTx(tx *sql.Tx, projectId string) error {
+	_, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('create_plan:' || $1))", projectId)
+
+	if err != nil {
+		return fmt.Errorf("error locking project for plan creation: %v", err)
+	}
+
+	return nil
+}
+
 func DeleteDraftPlans(orgId, projectId, userId string) error {
-	res, err := Conn.Query("DELETE FROM plans WHERE project_id = $1 AND owner_id = $2 AND name = 'draft' RETURNING id;", projectId, userId)
+	res, err := Conn.Query("DELETE FROM plans WHERE project_id = $1 AND owner_id = $2 AND name = 'draft' RETURNING id, name;", projectId, userId)
 	if err != nil {
 		return fmt.Errorf("error deleting draft plans: %v", err)
 	}
@@ -288,28 +640,31 @@ func DeleteDraftPlans(orgId, projectId, userId string) error {
 
 	// get ids
 	var ids []string
+	var deleted []*Plan
 
 	for res.Next() {
-		var id string
-		err := res.Scan(&id)
+		plan := &Plan{OrgId: orgId, ProjectId: projectId, OwnerId: userId}
+		err := res.Scan(&plan.Id, &plan.Name)
 		if err != nil {
 			return fmt.Errorf("error scanning deleted draft plan id: %v", err)
 		}
-		ids = append(ids, id)
+		ids = append(ids, plan.Id)
+		deleted = append(deleted, plan)
 	}
 
-	errCh := make(chan error)
-	for _, planId := range ids {
-		go func(planId string) {
-			errCh <- DeletePlanDir(orgId, planId)
-		}(planId)
+	if err = res.Err(); err != nil {
+		return fmt.Errorf("error iterating deleted draft plan ids: %v", err)
 	}
 
-	for i := 0; i < len(ids); i++ {
-		err := <-errCh
-		if err != nil {
-			return fmt.Errorf("error deleting draft plan dir: %v", err)
-		}
+	InvalidatePlanCache(ids...)
+
+	err = DeletePlanDirs(orgId, ids)
+	if err != nil {
+		return fmt.Errorf("error deleting draft plan dirs: %v", err)
+	}
+
+	for _, plan := range deleted {
+		PublishPlanDeleted(plan)
 	}
 
 	if len(ids) > 0 {
@@ -319,45 +674,142 @@ func DeleteDraftPlans(orgId, projectId, userId string) error {
 	return nil
 }
 
-func DeleteOwnerPlans(orgId, projectId, userId string) error {
-	res, err := Conn.Query("DELETE FROM plans WHERE project_id = $1 AND owner_id = $2 RETURNING id;", projectId, userId)
+// NormalizeDrafts archives all but the most recently updated unarchived draft for each project
+// and owner in the org. plans_one_draft_idx keeps new duplicates from being created, so this is
+// only needed to repair plans from before it. It returns the archived plans.
+func NormalizeDrafts(orgId string) ([]*Plan, error) {
+	var plans []*Plan
+	err := Conn.Select(&plans, `
+		UPDATE plans SET archived_at = NOW()
+		WHERE id IN (
+			SELECT id FROM (
+				SELECT id, ROW_NUMBER() OVER (PARTITION BY project_id, owner_id ORDER BY updated_at DESC, created_at DESC) AS rn
+				FROM plans
+				WHERE org_id = $1 AND name = 'draft' AND archived_at IS NULL
+			) ranked
+			WHERE rn > 1
+		)
+		RETURNING *`, orgId)
+
 	if err != nil {
-		return fmt.Errorf("error deleting plans: %v", err)
+		return nil, fmt.Errorf("error normalizing draft plans: %v", err)
 	}
 
-	defer res.Close()
+	var ids []string
+	for _, plan := range plans {
+		ids = append(ids, plan.Id)
+	}
+
+	InvalidatePlanCache(ids...)
+
+	for _, plan := range plans {
+		PublishPlanArchived(plan)
+	}
+
+	if len(plans) > 0 {
+		log.Println("Archived", len(plans), "duplicate draft plans")
+	}
+
+	return plans, nil
+}
+
+// ListOwnerPlansToDelete returns the plans DeleteOwnerPlans would delete
+func ListOwnerPlansToDelete(projectId, userId string) ([]*Plan, error) {
+	var plans []*Plan
+	err := Conn.Select(&plans, "SELECT * FROM plans WHERE project_id = $1 AND owner_id = $2 ORDER BY created_at", projectId, userId)
+
+	if err != nil {
+		return nil, fmt.Errorf("error listing plans: %v", err)
+	}
+
+	return plans, nil
+}
+
+// DeleteOwnerPlans deletes the owner's plans in the project the same way a single plan is
+// deleted: dirs are moved to the trash first and put back if deleting the rows fails, tombstones
+// are recorded, and once the rows are gone the trash is purged. A failed purge only leaves dirs
+// in the trash, so it's logged and the deleted ids are still returned.
+func DeleteOwnerPlans(orgId, projectId, userId string) ([]string, error) {
+	tx, err := Conn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+
+	var trashPaths map[string]string
+
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Printf("transaction rollback error: %v\n", rbErr)
+			}
+			RestoreTrashedPlanDirs(orgId, trashPaths)
+		}
+	}()
+
+	// lock the rows so the dirs moved to the trash are exactly the ones deleted
+	rows, err := tx.Query("SELECT id, name FROM plans WHERE project_id = $1 AND owner_id = $2 FOR UPDATE", projectId, userId)
+	if err != nil {
+		return nil, fmt.Errorf("error getting plans to delete: %v", err)
+	}
 
-	// get ids
 	var ids []string
+	var deleted []*Plan
 
-	for res.Next() {
-		var id string
-		err := res.Scan(&id)
+	for rows.Next() {
+		plan := &Plan{OrgId: orgId, ProjectId: projectId, OwnerId: userId}
+		err = rows.Scan(&plan.Id, &plan.Name)
 		if err != nil {
-			return fmt.Errorf("error scanning deleted draft plan id: %v", err)
+			rows.Close()
+			return nil, fmt.Errorf("error scanning plan to delete: %v", err)
 		}
-		ids = append(ids, id)
+		ids = append(ids, plan.Id)
+		deleted = append(deleted, plan)
 	}
 
-	errCh := make(chan error)
-	for _, planId := range ids {
-		go func(planId string) {
-			errCh <- DeletePlanDir(orgId, planId)
-		}(planId)
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating plans to delete: %v", err)
 	}
 
-	for i := 0; i < len(ids); i++ {
-		err := <-errCh
+	if len(ids) == 0 {
+		err = tx.Rollback()
 		if err != nil {
-			return fmt.Errorf("error deleting plan dir: %v", err)
+			return nil, fmt.Errorf("error rolling back transaction: %v", err)
 		}
+		return nil, nil
 	}
 
-	if len(ids) > 0 {
-		log.Println("Deleted", len(ids), "plans")
+	trashPaths, err = TrashPlanDirs(orgId, ids)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	_, err = tx.Exec("DELETE FROM plans WHERE id = ANY($1)", pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("error deleting plans: %v", err)
+	}
+
+	err = recordPlanTombstonesTx(tx, orgId, userId, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("error committing transaction: %v", err)
+	}
+
+	InvalidatePlanCache(ids...)
+
+	for _, plan := range deleted {
+		PublishPlanDeleted(plan)
+	}
+
+	PurgeTrashedPlanDirs(trashPaths)
+
+	log.Println("Deleted", len(ids), "plans")
+
+	return ids, nil
 }
 
 func ValidatePlanAccess(planId, userId, orgId string) (*Plan, error) {
@@ -365,9 +817,25 @@ func ValidatePlanAccess(planId, userId, orgId string) (*Plan, error) {
 	plan, err := GetPlan(planId)
 
 	if err != nil {
-		return nil, fmt.Errorf("error getting plan: %v", err)
+		return nil, fmt.Errorf("error getting plan: %w", err)
 	}
 
+	return validatePlanAccess(plan, userId, orgId)
+}
+
+// ValidatePlanAccessCached is ValidatePlanAccess with the plan read through the plan cache.
+// Only use it for read-only requests.
+func ValidatePlanAccessCached(planId, userId, orgId string) (*Plan, error) {
+	plan, err := GetPlanCached(planId)
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting plan: %w", err)
+	}
+
+	return validatePlanAccess(plan, userId, orgId)
+}
+
+func validatePlanAccess(plan *Plan, userId, orgId string) (*Plan, error) {
 	if plan == nil {
 		return nil, nil
 	}
@@ -376,7 +844,7 @@ func ValidatePlanAccess(planId, userId, orgId string) (*Plan, error) {
 		return nil, nil
 	}
 
-	hasProjectAccess, err := ProjectExists(orgId, plan.ProjectId)
+	hasProjectAccess, err := ProjectExistsCached(orgId, plan.ProjectId)
 
 	if err != nil {
 		return nil, fmt.Errorf("error validating project membership: %v", err)
@@ -386,17 +854,74 @@ func ValidatePlanAccess(planId, userId, orgId string) (*Plan, error) {
 		return nil, nil
 	}
 
+	if CanUserViewPlan(plan, userId) {
+		return plan, nil
+	}
+
+	return nil, nil
+}
+
+// CanUserViewPlan is the visibility part of ValidatePlanAccess, for callers that already have
+// the plan and have checked its org and project
+func CanUserViewPlan(plan *Plan, userId string) bool {
 	// owner has access
 	if plan.OwnerId == userId {
-		return plan, nil
+		return true
 	}
 
 	// plan is shared with org
-	if plan.SharedWithOrgAt != nil {
-		return plan, nil
+	return plan.SharedWithOrgAt != nil
+}
+
+func SharePlanWithOrg(planId string) error {
+	_, err := Conn.Exec("UPDATE plans SET shared_with_org_at = NOW() WHERE id = $1 AND shared_with_org_at IS NULL", planId)
+
+	if err != nil {
+		return fmt.Errorf("error sharing plan with org: %v", err)
 	}
 
-	return nil, nil
+	InvalidatePlanCache(planId)
+
+	return nil
+}
+
+func SetPlanWorkingBranch(planId, branch string) error {
+	_, err := Conn.Exec("UPDATE plans SET working_branch = $1 WHERE id = $2", branch, planId)
+
+	if err != nil {
+		return fmt.Errorf("error setting plan working branch: %v", err)
+	}
+
+	InvalidatePlanCache(planId)
+
+	return nil
+}
+
+func SetPlanTags(planId string, tags []string) error {
+	_, err := Conn.Exec("UPDATE plans SET tags = $1 WHERE id = $2", pq.StringArray(tags), planId)
+
+	if err != nil {
+		return fmt.Errorf("error setting plan tags: %v", err)
+	}
+
+	InvalidatePlanCache(planId)
+
+	return nil
+}
+
+// TouchPlan sets updated_at to now and returns the stored value. The modtime trigger sets
+// updated_at on every update, so it's read back rather than passed in.
+func TouchPlan(planId string) (time.Time, error) {
+	var updatedAt time.Time
+	err := Conn.QueryRow("UPDATE plans SET updated_at = NOW() WHERE id = $1 RETURNING updated_at", planId).Scan(&updatedAt)
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error touching plan: %v", err)
+	}
+
+	InvalidatePlanCache(planId)
+
+	return updatedAt, nil
 }
 
 func BumpPlanUpdatedAt(planId string, t time.Time) error {
@@ -406,5 +931,7 @@ func BumpPlanUpdatedAt(planId string, t time.Time) error {
 		return fmt.Errorf("error updating plan updated at: %v", err)
 	}
 
+	InvalidatePlanCache(planId)
+
 	return nil
 }
@@ -0,0 +1,393 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// fakeCreatePlanDriver answers just enough of the queries in CreatePlanTx to run it without
+// postgres. Statements containing failOn return an error. With names set, plan names are unique
+// like with plans_name_unique_idx, and each plan gets its own id.
+type fakeCreatePlanDriver struct {
+	mu         sync.Mutex
+	failOn     string
+	failCommit bool
+	rolledBack bool
+	committed  bool
+	names      map[string]bool
+	numPlans   int
+}
+
+func (d *fakeCreatePlanDriver) Open(name string) (driver.Conn, error) {
+	return &fakeCreatePlanConn{d: d}, nil
+}
+
+type fakeCreatePlanConn struct {
+	d *fakeCreatePlanDriver
+}
+
+func (c *fakeCreatePlanConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeCreatePlanStmt{d: c.d, query: query}, nil
+}
+
+func (c *fakeCreatePlanConn) Close() error { return nil }
+
+func (c *fakeCreatePlanConn) Begin() (driver.Tx, error) {
+	return &fakeCreatePlanTx{d: c.d}, nil
+}
+
+type fakeCreatePlanTx struct {
+	d *fakeCreatePlanDriver
+}
+
+func (t *fakeCreatePlanTx) Commit() error {
+	t.d.mu.Lock()
+	defer t.d.mu.Unlock()
+	if t.d.failCommit {
+		return errors.New("commit failed")
+	}
+	t.d.committed = true
+	return nil
+}
+
+func (t *fakeCreatePlanTx) Rollback() error {
+	t.d.mu.Lock()
+	defer t.d.mu.Unlock()
+	t.d.rolledBack = true
+	return nil
+}
+
+type fakeCreatePlanStmt struct {
+	d     *fakeCreatePlanDriver
+	query string
+}
+
+func (s *fakeCreatePlanStmt) Close() error  { return nil }
+func (s *fakeCreatePlanStmt) NumInput() int { return -1 }
+
+func (s *fakeCreatePlanStmt) fail() error {
+	if s.d.failOn != "" && strings.Contains(s.query, s.d.failOn) {
+		return errors.New("query failed: " + s.d.failOn)
+	}
+	return nil
+}
+
+func (s *fakeCreatePlanStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if err := s.fail(); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeCreatePlanStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if err := s.fail(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	if s.d.names != nil && strings.Contains(s.query, "SELECT name FROM plans") {
+		s.d.mu.Lock()
+		defer s.d.mu.Unlock()
+
+		rows := &fakePlanNameRows{}
+		for name := range s.d.names {
+			rows.names = append(rows.names, name)
+		}
+		return rows, nil
+	}
+
+	if strings.Contains(s.query, "INSERT INTO plans") {
+		id := "plan-id"
+
+		if s.d.names != nil {
+			s.d.mu.Lock()
+			defer s.d.mu.Unlock()
+
+			name := args[3].(string)
+			if s.d.names[name] {
+				return nil, &pq.Error{Code: "23505", Constraint: "plans_name_unique_idx"}
+			}
+			s.d.names[name] = true
+			s.d.numPlans++
+			id = fmt.Sprintf("plan-id-%d", s.d.numPlans)
+		}
+
+		return &fakeCreatePlanRows{
+			cols: []string{"id", "case_insensitive_name", "project_scoped_name", "created_at", "updated_at"},
+			vals: []driver.Value{id, false, false, now, now},
+		}, nil
+	}
+
+	return &fakeCreatePlanRows{
+		cols: []string{"id", "created_at", "updated_at"},
+		vals: []driver.Value{"branch-id", now, now},
+	}, nil
+}
+
+type fakeCreatePlanRows struct {
+	cols []string
+	vals []driver.Value
+	done bool
+}
+
+func (r *fakeCreatePlanRows) Columns() []string { return r.cols }
+func (r *fakeCreatePlanRows) Close() error      { return nil }
+
+func (r *fakeCreatePlanRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	copy(dest, r.vals)
+	return nil
+}
+
+type fakePlanNameRows struct {
+	names []string
+}
+
+func (r *fakePlanNameRows) Columns() []string { return []string{"name"} }
+func (r *fakePlanNameRows) Close() error      { return nil }
+
+func (r *fakePlanNameRows) Next(dest []driver.Value) error {
+	if len(r.names) == 0 {
+		return io.EOF
+	}
+	dest[0] = r.names[0]
+	r.names = r.names[1:]
+	return nil
+}
+
+func openFakeCreatePlanDb(t *testing.T, d *fakeCreatePlanDriver) *sql.DB {
+	name := "fake-create-plan-" + t.Name()
+	sql.Register(name, d)
+
+	sqlDb, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatalf("error opening fake db: %v", err)
+	}
+	t.Cleanup(func() { sqlDb.Close() })
+
+	return sqlDb
+}
+
+func createPlanWithFakeDb(t *testing.T, d *fakeCreatePlanDriver, name string) error {
+	sqlDb := openFakeCreatePlanDb(t, d)
+
+	tx, err := sqlDb.Begin()
+	if err != nil {
+		t.Fatalf("error starting transaction: %v", err)
+	}
+
+	plan, err := CreatePlanTx(tx, "org", "project", "user", "", name)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// like callers, roll back if committing fails
+	err = CommitCreatedPlan(tx, plan, PlanCreation{ActorId: "user"})
+	if err != nil {
+		tx.Rollback()
+	}
+
+	return err
+}
+
+func TestCreatePlanTxRollsBack(t *testing.T) {
+	tests := []struct {
+		desc       string
+		failOn     string
+		failCommit bool
+	}{
+		{desc: "branch insert fails", failOn: "INSERT INTO branches"},
+		{desc: "counter update fails", failOn: "num_non_draft_plans"},
+		{desc: "audit event queueing fails", failOn: "INSERT INTO audit_outbox"},
+		{desc: "commit fails", failCommit: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			origBaseDir := BaseDir
+			BaseDir = t.TempDir()
+			defer func() { BaseDir = origBaseDir }()
+
+			d := &fakeCreatePlanDriver{failOn: tt.failOn, failCommit: tt.failCommit}
+
+			err := createPlanWithFakeDb(t, d, "plan")
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+
+			if d.committed {
+				t.Errorf("transaction should not have been committed")
+			}
+
+			if !tt.failCommit && !d.rolledBack {
+				t.Errorf("transaction should have been rolled back")
+			}
+
+			if _, err := os.Stat(getPlanDir("org", "plan-id")); !os.IsNotExist(err) {
+				t.Errorf("plan dir should not exist after a failed create")
+			}
+		})
+	}
+}
+
+func TestCreatePlanTxInitDirFails(t *testing.T) {
+	origBaseDir := BaseDir
+	defer func() { BaseDir = origBaseDir }()
+
+	// a file where the base dir should be makes InitPlan fail
+	BaseDir = filepath.Join(t.TempDir(), "base")
+	err := os.WriteFile(BaseDir, []byte{}, 0644)
+	if err != nil {
+		t.Fatalf("error writing base file: %v", err)
+	}
+
+	d := &fakeCreatePlanDriver{}
+
+	err = createPlanWithFakeDb(t, d, "plan")
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	if d.committed || !d.rolledBack {
+		t.Errorf("expected rollback without commit, got committed=%v rolledBack=%v", d.committed, d.rolledBack)
+	}
+}
+
+func TestCreatePlanTxCommits(t *testing.T) {
+	origBaseDir := BaseDir
+	BaseDir = t.TempDir()
+	defer func() { BaseDir = origBaseDir }()
+
+	d := &fakeCreatePlanDriver{}
+
+	err := createPlanWithFakeDb(t, d, "draft")
+	if err != nil {
+		t.Fatalf("error creating plan: %v", err)
+	}
+
+	if !d.committed {
+		t.Errorf("transaction should have been committed")
+	}
+
+	if _, err := os.Stat(getPlanContextDir("org", "plan-id")); err != nil {
+		t.Errorf("plan dir should exist after create: %v", err)
+	}
+}
+
+func TestCreatePlanTxExistingDir(t *testing.T) {
+	origBaseDir := BaseDir
+	BaseDir = t.TempDir()
+	defer func() { BaseDir = origBaseDir }()
+
+	planId := "3f2b8c1e-6a4d-4e2b-9c1a-0f5e6d7c8b9a"
+	err := os.MkdirAll(getPlanContextDir("org", planId), os.ModePerm)
+	if err != nil {
+		t.Fatalf("error creating plan dir: %v", err)
+	}
+
+	sqlDb := openFakeCreatePlanDb(t, &fakeCreatePlanDriver{})
+
+	tx, err := sqlDb.Begin()
+	if err != nil {
+		t.Fatalf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = CreatePlanTx(tx, "org", "project", "user", planId, "plan")
+	if err != ErrPlanIdExists {
+		t.Errorf("expected ErrPlanIdExists, got %v", err)
+	}
+
+	if _, err := os.Stat(getPlanContextDir("org", planId)); err != nil {
+		t.Errorf("existing plan dir should be left alone: %v", err)
+	}
+}
+
+func TestCreateNamedPlanTxConcurrent(t *testing.T) {
+	origBaseDir := BaseDir
+	BaseDir = t.TempDir()
+	defer func() { BaseDir = origBaseDir }()
+
+	d := &fakeCreatePlanDriver{names: map[string]bool{}}
+	sqlDb := openFakeCreatePlanDb(t, d)
+	org := &Org{Id: "org"}
+
+	// each create can lose the race to at most all the others, which stays within the retries
+	n := maxCreatePlanNameAttempts
+	names := make([]string, n)
+	errs := make([]error, n)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			tx, err := sqlDb.Begin()
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer tx.Rollback()
+
+			plan, err := CreateNamedPlanTx(tx, org, "project", "user", "", "plan")
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			names[i] = plan.Name
+		}(i)
+	}
+	wg.Wait()
+
+	seen := map[string]bool{}
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Fatalf("error creating plan: %v", errs[i])
+		}
+		if seen[names[i]] {
+			t.Errorf("name %s was given to more than one plan", names[i])
+		}
+		seen[names[i]] = true
+	}
+
+	if !seen["plan"] {
+		t.Errorf("expected one plan to get the requested name, got %v", names)
+	}
+}
+
+func TestCreatePlanTxNameTaken(t *testing.T) {
+	origBaseDir := BaseDir
+	BaseDir = t.TempDir()
+	defer func() { BaseDir = origBaseDir }()
+
+	d := &fakeCreatePlanDriver{names: map[string]bool{"plan": true}}
+	sqlDb := openFakeCreatePlanDb(t, d)
+
+	tx, err := sqlDb.Begin()
+	if err != nil {
+		t.Fatalf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = CreatePlanTx(tx, "org", "project", "user", "", "plan")
+	if err != ErrPlanNameTaken {
+		t.Errorf("expected ErrPlanNameTaken, got %v", err)
+	}
+}
@@ -0,0 +1,305 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/plandex/plandex/shared"
+)
+
+// PlanImportRoots are the server dirs plans can be imported from, set with PLANDEX_IMPORT_ROOTS
+// as a list of absolute paths separated like PATH. Importing from a path is disabled when it's
+// empty.
+var PlanImportRoots []string
+
+var ErrPlanImportDisabled = errors.New("importing plans from a path isn't enabled on this server")
+var ErrPlanImportPathNotAllowed = errors.New("path isn't inside an allowed import root")
+
+// ErrInvalidPlanImport wraps errors caused by the contents of an import dir, like files that
+// can't be parsed, symlinks, or anything that isn't a regular file, as opposed to server failures
+var ErrInvalidPlanImport = errors.New("invalid plan import")
+
+func init() {
+	for _, root := range filepath.SplitList(os.Getenv("PLANDEX_IMPORT_ROOTS")) {
+		if root == "" {
+			continue
+		}
+		if !filepath.IsAbs(root) {
+			panic(fmt.Errorf("PLANDEX_IMPORT_ROOTS must only contain absolute paths, got: %s", root))
+		}
+		PlanImportRoots = append(PlanImportRoots, filepath.Clean(root))
+	}
+}
+
+type ImportPlanResult struct {
+	NumContexts      int
+	NumConvoMessages int
+}
+
+// ResolvePlanImportPath returns the real path of dir after following symlinks, as long as it's
+// a dir inside one of roots, whose own symlinks are followed too. Anything else, including paths
+// that only look like they're inside a root before symlinks or .. are resolved, is
+// ErrPlanImportPathNotAllowed.
+func ResolvePlanImportPath(roots []string, dir string) (string, error) {
+	if len(roots) == 0 {
+		return "", ErrPlanImportDisabled
+	}
+
+	if !filepath.IsAbs(dir) {
+		return "", ErrPlanImportPathNotAllowed
+	}
+
+	real, err := filepath.EvalSymlinks(filepath.Clean(dir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrPlanImportPathNotAllowed
+		}
+		return "", fmt.Errorf("error resolving import path: %v", err)
+	}
+
+	info, err := os.Stat(real)
+	if err != nil {
+		return "", fmt.Errorf("error checking import path: %v", err)
+	}
+	if !info.IsDir() {
+		return "", ErrPlanImportPathNotAllowed
+	}
+
+	for _, root := range roots {
+		realRoot, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			log.Printf("Skipping import root %s: %v\n", root, err)
+			continue
+		}
+
+		if isInsideDir(realRoot, real) {
+			return real, nil
+		}
+	}
+
+	return "", ErrPlanImportPathNotAllowed
+}
+
+// isInsideDir is true for dir itself or anything under it
+func isInsideDir(dir, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+// ReadPlanImportMeta reads the plan.json written by the plan export, or returns nil if dir
+// doesn't have one. dir must come from ResolvePlanImportPath.
+func ReadPlanImportMeta(dir string) (*shared.Plan, error) {
+	bytes, err := readImportFile(dir, "plan.json")
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var plan shared.Plan
+	err = json.Unmarshal(bytes, &plan)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error parsing plan.json: %v", ErrInvalidPlanImport, err)
+	}
+
+	return &plan, nil
+}
+
+// ImportPlanFromDir fills the target plan from a dir laid out like a plan export: context and
+// conversation dirs, and optional settings.json and plan.json. Contexts and messages get new
+// ids and are owned by userId. Symlinks anywhere they're read from are rejected rather than
+// followed, so nothing outside dir is read. Like a migration, only the main branch is imported.
+// Nothing else knows the target's id yet, so it isn't locked.
+func ImportPlanFromDir(dir string, target *Plan, userId string) (*ImportPlanResult, error) {
+	res := &ImportPlanResult{}
+
+	contextFiles, err := readImportDir(dir, "context")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range contextFiles {
+		if !strings.HasSuffix(file, ".meta") {
+			continue
+		}
+		id := strings.TrimSuffix(file, ".meta")
+
+		metaBytes, err := readImportFile(dir, filepath.Join("context", file))
+		if err != nil {
+			return nil, err
+		}
+
+		var context Context
+		err = json.Unmarshal(metaBytes, &context)
+		if err != nil {
+			return nil, fmt.Errorf("%w: error parsing context %s: %v", ErrInvalidPlanImport, file, err)
+		}
+
+		body, err := readImportFile(dir, filepath.Join("context", id+".body"))
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: context %s has no body", ErrInvalidPlanImport, id)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		context.OwnerId = userId
+
+		err = writeCopiedContext(&context, body, target.OrgId, target.Id)
+		if err != nil {
+			return nil, fmt.Errorf("error importing context %s: %v", id, err)
+		}
+		res.NumContexts++
+	}
+
+	convoFiles, err := readImportDir(dir, "conversation")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range convoFiles {
+		if !strings.HasSuffix(file, ".json") {
+			continue
+		}
+
+		bytes, err := readImportFile(dir, filepath.Join("conversation", file))
+		if err != nil {
+			return nil, err
+		}
+
+		var msg ConvoMessage
+		err = json.Unmarshal(bytes, &msg)
+		if err != nil {
+			return nil, fmt.Errorf("%w: error parsing convo message %s: %v", ErrInvalidPlanImport, file, err)
+		}
+
+		msg.Id = uuid.New().String()
+		msg.OrgId = target.OrgId
+		msg.PlanId = target.Id
+		msg.UserId = MapMigratedUserId(nil, msg.UserId, userId)
+
+		err = writeConvoMessageFile(&msg)
+		if err != nil {
+			return nil, fmt.Errorf("error importing convo message: %v", err)
+		}
+		res.NumConvoMessages++
+	}
+
+	settingsBytes, err := readImportFile(dir, "settings.json")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err == nil {
+		var settings shared.PlanSettings
+		err = json.Unmarshal(settingsBytes, &settings)
+		if err != nil {
+			return nil, fmt.Errorf("%w: error parsing settings.json: %v", ErrInvalidPlanImport, err)
+		}
+
+		err = StorePlanSettings(target, &settings)
+		if err != nil {
+			return nil, fmt.Errorf("error storing settings: %v", err)
+		}
+	}
+
+	meta, err := ReadPlanImportMeta(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if meta != nil {
+		_, err = Conn.Exec("UPDATE plans SET description = $1, tags = $2 WHERE id = $3", meta.Description, pq.StringArray(meta.Tags), target.Id)
+		if err != nil {
+			return nil, fmt.Errorf("error importing plan metadata: %v", err)
+		}
+
+		InvalidatePlanCache(target.Id)
+	}
+
+	err = SyncPlanTokens(target.OrgId, target.Id, "main")
+	if err != nil {
+		return nil, fmt.Errorf("error syncing plan tokens: %v", err)
+	}
+
+	msg := fmt.Sprintf("📥 Imported from %s | %d context | %d messages", dir, res.NumContexts, res.NumConvoMessages)
+
+	err = GitAddAndCommit(target.OrgId, target.Id, "main", msg)
+	if err != nil {
+		return nil, fmt.Errorf("error committing imported plan: %v", err)
+	}
+
+	log.Println(msg)
+
+	return res, nil
+}
+
+// readImportDir lists the regular files in dir/sub, or nothing if sub doesn't exist
+func readImportDir(dir, sub string) ([]string, error) {
+	p := filepath.Join(dir, sub)
+
+	info, err := os.Lstat(p)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", sub, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%w: %s isn't a dir", ErrInvalidPlanImport, sub)
+	}
+
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", sub, err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.Type()&fs.ModeSymlink != 0 {
+			return nil, fmt.Errorf("%w: %s contains a symlink, which isn't allowed in imports", ErrInvalidPlanImport, filepath.Join(sub, entry.Name()))
+		}
+		if entry.Type().IsRegular() {
+			files = append(files, entry.Name())
+		}
+	}
+
+	return files, nil
+}
+
+// readImportFile reads a regular file under dir. A missing file returns an error satisfying
+// os.IsNotExist.
+func readImportFile(dir, rel string) ([]byte, error) {
+	p := filepath.Join(dir, rel)
+
+	info, err := os.Lstat(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error reading %s: %v", rel, err)
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%w: %s isn't a regular file, symlinks aren't allowed in imports", ErrInvalidPlanImport, rel)
+	}
+
+	bytes, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", rel, err)
+	}
+
+	return bytes, nil
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolvePlanImportPath(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	outside := filepath.Join(base, "outside")
+
+	for _, dir := range []string{filepath.Join(root, "plan"), outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "plan"), filepath.Join(base, "link-in")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "file"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	realPlan, _ := filepath.EvalSymlinks(filepath.Join(root, "plan"))
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr error
+	}{
+		{filepath.Join(root, "plan"), realPlan, nil},
+		{root, "", nil},
+		{filepath.Join(base, "link-in"), realPlan, nil},
+		{filepath.Join(root, "escape"), "", ErrPlanImportPathNotAllowed},
+		{filepath.Join(root, "..", "outside"), "", ErrPlanImportPathNotAllowed},
+		{filepath.Join(root, "file"), "", ErrPlanImportPathNotAllowed},
+		{filepath.Join(root, "missing"), "", ErrPlanImportPathNotAllowed},
+		{"root/plan", "", ErrPlanImportPathNotAllowed},
+	}
+
+	for _, tt := range tests {
+		got, err := ResolvePlanImportPath([]string{root}, tt.path)
+		if err != tt.wantErr {
+			t.Errorf("%s: got err %v, want %v", tt.path, err, tt.wantErr)
+			continue
+		}
+		if tt.want != "" && got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.path, got, tt.want)
+		}
+	}
+
+	if _, err := ResolvePlanImportPath(nil, root); err != ErrPlanImportDisabled {
+		t.Errorf("expected ErrPlanImportDisabled without roots, got %v", err)
+	}
+}
+
+func TestIsInsideDir(t *testing.T) {
+	if !isInsideDir("/a/b", "/a/b") || !isInsideDir("/a/b", "/a/b/c") || !isInsideDir("/a/b", "/a/b/..c") {
+		t.Errorf("expected paths inside /a/b to match")
+	}
+	if isInsideDir("/a/b", "/a/bc") || isInsideDir("/a/b", "/a") {
+		t.Errorf("expected paths outside /a/b not to match")
+	}
+}
+
+func TestReadImportFileRejectsSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(t.TempDir(), "secret")
+
+	if err := os.WriteFile(target, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, filepath.Join(dir, "settings.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "context"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, filepath.Join(dir, "context", "x.meta")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := readImportFile(dir, "settings.json"); !errors.Is(err, ErrInvalidPlanImport) {
+		t.Errorf("expected a symlinked file to be rejected as an invalid import, got %v", err)
+	}
+
+	if _, err := readImportDir(dir, "context"); !errors.Is(err, ErrInvalidPlanImport) {
+		t.Errorf("expected a dir containing a symlink to be rejected as an invalid import, got %v", err)
+	}
+
+	if _, err := readImportFile(dir, "plan.json"); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error for a missing file, got %v", err)
+	}
+}
+
+func TestReadPlanImportMetaInvalid(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "plan.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadPlanImportMeta(dir); !errors.Is(err, ErrInvalidPlanImport) {
+		t.Errorf("expected unparseable plan.json to be an invalid import, got %v", err)
+	}
+}
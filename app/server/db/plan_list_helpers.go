@@ -0,0 +1,85 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// PlanListFilter covers the same plans as ListOwnedPlans, ListPlansForOwners, ListAllPlans, and
+// SearchPlans, for listing with StreamPlans
+type PlanListFilter struct {
+	ProjectIds []string
+	// nil includes every owner
+	OwnerIds []string
+	Archived bool
+	// if set, plans are searched like SearchPlans
+	Q    string
+	Sort PlanSort
+}
+
+func (filter PlanListFilter) query() (string, []interface{}) {
+	qs := "SELECT * FROM plans WHERE project_id = ANY($1)"
+	qargs := []interface{}{pq.Array(filter.ProjectIds)}
+
+	if filter.OwnerIds != nil {
+		qargs = append(qargs, pq.Array(filter.OwnerIds))
+		qs += fmt.Sprintf(" AND owner_id = ANY($%d)", len(qargs))
+	}
+
+	if filter.Archived {
+		qs += " AND archived_at IS NOT NULL"
+	} else {
+		qs += " AND archived_at IS NULL"
+	}
+
+	if filter.Q != "" {
+		return addPlanSearch(qs, qargs, filter.Q, filter.Sort)
+	}
+
+	return qs + filter.Sort.orderBy(), qargs
+}
+
+// StreamPlans reads the plans matching filter from a cursor and passes them to fn in batches of
+// up to batchSize, so a large listing is never held in memory at once. Stops at the first error
+// from fn and returns it.
+func StreamPlans(filter PlanListFilter, batchSize int, fn func(plans []*Plan) error) error {
+	qs, qargs := filter.query()
+
+	rows, err := Conn.Queryx(qs, qargs...)
+	if err != nil {
+		return fmt.Errorf("error listing plans: %v", err)
+	}
+	defer rows.Close()
+
+	batch := make([]*Plan, 0, batchSize)
+
+	for rows.Next() {
+		var plan Plan
+		err = rows.StructScan(&plan)
+		if err != nil {
+			return fmt.Errorf("error scanning plan: %v", err)
+		}
+
+		batch = append(batch, &plan)
+
+		if len(batch) == batchSize {
+			err = fn(batch)
+			if err != nil {
+				return err
+			}
+			batch = make([]*Plan, 0, batchSize)
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return fmt.Errorf("error listing plans: %v", err)
+	}
+
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+
+	return nil
+}
@@ -0,0 +1,383 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const defaultMaxPlanNameSuffix = 100
+
+// MaxPlanNameSuffix is the highest ".N" suffix tried when a plan name is taken.
+// Set with PLANDEX_MAX_PLAN_NAME_SUFFIX; orgs can override it with max_plan_name_suffix.
+var MaxPlanNameSuffix = defaultMaxPlanNameSuffix
+
+var ErrPlanNameExhausted = errors.New("plan name and all suffixes are taken")
+
+func init() {
+	s := os.Getenv("PLANDEX_MAX_PLAN_NAME_SUFFIX")
+	if s == "" {
+		return
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 2 {
+		panic(fmt.Errorf("PLANDEX_MAX_PLAN_NAME_SUFFIX must be an integer >= 2, got: %s", s))
+	}
+
+	MaxPlanNameSuffix = n
+}
+
+var ErrPlanNameCapReached = errors.New("too many plans share this name")
+
+var ErrPlanNamePrefixRequired = errors.New("plan name is missing the org's required prefix")
+
+var ErrPlanNameCaseConflict = errors.New("some plans have names that differ only by case")
+
+var ErrPlanNameProjectConflict = errors.New("some plans in the same project have the same name")
+
+// PlanNameScope is the set of plans a plan's name must be unique within: the owner's plans in
+// the project, or with ProjectScoped, all plans in the project.
+type PlanNameScope struct {
+	ProjectId string
+	// ignored with ProjectScoped
+	OwnerId         string
+	ProjectScoped   bool
+	CaseInsensitive bool
+}
+
+// NameScope is the scope for new plans, from the org's settings
+func (org *Org) NameScope(projectId, ownerId string) PlanNameScope {
+	return PlanNameScope{
+		ProjectId:       projectId,
+		OwnerId:         ownerId,
+		ProjectScoped:   org.ProjectScopedPlanNames,
+		CaseInsensitive: org.CaseInsensitivePlanNames,
+	}
+}
+
+// NameScope is the scope for renaming the plan, from the flags copied onto it
+func (plan *Plan) NameScope() PlanNameScope {
+	return PlanNameScope{
+		ProjectId:       plan.ProjectId,
+		OwnerId:         plan.OwnerId,
+		ProjectScoped:   plan.ProjectScopedName,
+		CaseInsensitive: plan.CaseInsensitiveName,
+	}
+}
+
+// filter returns the scope as a where condition using placeholders from $1, and its args.
+// Placeholders for further args start at len(args) + 1.
+func (scope PlanNameScope) filter() (string, []interface{}) {
+	if scope.ProjectScoped {
+		return "project_id = $1", []interface{}{scope.ProjectId}
+	}
+	return "project_id = $1 AND owner_id = $2", []interface{}{scope.ProjectId, scope.OwnerId}
+}
+
+func (scope PlanNameScope) nameExpr(expr string) string {
+	if scope.CaseInsensitive {
+		return "LOWER(" + expr + ")"
+	}
+	return expr
+}
+
+func placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+func GetOrgMaxPlanNameSuffix(orgId string) (int, error) {
+	org, err := GetOrg(orgId)
+
+	if err != nil {
+		return 0, fmt.Errorf("error getting org: %v", err)
+	}
+
+	return org.GetMaxPlanNameSuffix(), nil
+}
+
+func (org *Org) GetMaxPlanNameSuffix() int {
+	if org.MaxPlanNameSuffix != nil {
+		return *org.MaxPlanNameSuffix
+	}
+
+	return MaxPlanNameSuffix
+}
+
+// ApplyPlanNamePrefix enforces the org's required_name_prefix. Names missing the prefix get it
+// prepended if the org has auto_prefix on or autoPrefix is set (for server-generated names),
+// otherwise ErrPlanNamePrefixRequired is returned. Draft plans are exempt.
+func ApplyPlanNamePrefix(org *Org, name string, autoPrefix bool) (string, error) {
+	if org.RequiredNamePrefix == nil || name == "draft" {
+		return name, nil
+	}
+
+	prefix := *org.RequiredNamePrefix
+	if strings.HasPrefix(name, prefix) {
+		return name, nil
+	}
+
+	if autoPrefix || org.AutoPrefix {
+		return prefix + name, nil
+	}
+
+	return "", ErrPlanNamePrefixRequired
+}
+
+// GetAvailablePlanName returns name if it's free in the scope, otherwise the first free "name.N"
+// for N in 2..maxSuffix. It loads all candidate names in a single query.
+// With scope.CaseInsensitive, names that differ only by case count as taken.
+// Returns ErrPlanNameExhausted if every candidate is taken. Pass a tx to resolve the name
+// inside the transaction that creates the plan.
+func GetAvailablePlanName(scope PlanNameScope, name string, maxSuffix int, tx *sql.Tx) (string, error) {
+	cond, args := scope.filter()
+	n := len(args)
+	query := fmt.Sprintf(`SELECT name FROM plans WHERE %s AND (%s = %s OR %s LIKE %s ESCAPE '\')`,
+		cond, scope.nameExpr("name"), scope.nameExpr(placeholder(n+1)), scope.nameExpr("name"), scope.nameExpr(placeholder(n+2)))
+	args = append(args, name, escapeLike(name)+".%")
+
+	var taken []string
+	var err error
+	if tx == nil {
+		err = Conn.Select(&taken, query, args...)
+	} else {
+		taken, err = queryPlanNamesTx(tx, query, args...)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("error checking if plan exists: %v", err)
+	}
+
+	takenSet := make(map[string]bool, len(taken))
+	for _, n := range taken {
+		if scope.CaseInsensitive {
+			n = strings.ToLower(n)
+		}
+		takenSet[n] = true
+	}
+
+	available, ok := nextAvailablePlanName(name, takenSet, maxSuffix, scope.CaseInsensitive)
+	if !ok {
+		return "", ErrPlanNameExhausted
+	}
+
+	return available, nil
+}
+
+const maxCreatePlanNameAttempts = 5
+
+// CreateNamedPlanTx is CreatePlanTx with name, or the first ".N" variant of it that's available in
+// the org's name scope. The unique name indexes make the check race-safe: if a concurrent create takes the name
+// first, the insert is rolled back to a savepoint, which keeps tx usable, and the next available
+// name is tried. Returns ErrPlanNameTaken if that keeps happening.
+func CreateNamedPlanTx(tx *sql.Tx, org *Org, projectId, ownerId, planId, name string) (*Plan, error) {
+	scope := org.NameScope(projectId, ownerId)
+	maxSuffix := org.GetMaxPlanNameSuffix()
+
+	for attempt := 1; ; attempt++ {
+		available, err := GetAvailablePlanName(scope, name, maxSuffix, tx)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec("SAVEPOINT create_named_plan")
+		if err != nil {
+			return nil, fmt.Errorf("error creating savepoint: %v", err)
+		}
+
+		plan, err := CreatePlanTx(tx, org.Id, projectId, ownerId, planId, available)
+
+		if err == ErrPlanNameTaken && attempt < maxCreatePlanNameAttempts {
+			log.Printf("Plan name '%s' was just taken, retrying\n", available)
+
+			_, err = tx.Exec("ROLLBACK TO SAVEPOINT create_named_plan")
+			if err != nil {
+				return nil, fmt.Errorf("error rolling back to savepoint: %v", err)
+			}
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec("RELEASE SAVEPOINT create_named_plan")
+		if err != nil {
+			return nil, fmt.Errorf("error releasing savepoint: %v", err)
+		}
+
+		return plan, nil
+	}
+}
+
+// CheckPlanNameCap returns ErrPlanNameCapReached, along with the current count, if the scope
+// already has the org's max_plans_per_name plans named name or "name.N". A nil cap always passes.
+func CheckPlanNameCap(org *Org, scope PlanNameScope, name string, tx *sql.Tx) (int, error) {
+	if org.MaxPlansPerName == nil {
+		return 0, nil
+	}
+
+	count, err := countPlanNameVariants(scope, name, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	if count >= *org.MaxPlansPerName {
+		return count, ErrPlanNameCapReached
+	}
+
+	return count, nil
+}
+
+// unlike the GetAvailablePlanName query, this only counts numeric suffixes, so "name.draft"
+// isn't a variant of "name"
+func countPlanNameVariants(scope PlanNameScope, name string, tx *sql.Tx) (int, error) {
+	cond, args := scope.filter()
+	n := len(args)
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM plans WHERE %s AND (%s = %s OR (%s LIKE %s ESCAPE '\' AND SUBSTRING(name FROM %s) ~ '^[0-9]+$'))`,
+		cond, scope.nameExpr("name"), scope.nameExpr(placeholder(n+1)), scope.nameExpr("name"), scope.nameExpr(placeholder(n+2)), placeholder(n+3))
+
+	// postgres counts characters, not bytes; the suffix starts after the name and the dot
+	args = append(args, name, escapeLike(name)+".%", utf8.RuneCountInString(name)+2)
+
+	var count int
+	var err error
+	if tx == nil {
+		err = Conn.Get(&count, query, args...)
+	} else {
+		err = tx.QueryRow(query, args...).Scan(&count)
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("error counting plans with name: %v", err)
+	}
+
+	return count, nil
+}
+
+func queryPlanNamesTx(tx *sql.Tx, query string, args ...interface{}) ([]string, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+// with caseInsensitive, taken must be keyed by lowercased names
+func nextAvailablePlanName(name string, taken map[string]bool, maxSuffix int, caseInsensitive bool) (string, bool) {
+	isTaken := func(candidate string) bool {
+		if caseInsensitive {
+			return taken[strings.ToLower(candidate)]
+		}
+		return taken[candidate]
+	}
+
+	if !isTaken(name) {
+		return name, true
+	}
+
+	for i := 2; i <= maxSuffix; i++ {
+		candidate := name + "." + strconv.Itoa(i)
+		if !isTaken(candidate) {
+			return candidate, true
+		}
+	}
+
+	return "", false
+}
+
+func escapeLike(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "%", `\%`)
+	s = strings.ReplaceAll(s, "_", `\_`)
+	return s
+}
+
+func PlanNameExists(scope PlanNameScope, name, excludePlanId string) (bool, error) {
+	cond, args := scope.filter()
+	n := len(args)
+	query := fmt.Sprintf("SELECT COUNT(*) FROM plans WHERE %s AND %s = %s AND id != %s",
+		cond, scope.nameExpr("name"), scope.nameExpr(placeholder(n+1)), placeholder(n+2))
+	args = append(args, name, excludePlanId)
+
+	var count int
+	err := Conn.Get(&count, query, args...)
+
+	if err != nil {
+		return false, fmt.Errorf("error checking if plan name exists: %v", err)
+	}
+
+	return count > 0, nil
+}
+
+// SetOrgCaseInsensitivePlanNames updates the org setting and flags all of its plans to match.
+// Enabling returns ErrPlanNameCaseConflict if any plans would violate case-insensitive uniqueness.
+func SetOrgCaseInsensitivePlanNames(orgId string, enabled bool) error {
+	return setOrgPlanNameFlag(orgId, "case_insensitive_plan_names", "case_insensitive_name", enabled, ErrPlanNameCaseConflict)
+}
+
+// SetOrgProjectScopedPlanNames updates the org setting and flags all of its plans to match.
+// Enabling returns ErrPlanNameProjectConflict if two owners already have plans with the same
+// name in a project.
+func SetOrgProjectScopedPlanNames(orgId string, enabled bool) error {
+	return setOrgPlanNameFlag(orgId, "project_scoped_plan_names", "project_scoped_name", enabled, ErrPlanNameProjectConflict)
+}
+
+// the plan flag enables a unique index, so setting it fails with conflictErr if existing names
+// violate it
+func setOrgPlanNameFlag(orgId, orgCol, planCol string, enabled bool, conflictErr error) error {
+	tx, err := Conn.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+
+	// Ensure that rollback is attempted in case of failure
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Printf("transaction rollback error: %v\n", rbErr)
+			} else {
+				log.Println("transaction rolled back")
+			}
+		}
+	}()
+
+	_, err = tx.Exec(fmt.Sprintf("UPDATE orgs SET %s = $1 WHERE id = $2", orgCol), enabled, orgId)
+	if err != nil {
+		return fmt.Errorf("error updating org: %v", err)
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("UPDATE plans SET %s = $1 WHERE org_id = $2", planCol), enabled, orgId)
+	if err != nil {
+		if IsNonUniqueErr(err) {
+			return conflictErr
+		}
+		return fmt.Errorf("error updating plans: %v", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+
+	ClearPlanCache()
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlanNameScopeFilter(t *testing.T) {
+	cond, args := PlanNameScope{ProjectId: "project", OwnerId: "owner"}.filter()
+	if cond != "project_id = $1 AND owner_id = $2" || !reflect.DeepEqual(args, []interface{}{"project", "owner"}) {
+		t.Errorf("unexpected owner scope: %s %v", cond, args)
+	}
+
+	cond, args = PlanNameScope{ProjectId: "project", OwnerId: "owner", ProjectScoped: true}.filter()
+	if cond != "project_id = $1" || !reflect.DeepEqual(args, []interface{}{"project"}) {
+		t.Errorf("unexpected project scope: %s %v", cond, args)
+	}
+}
+
+func TestPlanNameScopeNameExpr(t *testing.T) {
+	if got := (PlanNameScope{}).nameExpr("$3"); got != "$3" {
+		t.Errorf("expected $3, got %s", got)
+	}
+
+	if got := (PlanNameScope{CaseInsensitive: true}).nameExpr("name"); got != "LOWER(name)" {
+		t.Errorf("expected LOWER(name), got %s", got)
+	}
+}
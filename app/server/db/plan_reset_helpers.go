@@ -0,0 +1,76 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ResetPlan clears the plan's context, convo, results, and descriptions on the branch and
+// commits the empty state. Settings and the plan row are left alone. The state before the reset
+// stays in the plan's history as snapshotSha, which can be restored as a version. The caller
+// must hold a write lock on the branch.
+func ResetPlan(orgId, planId, branch string) (snapshotSha string, changed bool, err error) {
+	snapshotSha, _, err = GetLatestCommit(orgId, planId, branch)
+	if err != nil {
+		return "", false, fmt.Errorf("error getting snapshot commit: %v", err)
+	}
+
+	for _, dir := range []string{
+		getPlanContextDir(orgId, planId),
+		getPlanConversationDir(orgId, planId),
+		getPlanResultsDir(orgId, planId),
+		getPlanDescriptionsDir(orgId, planId),
+	} {
+		err = clearDir(dir)
+		if err != nil {
+			return "", false, err
+		}
+	}
+
+	changed, err = GitHasChanges(orgId, planId)
+	if err != nil {
+		return "", false, fmt.Errorf("error checking for changes: %v", err)
+	}
+
+	if changed {
+		err = GitAddAndCommit(orgId, planId, branch, "🧹 Reset plan")
+		if err != nil {
+			return "", false, fmt.Errorf("error committing reset: %v", err)
+		}
+	}
+
+	err = SyncPlanTokens(orgId, planId, branch)
+	if err != nil {
+		return "", false, fmt.Errorf("error syncing plan tokens: %v", err)
+	}
+
+	_, err = Conn.Exec("UPDATE plans SET total_replies = 0 WHERE id = $1", planId)
+	if err != nil {
+		return "", false, fmt.Errorf("error resetting plan replies: %v", err)
+	}
+
+	InvalidatePlanCache(planId)
+
+	return snapshotSha, changed, nil
+}
+
+// clearDir removes everything in dir but keeps dir itself
+func clearDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading dir %s: %v", dir, err)
+	}
+
+	for _, entry := range entries {
+		err = os.RemoveAll(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("error removing %s: %v", entry.Name(), err)
+		}
+	}
+
+	return nil
+}
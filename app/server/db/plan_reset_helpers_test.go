@@ -0,0 +1,41 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClearDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "context")
+
+	err := os.MkdirAll(filepath.Join(dir, "nested"), os.ModePerm)
+	if err != nil {
+		t.Fatalf("error creating dir: %v", err)
+	}
+
+	for _, name := range []string{"a.meta", "a.body", filepath.Join("nested", "b")} {
+		err = os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644)
+		if err != nil {
+			t.Fatalf("error writing file: %v", err)
+		}
+	}
+
+	err = clearDir(dir)
+	if err != nil {
+		t.Fatalf("error clearing dir: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("dir should still exist: %v", err)
+	}
+
+	if len(entries) != 0 {
+		t.Errorf("expected an empty dir, got %d entries", len(entries))
+	}
+
+	if err := clearDir(filepath.Join(dir, "missing")); err != nil {
+		t.Errorf("clearing a missing dir should be a no-op, got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/lib/pq"
+)
+
+// PlanSearchFTS switches plan search from ILIKE to the search_vector full-text index.
+// ILIKE is fine for small deployments and matches substrings; FTS matches whole words but scales
+// to orgs with many plans. Set PLANDEX_PLAN_SEARCH_FTS to enable it.
+var PlanSearchFTS = os.Getenv("PLANDEX_PLAN_SEARCH_FTS") != ""
+
+// SearchPlans matches q against plan names, descriptions, and tags. If ownerId is empty, plans
+// from every owner are included. FTS results are ordered by rank unless sort is set to something
+// other than the default.
+func SearchPlans(projectIds []string, ownerId, q string, archived bool, sort PlanSort) ([]*Plan, error) {
+	qs := "SELECT * FROM plans WHERE project_id = ANY($1)"
+	qargs := []interface{}{pq.Array(projectIds)}
+
+	if ownerId != "" {
+		qargs = append(qargs, ownerId)
+		qs += fmt.Sprintf(" AND owner_id = $%d", len(qargs))
+	}
+
+	if archived {
+		qs += " AND archived_at IS NOT NULL"
+	} else {
+		qs += " AND archived_at IS NULL"
+	}
+
+	qs, qargs = addPlanSearch(qs, qargs, q, sort)
+
+	var plans []*Plan
+	err := Conn.Select(&plans, qs, qargs...)
+
+	if err != nil {
+		return nil, fmt.Errorf("error searching plans: %v", err)
+	}
+
+	return plans, nil
+}
+
+// addPlanSearch appends the condition matching q, and the order, to a plans query
+func addPlanSearch(qs string, qargs []interface{}, q string, sort PlanSort) (string, []interface{}) {
+	if PlanSearchFTS {
+		// websearch_to_tsquery never errors on user input, unlike to_tsquery
+		qargs = append(qargs, q)
+		n := len(qargs)
+		qs += fmt.Sprintf(" AND search_vector @@ websearch_to_tsquery('simple', $%d)", n)
+		if sort != (PlanSort{}) {
+			qs += sort.orderBy()
+		} else {
+			qs += fmt.Sprintf(" ORDER BY ts_rank(search_vector, websearch_to_tsquery('simple', $%d)) DESC, updated_at DESC", n)
+		}
+	} else {
+		qargs = append(qargs, "%"+escapeLike(q)+"%")
+		n := len(qargs)
+		qs += fmt.Sprintf(` AND (name ILIKE $%d ESCAPE '\' OR description ILIKE $%d ESCAPE '\' OR EXISTS (SELECT 1 FROM unnest(tags) tag WHERE tag ILIKE $%d ESCAPE '\'))`, n, n, n)
+		qs += sort.orderBy()
+	}
+
+	return qs, qargs
+}
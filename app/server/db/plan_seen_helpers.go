@@ -0,0 +1,58 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// MarkPlanSeen records that the user has seen the plan as of now. It's separate from the plan's
+// updated_at, so marking a plan seen doesn't make it look changed to anyone else.
+func MarkPlanSeen(planId, userId string) (time.Time, error) {
+	var seenAt time.Time
+	err := Conn.QueryRow(`INSERT INTO plan_seen (plan_id, user_id) VALUES ($1, $2)
+		ON CONFLICT (plan_id, user_id) DO UPDATE SET seen_at = NOW()
+		RETURNING seen_at`, planId, userId).Scan(&seenAt)
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error marking plan seen: %v", err)
+	}
+
+	return seenAt, nil
+}
+
+// GetPlansSeenAt returns when the user last saw each of the plans, by plan id. Plans they've
+// never seen are left out.
+func GetPlansSeenAt(userId string, planIds []string) (map[string]time.Time, error) {
+	var rows []struct {
+		PlanId string    `db:"plan_id"`
+		SeenAt time.Time `db:"seen_at"`
+	}
+
+	err := Conn.Select(&rows, "SELECT plan_id, seen_at FROM plan_seen WHERE user_id = $1 AND plan_id = ANY($2)", userId, pq.Array(planIds))
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting plan seen state: %v", err)
+	}
+
+	seenAt := make(map[string]time.Time, len(rows))
+	for _, row := range rows {
+		seenAt[row.PlanId] = row.SeenAt
+	}
+
+	return seenAt, nil
+}
+
+// FilterUnseenPlans keeps the plans that were never seen or have been updated since they were
+// last seen, in their original order
+func FilterUnseenPlans(plans []*Plan, seenAt map[string]time.Time) []*Plan {
+	unseen := []*Plan{}
+	for _, plan := range plans {
+		seen, ok := seenAt[plan.Id]
+		if !ok || plan.UpdatedAt.After(seen) {
+			unseen = append(unseen, plan)
+		}
+	}
+	return unseen
+}
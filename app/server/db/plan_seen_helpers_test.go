@@ -0,0 +1,39 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFilterUnseenPlans(t *testing.T) {
+	now := time.Now()
+
+	plans := []*Plan{
+		{Id: "never-seen", UpdatedAt: now},
+		{Id: "seen", UpdatedAt: now.Add(-time.Hour)},
+		{Id: "updated-since-seen", UpdatedAt: now},
+		{Id: "seen-at-update", UpdatedAt: now},
+	}
+
+	seenAt := map[string]time.Time{
+		"seen":               now.Add(-time.Minute),
+		"updated-since-seen": now.Add(-time.Minute),
+		"seen-at-update":     now,
+	}
+
+	got := FilterUnseenPlans(plans, seenAt)
+
+	want := []string{"never-seen", "updated-since-seen"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d plans, want %d", len(got), len(want))
+	}
+	for i, plan := range got {
+		if plan.Id != want[i] {
+			t.Errorf("plan %d: got %s, want %s", i, plan.Id, want[i])
+		}
+	}
+
+	if got := FilterUnseenPlans(nil, seenAt); got == nil || len(got) != 0 {
+		t.Errorf("expected an empty, non-nil list for no plans, got %v", got)
+	}
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/lib/pq"
+)
+
+// DefaultPlanNameCollation is used for name sorts that don't specify a collation. Set
+// PLANDEX_PLAN_NAME_COLLATION to override it. If the collation isn't installed on the
+// database, names are sorted by byte value instead.
+var DefaultPlanNameCollation = "en_US"
+
+var ErrUnknownCollation = errors.New("collation not available on the database")
+
+func init() {
+	if s := os.Getenv("PLANDEX_PLAN_NAME_COLLATION"); s != "" {
+		DefaultPlanNameCollation = s
+	}
+}
+
+// PlanSort orders plan lists. The zero value sorts by most recently updated.
+type PlanSort struct {
+	ByName bool
+	// Collation is a resolved collation name from ResolvePlanNameCollation; empty sorts by byte value
+	Collation string
+
+	// sort by the context of the plan's largest branch, biggest first
+	ByContextFiles bool
+	ByContextBytes bool
+}
+
+const planContextSortQuery = " ORDER BY (SELECT COALESCE(MAX(%s), 0) FROM branches WHERE branches.plan_id = plans.id AND branches.deleted_at IS NULL) DESC, updated_at DESC"
+
+func (s PlanSort) orderBy() string {
+	if s.ByContextFiles {
+		return fmt.Sprintf(planContextSortQuery, "context_files")
+	}
+
+	if s.ByContextBytes {
+		return fmt.Sprintf(planContextSortQuery, "context_bytes")
+	}
+
+	if !s.ByName {
+		return " ORDER BY updated_at DESC"
+	}
+
+	if s.Collation == "" {
+		return " ORDER BY name, updated_at DESC"
+	}
+
+	return fmt.Sprintf(" ORDER BY name COLLATE %s, updated_at DESC", pq.QuoteIdentifier(s.Collation))
+}
+
+// ResolvePlanNameCollation checks that a collation exists on the database so it's safe to use
+// in ORDER BY. An empty name resolves DefaultPlanNameCollation, falling back to byte order if
+// it's missing. A missing explicitly requested collation returns ErrUnknownCollation.
+func ResolvePlanNameCollation(name string) (string, error) {
+	requested := name != ""
+	if !requested {
+		name = DefaultPlanNameCollation
+	}
+
+	var collname string
+	err := Conn.Get(&collname, "SELECT collname FROM pg_collation WHERE collname = $1 LIMIT 1", name)
+
+	if err == sql.ErrNoRows {
+		if requested {
+			return "", ErrUnknownCollation
+		}
+		log.Printf("Default plan name collation %s not available, sorting by byte value\n", name)
+		return "", nil
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("error checking collation: %v", err)
+	}
+
+	return collname, nil
+}
@@ -0,0 +1,23 @@
+package db
+
+import "testing"
+
+func TestPlanSortOrderBy(t *testing.T) {
+	tests := []struct {
+		sort PlanSort
+		want string
+	}{
+		{PlanSort{}, " ORDER BY updated_at DESC"},
+		{PlanSort{ByName: true}, " ORDER BY name, updated_at DESC"},
+		{PlanSort{ByName: true, Collation: "en_US"}, ` ORDER BY name COLLATE "en_US", updated_at DESC`},
+		{PlanSort{ByName: true, Collation: `x"; DROP TABLE plans; --`}, ` ORDER BY name COLLATE "x""; DROP TABLE plans; --", updated_at DESC`},
+		{PlanSort{ByContextFiles: true}, " ORDER BY (SELECT COALESCE(MAX(context_files), 0) FROM branches WHERE branches.plan_id = plans.id AND branches.deleted_at IS NULL) DESC, updated_at DESC"},
+		{PlanSort{ByContextBytes: true}, " ORDER BY (SELECT COALESCE(MAX(context_bytes), 0) FROM branches WHERE branches.plan_id = plans.id AND branches.deleted_at IS NULL) DESC, updated_at DESC"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.sort.orderBy(); got != tt.want {
+			t.Errorf("orderBy() for %+v = %q, want %q", tt.sort, got, tt.want)
+		}
+	}
+}
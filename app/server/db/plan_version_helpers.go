@@ -0,0 +1,101 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/plandex/plandex/shared"
+)
+
+// same format as the plan log, so version shas match the ones shown there
+const planVersionLogFormat = "--pretty=%h@@|@@%at@@|@@%B@>>>@"
+
+// ListPlanVersions returns the commits on the checked out branch of the plan's repo, newest
+// first. The caller must hold a lock on the branch.
+func ListPlanVersions(orgId, planId string) ([]*shared.PlanVersion, error) {
+	return getPlanVersions(getPlanDir(orgId, planId), 0)
+}
+
+// RestorePlanVersion sets the plan's files back to how they were at sha and commits that as a
+// new version, so nothing after sha is lost and the restore can itself be undone. Returns the
+// latest version and whether anything changed. The caller must hold a write lock on the branch,
+// which leaves the work tree clean.
+func RestorePlanVersion(orgId, planId, sha string) (*shared.PlanVersion, bool, error) {
+	dir := getPlanDir(orgId, planId)
+
+	fullSha, err := resolvePlanCommit(dir, sha)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// unlike checkout, read-tree also removes files added after sha
+	res, err := exec.Command("git", "-C", dir, "read-tree", "-u", "--reset", fullSha).CombinedOutput()
+	if err != nil {
+		return nil, false, fmt.Errorf("error restoring version %s for dir: %s, err: %v, output: %s", sha, dir, err, string(res))
+	}
+
+	hasChanges, err := GitHasChanges(orgId, planId)
+	if err != nil {
+		return nil, false, fmt.Errorf("error checking for changes: %v", err)
+	}
+
+	if hasChanges {
+		err = gitCommit(dir, fmt.Sprintf("⏪ Restored version %s", sha))
+		if err != nil {
+			return nil, false, fmt.Errorf("error committing restored version: %v", err)
+		}
+	}
+
+	versions, err := getPlanVersions(dir, 1)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return versions[0], hasChanges, nil
+}
+
+func getPlanVersions(dir string, limit int) ([]*shared.PlanVersion, error) {
+	args := []string{"log", planVersionLogFormat}
+	if limit > 0 {
+		args = append(args, "-n", strconv.Itoa(limit))
+	}
+
+	var out bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &out
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("error getting git history for dir: %s, err: %v", dir, err)
+	}
+
+	return parsePlanVersions(out.String()), nil
+}
+
+func parsePlanVersions(raw string) []*shared.PlanVersion {
+	versions := []*shared.PlanVersion{}
+
+	for _, entry := range strings.Split(strings.TrimSpace(raw), "@>>>@") {
+		parts := strings.Split(strings.TrimSpace(entry), "@@|@@")
+		if len(parts) != 3 {
+			continue
+		}
+
+		timestamp, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		versions = append(versions, &shared.PlanVersion{
+			Sha:       parts[0],
+			Message:   strings.TrimSpace(parts[2]),
+			CreatedAt: time.Unix(timestamp, 0).UTC(),
+		})
+	}
+
+	return versions
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/plandex/plandex/shared"
+)
+
+func TestRestorePlanVersion(t *testing.T) {
+	origBaseDir := BaseDir
+	BaseDir = t.TempDir()
+	defer func() { BaseDir = origBaseDir }()
+
+	orgId := "org"
+	planId := "plan"
+
+	err := InitPlan(orgId, planId)
+	if err != nil {
+		t.Fatalf("error initializing plan: %v", err)
+	}
+
+	err = InitGitRepo(orgId, planId)
+	if err != nil {
+		t.Fatalf("error initializing git repo: %v", err)
+	}
+
+	storeAndCommit := func(msg string, contexts ...*Context) {
+		for _, context := range contexts {
+			err := StoreContext(context)
+			if err != nil {
+				t.Fatalf("error storing context: %v", err)
+			}
+		}
+
+		err := GitAddAndCommit(orgId, planId, "main", msg)
+		if err != nil {
+			t.Fatalf("error committing: %v", err)
+		}
+	}
+
+	storeAndCommit("first", &Context{OrgId: orgId, PlanId: planId, ContextType: shared.ContextFileType, FilePath: "a.go", Body: "a"})
+	storeAndCommit("second", &Context{OrgId: orgId, PlanId: planId, ContextType: shared.ContextFileType, FilePath: "b.go", Body: "b"})
+
+	versions, err := ListPlanVersions(orgId, planId)
+	if err != nil {
+		t.Fatalf("error listing versions: %v", err)
+	}
+
+	if len(versions) != 2 || versions[0].Message != "second" || versions[1].Message != "first" {
+		t.Fatalf("expected versions second, first, got %+v", versions)
+	}
+
+	first := versions[1]
+
+	latest, changed, err := RestorePlanVersion(orgId, planId, first.Sha)
+	if err != nil {
+		t.Fatalf("error restoring version: %v", err)
+	}
+
+	if !changed || latest.Message != "⏪ Restored version "+first.Sha {
+		t.Errorf("expected a new restore version, got changed=%v latest=%+v", changed, latest)
+	}
+
+	contexts, err := GetPlanContexts(orgId, planId, false)
+	if err != nil {
+		t.Fatalf("error getting contexts: %v", err)
+	}
+
+	if len(contexts) != 1 || contexts[0].FilePath != "a.go" {
+		t.Errorf("expected only a.go after restoring, got %d contexts", len(contexts))
+	}
+
+	versions, err = ListPlanVersions(orgId, planId)
+	if err != nil {
+		t.Fatalf("error listing versions: %v", err)
+	}
+
+	if len(versions) != 3 {
+		t.Errorf("restoring should keep history, got %d versions", len(versions))
+	}
+
+	_, changed, err = RestorePlanVersion(orgId, planId, first.Sha)
+	if err != nil {
+		t.Fatalf("error restoring version again: %v", err)
+	}
+
+	if changed {
+		t.Errorf("restoring the current state shouldn't add a version")
+	}
+
+	if _, _, err := RestorePlanVersion(orgId, planId, "HEAD"); err != ErrUnknownCommit {
+		t.Errorf("expected ErrUnknownCommit, got %v", err)
+	}
+}
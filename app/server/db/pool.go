@@ -0,0 +1,122 @@
+package db
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the defaults leave room for a few server instances under postgres' default max_connections of 100
+const defaultMaxOpenConns = 25
+const defaultMaxIdleConns = 10
+const defaultConnMaxLifetime = 30 * time.Minute
+const defaultConnMaxIdleTime = 5 * time.Minute
+
+type poolConfig struct {
+	maxOpenConns    int
+	maxIdleConns    int
+	connMaxLifetime time.Duration
+	connMaxIdleTime time.Duration
+	// 0 means queries can run indefinitely
+	statementTimeout time.Duration
+}
+
+// getPoolConfig reads the connection pool settings from PLANDEX_DB_MAX_OPEN_CONNS,
+// PLANDEX_DB_MAX_IDLE_CONNS, PLANDEX_DB_CONN_MAX_LIFETIME, PLANDEX_DB_CONN_MAX_IDLE_TIME, and
+// PLANDEX_DB_STATEMENT_TIMEOUT. The statement timeout is enforced by postgres, so a slow query
+// is cancelled and its connection goes back to the pool even though the db helpers don't take
+// a context.
+func getPoolConfig() (*poolConfig, error) {
+	config := &poolConfig{
+		maxOpenConns:    defaultMaxOpenConns,
+		maxIdleConns:    defaultMaxIdleConns,
+		connMaxLifetime: defaultConnMaxLifetime,
+		connMaxIdleTime: defaultConnMaxIdleTime,
+	}
+
+	for _, setting := range []struct {
+		env string
+		val *int
+	}{
+		{"PLANDEX_DB_MAX_OPEN_CONNS", &config.maxOpenConns},
+		{"PLANDEX_DB_MAX_IDLE_CONNS", &config.maxIdleConns},
+	} {
+		s := os.Getenv(setting.env)
+		if s == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("%s must be an integer >= 1, got: %s", setting.env, s)
+		}
+		*setting.val = n
+	}
+
+	for _, setting := range []struct {
+		env string
+		val *time.Duration
+	}{
+		{"PLANDEX_DB_CONN_MAX_LIFETIME", &config.connMaxLifetime},
+		{"PLANDEX_DB_CONN_MAX_IDLE_TIME", &config.connMaxIdleTime},
+		{"PLANDEX_DB_STATEMENT_TIMEOUT", &config.statementTimeout},
+	} {
+		s := os.Getenv(setting.env)
+		if s == "" {
+			continue
+		}
+
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("%s must be a non-negative duration like 30s, got: %s", setting.env, s)
+		}
+		*setting.val = d
+	}
+
+	// database/sql would silently lower it anyway
+	if config.maxIdleConns > config.maxOpenConns {
+		config.maxIdleConns = config.maxOpenConns
+	}
+
+	return config, nil
+}
+
+// withRuntimeParams adds postgres runtime params to a connection string in either url or
+// key=value form. Params already in the connection string are left as they are.
+func withRuntimeParams(dbUrl string, params map[string]string) (string, error) {
+	if strings.HasPrefix(dbUrl, "postgres://") || strings.HasPrefix(dbUrl, "postgresql://") {
+		u, err := url.Parse(dbUrl)
+		if err != nil {
+			return "", fmt.Errorf("error parsing database url: %v", err)
+		}
+
+		q := u.Query()
+		for k, v := range params {
+			if !q.Has(k) {
+				q.Set(k, v)
+			}
+		}
+		u.RawQuery = q.Encode()
+
+		return u.String(), nil
+	}
+
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	res := dbUrl
+	for _, k := range keys {
+		if !strings.Contains(res, k+"=") {
+			res += " " + k + "=" + params[k]
+		}
+	}
+
+	return strings.TrimSpace(res), nil
+}
@@ -3,6 +3,8 @@ package db
 import (
 	"database/sql"
 	"fmt"
+
+	"github.com/plandex/plandex/shared"
 )
 
 func ProjectExists(orgId, projectId string) (bool, error) {
@@ -16,6 +18,44 @@ func ProjectExists(orgId, projectId string) (bool, error) {
 	return count > 0, nil
 }
 
+func GetProject(orgId, projectId string) (*Project, error) {
+	var project Project
+	err := Conn.Get(&project, "SELECT * FROM projects WHERE org_id = $1 AND id = $2", orgId, projectId)
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting project: %w", err)
+	}
+
+	return &project, nil
+}
+
+// SetProjectDefaultPlanVisibility returns false if the project isn't in the org
+func SetProjectDefaultPlanVisibility(orgId, projectId string, visibility shared.PlanVisibility) (bool, error) {
+	res, err := Conn.Exec("UPDATE projects SET default_plan_visibility = $1 WHERE org_id = $2 AND id = $3", visibility, orgId, projectId)
+
+	if err != nil {
+		return false, fmt.Errorf("error setting project default plan visibility: %v", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %v", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func ListOrgProjects(orgId string) ([]*Project, error) {
+	var projects []*Project
+	err := Conn.Select(&projects, "SELECT * FROM projects WHERE org_id = $1 ORDER BY name", orgId)
+
+	if err != nil {
+		return nil, fmt.Errorf("error listing projects: %v", err)
+	}
+
+	return projects, nil
+}
+
 func CreateProject(orgId, name string, tx *sql.Tx) (string, error) {
 	var projectId string
 	err := tx.QueryRow("INSERT INTO projects (org_id, name) VALUES ($1, $2) RETURNING id", orgId, name).Scan(&projectId)
@@ -26,3 +66,40 @@ func CreateProject(orgId, name string, tx *sql.Tx) (string, error) {
 
 	return projectId, nil
 }
+
+// GetDefaultProjectId returns the org's configured default project, or its only project if
+// it has exactly one. It returns an empty string if there's no unambiguous default.
+func GetDefaultProjectId(orgId string) (string, error) {
+	org, err := GetOrg(orgId)
+
+	if err != nil {
+		return "", fmt.Errorf("error getting org: %v", err)
+	}
+
+	if org.DefaultProjectId != nil {
+		return *org.DefaultProjectId, nil
+	}
+
+	var projectIds []string
+	err = Conn.Select(&projectIds, "SELECT id FROM projects WHERE org_id = $1 LIMIT 2", orgId)
+
+	if err != nil {
+		return "", fmt.Errorf("error listing projects: %v", err)
+	}
+
+	if len(projectIds) == 1 {
+		return projectIds[0], nil
+	}
+
+	return "", nil
+}
+
+func SetDefaultProjectId(orgId string, projectId *string) error {
+	_, err := Conn.Exec("UPDATE orgs SET default_project_id = $1 WHERE id = $2", projectId, orgId)
+
+	if err != nil {
+		return fmt.Errorf("error setting default project: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/lib/pq"
+	"github.com/plandex/plandex/shared"
+)
+
+const interruptedPlanError = "The server restarted while this plan was running"
+
+// a branch in one of these states is being driven by an in-memory active plan
+var reconcileRunningStatuses = []string{
+	string(shared.PlanStatusReplying),
+	string(shared.PlanStatusDescribing),
+	string(shared.PlanStatusBuilding),
+	string(shared.PlanStatusMissingFile),
+}
+
+// ReconcileInterruptedPlans runs on startup, before this instance serves requests. Active plans
+// only live in memory, so any stream left open under this instance's ip belongs to a previous
+// process and is finished, and every branch still marked running without a live stream on some
+// instance is set to interrupted. Running it again changes nothing. Returns the number of
+// branches reconciled.
+func ReconcileInterruptedPlans(ip string) (int, error) {
+	res, err := Conn.Exec("UPDATE model_streams SET finished_at = NOW() WHERE finished_at IS NULL AND internal_ip = $1", ip)
+
+	if err != nil {
+		return 0, fmt.Errorf("error finishing stale model streams: %v", err)
+	}
+
+	numStreams, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting rows affected: %v", err)
+	}
+
+	if numStreams > 0 {
+		log.Printf("Finished %d model streams left open by a previous process\n", numStreams)
+	}
+
+	// a stream with a recent heartbeat is still running on another instance. The updated_at check
+	// skips branches another instance has just started, before their stream is stored.
+	query := fmt.Sprintf(`UPDATE branches SET status = $1, error = $2
+		WHERE status = ANY($3)
+		AND deleted_at IS NULL
+		AND updated_at < NOW() - INTERVAL '%d seconds'
+		AND NOT EXISTS (
+			SELECT 1 FROM model_streams s
+			WHERE s.plan_id = branches.plan_id
+			AND s.branch = branches.name
+			AND s.finished_at IS NULL
+			AND s.last_heartbeat_at > NOW() - INTERVAL '%d seconds'
+		)`, int(modelStreamHeartbeatTimeout.Seconds()), int(modelStreamHeartbeatTimeout.Seconds()))
+
+	res, err = Conn.Exec(query, shared.PlanStatusInterrupted, interruptedPlanError, pq.Array(reconcileRunningStatuses))
+
+	if err != nil {
+		return 0, fmt.Errorf("error reconciling interrupted plans: %v", err)
+	}
+
+	numBranches, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting rows affected: %v", err)
+	}
+
+	return int(numBranches), nil
+}
@@ -0,0 +1,158 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CheckPlanDir returns an error describing what's wrong if a plan's directory or git repo is
+// missing, without changing anything. RepairPlanDir fixes what it finds.
+func CheckPlanDir(orgId, planId string) error {
+	dir := getPlanDir(orgId, planId)
+
+	for _, check := range []struct {
+		path string
+		desc string
+	}{
+		{dir, "plan directory"},
+		{filepath.Join(dir, ".git"), "git repository"},
+	} {
+		_, err := os.Stat(check.path)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%s is missing", check.desc)
+		} else if err != nil {
+			return fmt.Errorf("error checking %s: %v", check.desc, err)
+		}
+	}
+
+	return nil
+}
+
+// RepairPlanDir recreates a plan's directory, subdirectories, and git repo if any of them are
+// missing. It doesn't touch the repo lock since LockRepo itself needs a working repo. Returns
+// a description of each fix applied.
+func RepairPlanDir(orgId, planId string) ([]string, error) {
+	dir := getPlanDir(orgId, planId)
+
+	_, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		err = InitPlan(orgId, planId)
+		if err != nil {
+			return nil, fmt.Errorf("error recreating plan dir: %v", err)
+		}
+		return []string{"recreated missing plan directory"}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error checking plan dir: %v", err)
+	}
+
+	var fixes []string
+
+	for _, subdirFn := range [](func(orgId, planId string) string){
+		getPlanContextDir,
+		getPlanConversationDir,
+		getPlanResultsDir,
+		getPlanDescriptionsDir} {
+		subdir := subdirFn(orgId, planId)
+
+		_, err = os.Stat(subdir)
+		if os.IsNotExist(err) {
+			err = os.MkdirAll(subdir, os.ModePerm)
+			if err != nil {
+				return nil, fmt.Errorf("error creating plan subdir: %v", err)
+			}
+			fixes = append(fixes, fmt.Sprintf("recreated missing %s directory", filepath.Base(subdir)))
+		} else if err != nil {
+			return nil, fmt.Errorf("error checking plan subdir: %v", err)
+		}
+	}
+
+	_, err = os.Stat(filepath.Join(dir, ".git"))
+	if os.IsNotExist(err) {
+		err = InitGitRepo(orgId, planId)
+		if err != nil {
+			return nil, fmt.Errorf("error initializing git repo: %v", err)
+		}
+		fixes = append(fixes, "reinitialized missing git repository")
+	} else if err != nil {
+		return nil, fmt.Errorf("error checking git repo: %v", err)
+	}
+
+	return fixes, nil
+}
+
+// ReconcilePlanContexts removes context files that can't be loaded: a .meta without its .body,
+// a .body without its .meta, or a .meta that can't be parsed. Call with the repo locked.
+func ReconcilePlanContexts(orgId, planId string) ([]string, error) {
+	contextDir := getPlanContextDir(orgId, planId)
+
+	files, err := os.ReadDir(contextDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading context dir: %v", err)
+	}
+
+	metas := map[string]bool{}
+	bodies := map[string]bool{}
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		name := file.Name()
+		if strings.HasSuffix(name, ".meta") {
+			metas[strings.TrimSuffix(name, ".meta")] = true
+		} else if strings.HasSuffix(name, ".body") {
+			bodies[strings.TrimSuffix(name, ".body")] = true
+		}
+	}
+
+	var fixes []string
+
+	remove := func(filename, reason string) error {
+		err := os.Remove(filepath.Join(contextDir, filename))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing context file %s: %v", filename, err)
+		}
+		fixes = append(fixes, fmt.Sprintf("removed context file %s (%s)", filename, reason))
+		return nil
+	}
+
+	for id := range metas {
+		if !bodies[id] {
+			err = remove(id+".meta", "missing body")
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		metaBytes, err := os.ReadFile(filepath.Join(contextDir, id+".meta"))
+		if err != nil {
+			return nil, fmt.Errorf("error reading context meta file: %v", err)
+		}
+
+		var context Context
+		if json.Unmarshal(metaBytes, &context) != nil || context.Id != id {
+			for _, ext := range []string{".meta", ".body"} {
+				err = remove(id+ext, "invalid meta file")
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	for id := range bodies {
+		if !metas[id] {
+			err = remove(id+".body", "missing meta file")
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return fixes, nil
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReconcilePlanContexts(t *testing.T) {
+	origBaseDir := BaseDir
+	BaseDir = t.TempDir()
+	defer func() { BaseDir = origBaseDir }()
+
+	orgId := "org"
+	planId := "plan"
+	contextDir := getPlanContextDir(orgId, planId)
+
+	err := os.MkdirAll(contextDir, os.ModePerm)
+	if err != nil {
+		t.Fatalf("error creating context dir: %v", err)
+	}
+
+	files := map[string]string{
+		"ok.meta":       `{"id":"ok"}`,
+		"ok.body":       "body",
+		"nobody.meta":   `{"id":"nobody"}`,
+		"nometa.body":   "body",
+		"invalid.meta":  "{",
+		"invalid.body":  "body",
+		"mismatch.meta": `{"id":"other"}`,
+		"mismatch.body": "body",
+	}
+	for name, content := range files {
+		err = os.WriteFile(filepath.Join(contextDir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("error writing %s: %v", name, err)
+		}
+	}
+
+	fixes, err := ReconcilePlanContexts(orgId, planId)
+	if err != nil {
+		t.Fatalf("error reconciling contexts: %v", err)
+	}
+
+	if len(fixes) != 6 {
+		t.Errorf("expected 6 fixes, got %d: %v", len(fixes), fixes)
+	}
+
+	entries, err := os.ReadDir(contextDir)
+	if err != nil {
+		t.Fatalf("error reading context dir: %v", err)
+	}
+
+	var remaining []string
+	for _, entry := range entries {
+		remaining = append(remaining, entry.Name())
+	}
+
+	if len(remaining) != 2 || remaining[0] != "ok.body" || remaining[1] != "ok.meta" {
+		t.Errorf("expected only ok.body and ok.meta to remain, got %v", remaining)
+	}
+}
+
+func TestCheckPlanDir(t *testing.T) {
+	origBaseDir := BaseDir
+	BaseDir = t.TempDir()
+	defer func() { BaseDir = origBaseDir }()
+
+	orgId := "org"
+	planId := "plan"
+	dir := getPlanDir(orgId, planId)
+
+	if err := CheckPlanDir(orgId, planId); err == nil {
+		t.Errorf("expected an error for a missing plan dir")
+	}
+
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		t.Fatalf("error creating plan dir: %v", err)
+	}
+
+	if err := CheckPlanDir(orgId, planId); err == nil {
+		t.Errorf("expected an error for a missing git repo")
+	}
+
+	err = os.MkdirAll(filepath.Join(dir, ".git"), os.ModePerm)
+	if err != nil {
+		t.Fatalf("error creating git dir: %v", err)
+	}
+
+	if err := CheckPlanDir(orgId, planId); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
@@ -323,8 +323,23 @@ func GetPlanResult(planFileResults []*shared.PlanFileResult) *shared.PlanResult
 }
 
 func ApplyPlan(orgId, userId, branchName string, plan *Plan) error {
+	return ApplyPlanFiles(orgId, userId, branchName, plan, nil)
+}
+
+// ApplyPlanFiles is ApplyPlan for only the pending results for paths, leaving the rest pending.
+// A nil paths applies everything. The convo's message descriptions are only marked applied once
+// nothing is left pending.
+func ApplyPlanFiles(orgId, userId, branchName string, plan *Plan, paths []string) error {
 	planId := plan.Id
 
+	var pathsSet map[string]bool
+	if paths != nil {
+		pathsSet = make(map[string]bool, len(paths))
+		for _, path := range paths {
+			pathsSet[path] = true
+		}
+	}
+
 	resultsDir := getPlanResultsDir(orgId, planId)
 
 	errCh := make(chan error)
@@ -379,14 +394,24 @@ func ApplyPlan(orgId, userId, branchName string, plan *Plan) error {
 	}
 
 	var pendingDbResults []*PlanFileResult
+	leftPending := false
 
 	for _, result := range results {
 		apiResult := result.ToApi()
 		if apiResult.IsPending() {
+			if pathsSet != nil && !pathsSet[result.Path] {
+				leftPending = true
+				continue
+			}
 			pendingDbResults = append(pendingDbResults, result)
 		}
 	}
 
+	descriptionsToApply := convoMessageDescriptions
+	if leftPending {
+		descriptionsToApply = nil
+	}
+
 	pendingNewFilesSet := make(map[string]bool)
 	pendingUpdatedFilesSet := make(map[string]bool)
 	for _, result := range pendingDbResults {
@@ -442,7 +467,7 @@ func ApplyPlan(orgId, userId, branchName string, plan *Plan) error {
 		}(result)
 	}
 
-	for _, description := range convoMessageDescriptions {
+	for _, description := range descriptionsToApply {
 		go func(description *ConvoMessageDescription) {
 			description.AppliedAt = &now
 
@@ -523,7 +548,7 @@ func ApplyPlan(orgId, userId, branchName string, plan *Plan) error {
 	}
 
 	numRoutines := len(pendingDbResults) +
-		len(convoMessageDescriptions)
+		len(descriptionsToApply)
 	if len(pendingNewFilesSet) > 0 {
 		numRoutines++
 	}
@@ -539,6 +564,9 @@ func ApplyPlan(orgId, userId, branchName string, plan *Plan) error {
 	}
 
 	msg := "✅ Marked pending results as applied"
+	if leftPending {
+		msg = fmt.Sprintf("✅ Marked pending results for %d files as applied", len(pathsSet))
+	}
 
 	if loadContextRes != nil && !loadContextRes.MaxTokensExceeded {
 		msg += "\n\n" + loadContextRes.Msg
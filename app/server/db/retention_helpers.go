@@ -0,0 +1,215 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/plandex/plandex/shared"
+)
+
+const planRetentionInterval = 1 * time.Hour
+
+// arbitrary key for pg_try_advisory_xact_lock so only one server instance applies retention at a time
+const planRetentionLockKey = 1874230519
+
+// plans on a branch in one of these states are never expired, even if updated_at is stale
+var planRetentionActiveStatuses = []string{
+	string(shared.PlanStatusReplying),
+	string(shared.PlanStatusDescribing),
+	string(shared.PlanStatusBuilding),
+}
+
+// StartPlanRetentionJob applies every org's auto-archive and auto-delete settings once an hour.
+// Set PLANDEX_DISABLE_PLAN_RETENTION to turn it off on a given instance.
+func StartPlanRetentionJob() {
+	if os.Getenv("PLANDEX_DISABLE_PLAN_RETENTION") != "" {
+		log.Println("Plan retention job disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(planRetentionInterval)
+		defer ticker.Stop()
+
+		for {
+			err := ApplyPlanRetention()
+			if err != nil {
+				log.Printf("Error applying plan retention: %v\n", err)
+			}
+
+			<-ticker.C
+		}
+	}()
+}
+
+// ApplyPlanRetention archives plans untouched for auto_archive_after_days, then deletes plans that
+// have been archived for a further auto_delete_after_days. Pinned plans are never expired.
+func ApplyPlanRetention() error {
+	var orgs []*Org
+	err := Conn.Select(&orgs, "SELECT * FROM orgs WHERE auto_archive_after_days IS NOT NULL OR auto_delete_after_days IS NOT NULL")
+
+	if err != nil {
+		return fmt.Errorf("error getting orgs with retention settings: %v", err)
+	}
+
+	// one org failing shouldn't hold up retention for the rest
+	for _, org := range orgs {
+		if org.AutoArchiveAfterDays != nil {
+			err = autoArchiveOrgPlans(org.Id, *org.AutoArchiveAfterDays)
+			if err != nil {
+				log.Printf("Error auto-archiving plans for org %s: %v\n", org.Id, err)
+			}
+		}
+
+		if org.AutoDeleteAfterDays != nil {
+			err = autoDeleteOrgPlans(org.Id, *org.AutoDeleteAfterDays)
+			if err != nil {
+				log.Printf("Error auto-deleting plans for org %s: %v\n", org.Id, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func autoArchiveOrgPlans(orgId string, days int) error {
+	tx, err := Conn.Beginx()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Printf("transaction rollback error: %v\n", rbErr)
+			}
+		}
+	}()
+
+	var locked bool
+	err = tx.Get(&locked, "SELECT pg_try_advisory_xact_lock($1)", planRetentionLockKey)
+	if err != nil {
+		return fmt.Errorf("error acquiring retention lock: %v", err)
+	}
+
+	if !locked {
+		log.Println("Plan retention already running on another instance")
+		return tx.Rollback()
+	}
+
+	var archived []*Plan
+	err = tx.Select(&archived, `
+		UPDATE plans SET archived_at = NOW()
+		WHERE org_id = $1
+			AND archived_at IS NULL
+			AND NOT pinned
+			AND name != 'draft'
+			AND updated_at < NOW() - make_interval(days => $2)
+			AND NOT EXISTS (SELECT 1 FROM branches WHERE branches.plan_id = plans.id AND branches.status = ANY($3))
+		RETURNING *`, orgId, days, pq.Array(planRetentionActiveStatuses))
+
+	if err != nil {
+		return fmt.Errorf("error archiving plans: %v", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+
+	for _, plan := range archived {
+		InvalidatePlanCache(plan.Id)
+		PublishPlanArchived(plan)
+	}
+
+	if len(archived) > 0 {
+		log.Printf("Auto-archived %d plans for org %s\n", len(archived), orgId)
+	}
+
+	return nil
+}
+
+func autoDeleteOrgPlans(orgId string, days int) error {
+	tx, err := Conn.Beginx()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+
+	var trashPaths map[string]string
+
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Printf("transaction rollback error: %v\n", rbErr)
+			}
+			RestoreTrashedPlanDirs(orgId, trashPaths)
+		}
+	}()
+
+	var locked bool
+	err = tx.Get(&locked, "SELECT pg_try_advisory_xact_lock($1)", planRetentionLockKey)
+	if err != nil {
+		return fmt.Errorf("error acquiring retention lock: %v", err)
+	}
+
+	if !locked {
+		log.Println("Plan retention already running on another instance")
+		return tx.Rollback()
+	}
+
+	// lock the rows so the dirs moved to the trash are exactly the ones deleted
+	var deleted []*Plan
+	err = tx.Select(&deleted, `
+		SELECT * FROM plans
+		WHERE org_id = $1
+			AND archived_at IS NOT NULL
+			AND NOT pinned
+			AND archived_at < NOW() - make_interval(days => $2)
+			AND NOT EXISTS (SELECT 1 FROM branches WHERE branches.plan_id = plans.id AND branches.status = ANY($3))
+		FOR UPDATE`, orgId, days, pq.Array(planRetentionActiveStatuses))
+
+	if err != nil {
+		return fmt.Errorf("error getting expired plans: %v", err)
+	}
+
+	if len(deleted) == 0 {
+		return tx.Rollback()
+	}
+
+	var ids []string
+	for _, plan := range deleted {
+		ids = append(ids, plan.Id)
+	}
+
+	trashPaths, err = TrashPlanDirs(orgId, ids)
+	if err != nil {
+		return err
+	}
+
+	// no tombstones: they're there so a user retrying their own delete gets a success rather than
+	// a 404, and no user issued this one. deleted_plans.deleted_by also requires a user.
+	_, err = tx.Exec("DELETE FROM plans WHERE id = ANY($1)", pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("error deleting plans: %v", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+
+	InvalidatePlanCache(ids...)
+
+	for _, plan := range deleted {
+		PublishPlanDeleted(plan)
+	}
+
+	PurgeTrashedPlanDirs(trashPaths)
+
+	log.Printf("Auto-deleted %d plans for org %s\n", len(deleted), orgId)
+
+	return nil
+}
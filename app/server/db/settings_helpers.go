@@ -70,3 +70,42 @@ func StorePlanSettings(plan *Plan, settings *shared.PlanSettings) error {
 
 	return nil
 }
+
+// GetOrgDefaults returns the plan settings new plans in the org start with, or nil if the org
+// hasn't set any
+func GetOrgDefaults(orgId string) (*shared.PlanSettings, error) {
+	org, err := GetOrg(orgId)
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting org: %v", err)
+	}
+
+	return org.GetDefaultPlanSettings()
+}
+
+func (org *Org) GetDefaultPlanSettings() (*shared.PlanSettings, error) {
+	if org.DefaultPlanSettings == nil {
+		return nil, nil
+	}
+
+	var settings shared.PlanSettings
+	err := json.Unmarshal(org.DefaultPlanSettings, &settings)
+
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling org default plan settings: %v", err)
+	}
+
+	return &settings, nil
+}
+
+// ResolveNewPlanSettings fills in anything the org defaults leave unset so that the stored settings
+// don't change if the server defaults do
+func ResolveNewPlanSettings(orgDefaults *shared.PlanSettings) *shared.PlanSettings {
+	settings := *orgDefaults
+	if settings.ModelSet == nil {
+		modelSet := shared.DefaultModelSet
+		settings.ModelSet = &modelSet
+	}
+	settings.UpdatedAt = time.Now()
+	return &settings
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const shareLinkTokenBytes = 32
+
+func hashShareLinkToken(token string) string {
+	hashBytes := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hashBytes[:])
+}
+
+// CreatePlanShareLink returns the plaintext token, which is never stored
+func CreatePlanShareLink(orgId, planId, creatorId string, expiresAt time.Time) (*PlanShareLink, string, error) {
+	tokenBytes := make([]byte, shareLinkTokenBytes)
+	_, err := rand.Read(tokenBytes)
+	if err != nil {
+		return nil, "", fmt.Errorf("error generating share link token: %v", err)
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	link := PlanShareLink{
+		OrgId:     orgId,
+		PlanId:    planId,
+		CreatorId: creatorId,
+		TokenHash: hashShareLinkToken(token),
+		ExpiresAt: expiresAt,
+	}
+
+	err = Conn.QueryRow(
+		"INSERT INTO plan_share_links (org_id, plan_id, creator_id, token_hash, expires_at) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at",
+		orgId, planId, creatorId, link.TokenHash, expiresAt,
+	).Scan(&link.Id, &link.CreatedAt)
+
+	if err != nil {
+		return nil, "", fmt.Errorf("error creating share link: %v", err)
+	}
+
+	return &link, token, nil
+}
+
+func ListActivePlanShareLinks(planId string) ([]*PlanShareLink, error) {
+	var links []*PlanShareLink
+	err := Conn.Select(&links, "SELECT * FROM plan_share_links WHERE plan_id = $1 AND revoked_at IS NULL AND expires_at > NOW() ORDER BY created_at DESC", planId)
+
+	if err != nil {
+		return nil, fmt.Errorf("error listing share links: %v", err)
+	}
+
+	return links, nil
+}
+
+// RevokePlanShareLink returns false if there's no active link with that id for the plan
+func RevokePlanShareLink(planId, linkId string) (bool, error) {
+	res, err := Conn.Exec("UPDATE plan_share_links SET revoked_at = NOW() WHERE id = $1 AND plan_id = $2 AND revoked_at IS NULL", linkId, planId)
+
+	if err != nil {
+		return false, fmt.Errorf("error revoking share link: %v", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %v", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// ValidatePlanShareToken returns the plan if the token is an active share link for it, nil otherwise
+func ValidatePlanShareToken(planId, token string) (*Plan, error) {
+	var link PlanShareLink
+	err := Conn.Get(&link, "SELECT * FROM plan_share_links WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW()", hashShareLinkToken(token))
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error validating share token: %v", err)
+	}
+
+	if link.PlanId != planId {
+		return nil, nil
+	}
+
+	plan, err := GetPlan(planId)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error getting plan: %v", err)
+	}
+
+	if plan.OrgId != link.OrgId {
+		return nil, nil
+	}
+
+	return plan, nil
+}
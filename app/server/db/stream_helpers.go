@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -14,26 +15,59 @@ import (
 const modelStreamHeartbeatInterval = 1 * time.Second
 const modelStreamHeartbeatTimeout = 5 * time.Second
 
+// ErrPlanBusy means another run already holds the stream for the plan branch, possibly on
+// another host
+var ErrPlanBusy = errors.New("plan branch already has a running stream")
+
+// StoreModelStream records the stream and keeps its heartbeat alive until ctx is done. The
+// stream acts as the lock on starting a run: the check for a live stream and the insert happen
+// under an advisory lock on the plan branch, so of two concurrent starts, the second gets
+// ErrPlanBusy. It's released when the stream finishes, or by ReconcileInterruptedPlans for
+// streams left open by a crashed process.
 func StoreModelStream(stream *ModelStream, ctx context.Context, cancelFn context.CancelFunc) error {
-	query := `INSERT INTO model_streams (org_id, plan_id, internal_ip, branch) VALUES (:org_id, :plan_id, :internal_ip, :branch) RETURNING id, created_at`
+	tx, err := Conn.Beginx()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
 
-	row, err := Conn.NamedQuery(query, stream)
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Printf("transaction rollback error: %v\n", rbErr)
+			}
+		}
+	}()
 
+	_, err = tx.Exec("SELECT pg_advisory_xact_lock(hashtext('model_stream:' || $1 || ':' || $2))", stream.PlanId, stream.Branch)
 	if err != nil {
-		return fmt.Errorf("error storing model stream: %v", err)
+		return fmt.Errorf("error locking plan branch: %v", err)
+	}
+
+	var busy bool
+	err = tx.Get(&busy, fmt.Sprintf(`SELECT EXISTS (
+		SELECT 1 FROM model_streams
+		WHERE plan_id = $1 AND branch = $2 AND finished_at IS NULL
+		AND last_heartbeat_at > NOW() - INTERVAL '%d seconds'
+	)`, int(modelStreamHeartbeatTimeout.Seconds())), stream.PlanId, stream.Branch)
+	if err != nil {
+		return fmt.Errorf("error checking for running stream: %v", err)
 	}
 
-	defer row.Close()
+	if busy {
+		err = ErrPlanBusy
+		return err
+	}
 
-	if row.Next() {
-		var createdAt time.Time
-		var id string
-		if err := row.Scan(&id, &createdAt); err != nil {
-			return fmt.Errorf("error storing model stream: %v", err)
-		}
+	query := `INSERT INTO model_streams (org_id, plan_id, internal_ip, branch) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
 
-		stream.Id = id
-		stream.CreatedAt = createdAt
+	err = tx.QueryRow(query, stream.OrgId, stream.PlanId, stream.InternalIp, stream.Branch).Scan(&stream.Id, &stream.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error storing model stream: %v", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
 	}
 
 	// Start a goroutine to keep the lock alive
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/plandex/plandex/shared"
+)
+
+type PlanFileTreeFilter struct {
+	// files must have one of these extensions, compared case-insensitively, e.g. ".go"
+	Exts []string
+	// files must match this slash-separated pattern, where ** matches any number of dirs
+	Glob string
+	// "file" or "dir" to only return that kind of entry; empty for both
+	Type string
+}
+
+// ValidateTreeGlob checks that each segment of a glob is a valid path.Match pattern
+func ValidateTreeGlob(glob string) error {
+	for _, segment := range strings.Split(glob, "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return fmt.Errorf("invalid glob segment '%s': %v", segment, err)
+		}
+	}
+	return nil
+}
+
+func (f PlanFileTreeFilter) matchesFile(filePath string) bool {
+	if len(f.Exts) > 0 {
+		ext := path.Ext(filePath)
+		matched := false
+		for _, e := range f.Exts {
+			if ext != "" && strings.EqualFold(ext, e) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if f.Glob != "" && !matchTreeGlob(strings.Split(f.Glob, "/"), strings.Split(filePath, "/")) {
+		return false
+	}
+
+	return true
+}
+
+func (f PlanFileTreeFilter) matchesType(entry *shared.PlanFileTreeEntry) bool {
+	switch f.Type {
+	case "file":
+		return !entry.IsDir
+	case "dir":
+		return entry.IsDir
+	}
+	return true
+}
+
+// matchTreeGlob matches path segments against glob segments, with path.Match for each segment
+// and ** matching zero or more segments
+func matchTreeGlob(glob, parts []string) bool {
+	if len(glob) == 0 {
+		return len(parts) == 0
+	}
+
+	if glob[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if matchTreeGlob(glob[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(parts) == 0 {
+		return false
+	}
+
+	// patterns are validated up front, so an error here just means no match
+	matched, err := path.Match(glob[0], parts[0])
+	if err != nil || !matched {
+		return false
+	}
+
+	return matchTreeGlob(glob[1:], parts[1:])
+}
+
+// GetPlanFileTree returns the files tracked in the plan's context along with their parent dirs,
+// sorted by path. A depth > 0 omits entries nested more than depth levels deep. The filter's
+// extensions and glob select files, and only dirs containing a selected file are returned.
+func GetPlanFileTree(orgId, planId string, depth int, filter PlanFileTreeFilter) ([]*shared.PlanFileTreeEntry, error) {
+	contexts, err := GetPlanContexts(orgId, planId, false)
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting contexts: %v", err)
+	}
+
+	contextDir := getPlanContextDir(orgId, planId)
+
+	entriesByPath := map[string]*shared.PlanFileTreeEntry{}
+
+	for _, context := range contexts {
+		if context.FilePath == "" {
+			continue
+		}
+
+		filePath := path.Clean(filepath.ToSlash(context.FilePath))
+		if !filter.matchesFile(filePath) {
+			continue
+		}
+
+		parts := strings.Split(filePath, "/")
+
+		// parent dirs, up to the depth limit
+		for i := 1; i < len(parts); i++ {
+			if depth > 0 && i > depth {
+				break
+			}
+			dir := strings.Join(parts[:i], "/")
+			if _, ok := entriesByPath[dir]; !ok {
+				entriesByPath[dir] = &shared.PlanFileTreeEntry{Path: dir, IsDir: true}
+			}
+		}
+
+		if depth > 0 && len(parts) > depth {
+			continue
+		}
+
+		updatedAt := context.UpdatedAt
+		entry := &shared.PlanFileTreeEntry{
+			Path:      filePath,
+			Sha:       context.Sha,
+			UpdatedAt: &updatedAt,
+		}
+
+		info, err := os.Stat(filepath.Join(contextDir, context.Id+".body"))
+		if err != nil {
+			return nil, fmt.Errorf("error getting context body size: %v", err)
+		}
+		entry.Size = info.Size()
+
+		entriesByPath[filePath] = entry
+	}
+
+	entries := make([]*shared.PlanFileTreeEntry, 0, len(entriesByPath))
+	for _, entry := range entriesByPath {
+		if filter.matchesType(entry) {
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+
+	return entries, nil
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/plandex/plandex/shared"
+)
+
+func TestMatchTreeGlob(t *testing.T) {
+	tests := []struct {
+		glob string
+		path string
+		want bool
+	}{
+		{"src/**", "src/main.go", true},
+		{"src/**", "src/lib/util/util.go", true},
+		{"src/**", "other/main.go", false},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "a/b/c.go", true},
+		{"**/*.go", "a/b/c.md", false},
+		{"src/*.go", "src/lib/util.go", false},
+		{"src/**/util.go", "src/util.go", true},
+		{"src/**/util.go", "src/a/b/util.go", true},
+		{"*.md", "docs/readme.md", false},
+	}
+
+	for _, tt := range tests {
+		got := matchTreeGlob(strings.Split(tt.glob, "/"), strings.Split(tt.path, "/"))
+		if got != tt.want {
+			t.Errorf("matchTreeGlob(%q, %q) = %v, want %v", tt.glob, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestPlanFileTreeFilter(t *testing.T) {
+	f := PlanFileTreeFilter{Exts: []string{".go", ".MD"}, Glob: "src/**"}
+
+	for path, want := range map[string]bool{
+		"src/main.go":   true,
+		"src/README.md": true,
+		"src/Makefile":  false,
+		"main.go":       false,
+	} {
+		if got := f.matchesFile(path); got != want {
+			t.Errorf("matchesFile(%q) = %v, want %v", path, got, want)
+		}
+	}
+
+	dir := &shared.PlanFileTreeEntry{Path: "src", IsDir: true}
+	file := &shared.PlanFileTreeEntry{Path: "src/main.go"}
+
+	if !(PlanFileTreeFilter{Type: "dir"}).matchesType(dir) || (PlanFileTreeFilter{Type: "dir"}).matchesType(file) {
+		t.Errorf("type dir should only match dirs")
+	}
+	if (PlanFileTreeFilter{Type: "file"}).matchesType(dir) || !(PlanFileTreeFilter{}).matchesType(dir) {
+		t.Errorf("type file should only match files, and no type should match both")
+	}
+
+	if err := ValidateTreeGlob("src/[a-"); err == nil {
+		t.Errorf("expected an error for a malformed glob")
+	}
+}
@@ -97,6 +97,42 @@ func ListUsers(orgId string) ([]*User, error) {
 	return users, nil
 }
 
+// GetNonOrgUserIds returns the ids in userIds that aren't members of the org
+func GetNonOrgUserIds(orgId string, userIds []string) ([]string, error) {
+	var memberIds []string
+	err := Conn.Select(&memberIds, "SELECT user_id FROM orgs_users WHERE org_id = $1 AND user_id = ANY($2)", orgId, pq.Array(userIds))
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting org users: %v", err)
+	}
+
+	isMember := map[string]bool{}
+	for _, id := range memberIds {
+		isMember[id] = true
+	}
+
+	var res []string
+	for _, id := range userIds {
+		if !isMember[id] {
+			res = append(res, id)
+		}
+	}
+
+	return res, nil
+}
+
+func GetUsersForIds(userIds []string) ([]*User, error) {
+	var users []*User
+
+	err := Conn.Select(&users, "SELECT * FROM users WHERE id = ANY($1)", pq.Array(userIds))
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting users: %v", err)
+	}
+
+	return users, nil
+}
+
 func CreateUser(user *User, tx *sql.Tx) error {
 	return tx.QueryRow("INSERT INTO users (name, email, domain, is_trial) VALUES ($1, $2, $3, $4) RETURNING id", user.Name, user.Email, user.Domain, user.IsTrial).Scan(&user.Id)
 }
@@ -10,3 +10,11 @@ func IsNonUniqueErr(err error) bool {
 	}
 	return false
 }
+
+// IsNonUniqueErrOn is IsNonUniqueErr limited to violations of the given constraint or index
+func IsNonUniqueErrOn(err error, constraint string) bool {
+	if err, ok := err.(*pq.Error); ok {
+		return err.Code == "23505" && err.Constraint == constraint
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+const webhookSecretBytes = 32
+
+// GetOrCreatePlanWebhookSecret returns the secret the plan's notification webhooks are signed
+// with, generating it the first time it's needed
+func GetOrCreatePlanWebhookSecret(planId string) (string, error) {
+	return getOrCreateWebhookSecret("UPDATE plans SET notify_webhook_secret = COALESCE(notify_webhook_secret, $2) WHERE id = $1 RETURNING notify_webhook_secret", planId)
+}
+
+// GetOrCreateOrgAuditWebhookSecret returns the secret the org's audit webhooks are signed with,
+// generating it the first time it's needed
+func GetOrCreateOrgAuditWebhookSecret(orgId string) (string, error) {
+	return getOrCreateWebhookSecret("UPDATE orgs SET audit_webhook_secret = COALESCE(audit_webhook_secret, $2) WHERE id = $1 RETURNING audit_webhook_secret", orgId)
+}
+
+func getOrCreateWebhookSecret(query, id string) (string, error) {
+	secretBytes := make([]byte, webhookSecretBytes)
+	_, err := rand.Read(secretBytes)
+	if err != nil {
+		return "", fmt.Errorf("error generating webhook secret: %v", err)
+	}
+
+	// the generated secret is only stored if there isn't one yet
+	var secret string
+	err = Conn.QueryRow(query, id, hex.EncodeToString(secretBytes)).Scan(&secret)
+
+	if err != nil {
+		return "", fmt.Errorf("error getting webhook secret: %v", err)
+	}
+
+	return secret, nil
+}
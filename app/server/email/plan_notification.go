@@ -0,0 +1,45 @@
+package email
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"os"
+
+	"github.com/gen2brain/beeep"
+)
+
+// SendPlanNotificationEmail tells the plan owner that a plan finished or failed. errStr is empty
+// for a plan that finished.
+func SendPlanNotificationEmail(email, planName, branch, errStr string) error {
+	outcome := "finished"
+	if errStr != "" {
+		outcome = "failed"
+	}
+
+	if os.Getenv("GOENV") == "production" {
+		subject := fmt.Sprintf("Plandex plan '%s' %s", planName, outcome)
+
+		htmlBody := fmt.Sprintf("<p>Hi there,</p><p>Your plan <strong>%s</strong> %s on branch <strong>%s</strong>.</p>", html.EscapeString(planName), outcome, html.EscapeString(branch))
+		textBody := fmt.Sprintf("Hi there,\n\nYour plan %s %s on branch %s.", planName, outcome, branch)
+
+		if errStr != "" {
+			htmlBody += fmt.Sprintf("<p>Error:<br><code>%s</code></p>", html.EscapeString(errStr))
+			textBody += fmt.Sprintf("\n\nError:\n%s", errStr)
+		}
+
+		if os.Getenv("IS_CLOUD") == "" {
+			return sendEmailViaSMTP(email, subject, htmlBody, textBody)
+		} else {
+			return sendEmailViaSES(email, subject, htmlBody, textBody)
+		}
+	}
+
+	if os.Getenv("GOENV") == "development" {
+		log.Printf("Development mode: plan %s %s, notification for %s", planName, outcome, email)
+
+		beeep.Notify("Plan "+outcome, fmt.Sprintf("Plan %s %s (email not sent in development)", planName, outcome), "") // ignore error
+	}
+
+	return nil
+}
@@ -7,13 +7,14 @@ import (
 	"log"
 	"net/http"
 	"plandex-server/db"
+	"plandex-server/logger"
 	"strings"
 
 	"github.com/plandex/plandex/shared"
 )
 
 func StartTrialHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for StartTrialHandler")
+	logger.Debugln("Received request for StartTrialHandler")
 
 	// start a transaction
 	tx, err := db.Conn.Begin()
@@ -127,7 +128,7 @@ func StartTrialHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func CreateAccountHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for CreateAccountHandler")
+	logger.Debugln("Received request for CreateAccountHandler")
 
 	// read the request body
 	body, err := io.ReadAll(r.Body)
@@ -293,7 +294,7 @@ func CreateAccountHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func ConvertTrialHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for ConvertTrialHandler")
+	logger.Debugln("Received request for ConvertTrialHandler")
 
 	auth := authenticate(w, r, true)
 	if auth == nil {
@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"plandex-server/db"
@@ -12,6 +15,11 @@ import (
 	"github.com/plandex/plandex/shared"
 )
 
+var (
+	errPlanNotFound  = errors.New("plan not found")
+	errPlanForbidden = errors.New("no permission for plan")
+)
+
 func authenticate(w http.ResponseWriter, r *http.Request, requireOrg bool) *types.ServerAuth {
 	log.Println("authenticating request")
 
@@ -51,6 +59,10 @@ func authenticate(w http.ResponseWriter, r *http.Request, requireOrg bool) *type
 		return nil
 	}
 
+	if db.IsPlanApiKeyToken(parsed.Token) {
+		return authenticatePlanApiKey(w, r, &parsed)
+	}
+
 	// validate the token
 	authToken, err := db.ValidateAuthToken(parsed.Token)
 
@@ -87,7 +99,7 @@ func authenticate(w http.ResponseWriter, r *http.Request, requireOrg bool) *type
 	}
 
 	// validate the org membership
-	isMember, err := db.ValidateOrgMembership(authToken.UserId, parsed.OrgId)
+	isMember, err := db.ValidateOrgMembershipCached(authToken.UserId, parsed.OrgId)
 
 	if err != nil {
 		log.Printf("error validating org membership: %v\n", err)
@@ -124,7 +136,7 @@ func authenticate(w http.ResponseWriter, r *http.Request, requireOrg bool) *type
 	}
 
 	// get user permissions
-	permissions, err := db.GetUserPermissions(authToken.UserId, parsed.OrgId)
+	permissions, err := db.GetUserPermissionsCached(authToken.UserId, parsed.OrgId)
 
 	if err != nil {
 		log.Printf("error getting user permissions: %v\n", err)
@@ -152,7 +164,7 @@ func authenticate(w http.ResponseWriter, r *http.Request, requireOrg bool) *type
 func authorizeProject(w http.ResponseWriter, projectId string, auth *types.ServerAuth) bool {
 	log.Println("authorizing project")
 
-	projectExists, err := db.ProjectExists(auth.OrgId, projectId)
+	projectExists, err := db.ProjectExistsCached(auth.OrgId, projectId)
 
 	if err != nil {
 		log.Printf("error validating project: %v\n", err)
@@ -183,6 +195,21 @@ func authorizeProjectRename(w http.ResponseWriter, projectId string, auth *types
 	return true
 }
 
+func authorizeProjectSettings(w http.ResponseWriter, projectId string, auth *types.ServerAuth) bool {
+	if !authorizeProject(w, projectId, auth) {
+		return false
+	}
+
+	// changing settings is gated the same as renaming
+	if !auth.HasPermission(types.PermissionRenameAnyProject) {
+		log.Println("User does not have permission to update project settings")
+		http.Error(w, "User does not have permission to update project settings", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
 func authorizeProjectDelete(w http.ResponseWriter, projectId string, auth *types.ServerAuth) bool {
 	if !authorizeProject(w, projectId, auth) {
 		return false
@@ -198,9 +225,18 @@ func authorizeProjectDelete(w http.ResponseWriter, projectId string, auth *types
 }
 
 func authorizePlan(w http.ResponseWriter, planId string, auth *types.ServerAuth) *db.Plan {
+	return authorizePlanWith(w, planId, auth, db.ValidatePlanAccess)
+}
+
+// authorizePlanCached reads the plan through the plan cache, so it's only for read-only handlers
+func authorizePlanCached(w http.ResponseWriter, planId string, auth *types.ServerAuth) *db.Plan {
+	return authorizePlanWith(w, planId, auth, db.ValidatePlanAccessCached)
+}
+
+func authorizePlanWith(w http.ResponseWriter, planId string, auth *types.ServerAuth, validate func(planId, userId, orgId string) (*db.Plan, error)) *db.Plan {
 	log.Println("authorizing plan")
 
-	plan, err := db.ValidatePlanAccess(planId, auth.User.Id, auth.OrgId)
+	plan, err := validate(planId, auth.User.Id, auth.OrgId)
 
 	if err != nil {
 		log.Printf("error validating plan membership: %v\n", err)
@@ -233,20 +269,73 @@ func authorizePlanUpdate(w http.ResponseWriter, planId string, auth *types.Serve
 	return plan
 }
 
-func authorizePlanDelete(w http.ResponseWriter, planId string, auth *types.ServerAuth) *db.Plan {
-	plan := authorizePlan(w, planId, auth)
+// authorizePlanDelete doesn't write to the response so that callers can map
+// errPlanNotFound / errPlanForbidden / other errors to the right status code
+// with writePlanAuthErr
+func authorizePlanDelete(planId string, auth *types.ServerAuth) (*db.Plan, error) {
+	log.Println("authorizing plan delete")
 
-	if plan == nil {
-		return nil
+	plan, err := db.GetPlan(planId)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errPlanNotFound
+		}
+		return nil, fmt.Errorf("error getting plan: %v", err)
 	}
 
-	if plan.OwnerId != auth.User.Id && !auth.HasPermission(types.PermissionDeleteAnyPlan) {
-		log.Println("User does not have permission to delete plan")
-		http.Error(w, "User does not have permission to delete plan", http.StatusForbidden)
-		return nil
+	if plan.OrgId == auth.OrgId {
+		projectExists, err := db.ProjectExistsCached(auth.OrgId, plan.ProjectId)
+
+		if err != nil {
+			return nil, fmt.Errorf("error validating project: %v", err)
+		}
+
+		if !projectExists {
+			return nil, errPlanNotFound
+		}
 	}
 
-	return plan
+	err = checkPlanDeleteAccess(plan, auth)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+func checkPlanDeleteAccess(plan *db.Plan, auth *types.ServerAuth) error {
+	// plans in other orgs are reported as missing so we don't leak their existence
+	if plan == nil || plan.OrgId != auth.OrgId {
+		return errPlanNotFound
+	}
+
+	// the plan exists in the org, so a plan the user can't see is forbidden rather than missing
+	if !db.CanUserViewPlan(plan, auth.User.Id) {
+		return errPlanForbidden
+	}
+
+	// only the owner can delete a plan, even with the delete any plan permission
+	if plan.OwnerId != auth.User.Id {
+		return errPlanForbidden
+	}
+
+	return nil
+}
+
+func writePlanAuthErr(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errPlanNotFound):
+		log.Println("plan not found")
+		http.Error(w, "plan not found", http.StatusNotFound)
+	case errors.Is(err, errPlanForbidden):
+		log.Println("user does not have permission for plan")
+		http.Error(w, "User does not have permission for plan", http.StatusForbidden)
+	default:
+		log.Printf("error authorizing plan: %v\n", err)
+		http.Error(w, "error authorizing plan: "+err.Error(), http.StatusInternalServerError)
+	}
 }
 
 func authorizePlanRename(w http.ResponseWriter, planId string, auth *types.ServerAuth) *db.Plan {
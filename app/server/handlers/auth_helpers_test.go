@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"plandex-server/db"
+	"plandex-server/types"
+	"testing"
+	"time"
+)
+
+func TestCheckPlanDeleteAccess(t *testing.T) {
+	owner := &db.User{Id: "owner"}
+	other := &db.User{Id: "other"}
+
+	sharedAt := time.Now()
+	plan := &db.Plan{Id: "plan", OrgId: "org", OwnerId: owner.Id}
+	sharedPlan := &db.Plan{Id: "shared-plan", OrgId: "org", OwnerId: owner.Id, SharedWithOrgAt: &sharedAt}
+	deleteAny := map[types.Permission]bool{types.PermissionDeleteAnyPlan: true}
+
+	tests := []struct {
+		name string
+		plan *db.Plan
+		auth *types.ServerAuth
+		want error
+	}{
+		{
+			name: "missing plan",
+			plan: nil,
+			auth: &types.ServerAuth{User: owner, OrgId: "org"},
+			want: errPlanNotFound,
+		},
+		{
+			name: "plan in another org",
+			plan: plan,
+			auth: &types.ServerAuth{User: owner, OrgId: "other-org"},
+			want: errPlanNotFound,
+		},
+		{
+			name: "non-owner without permission",
+			plan: plan,
+			auth: &types.ServerAuth{User: other, OrgId: "org"},
+			want: errPlanForbidden,
+		},
+		{
+			name: "non-owner of shared plan without permission",
+			plan: sharedPlan,
+			auth: &types.ServerAuth{User: other, OrgId: "org"},
+			want: errPlanForbidden,
+		},
+		{
+			name: "non-owner with delete any plan permission on private plan",
+			plan: plan,
+			auth: &types.ServerAuth{User: other, OrgId: "org", Permissions: deleteAny},
+			want: errPlanForbidden,
+		},
+		{
+			name: "non-owner with delete any plan permission on shared plan",
+			plan: sharedPlan,
+			auth: &types.ServerAuth{User: other, OrgId: "org", Permissions: deleteAny},
+			want: errPlanForbidden,
+		},
+		{
+			name: "owner",
+			plan: plan,
+			auth: &types.ServerAuth{User: owner, OrgId: "org"},
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPlanDeleteAccess(tt.plan, tt.auth)
+			if err != tt.want {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWritePlanAuthErr(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "not found", err: errPlanNotFound, want: http.StatusNotFound},
+		{name: "forbidden", err: errPlanForbidden, want: http.StatusForbidden},
+		{name: "other", err: errors.New("connection refused"), want: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writePlanAuthErr(rec, tt.err)
+			if rec.Code != tt.want {
+				t.Errorf("got status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
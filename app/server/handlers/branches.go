@@ -7,13 +7,15 @@ import (
 	"log"
 	"net/http"
 	"plandex-server/db"
+	"plandex-server/logger"
+	modelPlan "plandex-server/model/plan"
 
 	"github.com/gorilla/mux"
 	"github.com/plandex/plandex/shared"
 )
 
 func ListBranchesHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for ListBranchesHandler")
+	logger.Debugln("Received request for ListBranchesHandler")
 
 	auth := authenticate(w, r, true)
 	if auth == nil {
@@ -63,7 +65,7 @@ func ListBranchesHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func CreateBranchHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for CreateBranchHandler")
+	logger.Debugln("Received request for CreateBranchHandler")
 
 	auth := authenticate(w, r, true)
 	if auth == nil {
@@ -150,11 +152,111 @@ func CreateBranchHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	db.InvalidatePlanCache(planId)
+
 	log.Println("Successfully created branch")
 }
 
+// RenameBranchHandler renames one of a plan's branches. The current branch is kept by each
+// client, so the renamed branch is returned for it to switch to if it was on the old name.
+func RenameBranchHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for RenameBranchHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+	branch := vars["branch"]
+
+	log.Println("planId: ", planId)
+	log.Println("branch: ", branch)
+
+	if authorizePlanUpdate(w, planId, auth) == nil {
+		return
+	}
+
+	var req shared.RenameBranchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Error parsing request body: %v\n", err)
+		http.Error(w, "Error parsing request body", http.StatusBadRequest)
+		return
+	}
+
+	if branch == "main" {
+		log.Println("Cannot rename main branch")
+		http.Error(w, "Cannot rename main branch", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateWorkingBranch(req.Name); err != nil {
+		log.Printf("Invalid branch name: %v\n", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == branch {
+		log.Println("New branch name is the same as the current one")
+		http.Error(w, "New branch name is the same as the current one", http.StatusBadRequest)
+		return
+	}
+
+	// the stored status covers plans running on other hosts
+	if modelPlan.GetActivePlan(planId, branch) != nil {
+		log.Println("Plan is running on branch")
+		http.Error(w, db.ErrBranchRunning.Error(), http.StatusConflict)
+		return
+	}
+
+	var err error
+
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepo(w, r, auth, db.LockScopeWrite, ctx, cancel, true)
+	if unlockFn == nil {
+		return
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	renamed, err := db.RenameBranch(auth.OrgId, planId, branch, req.Name)
+
+	if err == db.ErrBranchNotFound {
+		log.Println("Branch not found")
+		http.Error(w, "Branch not found", http.StatusNotFound)
+		return
+	}
+
+	if err == db.ErrBranchExists || err == db.ErrBranchRunning {
+		log.Printf("Can't rename branch: %v\n", err)
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		log.Printf("Error renaming branch: %v\n", err)
+		http.Error(w, "Error renaming branch: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	bytes, err := json.Marshal(renamed.ToApi())
+
+	if err != nil {
+		log.Printf("Error marshalling branch: %v\n", err)
+		http.Error(w, "Error marshalling branch: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Printf("Successfully renamed branch %s to %s\n", branch, renamed.Name)
+}
+
 func DeleteBranchHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for DeleteBranchHandler")
+	logger.Debugln("Received request for DeleteBranchHandler")
 
 	auth := authenticate(w, r, true)
 	if auth == nil {
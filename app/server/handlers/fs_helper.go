@@ -23,6 +23,11 @@ func lockRepo(w http.ResponseWriter, r *http.Request, auth *types.ServerAuth, sc
 		return nil
 	}
 
+	return lockRepoBranch(w, auth, planId, branch, scope, ctx, cancelFn)
+}
+
+// lockRepoBranch is like lockRepo for handlers that don't get the plan and branch from the route
+func lockRepoBranch(w http.ResponseWriter, auth *types.ServerAuth, planId, branch string, scope db.LockScope, ctx context.Context, cancelFn context.CancelFunc) *func(err error) {
 	repoLockId, err := db.LockRepo(
 		db.LockRepoParams{
 			OrgId:    auth.OrgId,
@@ -6,13 +6,14 @@ import (
 	"log"
 	"net/http"
 	"plandex-server/db"
+	"plandex-server/logger"
 	"plandex-server/types"
 
 	"github.com/plandex/plandex/shared"
 )
 
 func ListOrgsHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for ListOrgsHandler")
+	logger.Debugln("Received request for ListOrgsHandler")
 
 	auth := authenticate(w, r, false)
 	if auth == nil {
@@ -46,7 +47,7 @@ func ListOrgsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func CreateOrgHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for CreateOrgHandler")
+	logger.Debugln("Received request for CreateOrgHandler")
 
 	auth := authenticate(w, r, false)
 	if auth == nil {
@@ -153,7 +154,7 @@ func CreateOrgHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetOrgSessionHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for GetOrgSessionHandler")
+	logger.Debugln("Received request for GetOrgSessionHandler")
 
 	auth := authenticate(w, r, true)
 
@@ -165,7 +166,7 @@ func GetOrgSessionHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func ListOrgRolesHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for ListOrgRolesHandler")
+	logger.Debugln("Received request for ListOrgRolesHandler")
 
 	auth := authenticate(w, r, true)
 	if auth == nil {
@@ -212,3 +213,245 @@ func ListOrgRolesHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.Write(bytes)
 }
+
+func SetOrgDefaultProjectHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for SetOrgDefaultProjectHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	if !auth.HasPermission(types.PermissionManageOrgSettings) {
+		log.Println("User cannot manage org settings")
+		http.Error(w, "User cannot manage org settings", http.StatusForbidden)
+		return
+	}
+
+	var req shared.SetOrgDefaultProjectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Error parsing request body: %v\n", err)
+		http.Error(w, "Error parsing request body", http.StatusBadRequest)
+		return
+	}
+
+	var projectId *string
+	if req.ProjectId != "" {
+		if !authorizeProject(w, req.ProjectId, auth) {
+			return
+		}
+		projectId = &req.ProjectId
+	}
+
+	err := db.SetDefaultProjectId(auth.OrgId, projectId)
+
+	if err != nil {
+		log.Printf("Error setting default project: %v\n", err)
+		http.Error(w, "Error setting default project: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Println("Successfully set org default project")
+}
+
+func GetOrgSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for GetOrgSettingsHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	org, err := db.GetOrg(auth.OrgId)
+
+	if err != nil {
+		log.Printf("Error getting org: %v\n", err)
+		http.Error(w, "Error getting org: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	settings, err := org.SettingsToApi()
+
+	if err != nil {
+		log.Printf("Error getting org settings: %v\n", err)
+		http.Error(w, "Error getting org settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if org.AuditWebhookUrl != nil && auth.HasPermission(types.PermissionManageOrgSettings) {
+		secret, err := db.GetOrCreateOrgAuditWebhookSecret(auth.OrgId)
+
+		if err != nil {
+			log.Printf("Error getting audit webhook secret: %v\n", err)
+			http.Error(w, "Error getting audit webhook secret: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		settings.AuditWebhookSecret = &secret
+	}
+
+	bytes, err := json.Marshal(settings)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Println("Successfully got org settings")
+}
+
+func UpdateOrgSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for UpdateOrgSettingsHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	if !auth.HasPermission(types.PermissionManageOrgSettings) {
+		log.Println("User cannot manage org settings")
+		http.Error(w, "User cannot manage org settings", http.StatusForbidden)
+		return
+	}
+
+	var req shared.UpdateOrgSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Error parsing request body: %v\n", err)
+		http.Error(w, "Error parsing request body", http.StatusBadRequest)
+		return
+	}
+
+	updates := map[string]interface{}{}
+
+	if req.MaxPlanNameSuffix != nil {
+		maxSuffix := *req.MaxPlanNameSuffix
+		if maxSuffix == 0 {
+			updates["max_plan_name_suffix"] = nil
+		} else if maxSuffix < 2 {
+			log.Println("Invalid max plan name suffix")
+			http.Error(w, "maxPlanNameSuffix must be >= 2, or 0 to use the server default", http.StatusBadRequest)
+			return
+		} else {
+			updates["max_plan_name_suffix"] = maxSuffix
+		}
+	}
+
+	if req.MaxPlansPerName != nil {
+		maxPlans := *req.MaxPlansPerName
+		if maxPlans == 0 {
+			updates["max_plans_per_name"] = nil
+		} else if maxPlans < 0 {
+			log.Println("Invalid max plans per name")
+			http.Error(w, "maxPlansPerName must be >= 1, or 0 to remove the cap", http.StatusBadRequest)
+			return
+		} else {
+			updates["max_plans_per_name"] = maxPlans
+		}
+	}
+
+	for col, days := range map[string]*int{
+		"auto_archive_after_days": req.AutoArchiveAfterDays,
+		"auto_delete_after_days":  req.AutoDeleteAfterDays,
+	} {
+		if days == nil {
+			continue
+		}
+		if *days < 0 {
+			log.Printf("Invalid %s: %d\n", col, *days)
+			http.Error(w, "Retention days must be >= 0, or 0 to disable", http.StatusBadRequest)
+			return
+		} else if *days == 0 {
+			updates[col] = nil
+		} else {
+			updates[col] = *days
+		}
+	}
+
+	if req.RequiredNamePrefix != nil {
+		prefix := *req.RequiredNamePrefix
+		if prefix == "" {
+			updates["required_name_prefix"] = nil
+		} else if len(prefix) > 50 {
+			log.Println("Required name prefix too long")
+			http.Error(w, "requiredNamePrefix must be at most 50 characters", http.StatusBadRequest)
+			return
+		} else {
+			updates["required_name_prefix"] = prefix
+		}
+	}
+
+	if req.AutoPrefix != nil {
+		updates["auto_prefix"] = *req.AutoPrefix
+	}
+
+	if req.AuditWebhookUrl != nil {
+		if *req.AuditWebhookUrl == "" {
+			updates["audit_webhook_url"] = nil
+		} else if err := validateWebhookUrl("auditWebhookUrl", *req.AuditWebhookUrl); err != nil {
+			log.Printf("Invalid audit webhook url: %v\n", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else {
+			updates["audit_webhook_url"] = *req.AuditWebhookUrl
+		}
+	}
+
+	if req.ClearDefaultPlanSettings {
+		updates["default_plan_settings"] = nil
+	} else if req.DefaultPlanSettings != nil {
+		bytes, err := json.Marshal(req.DefaultPlanSettings)
+
+		if err != nil {
+			log.Printf("Error marshalling default plan settings: %v\n", err)
+			http.Error(w, "Error marshalling default plan settings: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		updates["default_plan_settings"] = bytes
+	}
+
+	err := db.UpdateOrgSettings(auth.OrgId, updates)
+
+	if err != nil {
+		log.Printf("Error updating org settings: %v\n", err)
+		http.Error(w, "Error updating org settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if req.CaseInsensitivePlanNames != nil {
+		err = db.SetOrgCaseInsensitivePlanNames(auth.OrgId, *req.CaseInsensitivePlanNames)
+
+		if err == db.ErrPlanNameCaseConflict {
+			log.Println("Plan names conflict case-insensitively")
+			http.Error(w, "Some users have plans whose names differ only by case. Rename them before enabling case-insensitive plan names.", http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			log.Printf("Error updating case-insensitive plan names: %v\n", err)
+			http.Error(w, "Error updating case-insensitive plan names: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if req.ProjectScopedPlanNames != nil {
+		err = db.SetOrgProjectScopedPlanNames(auth.OrgId, *req.ProjectScopedPlanNames)
+
+		if err == db.ErrPlanNameProjectConflict {
+			log.Println("Plan names conflict within a project")
+			http.Error(w, "Some projects have plans from different users with the same name. Rename them before making plan names unique per project.", http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			log.Printf("Error updating project-scoped plan names: %v\n", err)
+			http.Error(w, "Error updating project-scoped plan names: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	log.Println("Successfully updated org settings")
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"plandex-server/db"
+	"plandex-server/logger"
+	"plandex-server/types"
+
+	"github.com/plandex/plandex/shared"
+)
+
+func ListOrphanedPlanDirsHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for ListOrphanedPlanDirsHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	if !authorizeManagePlanStorage(w, auth) {
+		return
+	}
+
+	dirs, err := db.ListOrphanedPlanDirs(auth.OrgId)
+
+	if err != nil {
+		log.Printf("Error listing orphaned plan dirs: %v\n", err)
+		http.Error(w, "Error listing orphaned plan dirs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res := shared.ListOrphanedPlanDirsResponse{
+		Dirs:       dirs,
+		TotalBytes: totalOrphanedBytes(dirs),
+	}
+
+	bytes, err := json.Marshal(res)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Printf("Successfully listed %d orphaned plan dirs\n", len(dirs))
+}
+
+func ReapOrphanedPlanDirsHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for ReapOrphanedPlanDirsHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	if !authorizeManagePlanStorage(w, auth) {
+		return
+	}
+
+	var req shared.ReapOrphanedPlanDirsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Error parsing request body: %v\n", err)
+		http.Error(w, "Error parsing request body", http.StatusBadRequest)
+		return
+	}
+
+	dirs, err := db.ReapOrphanedPlanDirs(auth.OrgId, req.DryRun)
+
+	if err != nil {
+		log.Printf("Error reaping orphaned plan dirs: %v\n", err)
+		http.Error(w, "Error reaping orphaned plan dirs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res := shared.ReapOrphanedPlanDirsResponse{
+		DryRun:     req.DryRun,
+		Dirs:       dirs,
+		TotalBytes: totalOrphanedBytes(dirs),
+	}
+
+	bytes, err := json.Marshal(res)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Printf("Successfully reaped %d orphaned plan dirs (dry run: %t)\n", len(dirs), req.DryRun)
+}
+
+func authorizeManagePlanStorage(w http.ResponseWriter, auth *types.ServerAuth) bool {
+	if !auth.HasPermission(types.PermissionManagePlanStorage) {
+		log.Println("User does not have permission to manage plan storage")
+		http.Error(w, "User does not have permission to manage plan storage", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+func totalOrphanedBytes(dirs []*shared.OrphanedPlanDir) int64 {
+	var total int64
+	for _, dir := range dirs {
+		total += dir.Bytes
+	}
+	return total
+}
@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"plandex-server/db"
+	"plandex-server/logger"
+	"plandex-server/types"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/plandex/plandex/shared"
+)
+
+const maxPlanApiKeyNameLength = 255
+
+// planApiKeyRouteScopes lists every route a plan api key can be used for, by method and path
+// template, with the scope it needs. Any other route is rejected, so new routes are closed to
+// plan api keys until they're added here.
+var planApiKeyRouteScopes = map[string]shared.PlanApiKeyScope{
+	"GET /plans/{planId}":                                shared.PlanApiKeyScopeRead,
+	"GET /plans/{planId}/tree":                           shared.PlanApiKeyScopeRead,
+	"GET /plans/{planId}/files":                          shared.PlanApiKeyScopeRead,
+	"GET /plans/{planId}/tokens":                         shared.PlanApiKeyScopeRead,
+	"GET /plans/{planId}/branches":                       shared.PlanApiKeyScopeRead,
+	"GET /plans/{planId}/{branch}/current_plan":          shared.PlanApiKeyScopeRead,
+	"GET /plans/{planId}/{branch}/diff":                  shared.PlanApiKeyScopeRead,
+	"GET /plans/{planId}/{branch}/context":               shared.PlanApiKeyScopeRead,
+	"GET /plans/{planId}/{branch}/convo":                 shared.PlanApiKeyScopeRead,
+	"GET /plans/{planId}/{branch}/convo/stream":          shared.PlanApiKeyScopeRead,
+	"GET /plans/{planId}/{branch}/logs":                  shared.PlanApiKeyScopeRead,
+	"GET /plans/{planId}/{branch}/versions":              shared.PlanApiKeyScopeRead,
+	"GET /plans/{planId}/{branch}/settings":              shared.PlanApiKeyScopeRead,
+	"POST /plans/{planId}/{branch}/tell":                 shared.PlanApiKeyScopeRun,
+	"POST /plans/{planId}/{branch}/respond_missing_file": shared.PlanApiKeyScopeRun,
+	"PATCH /plans/{planId}/{branch}/build":               shared.PlanApiKeyScopeRun,
+	"PATCH /plans/{planId}/{branch}/connect":             shared.PlanApiKeyScopeRun,
+	"DELETE /plans/{planId}/{branch}/stop":               shared.PlanApiKeyScopeRun,
+}
+
+func planApiKeyRouteScope(method, pathTemplate string) (shared.PlanApiKeyScope, bool) {
+	scope, ok := planApiKeyRouteScopes[method+" "+pathTemplate]
+	return scope, ok
+}
+
+// authenticatePlanApiKey is the plan api key branch of authenticate. The key has to be allowed
+// on the route, and its creator still has to be in the org, since the key acts as them.
+func authenticatePlanApiKey(w http.ResponseWriter, r *http.Request, parsed *shared.AuthHeader) *types.ServerAuth {
+	key, err := db.ValidatePlanApiKey(parsed.Token)
+
+	if err != nil {
+		log.Printf("error validating plan api key: %v\n", err)
+		http.Error(w, "error validating plan api key", http.StatusInternalServerError)
+		return nil
+	}
+
+	if key == nil || (parsed.OrgId != "" && parsed.OrgId != key.OrgId) {
+		log.Println("invalid plan api key")
+
+		writeApiError(w, shared.ApiError{
+			Type:   shared.ApiErrorTypeInvalidToken,
+			Status: http.StatusUnauthorized,
+			Msg:    "Invalid auth token",
+		})
+		return nil
+	}
+
+	var pathTemplate string
+	if route := mux.CurrentRoute(r); route != nil {
+		pathTemplate, _ = route.GetPathTemplate()
+	}
+
+	scope, ok := planApiKeyRouteScope(r.Method, pathTemplate)
+
+	if !ok || mux.Vars(r)["planId"] != key.PlanId {
+		log.Printf("plan api key %s can't be used for %s %s\n", key.Id, r.Method, r.URL.Path)
+		http.Error(w, "Plan api key can't be used for this request", http.StatusForbidden)
+		return nil
+	}
+
+	if !key.HasScope(scope) {
+		log.Printf("plan api key %s is missing scope %s\n", key.Id, scope)
+		http.Error(w, fmt.Sprintf("Plan api key is missing the '%s' scope", scope), http.StatusForbidden)
+		return nil
+	}
+
+	user, err := db.GetUser(key.CreatorId)
+
+	if err != nil {
+		log.Printf("error getting user: %v\n", err)
+		http.Error(w, "error getting user", http.StatusInternalServerError)
+		return nil
+	}
+
+	isMember, err := db.ValidateOrgMembershipCached(key.CreatorId, key.OrgId)
+
+	if err != nil {
+		log.Printf("error validating org membership: %v\n", err)
+		http.Error(w, "error validating org membership", http.StatusInternalServerError)
+		return nil
+	}
+
+	if !isMember {
+		log.Println("plan api key creator is no longer a member of the org")
+		http.Error(w, "not a member of org", http.StatusUnauthorized)
+		return nil
+	}
+
+	permissions, err := db.GetUserPermissionsCached(key.CreatorId, key.OrgId)
+
+	if err != nil {
+		log.Printf("error getting user permissions: %v\n", err)
+		http.Error(w, "error getting user permissions", http.StatusInternalServerError)
+		return nil
+	}
+
+	permissionsMap := make(map[types.Permission]bool)
+	for _, permission := range permissions {
+		permissionsMap[types.Permission(permission)] = true
+	}
+
+	log.Printf("PlanApiKeyId: %s, UserId: %s, OrgId: %s, PlanId: %s\n", key.Id, key.CreatorId, key.OrgId, key.PlanId)
+
+	return &types.ServerAuth{
+		User:        user,
+		OrgId:       key.OrgId,
+		Permissions: permissionsMap,
+		PlanApiKey:  key,
+	}
+}
+
+func CreatePlanApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for CreatePlanApiKeyHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+
+	log.Println("planId: ", planId)
+
+	// a key can run the plan, so minting one takes the same access as updating it
+	plan := authorizePlanUpdate(w, planId, auth)
+	if plan == nil {
+		return
+	}
+
+	var req shared.CreatePlanApiKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Error parsing request body: %v\n", err)
+		http.Error(w, "Error parsing request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Name) > maxPlanApiKeyNameLength {
+		log.Println("Plan api key name too long")
+		http.Error(w, fmt.Sprintf("name can't be longer than %d characters", maxPlanApiKeyNameLength), http.StatusBadRequest)
+		return
+	}
+
+	scopes, err := normalizePlanApiKeyScopes(req.Scopes)
+
+	if err != nil {
+		log.Printf("Invalid plan api key scopes: %v\n", err)
+		http.Error(w, "Invalid scopes: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	expiresInHours := req.ExpiresInHours
+	if expiresInHours == 0 {
+		expiresInHours = shared.DefaultPlanApiKeyHours
+	}
+
+	if expiresInHours < 0 || expiresInHours > shared.MaxPlanApiKeyHours {
+		log.Printf("Invalid plan api key expiration: %d hours\n", expiresInHours)
+		http.Error(w, fmt.Sprintf("expiresInHours must be between 1 and %d", shared.MaxPlanApiKeyHours), http.StatusBadRequest)
+		return
+	}
+
+	expiresAt := time.Now().Add(time.Duration(expiresInHours) * time.Hour)
+
+	key, token, err := db.CreatePlanApiKey(auth.OrgId, plan.Id, auth.User.Id, req.Name, scopes, expiresAt)
+
+	if err != nil {
+		log.Printf("Error creating plan api key: %v\n", err)
+		http.Error(w, "Error creating plan api key: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := shared.CreatePlanApiKeyResponse{
+		Key:   key.ToApi(),
+		Token: token,
+	}
+
+	bytes, err := json.Marshal(resp)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Println("Successfully created api key for plan", plan.Id)
+}
+
+func ListPlanApiKeysHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for ListPlanApiKeysHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+
+	log.Println("planId: ", planId)
+
+	plan := authorizePlanUpdate(w, planId, auth)
+	if plan == nil {
+		return
+	}
+
+	keys, err := db.ListActivePlanApiKeys(plan.Id)
+
+	if err != nil {
+		log.Printf("Error listing plan api keys: %v\n", err)
+		http.Error(w, "Error listing plan api keys: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apiKeys := []*shared.PlanApiKey{}
+	for _, key := range keys {
+		apiKeys = append(apiKeys, key.ToApi())
+	}
+
+	bytes, err := json.Marshal(apiKeys)
+
+	if err != nil {
+		log.Printf("Error marshalling plan api keys: %v\n", err)
+		http.Error(w, "Error marshalling plan api keys: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+}
+
+func RevokePlanApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for RevokePlanApiKeyHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+	keyId := vars["keyId"]
+
+	log.Println("planId: ", planId, "keyId: ", keyId)
+
+	plan := authorizePlanUpdate(w, planId, auth)
+	if plan == nil {
+		return
+	}
+
+	revoked, err := db.RevokePlanApiKey(plan.Id, keyId)
+
+	if err != nil {
+		log.Printf("Error revoking plan api key: %v\n", err)
+		http.Error(w, "Error revoking plan api key: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !revoked {
+		log.Println("Plan api key not found")
+		http.Error(w, "Plan api key not found", http.StatusNotFound)
+		return
+	}
+
+	log.Println("Successfully revoked plan api key", keyId)
+}
+
+// normalizePlanApiKeyScopes dedupes scopes and rejects unknown ones. At least one is required.
+func normalizePlanApiKeyScopes(scopes []shared.PlanApiKeyScope) ([]string, error) {
+	res := []string{}
+	seen := map[shared.PlanApiKeyScope]bool{}
+
+	for _, scope := range scopes {
+		switch scope {
+		case shared.PlanApiKeyScopeRead, shared.PlanApiKeyScopeRun:
+		default:
+			return nil, fmt.Errorf("unknown scope '%s'", scope)
+		}
+
+		if seen[scope] {
+			continue
+		}
+		seen[scope] = true
+
+		res = append(res, string(scope))
+	}
+
+	if len(res) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+
+	return res, nil
+}
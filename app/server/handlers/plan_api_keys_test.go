@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/plandex/plandex/shared"
+)
+
+func TestPlanApiKeyRouteScope(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		scope  shared.PlanApiKeyScope
+		ok     bool
+	}{
+		{"GET", "/plans/{planId}", shared.PlanApiKeyScopeRead, true},
+		{"GET", "/plans/{planId}/{branch}/context", shared.PlanApiKeyScopeRead, true},
+		{"POST", "/plans/{planId}/{branch}/tell", shared.PlanApiKeyScopeRun, true},
+		{"DELETE", "/plans/{planId}/{branch}/stop", shared.PlanApiKeyScopeRun, true},
+		// writes outside running the plan, and anything not scoped to one plan, are closed to keys
+		{"DELETE", "/plans/{planId}", "", false},
+		{"PATCH", "/plans/{planId}", "", false},
+		{"POST", "/plans/{planId}/{branch}/context", "", false},
+		{"POST", "/plans/{planId}/api_keys", "", false},
+		{"POST", "/plans/{planId}/share_links", "", false},
+		{"GET", "/plans", "", false},
+		{"POST", "/orgs", "", false},
+		{"GET", "", "", false},
+	}
+
+	for _, tt := range tests {
+		scope, ok := planApiKeyRouteScope(tt.method, tt.path)
+		if ok != tt.ok || scope != tt.scope {
+			t.Errorf("planApiKeyRouteScope(%s, %s) = %s, %v, expected %s, %v", tt.method, tt.path, scope, ok, tt.scope, tt.ok)
+		}
+	}
+}
+
+func TestNormalizePlanApiKeyScopes(t *testing.T) {
+	scopes, err := normalizePlanApiKeyScopes([]shared.PlanApiKeyScope{shared.PlanApiKeyScopeRun, shared.PlanApiKeyScopeRead, shared.PlanApiKeyScopeRun})
+	if err != nil {
+		t.Fatalf("error normalizing scopes: %v", err)
+	}
+
+	if len(scopes) != 2 || scopes[0] != "run" || scopes[1] != "read" {
+		t.Errorf("expected deduped scopes in order, got %v", scopes)
+	}
+
+	for _, invalid := range [][]shared.PlanApiKeyScope{nil, {}, {"admin"}, {shared.PlanApiKeyScopeRead, "write"}} {
+		if _, err := normalizePlanApiKeyScopes(invalid); err == nil {
+			t.Errorf("expected %v to be rejected", invalid)
+		}
+	}
+}
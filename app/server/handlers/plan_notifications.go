@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"plandex-server/logger"
+	"plandex-server/notify"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// TestPlanWebhookHandler sends a ping to the plan's notification webhook so users can check
+// their receiver before a real event fires
+func TestPlanWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for TestPlanWebhookHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+
+	log.Println("planId: ", planId)
+
+	plan := authorizePlanUpdate(w, planId, auth)
+	if plan == nil {
+		return
+	}
+
+	res, wait, err := notify.TestPlanWebhook(plan)
+
+	if err == notify.ErrNoPlanWebhook {
+		log.Println("Plan has no webhook")
+		http.Error(w, "Plan doesn't have webhook notifications configured", http.StatusBadRequest)
+		return
+	}
+
+	if err == notify.ErrWebhookTestRateLimited {
+		log.Println("Webhook tested too recently")
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "This plan's webhook was tested too recently, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	if err != nil {
+		log.Printf("Error testing webhook: %v\n", err)
+		http.Error(w, "Error testing webhook: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	bytes, err := json.Marshal(res)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Printf("Successfully tested webhook for plan %s, status: %d\n", planId, res.StatusCode)
+}
@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"plandex-server/notify"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/plandex/plandex/shared"
+)
+
+const maxPlanNameLength = 255
+const maxPlanDescriptionLength = 10000
+const maxPlanTags = 20
+const maxPlanTagLength = 50
+const maxPlanWebhookUrlLength = 2048
+const maxExternalKeyLength = 255
+const maxListPlanOwners = 100
+
+func validatePlanName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("plan name can't be empty")
+	}
+
+	if len(name) > maxPlanNameLength {
+		return fmt.Errorf("plan name can't be longer than %d characters", maxPlanNameLength)
+	}
+
+	if name == "draft" {
+		return fmt.Errorf("'draft' is reserved for unnamed plans")
+	}
+
+	return nil
+}
+
+// validatePlanId only accepts canonical lowercase uuids so that a custom id fits the plans.id
+// column and every foreign key to it, and is always safe to use as the plan's dir name
+func validatePlanId(id string) error {
+	parsed, err := uuid.Parse(id)
+	if err != nil || parsed.String() != id {
+		return fmt.Errorf("plan id must be a lowercase hyphenated uuid like '%s'", uuid.Nil.String())
+	}
+
+	if parsed == uuid.Nil {
+		return fmt.Errorf("plan id can't be the nil uuid")
+	}
+
+	return nil
+}
+
+func validatePlanDescription(description string) error {
+	if len(description) > maxPlanDescriptionLength {
+		return fmt.Errorf("plan description can't be longer than %d characters", maxPlanDescriptionLength)
+	}
+
+	return nil
+}
+
+const maxWorkingBranchLength = 255
+
+// validateWorkingBranch checks a git branch name against the rules in git check-ref-format
+func validateWorkingBranch(branch string) error {
+	if branch == "" {
+		return fmt.Errorf("branch name is required")
+	}
+
+	if len(branch) > maxWorkingBranchLength {
+		return fmt.Errorf("branch name must be at most %d characters", maxWorkingBranchLength)
+	}
+
+	if branch == "@" || strings.HasPrefix(branch, "-") || strings.HasSuffix(branch, ".") || strings.Contains(branch, "..") || strings.Contains(branch, "@{") {
+		return fmt.Errorf("invalid branch name '%s'", branch)
+	}
+
+	for _, r := range branch {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(" ~^:?*[\\", r) {
+			return fmt.Errorf("branch name can't contain %q", r)
+		}
+	}
+
+	for _, component := range strings.Split(branch, "/") {
+		if component == "" || strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			return fmt.Errorf("invalid branch name '%s'", branch)
+		}
+	}
+
+	return nil
+}
+
+func validatePlanVisibility(visibility shared.PlanVisibility) error {
+	switch visibility {
+	case shared.PlanVisibilityPrivate, shared.PlanVisibilityOrg:
+		return nil
+	}
+
+	return fmt.Errorf("invalid visibility '%s'", visibility)
+}
+
+func validatePlanNotifications(notifications *shared.PlanNotifications) error {
+	switch notifications.Channel {
+	case shared.PlanNotifyChannelEmail:
+		if notifications.WebhookUrl != "" {
+			return fmt.Errorf("webhookUrl is only used with the webhook channel")
+		}
+	case shared.PlanNotifyChannelWebhook:
+		if err := validateWebhookUrl("webhookUrl", notifications.WebhookUrl); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown notification channel '%s'", notifications.Channel)
+	}
+
+	return nil
+}
+
+func validateWebhookUrl(field, webhookUrl string) error {
+	if len(webhookUrl) > maxPlanWebhookUrlLength {
+		return fmt.Errorf("%s can't be longer than %d characters", field, maxPlanWebhookUrlLength)
+	}
+
+	u, err := url.Parse(webhookUrl)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("%s must be an http or https url", field)
+	}
+
+	if err := notify.ValidateWebhookHost(u.Hostname()); err != nil {
+		return fmt.Errorf("%s: %v", field, err)
+	}
+
+	return nil
+}
+
+// normalizePlanTags trims and dedupes tags, preserving order
+func normalizePlanTags(tags []string) ([]string, error) {
+	res := []string{}
+	seen := map[string]bool{}
+
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+
+		if tag == "" {
+			continue
+		}
+
+		if len(tag) > maxPlanTagLength {
+			return nil, fmt.Errorf("tag '%s' is longer than %d characters", tag, maxPlanTagLength)
+		}
+
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+
+		res = append(res, tag)
+	}
+
+	if len(res) > maxPlanTags {
+		return nil, fmt.Errorf("a plan can't have more than %d tags", maxPlanTags)
+	}
+
+	return res, nil
+}
+
+// plan fields that can be requested with ListPlansHandler's fields param, by json name
+var listPlanFields = []string{
+	"id",
+	"ownerId",
+	"projectId",
+	"name",
+	"description",
+	"tags",
+	"pinned",
+	"sharedWithOrgAt",
+	"totalReplies",
+	"activeBranches",
+	"archivedAt",
+	"createdAt",
+	"updatedAt",
+	"owner",
+	"externalKey",
+	"status",
+	"branch",
+}
+
+// optional plan data ListPlansHandler leaves out unless it's requested with the include param
+var listPlanIncludes = []string{
+	"tags",
+	"status",
+	"branch",
+}
+
+// parsePlanIncludes parses a comma-separated include param. An empty param includes nothing
+// extra.
+func parsePlanIncludes(param string) (map[string]bool, error) {
+	includes := map[string]bool{}
+
+	for _, include := range strings.Split(param, ",") {
+		include = strings.TrimSpace(include)
+		if include == "" {
+			continue
+		}
+
+		found := false
+		for _, allowed := range listPlanIncludes {
+			if include == allowed {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("unknown include '%s', allowed values are: %s", include, strings.Join(listPlanIncludes, ", "))
+		}
+
+		includes[include] = true
+	}
+
+	return includes, nil
+}
+
+// parsePlanFields parses a comma-separated fields param. Returns nil for an empty param, which
+// means all fields.
+func parsePlanFields(param string) (map[string]bool, error) {
+	if strings.TrimSpace(param) == "" {
+		return nil, nil
+	}
+
+	allowed := map[string]bool{}
+	for _, field := range listPlanFields {
+		allowed[field] = true
+	}
+
+	fields := map[string]bool{}
+	for _, field := range strings.Split(param, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		if !allowed[field] {
+			return nil, fmt.Errorf("unknown field '%s', allowed fields are: %s", field, strings.Join(listPlanFields, ", "))
+		}
+
+		fields[field] = true
+	}
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("fields can't be empty")
+	}
+
+	return fields, nil
+}
+
+// parsePlanOwners parses a comma-separated list of owner user ids, dropping duplicates. An empty
+// param returns nil.
+func parsePlanOwners(param string) ([]string, error) {
+	var owners []string
+	seen := map[string]bool{}
+
+	for _, owner := range strings.Split(param, ",") {
+		owner = strings.TrimSpace(owner)
+		if owner == "" || seen[owner] {
+			continue
+		}
+
+		if _, err := uuid.Parse(owner); err != nil {
+			return nil, fmt.Errorf("invalid owner id '%s'", owner)
+		}
+
+		seen[owner] = true
+		owners = append(owners, owner)
+	}
+
+	if len(owners) > maxListPlanOwners {
+		return nil, fmt.Errorf("at most %d owners can be listed at once", maxListPlanOwners)
+	}
+
+	return owners, nil
+}
+
+func validateInitialContexts(contexts shared.LoadContextRequest) error {
+	for i, context := range contexts {
+		if context == nil {
+			return fmt.Errorf("context %d is empty", i)
+		}
+
+		switch context.ContextType {
+		case shared.ContextFileType:
+			if _, ok := cleanPlanFilePath(context.FilePath); !ok {
+				return fmt.Errorf("context %d has an invalid file path: '%s'", i, context.FilePath)
+			}
+		case shared.ContextURLType:
+			if context.Url == "" {
+				return fmt.Errorf("context %d is a url context without a url", i)
+			}
+		case shared.ContextNoteType, shared.ContextDirectoryTreeType, shared.ContextPipedDataType:
+		default:
+			return fmt.Errorf("context %d has an invalid context type: '%s'", i, context.ContextType)
+		}
+	}
+
+	return nil
+}
+
+// validateContextPatch checks that every operation is known and targets a distinct valid path,
+// and cleans the paths in place
+func validateContextPatch(req *shared.PatchContextRequest) error {
+	if len(req.Operations) == 0 {
+		return fmt.Errorf("no operations")
+	}
+
+	seen := map[string]bool{}
+
+	for i, op := range req.Operations {
+		if op == nil {
+			return fmt.Errorf("operation %d is empty", i)
+		}
+
+		switch op.Op {
+		case shared.ContextPatchOpAdd, shared.ContextPatchOpUpdate, shared.ContextPatchOpRemove:
+		default:
+			return fmt.Errorf("operation %d has an invalid op: '%s'", i, op.Op)
+		}
+
+		cleaned, ok := cleanPlanFilePath(op.Path)
+		if !ok {
+			return fmt.Errorf("operation %d has an invalid path: '%s'", i, op.Path)
+		}
+
+		// applying several operations to one path would depend on their order
+		if seen[cleaned] {
+			return fmt.Errorf("operation %d targets '%s', which an earlier operation already does", i, cleaned)
+		}
+		seen[cleaned] = true
+
+		op.Path = cleaned
+	}
+
+	return nil
+}
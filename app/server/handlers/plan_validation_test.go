@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/plandex/plandex/shared"
+)
+
+func TestParsePlanFields(t *testing.T) {
+	fields, err := parsePlanFields("")
+	if err != nil || fields != nil {
+		t.Errorf("expected nil fields for empty param, got %v, %v", fields, err)
+	}
+
+	fields, err = parsePlanFields("id, name,updatedAt")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fields) != 3 || !fields["id"] || !fields["name"] || !fields["updatedAt"] {
+		t.Errorf("unexpected fields: %v", fields)
+	}
+
+	for _, param := range []string{"id,settings", "id,unknown", " , "} {
+		if _, err := parsePlanFields(param); err == nil {
+			t.Errorf("expected an error for %q", param)
+		}
+	}
+}
+
+func TestParsePlanIncludes(t *testing.T) {
+	includes, err := parsePlanIncludes("")
+	if err != nil || len(includes) != 0 {
+		t.Errorf("expected no includes for empty param, got %v, %v", includes, err)
+	}
+
+	includes, err = parsePlanIncludes(" tags, ")
+	if err != nil || !includes["tags"] {
+		t.Errorf("expected tags to be included, got %v, %v", includes, err)
+	}
+
+	if _, err := parsePlanIncludes("tags,settings"); err == nil {
+		t.Errorf("expected an error for an unknown include")
+	}
+}
+
+func TestParsePlanOwners(t *testing.T) {
+	owners, err := parsePlanOwners("")
+	if err != nil || owners != nil {
+		t.Errorf("expected no owners for empty param, got %v, %v", owners, err)
+	}
+
+	a := "8b0d4a8e-3c2f-4f51-9f0e-6a3a1c2b7d10"
+	b := "1f6c2e94-7a0b-4d3e-8c5f-2b9e0d4a6c71"
+
+	owners, err = parsePlanOwners(a + ", " + b + "," + a + ",")
+	if err != nil || len(owners) != 2 || owners[0] != a || owners[1] != b {
+		t.Errorf("expected deduped owners, got %v, %v", owners, err)
+	}
+
+	if _, err := parsePlanOwners(a + ",alice"); err == nil {
+		t.Errorf("expected an error for an invalid owner id")
+	}
+}
+
+func TestMarshalPlanFields(t *testing.T) {
+	plans := []*shared.Plan{
+		{Id: "plan-1", Name: "one", Description: "desc", TotalReplies: 3},
+	}
+
+	bytes, err := marshalPlanFields(plans, map[string]bool{"id": true, "name": true, "archivedAt": true})
+	if err != nil {
+		t.Fatalf("error marshalling: %v", err)
+	}
+
+	var res []map[string]interface{}
+	err = json.Unmarshal(bytes, &res)
+	if err != nil {
+		t.Fatalf("error unmarshalling: %v", err)
+	}
+
+	// archivedAt is omitted when unset, just like in the full shape
+	if len(res) != 1 || len(res[0]) != 2 || res[0]["id"] != "plan-1" || res[0]["name"] != "one" {
+		t.Errorf("unexpected projection: %v", res)
+	}
+}
+
+func TestMarshalPlanFieldsKeepsError(t *testing.T) {
+	plans := []*shared.Plan{
+		{Id: "plan-1", Name: "one", Error: "plan directory is missing"},
+		{Id: "plan-2", Name: "two"},
+	}
+
+	bytes, err := marshalPlanFields(plans, map[string]bool{"id": true})
+	if err != nil {
+		t.Fatalf("error marshalling: %v", err)
+	}
+
+	var res []map[string]interface{}
+	err = json.Unmarshal(bytes, &res)
+	if err != nil {
+		t.Fatalf("error unmarshalling: %v", err)
+	}
+
+	if len(res) != 2 || res[0]["error"] != "plan directory is missing" || len(res[0]) != 2 {
+		t.Errorf("expected the error to be kept, got %v", res)
+	}
+	if _, ok := res[1]["error"]; ok {
+		t.Errorf("expected no error for a plan that loaded, got %v", res[1])
+	}
+}
+
+func TestEmptyPlanListsMarshalAsArrays(t *testing.T) {
+	bytes, err := json.Marshal(plansToApi(nil))
+	if err != nil {
+		t.Fatalf("error marshalling: %v", err)
+	}
+	if string(bytes) != "[]" {
+		t.Errorf("expected [], got %s", bytes)
+	}
+
+	bytes, err = marshalPlanFields(plansToApi(nil), map[string]bool{"id": true})
+	if err != nil {
+		t.Fatalf("error marshalling fields: %v", err)
+	}
+	if string(bytes) != "[]" {
+		t.Errorf("expected [] with fields, got %s", bytes)
+	}
+}
+
+func TestValidatePlanId(t *testing.T) {
+	if err := validatePlanId("3f2b8c1e-6a4d-4e2b-9c1a-0f5e6d7c8b9a"); err != nil {
+		t.Errorf("expected valid uuid to pass, got %v", err)
+	}
+
+	for _, id := range []string{
+		"",
+		"my-plan",
+		"../../etc",
+		"3F2B8C1E-6A4D-4E2B-9C1A-0F5E6D7C8B9A",
+		"3f2b8c1e6a4d4e2b9c1a0f5e6d7c8b9a",
+		"{3f2b8c1e-6a4d-4e2b-9c1a-0f5e6d7c8b9a}",
+		"urn:uuid:3f2b8c1e-6a4d-4e2b-9c1a-0f5e6d7c8b9a",
+		"00000000-0000-0000-0000-000000000000",
+	} {
+		if err := validatePlanId(id); err == nil {
+			t.Errorf("expected %q to be rejected", id)
+		}
+	}
+}
+
+func TestValidateContextPatch(t *testing.T) {
+	req := &shared.PatchContextRequest{
+		Operations: []*shared.ContextPatchOperation{
+			{Op: shared.ContextPatchOpAdd, Path: "./src/main.go", Content: "package main"},
+			{Op: shared.ContextPatchOpRemove, Path: "README.md"},
+		},
+	}
+
+	if err := validateContextPatch(req); err != nil {
+		t.Fatalf("expected patch to be valid, got %v", err)
+	}
+
+	if req.Operations[0].Path != "src/main.go" {
+		t.Errorf("expected path to be cleaned, got %s", req.Operations[0].Path)
+	}
+
+	for desc, ops := range map[string][]*shared.ContextPatchOperation{
+		"no operations":  {},
+		"nil operation":  {nil},
+		"unknown op":     {{Op: "replace", Path: "main.go"}},
+		"absolute path":  {{Op: shared.ContextPatchOpAdd, Path: "/etc/passwd"}},
+		"escaping path":  {{Op: shared.ContextPatchOpUpdate, Path: "src/../../main.go"}},
+		"duplicate path": {{Op: shared.ContextPatchOpRemove, Path: "main.go"}, {Op: shared.ContextPatchOpAdd, Path: "./main.go"}},
+	} {
+		if err := validateContextPatch(&shared.PatchContextRequest{Operations: ops}); err == nil {
+			t.Errorf("expected %s to be rejected", desc)
+		}
+	}
+}
+
+func TestValidatePlanNotifications(t *testing.T) {
+	for _, valid := range []shared.PlanNotifications{
+		{OnComplete: true, Channel: shared.PlanNotifyChannelEmail},
+		{OnError: true, Channel: shared.PlanNotifyChannelWebhook, WebhookUrl: "https://example.com/hook"},
+	} {
+		if err := validatePlanNotifications(&valid); err != nil {
+			t.Errorf("expected %+v to be valid, got %v", valid, err)
+		}
+	}
+
+	for _, invalid := range []shared.PlanNotifications{
+		{OnComplete: true, Channel: "sms"},
+		{OnComplete: true, Channel: shared.PlanNotifyChannelEmail, WebhookUrl: "https://example.com/hook"},
+		{OnComplete: true, Channel: shared.PlanNotifyChannelWebhook},
+		{OnComplete: true, Channel: shared.PlanNotifyChannelWebhook, WebhookUrl: "file:///etc/passwd"},
+		{OnComplete: true, Channel: shared.PlanNotifyChannelWebhook, WebhookUrl: "https://"},
+		{OnComplete: true, Channel: shared.PlanNotifyChannelWebhook, WebhookUrl: "http://169.254.169.254/latest/meta-data"},
+		{OnComplete: true, Channel: shared.PlanNotifyChannelWebhook, WebhookUrl: "http://localhost:8080/hook"},
+		{OnComplete: true, Channel: shared.PlanNotifyChannelWebhook, WebhookUrl: "http://[::1]/hook"},
+	} {
+		if err := validatePlanNotifications(&invalid); err == nil {
+			t.Errorf("expected %+v to be rejected", invalid)
+		}
+	}
+}
+
+func TestValidatePlanVisibility(t *testing.T) {
+	for _, v := range []shared.PlanVisibility{shared.PlanVisibilityPrivate, shared.PlanVisibilityOrg} {
+		if err := validatePlanVisibility(v); err != nil {
+			t.Errorf("expected %q to pass, got %v", v, err)
+		}
+	}
+
+	for _, v := range []shared.PlanVisibility{"", "public", "Org"} {
+		if err := validatePlanVisibility(v); err == nil {
+			t.Errorf("expected %q to be rejected", v)
+		}
+	}
+}
+
+func TestValidateWorkingBranch(t *testing.T) {
+	for _, branch := range []string{"main", "feature/login", "release-1.2", "user/fix_bug.v2"} {
+		if err := validateWorkingBranch(branch); err != nil {
+			t.Errorf("expected %q to pass, got %v", branch, err)
+		}
+	}
+
+	for _, branch := range []string{
+		"",
+		"@",
+		"-main",
+		"/main",
+		"main/",
+		"feature//login",
+		"feature/.hidden",
+		".main",
+		"main.",
+		"main.lock",
+		"feature.lock/login",
+		"a..b",
+		"main@{1}",
+		"has space",
+		"a~1",
+		"a^",
+		"a:b",
+		"a?",
+		"a*",
+		"a[b",
+		`a\b`,
+		"tab\tname",
+	} {
+		if err := validateWorkingBranch(branch); err == nil {
+			t.Errorf("expected %q to be rejected", branch)
+		}
+	}
+}
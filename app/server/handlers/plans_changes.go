@@ -4,9 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"plandex-server/db"
+	"plandex-server/logger"
+	"plandex-server/types"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -14,7 +19,7 @@ import (
 )
 
 func CurrentPlanHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for CurrentPlanHandler")
+	logger.Debugln("Received request for CurrentPlanHandler")
 
 	auth := authenticate(w, r, true)
 	if auth == nil {
@@ -67,7 +72,7 @@ func CurrentPlanHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func ApplyPlanHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for ApplyPlanHandler")
+	logger.Debugln("Received request for ApplyPlanHandler")
 
 	auth := authenticate(w, r, true)
 	if auth == nil {
@@ -106,8 +111,301 @@ func ApplyPlanHandler(w http.ResponseWriter, r *http.Request) {
 	log.Println("Successfully applied plan", planId)
 }
 
+// ApplyPlanChangesHandler applies a branch's pending changes like ApplyPlanHandler, refusing if
+// there's nothing pending or the branch is running. If the request lists paths, only those
+// files are applied and the rest stay pending. The branch's latest commit is returned as
+// previousSha so the apply can be undone with a rewind, and a failed apply is rolled back to it
+// when the repo is unlocked.
+func ApplyPlanChangesHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for ApplyPlanChangesHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+
+	log.Println("planId: ", planId)
+
+	branch := r.URL.Query().Get("branch")
+	if branch == "" {
+		branch = "main"
+	}
+
+	var req shared.ApplyPlanChangesRequest
+	if decodeErr := json.NewDecoder(r.Body).Decode(&req); decodeErr != nil && decodeErr != io.EOF {
+		log.Printf("Error decoding request: %v\n", decodeErr)
+		http.Error(w, "Error decoding request: "+decodeErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Paths != nil && len(req.Paths) == 0 {
+		log.Println("Empty paths")
+		http.Error(w, "paths can't be empty, leave it out to apply every file", http.StatusBadRequest)
+		return
+	}
+
+	plan := authorizePlanUpdate(w, planId, auth)
+	if plan == nil {
+		return
+	}
+
+	var err error
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepoBranch(w, auth, planId, branch, db.LockScopeWrite, ctx, cancel)
+	if unlockFn == nil {
+		return
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	dbBranch, err := db.GetDbBranch(planId, branch)
+
+	if err != nil {
+		log.Printf("Error getting branch: %v\n", err)
+		http.Error(w, "Error getting branch: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if dbBranch == nil {
+		log.Printf("Branch not found: %s\n", branch)
+		http.Error(w, "Branch not found: "+branch, http.StatusNotFound)
+		return
+	}
+
+	if getPlanRunStatus([]*db.Branch{dbBranch}, isBranchActive) == shared.PlanRunStatusRunning {
+		log.Println("Branch is running")
+		http.Error(w, "Can't apply changes while the plan is running", http.StatusConflict)
+		return
+	}
+
+	planState, err := db.GetCurrentPlanState(db.CurrentPlanStateParams{
+		OrgId:  auth.OrgId,
+		PlanId: planId,
+	})
+
+	if err != nil {
+		log.Printf("Error getting current plan state: %v\n", err)
+		http.Error(w, "Error getting current plan state: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(planState.CurrentPlanFiles.Files) == 0 {
+		log.Println("No pending changes")
+		http.Error(w, "Plan has no pending changes to apply", http.StatusConflict)
+		return
+	}
+
+	var paths []string
+	if req.Paths != nil {
+		var missing []string
+		paths, missing = selectPendingPaths(planState.CurrentPlanFiles.Files, req.Paths)
+
+		if len(missing) > 0 {
+			log.Printf("Paths without pending changes: %v\n", missing)
+			http.Error(w, "No pending changes for: "+strings.Join(missing, ", "), http.StatusBadRequest)
+			return
+		}
+	}
+
+	changes, _ := getPlanFileChanges(planState)
+	applied, pending := splitPlanFileChanges(changes, paths)
+
+	previousSha, _, err := db.GetLatestCommit(auth.OrgId, planId, branch)
+
+	if err != nil {
+		log.Printf("Error getting latest commit: %v\n", err)
+		http.Error(w, "Error getting latest commit: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = db.ApplyPlanFiles(auth.OrgId, auth.User.Id, branch, plan, paths)
+
+	if err != nil {
+		log.Printf("Error applying plan: %v\n", err)
+		http.Error(w, "Error applying plan: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sha, _, err := db.GetLatestCommit(auth.OrgId, planId, branch)
+
+	if err != nil {
+		log.Printf("Error getting latest commit: %v\n", err)
+		http.Error(w, "Error getting latest commit: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res := shared.ApplyPlanChangesResponse{
+		PreviousSha: previousSha,
+		Sha:         sha,
+		Summary:     summarizePlanFileChanges(applied),
+		Files:       []string{},
+		Pending:     []string{},
+	}
+	for _, change := range applied {
+		res.Files = append(res.Files, change.Path)
+	}
+	for _, change := range pending {
+		res.Pending = append(res.Pending, change.Path)
+	}
+
+	bytes, err := json.Marshal(res)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Printf("Successfully applied %d changed files for plan %s\n", len(res.Files), planId)
+}
+
+// RejectPlanChangesHandler discards a branch's pending changes like RejectAllChangesHandler. The
+// discarded changes stay in the branch's history at previousSha. With nothing pending it
+// succeeds without a commit, so retrying is safe.
+func RejectPlanChangesHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for RejectPlanChangesHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+
+	log.Println("planId: ", planId)
+
+	branch := r.URL.Query().Get("branch")
+	if branch == "" {
+		branch = "main"
+	}
+
+	if authorizePlanUpdate(w, planId, auth) == nil {
+		return
+	}
+
+	var err error
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepoBranch(w, auth, planId, branch, db.LockScopeWrite, ctx, cancel)
+	if unlockFn == nil {
+		return
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	planState, err := db.GetCurrentPlanState(db.CurrentPlanStateParams{
+		OrgId:  auth.OrgId,
+		PlanId: planId,
+	})
+
+	if err != nil {
+		log.Printf("Error getting current plan state: %v\n", err)
+		http.Error(w, "Error getting current plan state: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res := shared.RejectPlanChangesResponse{
+		Files: []string{},
+	}
+	for path := range planState.CurrentPlanFiles.Files {
+		res.Files = append(res.Files, path)
+	}
+	sort.Strings(res.Files)
+	res.NumDiscarded = len(res.Files)
+
+	if res.NumDiscarded > 0 {
+		res.PreviousSha, _, err = db.GetLatestCommit(auth.OrgId, planId, branch)
+
+		if err != nil {
+			log.Printf("Error getting latest commit: %v\n", err)
+			http.Error(w, "Error getting latest commit: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = db.RejectAllResults(auth.OrgId, planId)
+
+		if err != nil {
+			log.Printf("Error rejecting all changes: %v\n", err)
+			http.Error(w, "Error rejecting all changes: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = db.GitAddAndCommit(auth.OrgId, planId, branch, fmt.Sprintf("🚫 Rejected pending changes to %d files", res.NumDiscarded))
+
+		if err != nil {
+			log.Printf("Error committing rejected changes: %v\n", err)
+			http.Error(w, "Error committing rejected changes: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	bytes, err := json.Marshal(res)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Printf("Successfully discarded pending changes to %d files for plan %s\n", res.NumDiscarded, planId)
+}
+
+// selectPendingPaths dedupes paths and returns the ones that aren't in pendingFiles separately
+func selectPendingPaths(pendingFiles map[string]string, paths []string) (selected, missing []string) {
+	seen := map[string]bool{}
+
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		if _, ok := pendingFiles[path]; ok {
+			selected = append(selected, path)
+		} else {
+			missing = append(missing, path)
+		}
+	}
+
+	return selected, missing
+}
+
+// splitPlanFileChanges splits changes into the ones for paths and the rest. A nil paths selects
+// every change.
+func splitPlanFileChanges(changes []*shared.PlanFileChange, paths []string) (selected, rest []*shared.PlanFileChange) {
+	if paths == nil {
+		return changes, nil
+	}
+
+	isSelected := map[string]bool{}
+	for _, path := range paths {
+		isSelected[path] = true
+	}
+
+	for _, change := range changes {
+		if isSelected[change.Path] {
+			selected = append(selected, change)
+		} else {
+			rest = append(rest, change)
+		}
+	}
+
+	return selected, rest
+}
+
 func RejectAllChangesHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for RejectAllChangesHandler")
+	logger.Debugln("Received request for RejectAllChangesHandler")
 
 	auth := authenticate(w, r, true)
 	if auth == nil {
@@ -154,7 +452,7 @@ func RejectAllChangesHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func RejectFileHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for RejectResultHandler")
+	logger.Debugln("Received request for RejectResultHandler")
 
 	auth := authenticate(w, r, true)
 	if auth == nil {
@@ -214,8 +512,25 @@ func ArchivePlanHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Println("Received request for ArchivePlanHandler")
+	logger.Debugln("Received request for ArchivePlanHandler")
+
+	setPlanArchived(w, r, auth, true)
+}
+
+func UnarchivePlanHandler(w http.ResponseWriter, r *http.Request) {
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
 
+	logger.Debugln("Received request for UnarchivePlanHandler")
+
+	setPlanArchived(w, r, auth, false)
+}
+
+// setPlanArchived is a no-op for a plan that's already in the requested state, so retries are
+// safe. The state check is part of the update so concurrent requests can't both change it.
+func setPlanArchived(w http.ResponseWriter, r *http.Request, auth *types.ServerAuth, archived bool) {
 	vars := mux.Vars(r)
 	planId := vars["planId"]
 	log.Println("planId: ", planId)
@@ -226,17 +541,30 @@ func ArchivePlanHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if plan.ArchivedAt != nil {
-		log.Println("Plan already archived")
-		http.Error(w, "Plan already archived", http.StatusBadRequest)
+	action := "archiving"
+	query := "UPDATE plans SET archived_at = NOW() WHERE id = $1 AND archived_at IS NULL"
+	if !archived {
+		action = "unarchiving"
+		query = "UPDATE plans SET archived_at = NULL WHERE id = $1 AND archived_at IS NOT NULL"
+	}
+
+	res, err := db.Conn.Exec(query, planId)
+
+	if db.IsNonUniqueErrOn(err, "plans_one_draft_idx") {
+		log.Println("Can't unarchive draft, another draft exists")
+		http.Error(w, "Can't unarchive this draft while there's another draft in the project", http.StatusConflict)
 		return
 	}
 
-	res, err := db.Conn.Exec("UPDATE plans SET archived_at = NOW() WHERE id = $1", planId)
+	if db.IsNonUniqueErrOn(err, "plans_name_unique_idx") {
+		log.Println("Can't unarchive plan, another plan has its name")
+		http.Error(w, fmt.Sprintf("Can't unarchive this plan while there's another plan named '%s' in the project. Rename one of them first.", plan.Name), http.StatusConflict)
+		return
+	}
 
 	if err != nil {
-		log.Printf("Error archiving plan: %v\n", err)
-		http.Error(w, "Error archiving plan: "+err.Error(), http.StatusInternalServerError)
+		log.Printf("Error %s plan: %v\n", action, err)
+		http.Error(w, fmt.Sprintf("Error %s plan: %v", action, err), http.StatusInternalServerError)
 		return
 	}
 
@@ -247,11 +575,195 @@ func ArchivePlanHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if rowsAffected == 0 {
-		log.Println("Plan not found")
-		http.Error(w, "Not found", http.StatusNotFound)
+	changed := rowsAffected > 0
+
+	if changed {
+		db.InvalidatePlanCache(planId)
+
+		if archived {
+			db.PublishPlanArchived(plan)
+		} else {
+			db.PublishPlanUnarchived(plan)
+		}
+	}
+
+	bytes, err := json.Marshal(shared.ArchivePlanResponse{Changed: changed})
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	if !changed {
+		log.Printf("Plan %s already in requested archive state, archived: %v\n", planId, archived)
+		return
+	}
+
+	log.Printf("Successfully set plan %s archived: %v\n", planId, archived)
+}
+
+// TouchPlanHandler bumps the plan's updated_at without changing anything else, so it moves to the
+// top of lists sorted by last update
+func TouchPlanHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for TouchPlanHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+	log.Println("planId: ", planId)
+
+	plan := authorizePlanUpdate(w, planId, auth)
+	if plan == nil {
+		return
+	}
+
+	updatedAt, err := db.TouchPlan(plan.Id)
+
+	if err != nil {
+		log.Printf("Error touching plan: %v\n", err)
+		http.Error(w, "Error touching plan: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	bytes, err := json.Marshal(shared.TouchPlanResponse{UpdatedAt: updatedAt})
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Println("Successfully touched plan", plan.Id)
+}
+
+// MarkPlanSeenHandler records that the user has reviewed the plan, so it drops out of their
+// unseen=true listing until it's updated again. Anyone who can read the plan can mark it seen.
+func MarkPlanSeenHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for MarkPlanSeenHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+	log.Println("planId: ", planId)
+
+	plan := authorizePlan(w, planId, auth)
+	if plan == nil {
 		return
 	}
 
-	log.Println("Successfully archived plan", planId)
+	seenAt, err := db.MarkPlanSeen(plan.Id, auth.User.Id)
+
+	if err != nil {
+		log.Printf("Error marking plan seen: %v\n", err)
+		http.Error(w, "Error marking plan seen: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	bytes, err := json.Marshal(shared.MarkPlanSeenResponse{SeenAt: seenAt})
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Println("Successfully marked plan seen", plan.Id)
+}
+
+// ResetPlanHandler empties the plan's main branch while keeping its id, name, metadata, and
+// settings, so it can be reused for a fresh start
+func ResetPlanHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for ResetPlanHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+	branch := "main"
+	log.Println("planId: ", planId)
+
+	plan := authorizePlan(w, planId, auth)
+	if plan == nil {
+		return
+	}
+
+	if plan.OwnerId != auth.User.Id {
+		log.Println("Only the plan owner can reset a plan")
+		http.Error(w, "Only the plan owner can reset a plan", http.StatusForbidden)
+		return
+	}
+
+	stream, err := db.GetActiveModelStream(planId, branch)
+
+	if err != nil {
+		log.Printf("Error getting active model stream: %v\n", err)
+		http.Error(w, "Error getting active model stream: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if stream != nil {
+		log.Println("Can't reset a running plan")
+		http.Error(w, "Plan is running. Stop it before resetting.", http.StatusConflict)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepoBranch(w, auth, planId, branch, db.LockScopeWrite, ctx, cancel)
+	if unlockFn == nil {
+		return
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	snapshotSha, changed, err := db.ResetPlan(auth.OrgId, planId, branch)
+
+	if err != nil {
+		log.Printf("Error resetting plan: %v\n", err)
+		http.Error(w, "Error resetting plan: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := db.GetPlan(planId)
+
+	if err != nil {
+		log.Printf("Error getting plan: %v\n", err)
+		http.Error(w, "Error getting plan: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	bytes, err := json.Marshal(shared.ResetPlanResponse{
+		Plan:        updated.ToApi(),
+		SnapshotSha: snapshotSha,
+		Changed:     changed,
+	})
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Println("Successfully reset plan", planId)
 }
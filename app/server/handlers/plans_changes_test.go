@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/plandex/plandex/shared"
+)
+
+func TestSelectPendingPaths(t *testing.T) {
+	pending := map[string]string{"a.go": "", "b.go": ""}
+
+	selected, missing := selectPendingPaths(pending, []string{"b.go", "c.go", "b.go"})
+
+	if len(selected) != 1 || selected[0] != "b.go" {
+		t.Errorf("expected only b.go selected, got %v", selected)
+	}
+	if len(missing) != 1 || missing[0] != "c.go" {
+		t.Errorf("expected c.go missing, got %v", missing)
+	}
+}
+
+func TestSplitPlanFileChanges(t *testing.T) {
+	changes := []*shared.PlanFileChange{
+		{Path: "a.go", Status: shared.PlanFileChangeAdded},
+		{Path: "b.go", Status: shared.PlanFileChangeModified},
+	}
+
+	selected, rest := splitPlanFileChanges(changes, []string{"b.go"})
+	if len(selected) != 1 || selected[0].Path != "b.go" || len(rest) != 1 || rest[0].Path != "a.go" {
+		t.Errorf("unexpected split: %v, %v", selected, rest)
+	}
+
+	if summary := summarizePlanFileChanges(selected); summary.Added != 0 || summary.Modified != 1 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+
+	selected, rest = splitPlanFileChanges(changes, nil)
+	if len(selected) != 2 || len(rest) != 0 {
+		t.Errorf("expected every change selected with nil paths, got %v, %v", selected, rest)
+	}
+}
@@ -3,17 +3,20 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
 	"net/http"
 	"plandex-server/db"
+	"plandex-server/logger"
+	"plandex-server/model/lib"
 
 	"github.com/gorilla/mux"
 	"github.com/plandex/plandex/shared"
 )
 
 func ListContextHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for ListContextHandler")
+	logger.Debugln("Received request for ListContextHandler")
 
 	auth := authenticate(w, r, true)
 	if auth == nil {
@@ -64,8 +67,95 @@ func ListContextHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(bytes)
 }
 
+// GetPlanContextTokensHandler counts the tokens in each of a branch's contexts with the model
+// tokenizer, so users can see what to trim before the context exceeds the planner's limit
+func GetPlanContextTokensHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for GetPlanContextTokensHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+	log.Println("planId: ", planId)
+
+	branch := r.URL.Query().Get("branch")
+	if branch == "" {
+		branch = "main"
+	}
+
+	plan := authorizePlan(w, planId, auth)
+	if plan == nil {
+		return
+	}
+
+	var err error
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepoBranch(w, auth, planId, branch, db.LockScopeRead, ctx, cancel)
+	if unlockFn == nil {
+		return
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	dbContexts, err := db.GetPlanContexts(auth.OrgId, planId, true)
+
+	if err != nil {
+		log.Printf("Error getting contexts: %v\n", err)
+		http.Error(w, "Error getting contexts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	settings, err := db.GetPlanSettings(plan, true)
+
+	if err != nil {
+		log.Printf("Error getting settings: %v\n", err)
+		http.Error(w, "Error getting settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res := shared.GetPlanContextTokensResponse{
+		Contexts:  []*shared.ContextTokens{},
+		MaxTokens: settings.GetPlannerEffectiveMaxTokens(),
+	}
+
+	for _, dbContext := range dbContexts {
+		numTokens, err := lib.GetNumTokensCached(dbContext.Body)
+
+		if err != nil {
+			log.Printf("Error counting tokens: %v\n", err)
+			http.Error(w, "Error counting tokens: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		res.Contexts = append(res.Contexts, &shared.ContextTokens{
+			Id:          dbContext.Id,
+			ContextType: dbContext.ContextType,
+			Name:        dbContext.Name,
+			FilePath:    dbContext.FilePath,
+			Url:         dbContext.Url,
+			NumTokens:   numTokens,
+		})
+		res.TotalTokens += numTokens
+	}
+
+	bytes, err := json.Marshal(res)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+}
+
 func LoadContextHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for LoadContextHandler")
+	logger.Debugln("Received request for LoadContextHandler")
 
 	auth := authenticate(w, r, true)
 	if auth == nil {
@@ -118,7 +208,7 @@ func LoadContextHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func UpdateContextHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for UpdateContextHandler")
+	logger.Debugln("Received request for UpdateContextHandler")
 
 	auth := authenticate(w, r, true)
 	if auth == nil {
@@ -209,8 +299,103 @@ func UpdateContextHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(bytes)
 }
 
+func PatchContextHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for PatchContextHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+	branchName := vars["branch"]
+	log.Println("planId: ", planId)
+
+	plan := authorizePlan(w, planId, auth)
+	if plan == nil {
+		return
+	}
+
+	// read the request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("Error reading request body: %v\n", err)
+		http.Error(w, "Error reading request body", http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+
+	var requestBody shared.PatchContextRequest
+	if err := json.Unmarshal(body, &requestBody); err != nil {
+		log.Printf("Error parsing request body: %v\n", err)
+		http.Error(w, "Error parsing request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateContextPatch(&requestBody); err != nil {
+		log.Printf("Invalid context patch: %v\n", err)
+		http.Error(w, "Invalid context patch: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepo(w, r, auth, db.LockScopeWrite, ctx, cancel, true)
+	if unlockFn == nil {
+		return
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	patchRes, err := db.PatchContexts(db.PatchContextsParams{
+		Req:        &requestBody,
+		OrgId:      auth.OrgId,
+		Plan:       plan,
+		BranchName: branchName,
+		UserId:     auth.User.Id,
+	})
+
+	if errors.Is(err, db.ErrInvalidContextPatch) {
+		log.Printf("Invalid context patch: %v\n", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		log.Printf("Error patching contexts: %v\n", err)
+		http.Error(w, "Error patching contexts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !patchRes.MaxTokensExceeded {
+		err = db.GitAddAndCommit(auth.OrgId, planId, branchName, patchRes.Msg)
+
+		if err != nil {
+			log.Printf("Error committing changes: %v\n", err)
+			http.Error(w, "Error committing changes: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		log.Printf("The total number of tokens (%d) exceeds the maximum allowed (%d)", patchRes.TotalTokens, patchRes.MaxTokens)
+	}
+
+	bytes, err := json.Marshal(patchRes)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Println("Successfully processed PatchContextHandler request")
+
+	w.Write(bytes)
+}
+
 func DeleteContextHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for DeleteContextHandler")
+	logger.Debugln("Received request for DeleteContextHandler")
 
 	auth := authenticate(w, r, true)
 	if auth == nil {
@@ -301,7 +486,7 @@ func DeleteContextHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = db.AddPlanContextTokens(planId, branchName, -removeTokens)
+	err = db.AddPlanContextTokens(auth.OrgId, planId, branchName, -removeTokens)
 	if err != nil {
 		log.Printf("Error updating plan tokens: %v\n", err)
 		http.Error(w, "Error updating plan tokens: "+err.Error(), http.StatusInternalServerError)
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"plandex-server/db"
+	"plandex-server/logger"
+
+	"github.com/gorilla/mux"
+)
+
+// UploadContextHandler loads file contexts from a multipart/form-data body, one "file" part per
+// file with the file's path as its filename. Each file is written to the plan as it arrives, so
+// large files aren't held in memory, and any file over the size cap fails the whole upload. The
+// branch stays locked while the upload streams in. Set forceSkipIgnore=true to skip ignore
+// checks for every file. Responds like LoadContextHandler.
+func UploadContextHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for UploadContextHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+	branchName := vars["branch"]
+	log.Println("planId: ", planId)
+
+	plan := authorizePlan(w, planId, auth)
+	if plan == nil {
+		return
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		log.Printf("Error reading multipart body: %v\n", err)
+		http.Error(w, "Expected a multipart/form-data body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	forceSkipIgnore := r.URL.Query().Get("forceSkipIgnore") == "true"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepo(w, r, auth, db.LockScopeWrite, ctx, cancel, true)
+	if unlockFn == nil {
+		return
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	// set for problems with the request itself, as opposed to storing it
+	var reqErr error
+
+	res, dbContexts, err := db.UploadContexts(db.UploadContextsParams{
+		OrgId:      auth.OrgId,
+		Plan:       plan,
+		BranchName: branchName,
+		UserId:     auth.User.Id,
+		NextFile: func() (*db.ContextUpload, error) {
+			upload, err := nextContextUpload(mr)
+			if err != nil && err != io.EOF {
+				reqErr = err
+			}
+			if upload != nil {
+				upload.ForceSkipIgnore = forceSkipIgnore
+			}
+			return upload, err
+		},
+	})
+
+	if reqErr != nil {
+		log.Printf("Invalid upload: %v\n", reqErr)
+		http.Error(w, "Invalid upload: "+reqErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, db.ErrContextUploadTooLarge) {
+		log.Printf("Context upload too large: %v\n", err)
+		http.Error(w, fmt.Sprintf("Each file can be at most %d bytes", db.MaxContextUploadBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if errors.Is(err, db.ErrTooManyContextUploads) {
+		log.Printf("Too many files in upload: %v\n", err)
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if err != nil {
+		log.Printf("Error uploading contexts: %v\n", err)
+		http.Error(w, "Error uploading contexts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !res.MaxTokensExceeded {
+		err = db.GitAddAndCommit(auth.OrgId, plan.Id, branchName, res.Msg)
+
+		if err != nil {
+			log.Printf("Error committing changes: %v\n", err)
+			http.Error(w, "Error committing changes: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		log.Printf("The total number of tokens (%d) exceeds the maximum allowed (%d)", res.TotalTokens, res.MaxTokens)
+	}
+
+	bytes, err := json.Marshal(res)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Printf("Successfully uploaded %d contexts\n", len(dbContexts))
+}
+
+// nextContextUpload returns the next "file" part, skipping any other form fields, or io.EOF
+// after the last one. The path comes from the raw filename, since Part.FileName drops
+// everything but the base name.
+func nextContextUpload(mr *multipart.Reader) (*db.ContextUpload, error) {
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading multipart body: %v", err)
+		}
+
+		if part.FormName() != "file" {
+			continue
+		}
+
+		_, params, err := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid content disposition: %v", err)
+		}
+
+		filePath, ok := cleanPlanFilePath(params["filename"])
+		if !ok {
+			return nil, fmt.Errorf("invalid file path: '%s'", params["filename"])
+		}
+
+		return &db.ContextUpload{FilePath: filePath, Body: part}, nil
+	}
+}
@@ -3,11 +3,15 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"plandex-server/db"
+	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/plandex/plandex/shared"
 )
 
 func ListConvoHandler(w http.ResponseWriter, r *http.Request) {
@@ -57,3 +61,463 @@ func ListConvoHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(bytes)
 
 }
+
+// StreamPlanConvoHandler writes a page of convo messages as NDJSON, one shared.ConvoMessage per
+// line. Messages are read one at a time so memory stays bounded for long convos. The after and
+// before params are message ids that bound the page, order is asc (default) or desc, and the
+// X-Has-More header says whether there are more messages past the page.
+func StreamPlanConvoHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Received a request for StreamPlanConvoHandler")
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+
+	log.Println("planId: ", planId)
+
+	if authorizePlan(w, planId, auth) == nil {
+		return
+	}
+
+	q := r.URL.Query()
+
+	limit := shared.DefaultConvoStreamLimit
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > shared.MaxConvoStreamLimit {
+			log.Printf("Invalid limit: %s\n", s)
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", shared.MaxConvoStreamLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	order := q.Get("order")
+	if order == "" {
+		order = "asc"
+	}
+	if order != "asc" && order != "desc" {
+		log.Printf("Invalid order: %s\n", order)
+		http.Error(w, "order must be 'asc' or 'desc'", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepo(w, r, auth, db.LockScopeRead, ctx, cancel, true)
+	if unlockFn == nil {
+		return
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	refs, err := db.ListPlanConvoRefs(auth.OrgId, planId)
+
+	if err != nil {
+		log.Println("Error listing plan convo: ", err)
+		http.Error(w, "Error listing plan convo: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	page, hasMore, err := convoPage(refs, q.Get("after"), q.Get("before"), limit, order == "desc")
+
+	if err != nil {
+		log.Println("Invalid convo page: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set(shared.ConvoHasMoreHeader, strconv.FormatBool(hasMore))
+
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+
+	for _, ref := range page {
+		msg, err := db.GetConvoMessage(auth.OrgId, planId, ref.Id)
+
+		// the status is already sent, so the client just sees a truncated page
+		if err != nil {
+			log.Println("Error getting convo message: ", err)
+			return
+		}
+
+		err = encoder.Encode(msg.ToApi())
+
+		if err != nil {
+			log.Println("Error writing convo message: ", err)
+			return
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	log.Println("Successfully processed request for StreamPlanConvoHandler")
+}
+
+// GetPlanConvoHandler returns a page of convo messages in chronological order as a JSON array,
+// for UIs that page by offset rather than following the NDJSON stream. The total is the number
+// of messages in the whole convo.
+func GetPlanConvoHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Received a request for GetPlanConvoHandler")
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+
+	log.Println("planId: ", planId)
+
+	if authorizePlan(w, planId, auth) == nil {
+		return
+	}
+
+	q := r.URL.Query()
+
+	limit := shared.DefaultConvoPageLimit
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > shared.MaxConvoPageLimit {
+			log.Printf("Invalid limit: %s\n", s)
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", shared.MaxConvoPageLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	offset := 0
+	if s := q.Get("offset"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			log.Printf("Invalid offset: %s\n", s)
+			http.Error(w, "offset must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+
+	var err error
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepo(w, r, auth, db.LockScopeRead, ctx, cancel, true)
+	if unlockFn == nil {
+		return
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	refs, err := db.ListPlanConvoRefs(auth.OrgId, planId)
+
+	if err != nil {
+		log.Println("Error listing plan convo: ", err)
+		http.Error(w, "Error listing plan convo: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res := shared.GetPlanConvoResponse{
+		Messages: []*shared.PlanConvoMessage{},
+		Total:    len(refs),
+		Offset:   offset,
+		Limit:    limit,
+	}
+
+	if offset < len(refs) {
+		end := offset + limit
+		if end > len(refs) {
+			end = len(refs)
+		}
+
+		for _, ref := range refs[offset:end] {
+			msg, err := db.GetConvoMessage(auth.OrgId, planId, ref.Id)
+
+			if err != nil {
+				log.Println("Error getting convo message: ", err)
+				http.Error(w, "Error getting convo message: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			res.Messages = append(res.Messages, &shared.PlanConvoMessage{
+				Id:        msg.Id,
+				Role:      msg.Role,
+				Content:   msg.Message,
+				CreatedAt: msg.CreatedAt,
+				Tokens:    msg.Tokens,
+			})
+		}
+	}
+
+	bytes, err := json.Marshal(res)
+
+	if err != nil {
+		log.Println("Error marshalling plan convo: ", err)
+		http.Error(w, "Error marshalling plan convo: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Println("Successfully processed request for GetPlanConvoHandler")
+	w.Write(bytes)
+}
+
+// UpdateConvoMessageHandler replaces a convo message's content, like correcting a mistyped prompt.
+// The edit is committed to the branch, and the commit from before it is returned as previousSha so
+// it can be undone with a rewind.
+func UpdateConvoMessageHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Received a request for UpdateConvoMessageHandler")
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+	branch := vars["branch"]
+	messageId := vars["messageId"]
+
+	log.Println("planId: ", planId, "branch: ", branch, "messageId: ", messageId)
+
+	var req shared.UpdateConvoMessageRequest
+	if decodeErr := json.NewDecoder(r.Body).Decode(&req); decodeErr != nil {
+		log.Printf("Error decoding request: %v\n", decodeErr)
+		http.Error(w, "Error decoding request: "+decodeErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(req.Content) == "" {
+		log.Println("Empty content")
+		http.Error(w, "content can't be empty, delete the message instead", http.StatusBadRequest)
+		return
+	}
+
+	if authorizePlanUpdate(w, planId, auth) == nil {
+		return
+	}
+
+	var err error
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepo(w, r, auth, db.LockScopeWrite, ctx, cancel, true)
+	if unlockFn == nil {
+		return
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	previousSha, ok := getConvoEditPreviousSha(w, auth.OrgId, planId, branch)
+	if !ok {
+		return
+	}
+
+	msg, err := db.UpdateConvoMessage(auth.OrgId, planId, branch, messageId, req.Content)
+
+	if err == db.ErrConvoMessageNotFound {
+		log.Printf("Convo message not found: %s\n", messageId)
+		http.Error(w, "Convo message not found: "+messageId, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		log.Printf("Error updating convo message: %v\n", err)
+		http.Error(w, "Error updating convo message: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	bytes, err := json.Marshal(shared.UpdateConvoMessageResponse{
+		Message: &shared.PlanConvoMessage{
+			Id:        msg.Id,
+			Role:      msg.Role,
+			Content:   msg.Message,
+			CreatedAt: msg.CreatedAt,
+			Tokens:    msg.Tokens,
+		},
+		PreviousSha: previousSha,
+	})
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Println("Successfully processed request for UpdateConvoMessageHandler")
+	w.Write(bytes)
+}
+
+// DeleteConvoMessageHandler deletes a convo message. With cascade=true, the assistant replies
+// that follow it are deleted too, so deleting the latest prompt this way rewinds the convo one
+// exchange. Pending changes from deleted replies are left as they are. Like an edit, the delete
+// is committed and previousSha can be used to undo it.
+func DeleteConvoMessageHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("Received a request for DeleteConvoMessageHandler")
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+	branch := vars["branch"]
+	messageId := vars["messageId"]
+
+	log.Println("planId: ", planId, "branch: ", branch, "messageId: ", messageId)
+
+	cascade := false
+	if s := r.URL.Query().Get("cascade"); s != "" {
+		var parseErr error
+		cascade, parseErr = strconv.ParseBool(s)
+		if parseErr != nil {
+			log.Printf("Invalid cascade: %s\n", s)
+			http.Error(w, "cascade must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if authorizePlanUpdate(w, planId, auth) == nil {
+		return
+	}
+
+	var err error
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepo(w, r, auth, db.LockScopeWrite, ctx, cancel, true)
+	if unlockFn == nil {
+		return
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	previousSha, ok := getConvoEditPreviousSha(w, auth.OrgId, planId, branch)
+	if !ok {
+		return
+	}
+
+	deletedIds, err := db.DeleteConvoMessage(auth.OrgId, planId, branch, messageId, cascade)
+
+	if err == db.ErrConvoMessageNotFound {
+		log.Printf("Convo message not found: %s\n", messageId)
+		http.Error(w, "Convo message not found: "+messageId, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		log.Printf("Error deleting convo message: %v\n", err)
+		http.Error(w, "Error deleting convo message: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	bytes, err := json.Marshal(shared.DeleteConvoMessageResponse{
+		DeletedIds:  deletedIds,
+		PreviousSha: previousSha,
+	})
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Println("Successfully processed request for DeleteConvoMessageHandler")
+	w.Write(bytes)
+}
+
+// getConvoEditPreviousSha checks the convo can be edited, refusing while the branch is running
+// since the reply being streamed builds on the convo, and returns the branch's latest commit.
+// Writes the error response and returns false otherwise.
+func getConvoEditPreviousSha(w http.ResponseWriter, orgId, planId, branch string) (string, bool) {
+	dbBranch, err := db.GetDbBranch(planId, branch)
+
+	if err != nil {
+		log.Printf("Error getting branch: %v\n", err)
+		http.Error(w, "Error getting branch: "+err.Error(), http.StatusInternalServerError)
+		return "", false
+	}
+
+	if dbBranch == nil {
+		log.Printf("Branch not found: %s\n", branch)
+		http.Error(w, "Branch not found: "+branch, http.StatusNotFound)
+		return "", false
+	}
+
+	if getPlanRunStatus([]*db.Branch{dbBranch}, isBranchActive) == shared.PlanRunStatusRunning {
+		log.Println("Branch is running")
+		http.Error(w, "Can't edit the convo while the plan is running", http.StatusConflict)
+		return "", false
+	}
+
+	previousSha, _, err := db.GetLatestCommit(orgId, planId, branch)
+
+	if err != nil {
+		log.Printf("Error getting latest commit: %v\n", err)
+		http.Error(w, "Error getting latest commit: "+err.Error(), http.StatusInternalServerError)
+		return "", false
+	}
+
+	return previousSha, true
+}
+
+// convoPage picks up to limit messages strictly between the after and before ids (either can be
+// empty), starting from the end nearest the requested order. refs are in chronological order.
+func convoPage(refs []*db.ConvoMessageRef, afterId, beforeId string, limit int, desc bool) ([]*db.ConvoMessageRef, bool, error) {
+	lo := 0
+	hi := len(refs)
+
+	indexOf := func(id string) int {
+		for i, ref := range refs {
+			if ref.Id == id {
+				return i
+			}
+		}
+		return -1
+	}
+
+	if afterId != "" {
+		i := indexOf(afterId)
+		if i == -1 {
+			return nil, false, fmt.Errorf("message '%s' not found", afterId)
+		}
+		lo = i + 1
+	}
+
+	if beforeId != "" {
+		i := indexOf(beforeId)
+		if i == -1 {
+			return nil, false, fmt.Errorf("message '%s' not found", beforeId)
+		}
+		hi = i
+	}
+
+	if lo >= hi {
+		return []*db.ConvoMessageRef{}, false, nil
+	}
+
+	hasMore := hi-lo > limit
+
+	if !desc {
+		if hasMore {
+			hi = lo + limit
+		}
+		return refs[lo:hi], hasMore, nil
+	}
+
+	if hasMore {
+		lo = hi - limit
+	}
+
+	page := make([]*db.ConvoMessageRef, 0, hi-lo)
+	for i := hi - 1; i >= lo; i-- {
+		page = append(page, refs[i])
+	}
+
+	return page, hasMore, nil
+}
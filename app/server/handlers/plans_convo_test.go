@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"plandex-server/db"
+	"strings"
+	"testing"
+)
+
+func TestConvoPage(t *testing.T) {
+	var refs []*db.ConvoMessageRef
+	for _, id := range []string{"m1", "m2", "m3", "m4", "m5"} {
+		refs = append(refs, &db.ConvoMessageRef{Id: id})
+	}
+
+	tests := []struct {
+		desc     string
+		after    string
+		before   string
+		limit    int
+		reverse  bool
+		expected string
+		hasMore  bool
+	}{
+		{desc: "first page", limit: 2, expected: "m1,m2", hasMore: true},
+		{desc: "next page", after: "m2", limit: 2, expected: "m3,m4", hasMore: true},
+		{desc: "last page", after: "m4", limit: 2, expected: "m5"},
+		{desc: "all", limit: 10, expected: "m1,m2,m3,m4,m5"},
+		{desc: "latest first", limit: 2, reverse: true, expected: "m5,m4", hasMore: true},
+		{desc: "older page", before: "m4", limit: 2, reverse: true, expected: "m3,m2", hasMore: true},
+		{desc: "range", after: "m1", before: "m5", limit: 10, expected: "m2,m3,m4"},
+		{desc: "empty range", after: "m3", before: "m2", limit: 10, expected: ""},
+		{desc: "after last", after: "m5", limit: 10, expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			page, hasMore, err := convoPage(refs, tt.after, tt.before, tt.limit, tt.reverse)
+			if err != nil {
+				t.Fatalf("error getting page: %v", err)
+			}
+
+			var ids []string
+			for _, ref := range page {
+				ids = append(ids, ref.Id)
+			}
+
+			if strings.Join(ids, ",") != tt.expected || hasMore != tt.hasMore {
+				t.Errorf("got %v, hasMore %v, expected %s, hasMore %v", ids, hasMore, tt.expected, tt.hasMore)
+			}
+		})
+	}
+
+	if _, _, err := convoPage(refs, "missing", "", 10, false); err == nil {
+		t.Errorf("expected an error for an unknown message id")
+	}
+}
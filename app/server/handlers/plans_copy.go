@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"plandex-server/db"
+	"plandex-server/logger"
+	"plandex-server/types"
+
+	"github.com/gorilla/mux"
+	"github.com/plandex/plandex/shared"
+)
+
+// CopyPlanHandler creates a copy of a plan in the same project with its main branch context,
+// convo, settings, and metadata, owned by the requesting user. The convo can be left out or cut
+// down to its most recent messages with ConvoMode.
+func CopyPlanHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for CopyPlanHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	if !auth.HasPermission(types.PermissionCreatePlan) {
+		log.Println("User does not have permission to create a plan")
+		http.Error(w, "User does not have permission to create a plan", http.StatusForbidden)
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+
+	log.Println("planId: ", planId)
+
+	source := authorizePlan(w, planId, auth)
+	if source == nil {
+		return
+	}
+
+	var req shared.CopyPlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Error parsing request body: %v\n", err)
+		http.Error(w, "Error parsing request body", http.StatusBadRequest)
+		return
+	}
+
+	convoMode, err := db.ParseConvoCopyMode(req.ConvoMode)
+
+	if err != nil {
+		log.Printf("Invalid convo mode: %v\n", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !validateCopiedPlanName(w, source, req.Name) {
+		return
+	}
+
+	quotaUser, ok := checkPlanQuota(w, auth)
+	if !ok {
+		return
+	}
+
+	org, err := db.GetOrg(auth.OrgId)
+
+	if err != nil {
+		log.Printf("Error getting org: %v\n", err)
+		http.Error(w, "Error getting org: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	name, ok := resolveCopiedPlanName(w, org, source, req.Name)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepoBranch(w, auth, source.Id, "main", db.LockScopeRead, ctx, cancel)
+	if unlockFn == nil {
+		return
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	plan, _ := createPlan(w, org, source.ProjectId, auth.User.Id, "", name, false, db.PlanCreation{ActorId: auth.User.Id})
+	if plan == nil {
+		// an error response has already been written
+		return
+	}
+
+	copyRes, err := db.CopyPlan(db.MigratePlanParams{
+		Source:      source,
+		Target:      plan,
+		KeepUserIds: true,
+		Convo:       convoMode,
+	})
+
+	if err != nil {
+		log.Printf("Error copying plan: %v\n", err)
+		http.Error(w, "Error copying plan: "+err.Error(), http.StatusInternalServerError)
+		deleteCreatedPlan(plan)
+		return
+	}
+
+	if source.SharedWithOrgAt != nil {
+		err = db.SharePlanWithOrg(plan.Id)
+
+		if err != nil {
+			log.Printf("Error sharing plan with org: %v\n", err)
+			http.Error(w, "Error sharing plan with org: "+err.Error(), http.StatusInternalServerError)
+			deleteCreatedPlan(plan)
+			return
+		}
+	}
+
+	resp := shared.CopyPlanResponse{
+		Id:               plan.Id,
+		Name:             plan.Name,
+		NumContexts:      copyRes.NumContexts,
+		NumConvoMessages: copyRes.NumConvoMessages,
+	}
+
+	setRenamedName(&resp.WasRenamed, &resp.RequestedName, plan.Name, name, requestedCopyName(source, req.Name))
+
+	bytes, err := json.Marshal(resp)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if quotaUser != nil {
+		setPlanQuotaHeaders(w, quotaUser, quotaUser.NumNonDraftPlans+1)
+	}
+
+	w.Write(bytes)
+
+	log.Printf("Successfully copied plan %s to new plan %s\n", source.Id, plan.Id)
+}
+
+// CopyPlanSettingsHandler creates an empty plan in the same project with the source plan's model
+// settings, tags, and visibility, for starting a fresh task with the same setup. No context,
+// conversation, or branches are copied. The new plan is owned by the requesting user. Settings
+// come from the source's main branch.
+func CopyPlanSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for CopyPlanSettingsHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	if !auth.HasPermission(types.PermissionCreatePlan) {
+		log.Println("User does not have permission to create a plan")
+		http.Error(w, "User does not have permission to create a plan", http.StatusForbidden)
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+
+	log.Println("planId: ", planId)
+
+	source := authorizePlan(w, planId, auth)
+	if source == nil {
+		return
+	}
+
+	var req shared.CopyPlanSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Error parsing request body: %v\n", err)
+		http.Error(w, "Error parsing request body", http.StatusBadRequest)
+		return
+	}
+
+	if !validateCopiedPlanName(w, source, req.Name) {
+		return
+	}
+
+	quotaUser, ok := checkPlanQuota(w, auth)
+	if !ok {
+		return
+	}
+
+	org, err := db.GetOrg(auth.OrgId)
+
+	if err != nil {
+		log.Printf("Error getting org: %v\n", err)
+		http.Error(w, "Error getting org: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	name, ok := resolveCopiedPlanName(w, org, source, req.Name)
+	if !ok {
+		return
+	}
+
+	settings, ok := getCopiedPlanSettings(w, auth, source)
+	if !ok {
+		return
+	}
+
+	plan, _ := createPlan(w, org, source.ProjectId, auth.User.Id, "", name, false, db.PlanCreation{ActorId: auth.User.Id})
+	if plan == nil {
+		// an error response has already been written
+		return
+	}
+
+	if len(source.Tags) > 0 {
+		err = db.SetPlanTags(plan.Id, source.Tags)
+
+		if err != nil {
+			log.Printf("Error setting plan tags: %v\n", err)
+			http.Error(w, "Error setting plan tags: "+err.Error(), http.StatusInternalServerError)
+			deleteCreatedPlan(plan)
+			return
+		}
+	}
+
+	if source.SharedWithOrgAt != nil {
+		err = db.SharePlanWithOrg(plan.Id)
+
+		if err != nil {
+			log.Printf("Error sharing plan with org: %v\n", err)
+			http.Error(w, "Error sharing plan with org: "+err.Error(), http.StatusInternalServerError)
+			deleteCreatedPlan(plan)
+			return
+		}
+	}
+
+	commitMsg := "⚙️  Copied model settings from " + source.Name
+
+	if settings == nil {
+		orgDefaults, err := org.GetDefaultPlanSettings()
+
+		if err != nil {
+			log.Printf("Error getting org default plan settings: %v\n", err)
+			http.Error(w, "Error getting org default plan settings: "+err.Error(), http.StatusInternalServerError)
+			deleteCreatedPlan(plan)
+			return
+		}
+
+		if orgDefaults != nil {
+			settings = db.ResolveNewPlanSettings(orgDefaults)
+			commitMsg = "⚙️  Applied org default model settings"
+		}
+	}
+
+	if settings != nil {
+		if !storeInitialSettings(w, auth, plan, settings, commitMsg) {
+			// an error response has already been written
+			deleteCreatedPlan(plan)
+			return
+		}
+	}
+
+	resp := shared.CreatePlanResponse{
+		Id:   plan.Id,
+		Name: plan.Name,
+	}
+
+	setRenamedName(&resp.WasRenamed, &resp.RequestedName, plan.Name, name, requestedCopyName(source, req.Name))
+
+	bytes, err := json.Marshal(resp)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if quotaUser != nil {
+		setPlanQuotaHeaders(w, quotaUser, quotaUser.NumNonDraftPlans+1)
+	}
+
+	w.Write(bytes)
+
+	log.Printf("Successfully copied settings of plan %s to new plan %s\n", source.Id, plan.Id)
+}
+
+// validateCopiedPlanName checks a requested name for a copy. Without one the copy takes the
+// source's name, which doesn't work for a draft.
+func validateCopiedPlanName(w http.ResponseWriter, source *db.Plan, name string) bool {
+	if name != "" {
+		if err := validatePlanName(name); err != nil {
+			log.Printf("Invalid plan name: %v\n", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return false
+		}
+	} else if source.Name == "draft" {
+		log.Println("No name for a copy of a draft plan")
+		http.Error(w, "A name is required to copy a draft plan", http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+// resolveCopiedPlanName applies the org's name prefix to a copy's name, which must already have
+// passed validateCopiedPlanName
+func resolveCopiedPlanName(w http.ResponseWriter, org *db.Org, source *db.Plan, name string) (string, bool) {
+	if name == "" {
+		// the source name may predate the org's prefix, so add it rather than rejecting it
+		name, err := db.ApplyPlanNamePrefix(org, source.Name, true)
+
+		if err != nil {
+			log.Printf("Error applying plan name prefix: %v\n", err)
+			http.Error(w, "Error applying plan name prefix: "+err.Error(), http.StatusInternalServerError)
+			return "", false
+		}
+
+		return name, true
+	}
+
+	prefixed, err := db.ApplyPlanNamePrefix(org, name, false)
+
+	if err == db.ErrPlanNamePrefixRequired {
+		writePlanNamePrefixErr(w, org, name)
+		return "", false
+	}
+
+	return prefixed, true
+}
+
+// requestedCopyName is the name a copy was asked for, before the org's prefix: the name given,
+// or the source's name if none was
+func requestedCopyName(source *db.Plan, name string) string {
+	if name == "" {
+		return source.Name
+	}
+	return name
+}
+
+// getCopiedPlanSettings reads the source's settings under a read lock on its main branch. Returns
+// nil settings if the source has never stored any, in which case the copy starts with the org's
+// defaults like any new plan.
+func getCopiedPlanSettings(w http.ResponseWriter, auth *types.ServerAuth, source *db.Plan) (*shared.PlanSettings, bool) {
+	var err error
+
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepoBranch(w, auth, source.Id, "main", db.LockScopeRead, ctx, cancel)
+	if unlockFn == nil {
+		return nil, false
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	settings, err := db.GetPlanSettings(source, false)
+
+	if err != nil {
+		log.Printf("Error getting plan settings: %v\n", err)
+		http.Error(w, "Error getting plan settings: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if settings.ModelSet == nil && settings.ModelOverrides == (shared.ModelOverrides{}) {
+		return nil, true
+	}
+
+	return settings, true
+}
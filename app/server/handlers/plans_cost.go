@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"plandex-server/db"
+	"plandex-server/logger"
+	"plandex-server/model/lib"
+
+	"github.com/gorilla/mux"
+	"github.com/plandex/plandex/shared"
+)
+
+// EstimatePlanCostHandler estimates what sending a prompt to the branch's planner would cost,
+// from the branch's current context and conversation and the plan's model settings, so users
+// can decide whether to trim context before running it
+func EstimatePlanCostHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for EstimatePlanCostHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+	branch := vars["branch"]
+	log.Println("planId: ", planId, "branch: ", branch)
+
+	plan := authorizePlan(w, planId, auth)
+	if plan == nil {
+		return
+	}
+
+	var req shared.EstimatePlanCostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Error parsing request body: %v\n", err)
+		http.Error(w, "Error parsing request body", http.StatusBadRequest)
+		return
+	}
+
+	dbBranch, err := db.GetDbBranch(planId, branch)
+
+	if err != nil {
+		log.Printf("Error getting branch: %v\n", err)
+		http.Error(w, "Error getting branch: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if dbBranch == nil {
+		log.Printf("Branch %s not found\n", branch)
+		http.Error(w, "Branch not found", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepoBranch(w, auth, planId, branch, db.LockScopeRead, ctx, cancel)
+	if unlockFn == nil {
+		return
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	dbContexts, err := db.GetPlanContexts(auth.OrgId, planId, true)
+
+	if err != nil {
+		log.Printf("Error getting contexts: %v\n", err)
+		http.Error(w, "Error getting contexts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	settings, err := db.GetPlanSettings(plan, true)
+
+	if err != nil {
+		log.Printf("Error getting settings: %v\n", err)
+		http.Error(w, "Error getting settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	inputTokens, err := lib.GetNumTokensCached(req.Prompt)
+
+	if err != nil {
+		log.Printf("Error counting tokens: %v\n", err)
+		http.Error(w, "Error counting tokens: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, dbContext := range dbContexts {
+		numTokens, err := lib.GetNumTokensCached(dbContext.Body)
+
+		if err != nil {
+			log.Printf("Error counting tokens: %v\n", err)
+			http.Error(w, "Error counting tokens: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		inputTokens += numTokens
+	}
+
+	res := estimatePlannerCost(settings, inputTokens, dbBranch.ConvoTokens)
+
+	bytes, err := json.Marshal(res)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+}
+
+func estimatePlannerCost(settings *shared.PlanSettings, promptTokens, convoTokens int) *shared.EstimatePlanCostResponse {
+	modelSet := settings.ModelSet
+	if modelSet == nil {
+		modelSet = &shared.DefaultModelSet
+	}
+	modelName := modelSet.Planner.BaseModelConfig.ModelName
+
+	// older messages past max-convo-tokens are replaced by a summary
+	if maxConvo := settings.GetPlannerMaxConvoTokens(); convoTokens > maxConvo {
+		convoTokens = maxConvo
+	}
+
+	res := &shared.EstimatePlanCostResponse{
+		ModelName:       modelName,
+		InputTokens:     promptTokens + convoTokens,
+		MaxOutputTokens: settings.GetPlannerReservedOutputTokens(),
+	}
+
+	if pricing, ok := shared.ModelPricingByName[modelName]; ok {
+		minCost := pricing.Cost(res.InputTokens, res.MinOutputTokens)
+		maxCost := pricing.Cost(res.InputTokens, res.MaxOutputTokens)
+		res.MinCost = &minCost
+		res.MaxCost = &maxCost
+	}
+
+	return res
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"math"
+	"testing"
+
+	"github.com/plandex/plandex/shared"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestEstimatePlannerCost(t *testing.T) {
+	res := estimatePlannerCost(&shared.PlanSettings{}, 90000, 50000)
+
+	maxConvo := shared.DefaultModelSet.Planner.MaxConvoTokens
+	if res.InputTokens != 90000+maxConvo {
+		t.Errorf("expected convo tokens capped at %d, got input tokens %d", maxConvo, res.InputTokens)
+	}
+
+	if res.ModelName != openai.GPT4TurboPreview || res.MinCost == nil || res.MaxCost == nil {
+		t.Fatalf("expected a priced default planner estimate, got %+v", res)
+	}
+
+	wantMin := float64(res.InputTokens) * 10 / 1e6
+	wantMax := wantMin + float64(res.MaxOutputTokens)*30/1e6
+	if math.Abs(*res.MinCost-wantMin) > 1e-9 || math.Abs(*res.MaxCost-wantMax) > 1e-9 {
+		t.Errorf("got cost range %v-%v, want %v-%v", *res.MinCost, *res.MaxCost, wantMin, wantMax)
+	}
+
+	custom := shared.DefaultModelSet
+	custom.Planner.BaseModelConfig.ModelName = "custom-model"
+	res = estimatePlannerCost(&shared.PlanSettings{ModelSet: &custom}, 100, 0)
+	if res.MinCost != nil || res.MaxCost != nil {
+		t.Errorf("expected no cost for a model without pricing, got %+v", res)
+	}
+}
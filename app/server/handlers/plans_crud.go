@@ -1,24 +1,31 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"plandex-server/db"
+	"plandex-server/logger"
+	modelPlan "plandex-server/model/plan"
 	"plandex-server/types"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/lib/pq"
 	"github.com/plandex/plandex/shared"
 )
 
 func CreatePlanHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for CreatePlanHandler")
+	logger.Debugln("Received request for CreatePlanHandler")
 
 	auth := authenticate(w, r, true)
 	if auth == nil {
@@ -34,36 +41,35 @@ func CreatePlanHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	projectId := vars["projectId"]
 
-	log.Println("projectId: ", projectId)
-
-	if !authorizeProject(w, projectId, auth) {
-		return
-	}
-
-	if os.Getenv("IS_CLOUD") != "" {
-		user, err := db.GetUser(auth.User.Id)
+	if projectId == "" {
+		// no project in the path, so fall back to the org's default project
+		var err error
+		projectId, err = db.GetDefaultProjectId(auth.OrgId)
 
 		if err != nil {
-			log.Printf("Error getting user: %v\n", err)
-			http.Error(w, "Error getting user: "+err.Error(), http.StatusInternalServerError)
+			log.Printf("Error getting default project: %v\n", err)
+			http.Error(w, "Error getting default project: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		if user.IsTrial {
-			if user.NumNonDraftPlans >= types.TrialMaxPlans {
-				writeApiError(w, shared.ApiError{
-					Type:   shared.ApiErrorTypeTrialPlansExceeded,
-					Status: http.StatusForbidden,
-					Msg:    "User has reached max number of anonymous trial plans",
-					TrialPlansExceededError: &shared.TrialPlansExceededError{
-						MaxPlans: types.TrialMaxPlans,
-					},
-				})
-				return
-			}
+		if projectId == "" {
+			log.Println("No default project for org")
+			http.Error(w, "Org has multiple projects and no default project. Specify a project id.", http.StatusBadRequest)
+			return
 		}
 	}
 
+	log.Println("projectId: ", projectId)
+
+	if !authorizeProject(w, projectId, auth) {
+		return
+	}
+
+	quotaUser, ok := checkPlanQuota(w, auth)
+	if !ok {
+		return
+	}
+
 	// read the request body
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -80,11 +86,118 @@ func CreatePlanHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if requestBody.Id != "" {
+		if err := validatePlanId(requestBody.Id); err != nil {
+			log.Printf("Invalid plan id: %v\n", err)
+			http.Error(w, "Invalid plan id: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := validateInitialContexts(requestBody.Contexts); err != nil {
+		log.Printf("Invalid initial contexts: %v\n", err)
+		http.Error(w, "Invalid contexts: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(requestBody.ExternalKey) > maxExternalKeyLength {
+		log.Println("External key too long")
+		http.Error(w, fmt.Sprintf("externalKey can't be longer than %d characters", maxExternalKeyLength), http.StatusBadRequest)
+		return
+	}
+
+	if requestBody.InitialPrompt != nil {
+		if strings.TrimSpace(requestBody.InitialPrompt.Prompt) == "" {
+			log.Println("Initial prompt is empty")
+			http.Error(w, "initialPrompt.prompt can't be empty", http.StatusBadRequest)
+			return
+		}
+
+		if requestBody.InitialPrompt.ApiKey == "" {
+			log.Println("API key is required for initial prompt")
+			http.Error(w, "initialPrompt.apiKey is required", http.StatusBadRequest)
+			return
+		}
+	}
+
+	switch requestBody.OnConflict {
+	case "", shared.PlanExternalKeyConflictReturnExisting, shared.PlanExternalKeyConflictError, shared.PlanExternalKeyConflictUpdateName:
+	default:
+		log.Printf("Invalid onConflict: %s\n", requestBody.OnConflict)
+		http.Error(w, "Invalid onConflict: "+string(requestBody.OnConflict), http.StatusBadRequest)
+		return
+	}
+
+	if requestBody.Branch != "" {
+		if err := validateWorkingBranch(requestBody.Branch); err != nil {
+			log.Printf("Invalid branch: %v\n", err)
+			http.Error(w, "Invalid branch: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if requestBody.Visibility != nil {
+		if err := validatePlanVisibility(*requestBody.Visibility); err != nil {
+			log.Printf("Invalid visibility: %v\n", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	org, err := db.GetOrg(auth.OrgId)
+
+	if err != nil {
+		log.Printf("Error getting org: %v\n", err)
+		http.Error(w, "Error getting org: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	orgDefaults, err := org.GetDefaultPlanSettings()
+
+	if err != nil {
+		log.Printf("Error getting org default plan settings: %v\n", err)
+		http.Error(w, "Error getting org default plan settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	name := requestBody.Name
 	if name == "" {
 		name = "draft"
 	}
 
+	if requestBody.CreateIfProjectEmpty {
+		// checked before drafts are deleted so a no-op has no side effects. createPlan checks again
+		// under a lock in case a plan is created in between.
+		count, err := db.CountPlansInProject(projectId, nil)
+
+		if err != nil {
+			log.Printf("Error counting plans in project: %v\n", err)
+			http.Error(w, "Error counting plans in project: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if count > 0 {
+			writeProjectHasPlans(w, auth, projectId)
+			return
+		}
+	}
+
+	// checked before drafts are deleted, since the existing plan could be a draft
+	if requestBody.ExternalKey != "" {
+		existing, err := db.GetPlanByExternalKey(projectId, requestBody.ExternalKey)
+
+		if err != nil {
+			log.Printf("Error checking external key: %v\n", err)
+			http.Error(w, "Error checking external key: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if existing != nil {
+			writeExternalKeyConflict(w, auth, org, existing, &requestBody)
+			return
+		}
+	}
+
 	if name == "draft" {
 		// delete any existing draft plans
 		err = db.DeleteDraftPlans(auth.OrgId, projectId, auth.User.Id)
@@ -95,40 +208,96 @@ func CreatePlanHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	} else {
-		i := 2
-		originalName := name
-		for {
-			var count int
-			err := db.Conn.Get(&count, "SELECT COUNT(*) FROM plans WHERE project_id = $1 AND owner_id = $2 AND name = $3", projectId, auth.User.Id, name)
+		name, err = db.ApplyPlanNamePrefix(org, name, false)
 
-			if err != nil {
-				log.Printf("Error checking if plan exists: %v\n", err)
-				http.Error(w, "Error checking if plan exists: "+err.Error(), http.StatusInternalServerError)
-				return
-			}
+		if err == db.ErrPlanNamePrefixRequired {
+			writePlanNamePrefixErr(w, org, requestBody.Name)
+			return
+		}
+	}
 
-			if count == 0 {
-				break
-			}
+	visibility := shared.PlanVisibilityPrivate
+	if requestBody.Visibility != nil {
+		visibility = *requestBody.Visibility
+	} else {
+		project, err := db.GetProject(auth.OrgId, projectId)
 
-			name = originalName + "." + fmt.Sprint(i)
-			i++
+		if err != nil {
+			log.Printf("Error getting project: %v\n", err)
+			http.Error(w, "Error getting project: "+err.Error(), http.StatusInternalServerError)
+			return
 		}
-	}
 
-	plan, err := db.CreatePlan(auth.OrgId, projectId, auth.User.Id, name)
+		visibility = project.DefaultPlanVisibility
+	}
 
-	if err != nil {
-		log.Printf("Error creating plan: %v\n", err)
-		http.Error(w, "Error creating plan: "+err.Error(), http.StatusInternalServerError)
+	plan, projectHasPlans := createPlan(w, org, projectId, auth.User.Id, requestBody.Id, name, requestBody.CreateIfProjectEmpty, db.PlanCreation{
+		ActorId:     auth.User.Id,
+		ExternalKey: requestBody.ExternalKey,
+	})
+	if projectHasPlans {
+		writeProjectHasPlans(w, auth, projectId)
+		return
+	}
+	if plan == nil {
+		// an error response has already been written
 		return
 	}
 
+	if visibility == shared.PlanVisibilityOrg {
+		err = db.SharePlanWithOrg(plan.Id)
+
+		if err != nil {
+			log.Printf("Error sharing plan with org: %v\n", err)
+			http.Error(w, "Error sharing plan with org: "+err.Error(), http.StatusInternalServerError)
+			deleteCreatedPlan(plan)
+			return
+		}
+	}
+
+	if requestBody.Branch != "" {
+		err = db.SetPlanWorkingBranch(plan.Id, requestBody.Branch)
+
+		if err != nil {
+			log.Printf("Error setting plan working branch: %v\n", err)
+			http.Error(w, "Error setting plan working branch: "+err.Error(), http.StatusInternalServerError)
+			deleteCreatedPlan(plan)
+			return
+		}
+	}
+
 	resp := shared.CreatePlanResponse{
 		Id:   plan.Id,
 		Name: plan.Name,
 	}
 
+	setRenamedName(&resp.WasRenamed, &resp.RequestedName, plan.Name, name, requestBody.Name)
+
+	if orgDefaults != nil {
+		if !storeInitialSettings(w, auth, plan, db.ResolveNewPlanSettings(orgDefaults), "⚙️  Applied org default model settings") {
+			// an error response has already been written
+			deleteCreatedPlan(plan)
+			return
+		}
+	}
+
+	if len(requestBody.Contexts) > 0 {
+		loadRes, ok := loadInitialContexts(w, auth, plan, &requestBody.Contexts)
+
+		if !ok {
+			// an error response has already been written
+			deleteCreatedPlan(plan)
+			return
+		}
+
+		resp.LoadContextRes = loadRes
+	}
+
+	// the plan is kept if the prompt can't be started, so the response reports both
+	if requestBody.InitialPrompt != nil {
+		resp.InitialPrompt = startInitialPrompt(auth, plan, requestBody.InitialPrompt)
+	}
+
 	bytes, err := json.Marshal(resp)
 
 	if err != nil {
@@ -137,31 +306,160 @@ func CreatePlanHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if quotaUser != nil {
+		// the count was read before the plan was created, and drafts don't count towards it
+		used := quotaUser.NumNonDraftPlans
+		if plan.Name != "draft" {
+			used++
+		}
+		setPlanQuotaHeaders(w, quotaUser, used)
+	}
+
 	w.Write(bytes)
 
 	log.Printf("Successfully created plan: %v\n", plan)
 }
 
-func GetPlanHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for GetPlanHandler")
+// checkPlanQuota checks that a trial user on cloud can create another plan, writing the error
+// response and returning false if not. The user is only returned on cloud, where plan creation
+// is limited for trial users.
+func checkPlanQuota(w http.ResponseWriter, auth *types.ServerAuth) (*db.User, bool) {
+	if os.Getenv("IS_CLOUD") == "" {
+		return nil, true
+	}
 
-	auth := authenticate(w, r, true)
-	if auth == nil {
+	user, err := db.GetUser(auth.User.Id)
+
+	if err != nil {
+		log.Printf("Error getting user: %v\n", err)
+		http.Error(w, "Error getting user: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if user.IsTrial && user.NumNonDraftPlans >= types.TrialMaxPlans {
+		setPlanQuotaHeaders(w, user, user.NumNonDraftPlans)
+		writeApiError(w, shared.ApiError{
+			Type:   shared.ApiErrorTypeTrialPlansExceeded,
+			Status: http.StatusForbidden,
+			Msg:    "User has reached max number of anonymous trial plans",
+			TrialPlansExceededError: &shared.TrialPlansExceededError{
+				MaxPlans: types.TrialMaxPlans,
+			},
+		})
+		return nil, false
+	}
+
+	return user, true
+}
+
+// writeProjectHasPlans responds to a CreateIfProjectEmpty request for a project that already has
+// plans. It's a 200 so setup scripts can treat it like a successful create.
+func writeProjectHasPlans(w http.ResponseWriter, auth *types.ServerAuth, projectId string) {
+	resp := shared.CreatePlanResponse{ProjectHasPlans: true}
+
+	first, err := db.GetFirstPlanInProject(projectId)
+
+	if err != nil {
+		log.Printf("Error getting first plan in project: %v\n", err)
+		http.Error(w, "Error getting first plan in project: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if first != nil {
+		plan, err := db.ValidatePlanAccess(first.Id, auth.User.Id, auth.OrgId)
+
+		if err != nil {
+			log.Printf("Error validating plan access: %v\n", err)
+			http.Error(w, "Error validating plan access: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if plan != nil {
+			resp.Id = plan.Id
+			resp.Name = plan.Name
+		}
+	}
+
+	bytes, err := json.Marshal(resp)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	w.Write(bytes)
+
+	log.Printf("Project %s already has plans, skipped creating a plan\n", projectId)
+}
+
+// setPlanQuotaHeaders lets clients warn users before they hit the trial plan limit. The limit
+// header is omitted for users without one.
+func setPlanQuotaHeaders(w http.ResponseWriter, user *db.User, used int) {
+	w.Header().Set(shared.PlansUsedHeader, strconv.Itoa(used))
+
+	if user.IsTrial {
+		w.Header().Set(shared.PlansLimitHeader, strconv.Itoa(types.TrialMaxPlans))
+	}
+}
+
+func GetPlanHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for GetPlanHandler")
+
 	vars := mux.Vars(r)
 	planId := vars["planId"]
 
 	log.Println("planId: ", planId)
 
-	plan := authorizePlan(w, planId, auth)
+	branch := r.URL.Query().Get("branch")
+	if branch == "" {
+		branch = "main"
+	}
 
-	if plan == nil {
-		return
+	var plan *db.Plan
+	var apiPlan *shared.Plan
+
+	// share links grant read-only access to a single plan without an account in the org
+	shareToken := r.URL.Query().Get("shareToken")
+	if shareToken != "" {
+		var err error
+		plan, err = db.ValidatePlanShareToken(planId, shareToken)
+
+		if err != nil {
+			log.Printf("Error validating share token: %v\n", err)
+			http.Error(w, "Error validating share token: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if plan == nil {
+			log.Println("Invalid share token")
+			http.Error(w, "Invalid or expired share token", http.StatusUnauthorized)
+			return
+		}
+
+		apiPlan = plan.ToApi()
+	} else {
+		auth := authenticate(w, r, true)
+		if auth == nil {
+			return
+		}
+
+		plan = authorizePlanCached(w, planId, auth)
+
+		if plan == nil {
+			return
+		}
+
+		apiPlan = plan.ToApi()
+
+		settings, ok := getPlanSettingsForBranch(w, auth, plan, branch)
+		if !ok {
+			return
+		}
+		apiPlan.Settings = settings
 	}
 
-	bytes, err := json.Marshal(plan)
+	bytes, err := json.Marshal(apiPlan)
 
 	if err != nil {
 		log.Printf("Error marshalling plan: %v\n", err)
@@ -173,7 +471,7 @@ func GetPlanHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func DeletePlanHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for DeletePlanHandler")
+	logger.Debugln("Received request for DeletePlanHandler")
 
 	auth := authenticate(w, r, true)
 	if auth == nil {
@@ -185,52 +483,86 @@ func DeletePlanHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Println("planId: ", planId)
 
-	plan := authorizePlanDelete(w, planId, auth)
+	plan, err := authorizePlanDelete(planId, auth)
 
-	if plan == nil {
+	if errors.Is(err, errPlanNotFound) && writeAlreadyDeleted(w, auth, planId) {
 		return
 	}
 
-	if plan.OwnerId != auth.User.Id {
-		log.Println("Only the plan owner can delete a plan")
-		http.Error(w, "Only the plan owner can delete a plan", http.StatusForbidden)
+	if err != nil {
+		writePlanAuthErr(w, err)
 		return
 	}
 
-	res, err := db.Conn.Exec("DELETE FROM plans WHERE id = $1", planId)
+	// move the dir aside first so that if the row delete fails, the plan can be put back as it was
+	trashPath, err := db.TrashPlanDir(auth.OrgId, planId)
 
 	if err != nil {
-		log.Printf("Error deleting plan: %v\n", err)
-		http.Error(w, "Error deleting plan: "+err.Error(), http.StatusInternalServerError)
+		log.Printf("Error moving plan dir to trash: %v\n", err)
+		http.Error(w, "Error deleting plan dir: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	rowsAffected, err := res.RowsAffected()
-	if err != nil {
-		log.Printf("Error getting rows affected: %v\n", err)
-		http.Error(w, "Error getting rows affected: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
+	deleted, err := db.DeletePlanWithTombstone(auth.OrgId, planId, auth.User.Id)
+
+	if err != nil || !deleted {
+		if restoreErr := db.RestoreTrashedPlanDir(auth.OrgId, planId, trashPath); restoreErr != nil {
+			log.Printf("Error restoring plan dir for plan %s from %s; move it back manually: %v\n", planId, trashPath, restoreErr)
+		}
+
+		if err != nil {
+			log.Printf("Error deleting plan: %v\n", err)
+			http.Error(w, "Error deleting plan: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// a concurrent request deleted it first
+		if writeAlreadyDeleted(w, auth, planId) {
+			return
+		}
 
-	if rowsAffected == 0 {
 		log.Println("Plan not found")
 		http.Error(w, "Not found", http.StatusNotFound)
 		return
 	}
 
-	err = db.DeletePlanDir(auth.OrgId, planId)
+	db.PublishPlanDeleted(plan)
+
+	// the plan is gone at this point, so a failure here only leaves a dir in the trash and shouldn't fail the request
+	err = db.PurgeTrashedPlanDir(trashPath)
 
 	if err != nil {
-		log.Printf("Error deleting plan dir: %v\n", err)
-		http.Error(w, "Error deleting plan dir: "+err.Error(), http.StatusInternalServerError)
-		return
+		log.Printf("Error purging trashed dir for deleted plan %s at %s; remove it manually: %v\n", planId, trashPath, err)
 	}
 
 	log.Println("Successfully deleted plan", planId)
 }
 
+// writeAlreadyDeleted responds with success if the user deleted the plan within the retry
+// window, so repeating a delete is safe. Returns false, without writing anything, if the plan
+// should be reported missing.
+func writeAlreadyDeleted(w http.ResponseWriter, auth *types.ServerAuth, planId string) bool {
+	if _, err := uuid.Parse(planId); err != nil {
+		return false
+	}
+
+	deleted, err := db.WasPlanRecentlyDeleted(auth.OrgId, planId, auth.User.Id)
+
+	if err != nil {
+		// reporting the plan missing is still accurate, so don't fail the request over this
+		log.Printf("Error checking if plan was recently deleted: %v\n", err)
+		return false
+	}
+
+	if deleted {
+		log.Println("Plan already deleted", planId)
+	}
+
+	return deleted
+}
+
 func DeleteAllPlansHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for DeleteAllPlansHandler")
+	logger.Debugln("Received request for DeleteAllPlansHandler")
 
 	auth := authenticate(w, r, true)
 	if auth == nil {
@@ -246,7 +578,12 @@ func DeleteAllPlansHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := db.DeleteOwnerPlans(auth.OrgId, projectId, auth.User.Id)
+	if r.URL.Query().Get("dryRun") == "true" {
+		deleteAllPlansDryRun(w, auth, projectId)
+		return
+	}
+
+	deletedIds, err := db.DeleteOwnerPlans(auth.OrgId, projectId, auth.User.Id)
 
 	if err != nil {
 		log.Printf("Error deleting plans: %v\n", err)
@@ -254,34 +591,32 @@ func DeleteAllPlansHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Println("Successfully deleted all plans")
-}
-
-func ListPlansHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for ListPlans")
-
-	auth := authenticate(w, r, true)
-	if auth == nil {
-		return
+	resp := shared.DeleteAllPlansResponse{
+		DeletedCount: len(deletedIds),
+		DeletedIds:   deletedIds,
 	}
 
-	projectIds := r.URL.Query()["projectId"]
+	if resp.DeletedIds == nil {
+		resp.DeletedIds = []string{}
+	}
 
-	log.Println("projectIds: ", projectIds)
+	bytes, err := json.Marshal(resp)
 
-	if len(projectIds) == 0 {
-		log.Println("No project ids provided")
-		http.Error(w, "No project ids provided", http.StatusBadRequest)
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	for _, projectId := range projectIds {
-		if !authorizeProject(w, projectId, auth) {
-			return
-		}
-	}
+	w.Write(bytes)
+
+	log.Printf("Successfully deleted %d plans\n", len(deletedIds))
+}
 
-	plans, err := db.ListOwnedPlans(projectIds, auth.User.Id, false)
+// deleteAllPlansDryRun responds with what DeleteAllPlansHandler would delete without touching
+// any rows or dirs
+func deleteAllPlansDryRun(w http.ResponseWriter, auth *types.ServerAuth, projectId string) {
+	plans, err := db.ListOwnerPlansToDelete(projectId, auth.User.Id)
 
 	if err != nil {
 		log.Printf("Error listing plans: %v\n", err)
@@ -289,24 +624,47 @@ func ListPlansHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var apiPlans []*shared.Plan
-	for _, plan := range plans {
-		apiPlans = append(apiPlans, plan.ToApi())
+	resp := shared.DeleteAllPlansResponse{
+		DeletedCount: len(plans),
+		DeletedIds:   []string{},
+		DryRun:       true,
+		Plans:        []*shared.DeletePlanSummary{},
 	}
 
-	bytes, err := json.Marshal(apiPlans)
+	for _, plan := range plans {
+		size, err := db.PlanDirSize(auth.OrgId, plan.Id)
 
-	if err != nil {
-		log.Printf("Error marshalling plans: %v\n", err)
-		http.Error(w, "Error marshalling plans: "+err.Error(), http.StatusInternalServerError)
-		return
+		if err != nil {
+			log.Printf("Error getting plan dir size: %v\n", err)
+			http.Error(w, "Error getting plan dir size: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		resp.DeletedIds = append(resp.DeletedIds, plan.Id)
+		resp.Plans = append(resp.Plans, &shared.DeletePlanSummary{
+			Id:    plan.Id,
+			Name:  plan.Name,
+			Bytes: size,
+		})
+		resp.TotalBytes += size
 	}
 
-	w.Write(bytes)
+	bytes, err := json.Marshal(resp)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Printf("Dry run: would delete %d plans, %d bytes\n", len(plans), resp.TotalBytes)
 }
 
-func ListArchivedPlansHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for ListArchivedPlansHandler")
+func ListPlansHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for ListPlans")
+
 	auth := authenticate(w, r, true)
 	if auth == nil {
 		return
@@ -328,7 +686,45 @@ func ListArchivedPlansHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	plans, err := db.ListOwnedPlans(projectIds, "", true)
+	params, ok := parsePlanListParams(w, r, auth)
+	if !ok {
+		return
+	}
+
+	fields, err := parsePlanFields(r.URL.Query().Get("fields"))
+
+	if err != nil {
+		log.Printf("Invalid fields: %v\n", err)
+		http.Error(w, "Invalid fields: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	includes, err := parsePlanIncludes(r.URL.Query().Get("include"))
+
+	if err != nil {
+		log.Printf("Invalid include: %v\n", err)
+		http.Error(w, "Invalid include: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var plans []*db.Plan
+	if params.q != "" {
+		ownerId := auth.User.Id
+		if params.includesOthers() {
+			ownerId = ""
+		}
+		plans, err = db.SearchPlans(projectIds, ownerId, params.q, false, params.sort)
+
+		if err == nil && len(params.owners) > 0 {
+			plans = filterPlansByOwner(plans, params.owners)
+		}
+	} else if len(params.owners) > 0 {
+		plans, err = db.ListPlansForOwners(projectIds, params.owners, false, params.sort)
+	} else if params.allUsers {
+		plans, err = db.ListAllPlans(projectIds, false, params.sort)
+	} else {
+		plans, err = db.ListOwnedPlans(projectIds, auth.User.Id, false, params.sort)
+	}
 
 	if err != nil {
 		log.Printf("Error listing plans: %v\n", err)
@@ -336,10 +732,425 @@ func ListArchivedPlansHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var apiPlans []*shared.Plan
+	// unseen is per user, so it's applied after listing rather than in each list query
+	if params.unseen && len(plans) > 0 {
+		planIds := make([]string, len(plans))
+		for i, plan := range plans {
+			planIds[i] = plan.Id
+		}
+
+		seenAt, err := db.GetPlansSeenAt(auth.User.Id, planIds)
+
+		if err != nil {
+			log.Printf("Error getting plan seen state: %v\n", err)
+			http.Error(w, "Error getting plan seen state: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		plans = db.FilterUnseenPlans(plans, seenAt)
+	}
+
+	apiPlans := plansToApi(plans)
+
+	// tags come with each plan's row, so including them costs payload size rather than queries.
+	// Asking for the tags field counts as including them.
+	if !includes["tags"] && !fields["tags"] {
+		for _, apiPlan := range apiPlans {
+			apiPlan.Tags = nil
+		}
+	}
+
+	// owners need an extra query, so skip it if they weren't asked for
+	if params.includesOthers() && len(plans) > 0 && (fields == nil || fields["owner"]) {
+		err = addPlanOwners(apiPlans)
+
+		if err != nil {
+			log.Printf("Error getting plan owners: %v\n", err)
+			http.Error(w, "Error getting plan owners: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// like tags, asking for the field counts as including it
+	includeStatus := includes["status"] || fields["status"]
+	includeBranch := includes["branch"] || fields["branch"]
+
+	// one query for all the plans' branches and one read of the active plans cover the whole list
+	if (includeStatus || includeBranch) && len(plans) > 0 {
+		planIds := make([]string, len(plans))
+		for i, plan := range plans {
+			planIds[i] = plan.Id
+		}
+
+		branches, err := db.ListBranchesForPlans(auth.OrgId, planIds)
+
+		if err != nil {
+			log.Printf("Error getting branches: %v\n", err)
+			http.Error(w, "Error getting branches: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		setPlanRunStates(apiPlans, branches, modelPlan.GetActiveBranchesSnapshot(), includeStatus, includeBranch)
+	}
+
+	addPlanLoadErrors(plans, apiPlans)
+
+	bytes, err := marshalPlanFields(apiPlans, fields)
+
+	if err != nil {
+		log.Printf("Error marshalling plans: %v\n", err)
+		http.Error(w, "Error marshalling plans: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+}
+
+// planListParams are the ListPlansHandler query params that pick which plans are listed
+type planListParams struct {
+	allUsers bool
+	owners   []string
+	q        string
+	sort     db.PlanSort
+	unseen   bool
+}
+
+// includesOthers is whether plans owned by other users can be listed
+func (params *planListParams) includesOthers() bool {
+	return params.allUsers || len(params.owners) > 0
+}
+
+// filter is the db filter for the params, leaving out unseen, which is per user
+func (params *planListParams) filter(projectIds []string, userId string) db.PlanListFilter {
+	filter := db.PlanListFilter{
+		ProjectIds: projectIds,
+		Q:          params.q,
+		Sort:       params.sort,
+	}
+
+	if len(params.owners) > 0 {
+		filter.OwnerIds = params.owners
+	} else if !params.allUsers {
+		filter.OwnerIds = []string{userId}
+	}
+
+	return filter
+}
+
+// parsePlanListParams parses and authorizes the list params. On failure it writes the error
+// response and returns false.
+func parsePlanListParams(w http.ResponseWriter, r *http.Request, auth *types.ServerAuth) (*planListParams, bool) {
+	query := r.URL.Query()
+
+	params := &planListParams{
+		allUsers: query.Get("allUsers") == "true",
+		q:        strings.TrimSpace(query.Get("q")),
+		unseen:   query.Get("unseen") == "true",
+	}
+
+	if params.allUsers && !auth.HasPermission(types.PermissionListAnyPlan) {
+		log.Println("User does not have permission to list all users' plans")
+		http.Error(w, "User does not have permission to list all users' plans", http.StatusForbidden)
+		return nil, false
+	}
+
+	owners, err := parsePlanOwners(query.Get("owners"))
+
+	if err != nil {
+		log.Printf("Invalid owners: %v\n", err)
+		http.Error(w, "Invalid owners: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	if len(owners) > 0 {
+		if !auth.HasPermission(types.PermissionListAnyPlan) {
+			log.Println("User does not have permission to list other users' plans")
+			http.Error(w, "User does not have permission to list other users' plans", http.StatusForbidden)
+			return nil, false
+		}
+
+		nonMembers, err := db.GetNonOrgUserIds(auth.OrgId, owners)
+
+		if err != nil {
+			log.Printf("Error validating owners: %v\n", err)
+			http.Error(w, "Error validating owners: "+err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
+
+		if len(nonMembers) > 0 {
+			log.Printf("Owners not in org: %v\n", nonMembers)
+			http.Error(w, "Owners aren't members of the org: "+strings.Join(nonMembers, ", "), http.StatusBadRequest)
+			return nil, false
+		}
+
+		params.owners = owners
+	}
+
+	planSort, ok := parsePlanSort(w, query.Get("sort"))
+	if !ok {
+		return nil, false
+	}
+	params.sort = planSort
+
+	return params, true
+}
+
+// filterPlansByOwner keeps plans owned by one of ownerIds, in order
+func filterPlansByOwner(plans []*db.Plan, ownerIds []string) []*db.Plan {
+	isOwner := map[string]bool{}
+	for _, id := range ownerIds {
+		isOwner[id] = true
+	}
+
+	var res []*db.Plan
+	for _, plan := range plans {
+		if isOwner[plan.OwnerId] {
+			res = append(res, plan)
+		}
+	}
+	return res
+}
+
+// plansToApi never returns nil, so an empty list marshals as [] rather than null
+func plansToApi(plans []*db.Plan) []*shared.Plan {
+	apiPlans := make([]*shared.Plan, 0, len(plans))
 	for _, plan := range plans {
 		apiPlans = append(apiPlans, plan.ToApi())
 	}
+	return apiPlans
+}
+
+// addPlanLoadErrors sets the error of each listed plan whose dir can't be used, so one broken
+// plan shows up in the list instead of failing it. apiPlans must be plansToApi(plans).
+func addPlanLoadErrors(plans []*db.Plan, apiPlans []*shared.Plan) {
+	for i, plan := range plans {
+		err := db.CheckPlanDir(plan.OrgId, plan.Id)
+		if err != nil {
+			log.Printf("Plan %s can't be loaded: %v\n", plan.Id, err)
+			apiPlans[i].Error = err.Error()
+		}
+	}
+}
+
+// marshalPlanFields marshals only the given json fields of each plan, or every field if fields
+// is nil. The error field is always kept. A plan that fails to marshal is replaced by its id,
+// name, and the error rather than failing the whole list.
+func marshalPlanFields(plans []*shared.Plan, fields map[string]bool) ([]byte, error) {
+	res := make([]json.RawMessage, 0, len(plans))
+
+	for _, plan := range plans {
+		bytes, err := marshalPlan(plan, fields)
+
+		if err != nil {
+			log.Printf("Error marshalling plan %s: %v\n", plan.Id, err)
+
+			bytes, err = json.Marshal(map[string]string{
+				"id":    plan.Id,
+				"name":  plan.Name,
+				"error": "error serializing plan: " + err.Error(),
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		res = append(res, bytes)
+	}
+
+	return json.Marshal(res)
+}
+
+func marshalPlan(plan *shared.Plan, fields map[string]bool) ([]byte, error) {
+	bytes, err := json.Marshal(plan)
+	if err != nil || fields == nil {
+		return bytes, err
+	}
+
+	var all map[string]json.RawMessage
+	err = json.Unmarshal(bytes, &all)
+	if err != nil {
+		return nil, err
+	}
+
+	projected := map[string]json.RawMessage{}
+	for field := range fields {
+		if val, ok := all[field]; ok {
+			projected[field] = val
+		}
+	}
+	if val, ok := all["error"]; ok {
+		projected["error"] = val
+	}
+
+	return json.Marshal(projected)
+}
+
+// NormalizeDraftsHandler archives duplicate drafts across the org so that each user has at most
+// one unarchived draft per project
+func NormalizeDraftsHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for NormalizeDraftsHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	if !auth.HasPermission(types.PermissionArchiveAnyPlan) {
+		log.Println("User does not have permission to archive other users' plans")
+		http.Error(w, "User does not have permission to archive other users' plans", http.StatusForbidden)
+		return
+	}
+
+	archived, err := db.NormalizeDrafts(auth.OrgId)
+
+	if err != nil {
+		log.Printf("Error normalizing drafts: %v\n", err)
+		http.Error(w, "Error normalizing drafts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res := shared.NormalizeDraftsResponse{
+		ArchivedPlanIds: []string{},
+	}
+	for _, plan := range archived {
+		res.ArchivedPlanIds = append(res.ArchivedPlanIds, plan.Id)
+	}
+
+	bytes, err := json.Marshal(res)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Printf("Successfully normalized drafts, archived %d plans\n", len(archived))
+}
+
+// ListUserPlansHandler lists another user's plans across all of the org's projects, e.g. to
+// clean up or hand off a departing member's work. It doesn't require the user to still be a
+// member of the org.
+func ListUserPlansHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for ListUserPlansHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	orgId := vars["orgId"]
+	userId := vars["userId"]
+
+	log.Println("orgId: ", orgId)
+	log.Println("userId: ", userId)
+
+	if orgId != auth.OrgId {
+		log.Println("Org id doesn't match the authenticated org")
+		http.Error(w, "Can only list plans in the current org", http.StatusForbidden)
+		return
+	}
+
+	if !auth.HasPermission(types.PermissionListAnyPlan) {
+		log.Println("User does not have permission to list other users' plans")
+		http.Error(w, "User does not have permission to list other users' plans", http.StatusForbidden)
+		return
+	}
+
+	planSort, ok := parsePlanSort(w, r.URL.Query().Get("sort"))
+	if !ok {
+		return
+	}
+
+	archived := r.URL.Query().Get("archived") == "true"
+
+	projects, err := db.ListOrgProjects(auth.OrgId)
+
+	if err != nil {
+		log.Printf("Error listing projects: %v\n", err)
+		http.Error(w, "Error listing projects: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := shared.ListUserPlansResponse{
+		Plans:        []*shared.Plan{},
+		ProjectsById: map[string]*shared.Project{},
+	}
+
+	if len(projects) > 0 {
+		var projectIds []string
+		for _, project := range projects {
+			projectIds = append(projectIds, project.Id)
+		}
+
+		plans, err := db.ListOwnedPlans(projectIds, userId, archived, planSort)
+
+		if err != nil {
+			log.Printf("Error listing plans: %v\n", err)
+			http.Error(w, "Error listing plans: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		withPlans := map[string]bool{}
+		for _, plan := range plans {
+			resp.Plans = append(resp.Plans, plan.ToApi())
+			withPlans[plan.ProjectId] = true
+		}
+
+		for _, project := range projects {
+			if withPlans[project.Id] {
+				resp.ProjectsById[project.Id] = project.ToApi()
+			}
+		}
+	}
+
+	bytes, err := json.Marshal(resp)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Printf("Successfully listed %d plans for user %s\n", len(resp.Plans), userId)
+}
+
+func ListArchivedPlansHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for ListArchivedPlansHandler")
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	projectIds := r.URL.Query()["projectId"]
+
+	log.Println("projectIds: ", projectIds)
+
+	if len(projectIds) == 0 {
+		log.Println("No project ids provided")
+		http.Error(w, "No project ids provided", http.StatusBadRequest)
+		return
+	}
+
+	for _, projectId := range projectIds {
+		if !authorizeProject(w, projectId, auth) {
+			return
+		}
+	}
+
+	plans, err := db.ListOwnedPlans(projectIds, "", true, db.PlanSort{})
+
+	if err != nil {
+		log.Printf("Error listing plans: %v\n", err)
+		http.Error(w, "Error listing plans: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apiPlans := plansToApi(plans)
 
 	jsonBytes, err := json.Marshal(apiPlans)
 	if err != nil {
@@ -354,7 +1165,7 @@ func ListArchivedPlansHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func ListPlansRunningHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for ListPlansRunningHandler")
+	logger.Debugln("Received request for ListPlansRunningHandler")
 	auth := authenticate(w, r, true)
 	if auth == nil {
 		return
@@ -377,7 +1188,7 @@ func ListPlansRunningHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	plans, err := db.ListOwnedPlans(projectIds, auth.User.Id, false)
+	plans, err := db.ListOwnedPlans(projectIds, auth.User.Id, false, db.PlanSort{})
 
 	if err != nil {
 		log.Printf("Error listing plans: %v\n", err)
@@ -512,7 +1323,7 @@ func ListPlansRunningHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetCurrentBranchByPlanIdHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for CurrentBranchByPlanIdHandler")
+	logger.Debugln("Received request for CurrentBranchByPlanIdHandler")
 	auth := authenticate(w, r, true)
 	if auth == nil {
 		return
@@ -534,7 +1345,7 @@ func GetCurrentBranchByPlanIdHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	plans, err := db.ListOwnedPlans([]string{projectId}, auth.User.Id, false)
+	plans, err := db.ListOwnedPlans([]string{projectId}, auth.User.Id, false, db.PlanSort{})
 
 	if err != nil {
 		log.Printf("Error listing plans: %v\n", err)
@@ -594,3 +1405,606 @@ func GetCurrentBranchByPlanIdHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.Write(bytes)
 }
+
+func UpdatePlanHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for UpdatePlanHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+
+	log.Println("planId: ", planId)
+
+	plan := authorizePlanUpdate(w, planId, auth)
+
+	if plan == nil {
+		return
+	}
+
+	var req shared.UpdatePlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Error parsing request body: %v\n", err)
+		http.Error(w, "Error parsing request body", http.StatusBadRequest)
+		return
+	}
+
+	updates := map[string]interface{}{}
+
+	if req.Name != nil && *req.Name != plan.Name {
+		if plan.OwnerId != auth.User.Id && !auth.HasPermission(types.PermissionRenameAnyPlan) {
+			log.Println("User does not have permission to rename plan")
+			http.Error(w, "User does not have permission to rename plan", http.StatusForbidden)
+			return
+		}
+
+		if err := validatePlanName(*req.Name); err != nil {
+			log.Printf("Invalid plan name: %v\n", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		org, err := db.GetOrg(auth.OrgId)
+
+		if err != nil {
+			log.Printf("Error getting org: %v\n", err)
+			http.Error(w, "Error getting org: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		name, err := db.ApplyPlanNamePrefix(org, *req.Name, false)
+
+		if err == db.ErrPlanNamePrefixRequired {
+			writePlanNamePrefixErr(w, org, *req.Name)
+			return
+		}
+
+		exists, err := db.PlanNameExists(plan.NameScope(), name, plan.Id)
+
+		if err != nil {
+			log.Printf("Error checking plan name: %v\n", err)
+			http.Error(w, "Error checking plan name: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if exists {
+			log.Println("Plan name already exists")
+			http.Error(w, "A plan with this name already exists", http.StatusConflict)
+			return
+		}
+
+		updates["name"] = name
+	}
+
+	if req.Description != nil {
+		if err := validatePlanDescription(*req.Description); err != nil {
+			log.Printf("Invalid plan description: %v\n", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		updates["description"] = *req.Description
+	}
+
+	if req.Tags != nil {
+		tags, err := normalizePlanTags(*req.Tags)
+		if err != nil {
+			log.Printf("Invalid plan tags: %v\n", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		updates["tags"] = pq.StringArray(tags)
+	}
+
+	if req.Pinned != nil {
+		updates["pinned"] = *req.Pinned
+	}
+
+	if req.Visibility != nil {
+		if plan.OwnerId != auth.User.Id && !auth.HasPermission(types.PermissionManageAnyPlanShares) {
+			log.Println("User does not have permission to change plan visibility")
+			http.Error(w, "User does not have permission to change plan visibility", http.StatusForbidden)
+			return
+		}
+
+		switch *req.Visibility {
+		case shared.PlanVisibilityPrivate:
+			updates["shared_with_org_at"] = nil
+		case shared.PlanVisibilityOrg:
+			if plan.SharedWithOrgAt == nil {
+				updates["shared_with_org_at"] = time.Now()
+			}
+		default:
+			log.Printf("Invalid visibility: %s\n", *req.Visibility)
+			http.Error(w, "Invalid visibility: "+string(*req.Visibility), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if req.Notifications != nil {
+		notifications := *req.Notifications
+
+		if notifications.Channel == "" {
+			notifications.Channel = shared.PlanNotifyChannelEmail
+		}
+
+		if err := validatePlanNotifications(&notifications); err != nil {
+			log.Printf("Invalid plan notifications: %v\n", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		updates["notify_on_complete"] = notifications.OnComplete
+		updates["notify_on_error"] = notifications.OnError
+		updates["notify_channel"] = notifications.Channel
+
+		if notifications.WebhookUrl == "" {
+			updates["notify_webhook_url"] = nil
+		} else {
+			updates["notify_webhook_url"] = notifications.WebhookUrl
+		}
+	}
+
+	tx, err := db.Conn.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v\n", err)
+		http.Error(w, "Error starting transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure that rollback is attempted in case of failure
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Printf("transaction rollback error: %v\n", rbErr)
+			} else {
+				log.Println("transaction rolled back")
+			}
+		}
+	}()
+
+	updatedAt, err := db.LockPlanForUpdate(planId, tx)
+
+	if err != nil {
+		log.Printf("Error locking plan: %v\n", err)
+		http.Error(w, "Error locking plan: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if req.IfUpdatedAt != nil && !req.IfUpdatedAt.Truncate(time.Microsecond).Equal(updatedAt.Truncate(time.Microsecond)) {
+		log.Println("Plan was updated since ifUpdatedAt")
+		err = fmt.Errorf("plan was modified")
+		http.Error(w, "Plan was updated by another request. Reload it and try again.", http.StatusConflict)
+		return
+	}
+
+	err = db.UpdatePlan(planId, updates, tx)
+
+	if err != nil {
+		log.Printf("Error updating plan: %v\n", err)
+		http.Error(w, "Error updating plan: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing transaction: %v\n", err)
+		http.Error(w, "Error committing transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	db.InvalidatePlanCache(planId)
+
+	updated, err := db.GetPlan(planId)
+
+	if err != nil {
+		log.Printf("Error getting updated plan: %v\n", err)
+		http.Error(w, "Error getting updated plan: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, ok := updates["name"]; ok {
+		db.PublishPlanRenamed(updated)
+	}
+
+	apiPlan := updated.ToApi()
+
+	// the user just configured the webhook, so this is where they get the key to verify it with
+	if apiPlan.Notifications != nil && apiPlan.Notifications.Channel == shared.PlanNotifyChannelWebhook {
+		secret, err := db.GetOrCreatePlanWebhookSecret(planId)
+
+		if err != nil {
+			log.Printf("Error getting webhook secret: %v\n", err)
+			http.Error(w, "Error getting webhook secret: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		apiPlan.Notifications.WebhookSecret = secret
+	}
+
+	bytes, err := json.Marshal(apiPlan)
+
+	if err != nil {
+		log.Printf("Error marshalling plan: %v\n", err)
+		http.Error(w, "Error marshalling plan: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Println("Successfully updated plan", planId)
+}
+
+func writePlanNamePrefixErr(w http.ResponseWriter, org *db.Org, name string) {
+	log.Printf("Plan name '%s' is missing required prefix '%s'\n", name, *org.RequiredNamePrefix)
+
+	writeApiError(w, shared.ApiError{
+		Type:   shared.ApiErrorTypePlanNamePrefixRequired,
+		Status: http.StatusBadRequest,
+		Msg:    fmt.Sprintf("Plan names in this org must start with '%s'", *org.RequiredNamePrefix),
+		PlanNamePrefixRequiredError: &shared.PlanNamePrefixRequiredError{
+			Name:   name,
+			Prefix: *org.RequiredNamePrefix,
+		},
+	})
+}
+
+// parsePlanSort reads the sort param: "updated" (the default), "name", or "name:<collation>"
+// to sort names with a specific database collation, e.g. "name:de_DE" or "name:und-x-icu"
+func parsePlanSort(w http.ResponseWriter, param string) (db.PlanSort, bool) {
+	field, collation, _ := strings.Cut(param, ":")
+
+	if field != "name" && collation != "" {
+		log.Println("Collation given for non-name sort")
+		http.Error(w, "A collation can only be used with sort=name", http.StatusBadRequest)
+		return db.PlanSort{}, false
+	}
+
+	switch field {
+	case "", "updated":
+		return db.PlanSort{}, true
+	case "context_files":
+		return db.PlanSort{ByContextFiles: true}, true
+	case "context_bytes":
+		return db.PlanSort{ByContextBytes: true}, true
+	case "name":
+		resolved, err := db.ResolvePlanNameCollation(collation)
+
+		if err == db.ErrUnknownCollation {
+			log.Printf("Unknown collation: %s\n", collation)
+			http.Error(w, fmt.Sprintf("Collation '%s' is not available", collation), http.StatusBadRequest)
+			return db.PlanSort{}, false
+		}
+
+		if err != nil {
+			log.Printf("Error resolving collation: %v\n", err)
+			http.Error(w, "Error resolving collation: "+err.Error(), http.StatusInternalServerError)
+			return db.PlanSort{}, false
+		}
+
+		return db.PlanSort{ByName: true, Collation: resolved}, true
+	default:
+		log.Printf("Invalid sort: %s\n", param)
+		http.Error(w, "sort must be 'updated', 'name', 'context_files', or 'context_bytes'", http.StatusBadRequest)
+		return db.PlanSort{}, false
+	}
+}
+
+func addPlanOwners(plans []*shared.Plan) error {
+	ownerIdsSet := map[string]bool{}
+	var ownerIds []string
+	for _, plan := range plans {
+		if !ownerIdsSet[plan.OwnerId] {
+			ownerIdsSet[plan.OwnerId] = true
+			ownerIds = append(ownerIds, plan.OwnerId)
+		}
+	}
+
+	users, err := db.GetUsersForIds(ownerIds)
+
+	if err != nil {
+		return err
+	}
+
+	usersById := map[string]*shared.User{}
+	for _, user := range users {
+		usersById[user.Id] = user.ToApi()
+	}
+
+	for _, plan := range plans {
+		plan.Owner = usersById[plan.OwnerId]
+	}
+
+	return nil
+}
+
+// loadInitialContexts loads the contexts sent with CreatePlanRequest into the new plan's main branch.
+// On failure it writes the error response and returns false.
+func loadInitialContexts(w http.ResponseWriter, auth *types.ServerAuth, plan *db.Plan, loadReq *shared.LoadContextRequest) (*shared.LoadContextResponse, bool) {
+	var err error
+
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepoBranch(w, auth, plan.Id, "main", db.LockScopeWrite, ctx, cancel)
+	if unlockFn == nil {
+		return nil, false
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	res, _, err := db.LoadContexts(db.LoadContextsParams{
+		OrgId:                    auth.OrgId,
+		Plan:                     plan,
+		BranchName:               "main",
+		Req:                      loadReq,
+		UserId:                   auth.User.Id,
+		SkipConflictInvalidation: true,
+	})
+
+	if err != nil {
+		log.Printf("Error loading contexts: %v\n", err)
+		http.Error(w, "Error loading contexts: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if res.MaxTokensExceeded {
+		log.Printf("The total number of tokens (%d) exceeds the maximum allowed (%d)", res.TotalTokens, res.MaxTokens)
+		err = fmt.Errorf("max tokens exceeded")
+		http.Error(w, fmt.Sprintf("Contexts total %d tokens, which exceeds the maximum of %d", res.TotalTokens, res.MaxTokens), http.StatusBadRequest)
+		return nil, false
+	}
+
+	err = db.GitAddAndCommit(auth.OrgId, plan.Id, "main", res.Msg)
+
+	if err != nil {
+		log.Printf("Error committing changes: %v\n", err)
+		http.Error(w, "Error committing changes: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return res, true
+}
+
+// createPlan resolves an available name and creates the plan in a single transaction, so a
+// failure at any step leaves no plan row, counter change, or plan dir behind. With ifProjectEmpty,
+// the project is checked for plans in the same transaction, and if it has any, nothing is
+// created or written and projectHasPlans is true. creation is passed along with the created event.
+func createPlan(w http.ResponseWriter, org *db.Org, projectId, ownerId, planId, name string, ifProjectEmpty bool, creation db.PlanCreation) (plan *db.Plan, projectHasPlans bool) {
+	tx, err := db.Conn.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v\n", err)
+		http.Error(w, "Error starting transaction: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	// Ensure that rollback is attempted in case of failure
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Printf("transaction rollback error: %v\n", rbErr)
+			} else {
+				log.Println("transaction rolled back")
+			}
+		}
+	}()
+
+	if ifProjectEmpty {
+		err = db.LockProjectPlanCreationTx(tx, projectId)
+
+		if err != nil {
+			log.Printf("Error locking project: %v\n", err)
+			http.Error(w, "Error locking project: "+err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
+
+		var count int
+		count, err = db.CountPlansInProject(projectId, tx)
+
+		if err != nil {
+			log.Printf("Error counting plans in project: %v\n", err)
+			http.Error(w, "Error counting plans in project: "+err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
+
+		if count > 0 {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Printf("transaction rollback error: %v\n", rbErr)
+			}
+			return nil, true
+		}
+	}
+
+	if name != "draft" {
+		scope := org.NameScope(projectId, ownerId)
+
+		var count int
+		count, err = db.CheckPlanNameCap(org, scope, name, tx)
+
+		if err == db.ErrPlanNameCapReached {
+			writeApiError(w, shared.ApiError{
+				Type:   shared.ApiErrorTypePlanNameCapReached,
+				Status: http.StatusConflict,
+				Msg:    fmt.Sprintf("There are already %d plans named '%s' or '%s.N' in this project, the most your org allows. Choose a different name.", count, name, name),
+				PlanNameCapReachedError: &shared.PlanNameCapReachedError{
+					Name:     name,
+					Count:    count,
+					MaxPlans: *org.MaxPlansPerName,
+				},
+			})
+			return nil, false
+		}
+
+		if err != nil {
+			log.Printf("Error checking plan name cap: %v\n", err)
+			http.Error(w, "Error checking plan name cap: "+err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
+	}
+
+	if name == "draft" {
+		plan, err = db.CreatePlanTx(tx, org.Id, projectId, ownerId, planId, name)
+	} else {
+		// picks the next available suffix if the name is taken, including by a concurrent create
+		plan, err = db.CreateNamedPlanTx(tx, org, projectId, ownerId, planId, name)
+	}
+
+	if err == db.ErrPlanNameExhausted {
+		maxSuffix := org.GetMaxPlanNameSuffix()
+		writeApiError(w, shared.ApiError{
+			Type:   shared.ApiErrorTypePlanNameExhausted,
+			Status: http.StatusConflict,
+			Msg:    fmt.Sprintf("Plan name '%s' and all suffixes up to .%d are taken. Choose a different name.", name, maxSuffix),
+			PlanNameExhaustedError: &shared.PlanNameExhaustedError{
+				Name:      name,
+				MaxSuffix: maxSuffix,
+			},
+		})
+		return nil, false
+	}
+
+	if err == db.ErrPlanNameTaken {
+		log.Printf("Plan name '%s' kept being taken concurrently\n", name)
+		http.Error(w, fmt.Sprintf("Plans named '%s' are being created concurrently, please try again", name), http.StatusConflict)
+		return nil, false
+	}
+
+	if err == db.ErrPlanIdExists {
+		log.Printf("Plan id %s already in use\n", planId)
+		http.Error(w, fmt.Sprintf("Plan id '%s' is already in use", planId), http.StatusConflict)
+		return nil, false
+	}
+
+	if err == db.ErrDraftExists {
+		// another request created a draft between deleting the old drafts and this insert
+		log.Println("Draft plan created concurrently")
+		http.Error(w, "A draft plan was just created in this project, please try again", http.StatusConflict)
+		return nil, false
+	}
+
+	if err != nil {
+		log.Printf("Error creating plan: %v\n", err)
+		http.Error(w, "Error creating plan: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if creation.ExternalKey != "" {
+		err = db.SetPlanExternalKeyTx(tx, plan, creation.ExternalKey)
+
+		if err == db.ErrExternalKeyExists {
+			// another request created a plan with the key since it was checked
+			log.Println("Plan with external key created concurrently")
+			http.Error(w, "A plan with this externalKey was just created in this project, please try again", http.StatusConflict)
+		} else if err != nil {
+			log.Printf("Error setting external key: %v\n", err)
+			http.Error(w, "Error setting external key: "+err.Error(), http.StatusInternalServerError)
+		}
+
+		if err != nil {
+			if rmErr := db.DeletePlanDir(org.Id, plan.Id); rmErr != nil {
+				log.Printf("Error removing plan dir: %v\n", rmErr)
+			}
+			return nil, false
+		}
+	}
+
+	err = db.CommitCreatedPlan(tx, plan, creation)
+
+	if err != nil {
+		log.Printf("Error creating plan: %v\n", err)
+		http.Error(w, "Error creating plan: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return plan, false
+}
+
+// setRenamedName flags a response whose plan was given a suffix because its name was taken.
+// createPlan only changes the name when it adds a suffix, so planName is compared against the
+// name it was passed, after any org prefix, while requested is the name reported back as asked for.
+func setRenamedName(wasRenamed *bool, requestedName *string, planName, name, requested string) {
+	if planName != name {
+		*wasRenamed = true
+		*requestedName = requested
+	}
+}
+
+// storeInitialSettings stamps settings onto a new plan, like the org's defaults so later changes
+// to them don't affect it. On failure it writes the error response and returns false.
+func storeInitialSettings(w http.ResponseWriter, auth *types.ServerAuth, plan *db.Plan, settings *shared.PlanSettings, commitMsg string) bool {
+	var err error
+
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepoBranch(w, auth, plan.Id, "main", db.LockScopeWrite, ctx, cancel)
+	if unlockFn == nil {
+		return false
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	err = db.StorePlanSettings(plan, settings)
+
+	if err != nil {
+		log.Printf("Error storing settings: %v\n", err)
+		http.Error(w, "Error storing settings: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+
+	err = db.GitAddAndCommit(auth.OrgId, plan.Id, "main", commitMsg)
+
+	if err != nil {
+		log.Printf("Error committing settings: %v\n", err)
+		http.Error(w, "Error committing settings: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+
+	return true
+}
+
+// deleteCreatedPlan undoes CreatePlan when a later step of plan creation fails
+func deleteCreatedPlan(plan *db.Plan) {
+	_, err := db.Conn.Exec("DELETE FROM plans WHERE id = $1", plan.Id)
+	if err != nil {
+		log.Printf("Error deleting plan %s after failed creation: %v\n", plan.Id, err)
+		return
+	}
+
+	db.InvalidatePlanCache(plan.Id)
+
+	err = db.DeletePlanDir(plan.OrgId, plan.Id)
+	if err != nil {
+		log.Printf("Error deleting plan dir %s after failed creation: %v\n", plan.Id, err)
+	}
+
+	db.PublishPlanDeleted(plan)
+}
+
+// getPlanSettingsForBranch reads the plan's resolved settings under a read lock. On failure it
+// writes the error response and returns false.
+func getPlanSettingsForBranch(w http.ResponseWriter, auth *types.ServerAuth, plan *db.Plan, branch string) (*shared.PlanSettings, bool) {
+	var err error
+
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepoBranch(w, auth, plan.Id, branch, db.LockScopeRead, ctx, cancel)
+	if unlockFn == nil {
+		return nil, false
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	settings, err := db.GetPlanSettings(plan, true)
+
+	if err != nil {
+		log.Printf("Error getting settings: %v\n", err)
+		http.Error(w, "Error getting settings: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return settings, true
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"plandex-server/db"
+	"plandex-server/logger"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// plans are read, looked up, and written this many at a time
+const plansCSVBatchSize = 200
+
+var plansCSVHeader = []string{"id", "name", "owner_name", "owner_email", "created_at", "updated_at", "status", "tags"}
+
+// ExportPlansCSVHandler streams a project's plans as CSV, one row per plan, with the same
+// filters as ListPlansHandler. Plans are read from a cursor and written in batches, so large
+// projects aren't buffered. Once the first row is written the status can't change, so a later
+// error cuts the file short.
+func ExportPlansCSVHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for ExportPlansCSVHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	projectId := vars["projectId"]
+
+	log.Println("projectId: ", projectId)
+
+	if !authorizeProject(w, projectId, auth) {
+		return
+	}
+
+	params, ok := parsePlanListParams(w, r, auth)
+	if !ok {
+		return
+	}
+
+	cw := csv.NewWriter(w)
+	usersById := map[string]*db.User{}
+	started := false
+	numRows := 0
+
+	start := func() {
+		if started {
+			return
+		}
+		started = true
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"plans-%s.csv\"", time.Now().UTC().Format("20060102-150405")))
+
+		cw.Write(plansCSVHeader)
+	}
+
+	err := db.StreamPlans(params.filter([]string{projectId}, auth.User.Id), plansCSVBatchSize, func(plans []*db.Plan) error {
+		planIds := make([]string, len(plans))
+		for i, plan := range plans {
+			planIds[i] = plan.Id
+		}
+
+		if params.unseen {
+			seenAt, err := db.GetPlansSeenAt(auth.User.Id, planIds)
+			if err != nil {
+				return fmt.Errorf("error getting plan seen state: %v", err)
+			}
+
+			plans = db.FilterUnseenPlans(plans, seenAt)
+		}
+
+		branches, err := db.ListBranchesForPlans(auth.OrgId, planIds)
+		if err != nil {
+			return fmt.Errorf("error getting branches: %v", err)
+		}
+
+		branchesByPlanId := map[string][]*db.Branch{}
+		for _, branch := range branches {
+			branchesByPlanId[branch.PlanId] = append(branchesByPlanId[branch.PlanId], branch)
+		}
+
+		var missingUserIds []string
+		for _, plan := range plans {
+			if _, ok := usersById[plan.OwnerId]; !ok {
+				usersById[plan.OwnerId] = nil
+				missingUserIds = append(missingUserIds, plan.OwnerId)
+			}
+		}
+
+		if len(missingUserIds) > 0 {
+			users, err := db.GetUsersForIds(missingUserIds)
+			if err != nil {
+				return fmt.Errorf("error getting plan owners: %v", err)
+			}
+
+			for _, user := range users {
+				usersById[user.Id] = user
+			}
+		}
+
+		start()
+
+		for _, plan := range plans {
+			var ownerName, ownerEmail string
+			if owner := usersById[plan.OwnerId]; owner != nil {
+				ownerName = owner.Name
+				ownerEmail = owner.Email
+			}
+
+			status := getPlanRunStatus(branchesByPlanId[plan.Id], isBranchActive)
+
+			cw.Write([]string{
+				plan.Id,
+				csvCell(plan.Name),
+				csvCell(ownerName),
+				csvCell(ownerEmail),
+				plan.CreatedAt.UTC().Format(time.RFC3339),
+				plan.UpdatedAt.UTC().Format(time.RFC3339),
+				string(status),
+				csvCell(strings.Join(plan.Tags, ", ")),
+			})
+			numRows++
+		}
+
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return fmt.Errorf("error writing csv: %v", err)
+		}
+
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		if !started {
+			log.Printf("Error exporting plans: %v\n", err)
+			http.Error(w, "Error exporting plans: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Error exporting plans, aborting export: %v\n", err)
+		return
+	}
+
+	start()
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.Printf("Error writing csv: %v\n", err)
+		return
+	}
+
+	log.Printf("Successfully exported %d plans as csv\n", numRows)
+}
+
+// csvCell keeps user text from being read as a formula when the file is opened in a spreadsheet.
+// The csv writer handles quoting.
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import "testing"
+
+func TestCsvCell(t *testing.T) {
+	tests := map[string]string{
+		"":            "",
+		"plan":        "plan",
+		"=SUM(A1:A2)": "'=SUM(A1:A2)",
+		"+1":          "'+1",
+		"-1":          "'-1",
+		"@me":         "'@me",
+		"a=b":         "a=b",
+	}
+
+	for in, want := range tests {
+		if got := csvCell(in); got != want {
+			t.Errorf("csvCell(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"plandex-server/db"
+	"plandex-server/logger"
+
+	"github.com/gorilla/mux"
+	"github.com/plandex/plandex/shared"
+)
+
+// DeletePlansByFilterHandler deletes the user's own plans in the project that match a filter.
+// Deletes must be confirmed with the token from a dry run of the same filter, and at most
+// db.MaxPlansDeletedByFilter plans are deleted per request.
+func DeletePlansByFilterHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for DeletePlansByFilterHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	projectId := vars["projectId"]
+
+	log.Println("projectId: ", projectId)
+
+	if !authorizeProject(w, projectId, auth) {
+		return
+	}
+
+	var req shared.DeletePlansByFilterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Error parsing request body: %v\n", err)
+		http.Error(w, "Error parsing request body", http.StatusBadRequest)
+		return
+	}
+
+	filter := db.PlanDeleteFilter{
+		Archived:   req.Archived,
+		OlderThan:  req.OlderThan,
+		NamePrefix: req.NamePrefix,
+	}
+
+	var resp shared.DeletePlansByFilterResponse
+	var plans []*db.Plan
+	var err error
+
+	if req.DryRun {
+		plans, resp.HasMore, err = db.ListOwnerPlansByFilter(projectId, auth.User.Id, filter)
+
+		if err != nil {
+			log.Printf("Error listing plans: %v\n", err)
+			http.Error(w, "Error listing plans: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		ids := make([]string, len(plans))
+		for i, plan := range plans {
+			ids[i] = plan.Id
+		}
+
+		resp.DryRun = true
+		resp.ConfirmationToken = db.PlanDeleteConfirmationToken(auth.User.Id, ids)
+	} else {
+		if req.ConfirmationToken == "" {
+			log.Println("Missing confirmation token")
+			http.Error(w, "A confirmationToken from a dry run is required", http.StatusBadRequest)
+			return
+		}
+
+		plans, resp.HasMore, err = db.DeleteOwnerPlansByFilter(auth.OrgId, projectId, auth.User.Id, filter, req.ConfirmationToken)
+
+		if err == db.ErrPlanDeleteTokenMismatch {
+			log.Println("Confirmation token mismatch")
+			http.Error(w, "The plans matching this filter changed since the dry run. Run it again to review them.", http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			log.Printf("Error deleting plans: %v\n", err)
+			http.Error(w, "Error deleting plans: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	resp.DeletedCount = len(plans)
+	resp.Plans = []*shared.DeletePlanSummary{}
+
+	for _, plan := range plans {
+		summary := &shared.DeletePlanSummary{Id: plan.Id, Name: plan.Name}
+
+		// dirs of deleted plans are already gone
+		if req.DryRun {
+			summary.Bytes, err = db.PlanDirSize(auth.OrgId, plan.Id)
+
+			if err != nil {
+				log.Printf("Error getting plan dir size: %v\n", err)
+				http.Error(w, "Error getting plan dir size: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			resp.TotalBytes += summary.Bytes
+		}
+
+		resp.Plans = append(resp.Plans, summary)
+	}
+
+	bytes, err := json.Marshal(resp)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	if req.DryRun {
+		log.Printf("Dry run: would delete %d plans by filter, %d bytes\n", len(plans), resp.TotalBytes)
+	} else {
+		log.Printf("Successfully deleted %d plans by filter\n", len(plans))
+	}
+}
@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"plandex-server/db"
+	"plandex-server/logger"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/plandex/plandex/shared"
+)
+
+// diffs past these sizes are cut off and marked as truncated
+const maxPlanFileDiffBytes = 256 * 1024
+const maxPlanDiffBytes = 4 * 1024 * 1024
+
+// GetPlanDiffHandler diffs the files with pending changes on a branch against the same files as
+// of a commit in the plan's history (a sha from the plan's log). It streams one
+// shared.PlanFileDiff per changed file as NDJSON, sorted by path.
+func GetPlanDiffHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for GetPlanDiffHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+
+	log.Println("planId: ", planId)
+
+	sha := r.URL.Query().Get("sha")
+	if sha == "" {
+		log.Println("Missing sha param")
+		http.Error(w, "sha is required", http.StatusBadRequest)
+		return
+	}
+
+	if authorizePlan(w, planId, auth) == nil {
+		return
+	}
+
+	var err error
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepo(w, r, auth, db.LockScopeRead, ctx, cancel, true)
+	if unlockFn == nil {
+		return
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	baseFiles, err := db.GetPlanFilesAtSha(auth.OrgId, planId, strings.ToLower(sha))
+
+	if err == db.ErrUnknownCommit {
+		log.Printf("Unknown commit: %s\n", sha)
+		http.Error(w, "Commit not found in plan history: "+sha, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		log.Printf("Error getting plan files at commit: %v\n", err)
+		http.Error(w, "Error getting plan files at commit: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	planState, err := db.GetCurrentPlanState(db.CurrentPlanStateParams{
+		OrgId:  auth.OrgId,
+		PlanId: planId,
+	})
+
+	if err != nil {
+		log.Printf("Error getting current plan state: %v\n", err)
+		http.Error(w, "Error getting current plan state: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	files := planState.CurrentPlanFiles.Files
+
+	var paths []string
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	remaining := maxPlanDiffBytes
+
+	for _, path := range paths {
+		res := shared.PlanFileDiff{Path: path}
+
+		var before *string
+		if content, ok := baseFiles[path]; ok {
+			before = &content
+		} else {
+			res.Added = true
+		}
+
+		after := unescapePlanFile(files[path])
+
+		if remaining <= 0 {
+			res.Truncated = true
+		} else {
+			diff, err := db.GitDiffFile(path, before, after)
+
+			// the status is already sent, so the client just sees a truncated response
+			if err != nil {
+				log.Printf("Error diffing %s: %v\n", path, err)
+				return
+			}
+
+			if diff == "" {
+				continue
+			}
+
+			limit := maxPlanFileDiffBytes
+			if remaining < limit {
+				limit = remaining
+			}
+			if len(diff) > limit {
+				// cut at a line boundary so the last line isn't partial
+				diff = diff[:limit]
+				if i := strings.LastIndex(diff, "\n"); i != -1 {
+					diff = diff[:i+1]
+				}
+				res.Truncated = true
+			}
+
+			res.Diff = diff
+			remaining -= len(diff)
+		}
+
+		err = encoder.Encode(res)
+
+		if err != nil {
+			log.Printf("Error writing diff: %v\n", err)
+			return
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	log.Println("Successfully processed request for GetPlanDiffHandler")
+}
+
+// GetPlanChangesHandler returns the files with pending changes on a branch, each with its content
+// as loaded into context and as the plan would leave it, without applying anything. With
+// format=json (the default) it's a shared.GetPlanChangesResponse written a file at a time; with
+// format=unified it's a unified diff of every file, with the summary counts in headers.
+func GetPlanChangesHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for GetPlanChangesHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+
+	log.Println("planId: ", planId)
+
+	branch := r.URL.Query().Get("branch")
+	if branch == "" {
+		branch = "main"
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+
+	if format != "json" && format != "unified" {
+		log.Printf("Invalid format param: %s\n", format)
+		http.Error(w, "format must be 'json' or 'unified'", http.StatusBadRequest)
+		return
+	}
+
+	if authorizePlan(w, planId, auth) == nil {
+		return
+	}
+
+	var err error
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepoBranch(w, auth, planId, branch, db.LockScopeRead, ctx, cancel)
+	if unlockFn == nil {
+		return
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	planState, err := db.GetCurrentPlanState(db.CurrentPlanStateParams{
+		OrgId:  auth.OrgId,
+		PlanId: planId,
+	})
+
+	if err != nil {
+		log.Printf("Error getting current plan state: %v\n", err)
+		http.Error(w, "Error getting current plan state: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	changes, summary := getPlanFileChanges(planState)
+
+	flusher, _ := w.(http.Flusher)
+
+	if format == "unified" {
+		w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+		w.Header().Set("X-Plandex-Files-Added", strconv.Itoa(summary.Added))
+		w.Header().Set("X-Plandex-Files-Modified", strconv.Itoa(summary.Modified))
+
+		for _, change := range changes {
+			diff, err := db.GitDiffFile(change.Path, change.Old, change.New)
+
+			// the status is already sent, so the client just sees a truncated response
+			if err != nil {
+				log.Printf("Error diffing %s: %v\n", change.Path, err)
+				return
+			}
+
+			_, err = w.Write([]byte(diff))
+			if err != nil {
+				log.Printf("Error writing diff: %v\n", err)
+				return
+			}
+
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+
+		log.Printf("Successfully processed request for GetPlanChangesHandler, %d files\n", len(changes))
+		return
+	}
+
+	summaryBytes, err := json.Marshal(summary)
+	if err != nil {
+		log.Printf("Error marshalling summary: %v\n", err)
+		http.Error(w, "Error marshalling summary: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// write the files an entry at a time so large changes don't need to be marshalled in one buffer
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"summary":`))
+	w.Write(summaryBytes)
+	w.Write([]byte(`,"files":[`))
+
+	for i, change := range changes {
+		bytes, err := json.Marshal(change)
+		if err != nil {
+			log.Printf("Error marshalling change for %s: %v\n", change.Path, err)
+			return
+		}
+
+		if i > 0 {
+			w.Write([]byte(","))
+		}
+
+		_, err = w.Write(bytes)
+		if err != nil {
+			log.Printf("Error writing change: %v\n", err)
+			return
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	w.Write([]byte("]}"))
+
+	log.Printf("Successfully processed request for GetPlanChangesHandler, %d files\n", len(changes))
+}
+
+// getPlanFileChanges compares each file with pending changes against its context, sorted by
+// path. Files the changes leave the same are left out.
+func getPlanFileChanges(planState *shared.CurrentPlanState) ([]*shared.PlanFileChange, shared.PlanChangesSummary) {
+	files := planState.CurrentPlanFiles.Files
+
+	var paths []string
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	changes := []*shared.PlanFileChange{}
+
+	for _, path := range paths {
+		change := &shared.PlanFileChange{
+			Path: path,
+			New:  unescapePlanFile(files[path]),
+		}
+
+		if context, ok := planState.ContextsByPath[path]; ok {
+			old := unescapePlanFile(context.Body)
+			if old == change.New {
+				continue
+			}
+			change.Old = &old
+			change.Status = shared.PlanFileChangeModified
+		} else {
+			change.Status = shared.PlanFileChangeAdded
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes, summarizePlanFileChanges(changes)
+}
+
+func summarizePlanFileChanges(changes []*shared.PlanFileChange) shared.PlanChangesSummary {
+	var summary shared.PlanChangesSummary
+	for _, change := range changes {
+		switch change.Status {
+		case shared.PlanFileChangeAdded:
+			summary.Added++
+		case shared.PlanFileChangeModified:
+			summary.Modified++
+		}
+	}
+	return summary
+}
+
+func unescapePlanFile(s string) string {
+	return strings.ReplaceAll(s, "\\`\\`\\`", "```")
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/plandex/plandex/shared"
+)
+
+func TestGetPlanFileChanges(t *testing.T) {
+	planState := &shared.CurrentPlanState{
+		CurrentPlanFiles: &shared.CurrentPlanFiles{
+			Files: map[string]string{
+				"b.go":    "package b\n\nfunc B() {}\n",
+				"a.go":    "package a\n",
+				"same.go": "package same\n",
+			},
+		},
+		ContextsByPath: map[string]*shared.Context{
+			"b.go":    {FilePath: "b.go", Body: "package b\n"},
+			"same.go": {FilePath: "same.go", Body: "package same\n"},
+		},
+	}
+
+	changes, summary := getPlanFileChanges(planState)
+
+	if summary.Added != 1 || summary.Modified != 1 {
+		t.Errorf("expected 1 added and 1 modified, got %+v", summary)
+	}
+
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %d", len(changes))
+	}
+
+	if changes[0].Path != "a.go" || changes[0].Status != shared.PlanFileChangeAdded || changes[0].Old != nil {
+		t.Errorf("unexpected added change: %+v", changes[0])
+	}
+
+	if changes[1].Path != "b.go" || changes[1].Status != shared.PlanFileChangeModified || changes[1].Old == nil || *changes[1].Old != "package b\n" {
+		t.Errorf("unexpected modified change: %+v", changes[1])
+	}
+}
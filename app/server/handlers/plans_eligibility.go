@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"plandex-server/db"
+	"plandex-server/logger"
+	"plandex-server/types"
+
+	"github.com/gorilla/mux"
+	"github.com/plandex/plandex/shared"
+)
+
+// GetCreatePlanEligibilityHandler runs CreatePlanHandler's permission and trial limit checks
+// without creating anything, so clients can disable plan creation up front instead of
+// handling a failed create
+func GetCreatePlanEligibilityHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for GetCreatePlanEligibilityHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	projectId := vars["projectId"]
+
+	log.Println("projectId: ", projectId)
+
+	if !authorizeProject(w, projectId, auth) {
+		return
+	}
+
+	// only set on cloud, where plan creation is limited for trial users
+	var quotaUser *db.User
+	if os.Getenv("IS_CLOUD") != "" {
+		user, err := db.GetUser(auth.User.Id)
+
+		if err != nil {
+			log.Printf("Error getting user: %v\n", err)
+			http.Error(w, "Error getting user: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		quotaUser = user
+	}
+
+	res := getCreatePlanEligibility(auth.HasPermission(types.PermissionCreatePlan), quotaUser)
+
+	bytes, err := json.Marshal(res)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Printf("Successfully got plan creation eligibility, allowed: %v\n", res.Allowed)
+}
+
+// getCreatePlanEligibility mirrors the gates in CreatePlanHandler. quotaUser is nil when plan
+// quotas don't apply.
+func getCreatePlanEligibility(canCreate bool, quotaUser *db.User) *shared.GetCreatePlanEligibilityResponse {
+	res := &shared.GetCreatePlanEligibilityResponse{Allowed: true}
+
+	if quotaUser != nil {
+		used := quotaUser.NumNonDraftPlans
+		res.PlansUsed = &used
+
+		if quotaUser.IsTrial {
+			limit := types.TrialMaxPlans
+			res.PlansLimit = &limit
+		}
+	}
+
+	if !canCreate {
+		res.Allowed = false
+		res.Reason = "User does not have permission to create a plan"
+	} else if quotaUser != nil && quotaUser.IsTrial && quotaUser.NumNonDraftPlans >= types.TrialMaxPlans {
+		res.Allowed = false
+		res.Reason = "User has reached max number of anonymous trial plans"
+	}
+
+	return res
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"plandex-server/db"
+	"plandex-server/types"
+	"testing"
+)
+
+func TestGetCreatePlanEligibility(t *testing.T) {
+	tests := []struct {
+		name      string
+		canCreate bool
+		user      *db.User
+		allowed   bool
+		hasLimit  bool
+	}{
+		{"self-hosted", true, nil, true, false},
+		{"no permission", false, nil, false, false},
+		{"paid user", true, &db.User{NumNonDraftPlans: types.TrialMaxPlans + 5}, true, false},
+		{"trial under limit", true, &db.User{IsTrial: true, NumNonDraftPlans: types.TrialMaxPlans - 1}, true, true},
+		{"trial at limit", true, &db.User{IsTrial: true, NumNonDraftPlans: types.TrialMaxPlans}, false, true},
+	}
+
+	for _, tt := range tests {
+		res := getCreatePlanEligibility(tt.canCreate, tt.user)
+
+		if res.Allowed != tt.allowed {
+			t.Errorf("%s: got allowed %v, want %v", tt.name, res.Allowed, tt.allowed)
+		}
+
+		if res.Allowed == (res.Reason != "") {
+			t.Errorf("%s: reason %q doesn't match allowed %v", tt.name, res.Reason, res.Allowed)
+		}
+
+		if (res.PlansUsed != nil) != (tt.user != nil) {
+			t.Errorf("%s: got plans used %v", tt.name, res.PlansUsed)
+		}
+
+		if (res.PlansLimit != nil) != tt.hasLimit {
+			t.Errorf("%s: got plans limit %v", tt.name, res.PlansLimit)
+		}
+	}
+}
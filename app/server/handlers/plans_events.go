@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"plandex-server/db"
+	"plandex-server/logger"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const planEventsKeepAliveInterval = 15 * time.Second
+
+func SubscribePlansHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for SubscribePlansHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	projectId := vars["projectId"]
+
+	log.Println("projectId: ", projectId)
+
+	if !authorizeProject(w, projectId, auth) {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		log.Println("Streaming not supported")
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	subscriptionId, ch := db.SubscribePlanEvents(projectId)
+	defer func() {
+		log.Println("SubscribePlansHandler: client disconnected")
+		db.UnsubscribePlanEvents(subscriptionId)
+	}()
+
+	ticker := time.NewTicker(planEventsKeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-ticker.C:
+			_, err := fmt.Fprint(w, ": keep-alive\n\n")
+			if err != nil {
+				log.Printf("SubscribePlansHandler: error writing keep-alive: %v\n", err)
+				return
+			}
+			flusher.Flush()
+
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+
+			// same visibility as ListPlansHandler -- only the caller's own plans
+			if event.OwnerId != auth.User.Id {
+				continue
+			}
+
+			bytes, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("SubscribePlansHandler: error marshalling event: %v\n", err)
+				continue
+			}
+
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, bytes)
+			if err != nil {
+				log.Printf("SubscribePlansHandler: error writing event: %v\n", err)
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
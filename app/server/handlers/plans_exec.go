@@ -3,12 +3,15 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"plandex-server/db"
 	"plandex-server/host"
+	"plandex-server/logger"
 	"plandex-server/model"
 	modelPlan "plandex-server/model/plan"
 	"plandex-server/types"
@@ -21,7 +24,7 @@ import (
 const TrialMaxReplies = 10
 
 func TellPlanHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for TellPlanHandler", "ip:", host.Ip)
+	logger.Debugln("Received request for TellPlanHandler", "ip:", host.Ip)
 
 	auth := authenticate(w, r, true)
 	if auth == nil {
@@ -90,6 +93,12 @@ func TellPlanHandler(w http.ResponseWriter, r *http.Request) {
 	client := model.NewClient(requestBody.ApiKey)
 	err = modelPlan.Tell(client, plan, branch, auth, &requestBody)
 
+	if apiErr := tellApiError(err, branch); apiErr != nil {
+		log.Printf("Can't tell plan: %s\n", apiErr.Msg)
+		writeApiError(w, *apiErr)
+		return
+	}
+
 	if err != nil {
 		log.Printf("Error telling plan: %v\n", err)
 		http.Error(w, "Error telling plan", http.StatusInternalServerError)
@@ -103,8 +112,37 @@ func TellPlanHandler(w http.ResponseWriter, r *http.Request) {
 	log.Println("Successfully processed request for TellPlanHandler")
 }
 
+// startInitialPrompt sends a new plan its first prompt on main, like TellPlanHandler
+func startInitialPrompt(auth *types.ServerAuth, plan *db.Plan, req *shared.TellPlanRequest) *shared.InitialPromptResult {
+	res := &shared.InitialPromptResult{Branch: "main"}
+
+	req.ConnectStream = false
+
+	client := model.NewClient(req.ApiKey)
+	err := modelPlan.Tell(client, plan, "main", auth, req)
+
+	if err != nil {
+		log.Printf("Error starting initial prompt: %v\n", err)
+
+		res.Error = tellApiError(err, "main")
+		if res.Error == nil {
+			res.Error = &shared.ApiError{
+				Type:   shared.ApiErrorTypeOther,
+				Status: http.StatusInternalServerError,
+				Msg:    "Error starting initial prompt",
+			}
+		}
+
+		return res
+	}
+
+	res.Started = true
+
+	return res
+}
+
 func BuildPlanHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for BuildPlanHandler", "ip:", host.Ip)
+	logger.Debugln("Received request for BuildPlanHandler", "ip:", host.Ip)
 	auth := authenticate(w, r, true)
 	if auth == nil {
 		return
@@ -147,6 +185,11 @@ func BuildPlanHandler(w http.ResponseWriter, r *http.Request) {
 	client := model.NewClient(requestBody.ApiKey)
 	numBuilds, err := modelPlan.Build(client, plan, branch, auth)
 
+	if errors.Is(err, db.ErrPlanBusy) {
+		writePlanBusyErr(w, branch)
+		return
+	}
+
 	if err != nil {
 		log.Printf("Error building plan: %v\n", err)
 		http.Error(w, "Error building plan", http.StatusInternalServerError)
@@ -167,7 +210,7 @@ func BuildPlanHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func ConnectPlanHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for ConnectPlanHandler", "ip:", host.Ip)
+	logger.Debugln("Received request for ConnectPlanHandler", "ip:", host.Ip)
 
 	vars := mux.Vars(r)
 	planId := vars["planId"]
@@ -208,7 +251,7 @@ func ConnectPlanHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func StopPlanHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for StopPlanHandler", "ip:", host.Ip)
+	logger.Debugln("Received request for StopPlanHandler", "ip:", host.Ip)
 
 	vars := mux.Vars(r)
 	planId := vars["planId"]
@@ -271,7 +314,7 @@ func StopPlanHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func RespondMissingFileHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for RespondMissingFileHandler", "ip:", host.Ip)
+	logger.Debugln("Received request for RespondMissingFileHandler", "ip:", host.Ip)
 
 	vars := mux.Vars(r)
 	planId := vars["planId"]
@@ -365,3 +408,40 @@ func authorizePlanExecUpdate(w http.ResponseWriter, planId string, auth *types.S
 
 	return plan
 }
+
+func writePlanBusyErr(w http.ResponseWriter, branch string) {
+	log.Printf("Plan branch %s is already running\n", branch)
+	writeApiError(w, planBusyApiError(branch))
+}
+
+func planBusyApiError(branch string) shared.ApiError {
+	return shared.ApiError{
+		Type:   shared.ApiErrorTypePlanBusy,
+		Status: http.StatusConflict,
+		Msg:    fmt.Sprintf("Branch '%s' of this plan is already running. Wait for it to finish or stop it, then try again.", branch),
+	}
+}
+
+// tellApiError returns the api error for the errors from modelPlan.Tell that callers can act on,
+// or nil for any other error
+func tellApiError(err error, branch string) *shared.ApiError {
+	var tooManyRunningErr *modelPlan.TooManyRunningError
+	if errors.As(err, &tooManyRunningErr) {
+		return &shared.ApiError{
+			Type:   shared.ApiErrorTypeTooManyRunning,
+			Status: http.StatusTooManyRequests,
+			Msg:    fmt.Sprintf("You have %d plans running, which is the max allowed. Wait for one to finish or stop it, then try again.", tooManyRunningErr.Running),
+			TooManyRunningError: &shared.TooManyRunningError{
+				Running:    tooManyRunningErr.Running,
+				MaxRunning: tooManyRunningErr.MaxRunning,
+			},
+		}
+	}
+
+	if errors.Is(err, db.ErrPlanBusy) {
+		apiErr := planBusyApiError(branch)
+		return &apiErr
+	}
+
+	return nil
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"plandex-server/db"
+	"plandex-server/logger"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/plandex/plandex/shared"
+)
+
+// ExportPlansHandler streams a gzipped tarball with one directory per plan, named by plan id,
+// and a manifest listing what was exported and what was skipped. Plans that don't exist or that
+// the user can't access are skipped rather than failing the export. Once streaming starts the
+// status can't change, so an error partway through cuts the archive short, and the client sees
+// a truncated gzip stream.
+func ExportPlansHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for ExportPlansHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	projectId := vars["projectId"]
+
+	log.Println("projectId: ", projectId)
+
+	if !authorizeProject(w, projectId, auth) {
+		return
+	}
+
+	var req shared.ExportPlansRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Error parsing request body: %v\n", err)
+		http.Error(w, "Error parsing request body", http.StatusBadRequest)
+		return
+	}
+
+	manifest := shared.ExportPlansManifest{
+		ExportedAt: time.Now(),
+		Plans:      []*shared.ExportedPlan{},
+		Skipped:    []*shared.SkippedExportPlan{},
+	}
+
+	var plans []*db.Plan
+
+	if len(req.PlanIds) == 0 {
+		var err error
+		plans, err = db.ListOwnedPlans([]string{projectId}, auth.User.Id, false, db.PlanSort{})
+
+		if err != nil {
+			log.Printf("Error listing plans: %v\n", err)
+			http.Error(w, "Error listing plans: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		seen := map[string]bool{}
+
+		for _, planId := range req.PlanIds {
+			if seen[planId] {
+				continue
+			}
+			seen[planId] = true
+
+			skip := func(reason string) {
+				manifest.Skipped = append(manifest.Skipped, &shared.SkippedExportPlan{Id: planId, Reason: reason})
+			}
+
+			if _, err := uuid.Parse(planId); err != nil {
+				skip("not found")
+				continue
+			}
+
+			plan, err := db.ValidatePlanAccess(planId, auth.User.Id, auth.OrgId)
+
+			if errors.Is(err, sql.ErrNoRows) {
+				skip("not found")
+				continue
+			}
+
+			if err != nil {
+				log.Printf("Error validating plan access: %v\n", err)
+				http.Error(w, "Error validating plan access: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			if plan == nil || plan.ProjectId != projectId {
+				skip("not authorized")
+				continue
+			}
+
+			plans = append(plans, plan)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"plans-%s.tar.gz\"", manifest.ExportedAt.UTC().Format("20060102-150405")))
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	for _, plan := range plans {
+		ok, err := exportPlan(tw, auth.OrgId, auth.User.Id, plan)
+
+		if err != nil {
+			log.Printf("Error exporting plan %s, aborting export: %v\n", plan.Id, err)
+			return
+		}
+
+		if !ok {
+			manifest.Skipped = append(manifest.Skipped, &shared.SkippedExportPlan{Id: plan.Id, Reason: "couldn't lock plan"})
+			continue
+		}
+
+		manifest.Plans = append(manifest.Plans, &shared.ExportedPlan{Id: plan.Id, Name: plan.Name, Dir: plan.Id})
+
+		if flusher, ok := w.(http.Flusher); ok {
+			// push what's compressed so far so large exports start arriving right away
+			gz.Flush()
+			flusher.Flush()
+		}
+	}
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+
+	if err != nil {
+		log.Printf("Error marshalling manifest: %v\n", err)
+		return
+	}
+
+	err = db.WriteArchiveFile(tw, shared.ExportPlansManifestPath, manifestBytes, manifest.ExportedAt)
+
+	if err != nil {
+		log.Printf("Error writing manifest: %v\n", err)
+		return
+	}
+
+	if err := tw.Close(); err != nil {
+		log.Printf("Error closing tar writer: %v\n", err)
+		return
+	}
+
+	if err := gz.Close(); err != nil {
+		log.Printf("Error closing gzip writer: %v\n", err)
+		return
+	}
+
+	log.Printf("Successfully exported %d plans, skipped %d\n", len(manifest.Plans), len(manifest.Skipped))
+}
+
+// exportPlan writes one plan to the archive under a read lock. Returns false without writing
+// anything if the lock can't be taken.
+func exportPlan(tw *tar.Writer, orgId, userId string, plan *db.Plan) (bool, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	repoLockId, err := db.LockRepo(
+		db.LockRepoParams{
+			OrgId:    orgId,
+			UserId:   userId,
+			PlanId:   plan.Id,
+			Branch:   "main",
+			Scope:    db.LockScopeRead,
+			Ctx:      ctx,
+			CancelFn: cancel,
+		},
+	)
+
+	if err != nil {
+		log.Printf("Error locking plan %s for export: %v\n", plan.Id, err)
+		return false, nil
+	}
+
+	defer func() {
+		err := db.UnlockRepo(repoLockId)
+		if err != nil {
+			log.Printf("Error unlocking repo: %v\n", err)
+		}
+	}()
+
+	return true, db.WritePlanToArchive(tw, plan, plan.Id)
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"plandex-server/db"
+	"plandex-server/types"
+
+	"github.com/plandex/plandex/shared"
+)
+
+// writeExternalKeyConflict responds to a CreatePlanRequest whose ExternalKey is already used by
+// existing, following the request's OnConflict. A plan the user can't access is reported as a
+// conflict whatever OnConflict is, without saying which plan it is.
+func writeExternalKeyConflict(w http.ResponseWriter, auth *types.ServerAuth, org *db.Org, existing *db.Plan, req *shared.CreatePlanRequest) {
+	conflictMsg := fmt.Sprintf("A plan with externalKey '%s' already exists in this project", req.ExternalKey)
+
+	if req.OnConflict == shared.PlanExternalKeyConflictError {
+		log.Printf("Plan with external key already exists: %s\n", existing.Id)
+		http.Error(w, conflictMsg, http.StatusConflict)
+		return
+	}
+
+	plan, err := db.ValidatePlanAccess(existing.Id, auth.User.Id, auth.OrgId)
+
+	if err != nil {
+		log.Printf("Error validating plan access: %v\n", err)
+		http.Error(w, "Error validating plan access: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if plan == nil {
+		log.Printf("Plan with external key already exists and user can't access it: %s\n", existing.Id)
+		http.Error(w, conflictMsg, http.StatusConflict)
+		return
+	}
+
+	if req.OnConflict == shared.PlanExternalKeyConflictUpdateName && req.Name != "" && req.Name != plan.Name {
+		renamed, ok := renameExternalKeyPlan(w, auth, org, plan, req.Name)
+		if !ok {
+			return
+		}
+		plan = renamed
+	}
+
+	bytes, err := json.Marshal(shared.CreatePlanResponse{
+		Id:       plan.Id,
+		Name:     plan.Name,
+		Existing: true,
+	})
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Printf("Returned existing plan %s for external key\n", plan.Id)
+}
+
+// renameExternalKeyPlan renames the existing plan with the same checks as UpdatePlanHandler. On
+// failure it writes the error response and returns false.
+func renameExternalKeyPlan(w http.ResponseWriter, auth *types.ServerAuth, org *db.Org, plan *db.Plan, name string) (*db.Plan, bool) {
+	if authorizePlanUpdate(w, plan.Id, auth) == nil {
+		return nil, false
+	}
+
+	if plan.OwnerId != auth.User.Id && !auth.HasPermission(types.PermissionRenameAnyPlan) {
+		log.Println("User does not have permission to rename plan")
+		http.Error(w, "User does not have permission to rename plan", http.StatusForbidden)
+		return nil, false
+	}
+
+	if err := validatePlanName(name); err != nil {
+		log.Printf("Invalid plan name: %v\n", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	prefixed, err := db.ApplyPlanNamePrefix(org, name, false)
+
+	if err == db.ErrPlanNamePrefixRequired {
+		writePlanNamePrefixErr(w, org, name)
+		return nil, false
+	}
+
+	if prefixed == plan.Name {
+		return plan, true
+	}
+
+	exists, err := db.PlanNameExists(plan.NameScope(), prefixed, plan.Id)
+
+	if err != nil {
+		log.Printf("Error checking plan name: %v\n", err)
+		http.Error(w, "Error checking plan name: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if exists {
+		log.Println("Plan name already exists")
+		http.Error(w, "A plan with this name already exists", http.StatusConflict)
+		return nil, false
+	}
+
+	tx, err := db.Conn.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v\n", err)
+		http.Error(w, "Error starting transaction: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	// Ensure that rollback is attempted in case of failure
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Printf("transaction rollback error: %v\n", rbErr)
+			} else {
+				log.Println("transaction rolled back")
+			}
+		}
+	}()
+
+	err = db.RenamePlan(plan.Id, prefixed, tx)
+
+	if err != nil {
+		log.Printf("Error renaming plan: %v\n", err)
+		http.Error(w, "Error renaming plan: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing transaction: %v\n", err)
+		http.Error(w, "Error committing transaction: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	db.InvalidatePlanCache(plan.Id)
+
+	renamed, err := db.GetPlan(plan.Id)
+
+	if err != nil {
+		log.Printf("Error getting renamed plan: %v\n", err)
+		http.Error(w, "Error getting renamed plan: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	db.PublishPlanRenamed(renamed)
+
+	return renamed, true
+}
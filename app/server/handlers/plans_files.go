@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"path"
+	"path/filepath"
+	"plandex-server/db"
+	"plandex-server/logger"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+func GetPlanFileHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for GetPlanFileHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+
+	log.Println("planId: ", planId)
+
+	filePath, ok := cleanPlanFilePath(r.URL.Query().Get("path"))
+	if !ok {
+		log.Println("Invalid path param")
+		http.Error(w, "path must be a relative path inside the plan", http.StatusBadRequest)
+		return
+	}
+
+	branch := r.URL.Query().Get("branch")
+	if branch == "" {
+		branch = "main"
+	}
+
+	if authorizePlan(w, planId, auth) == nil {
+		return
+	}
+
+	var err error
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepoBranch(w, auth, planId, branch, db.LockScopeRead, ctx, cancel)
+	if unlockFn == nil {
+		return
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	fileContext, err := db.GetPlanContextByPath(auth.OrgId, planId, filePath)
+
+	if err != nil {
+		log.Printf("Error getting plan file: %v\n", err)
+		http.Error(w, "Error getting plan file: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if fileContext == nil {
+		log.Println("Plan file not found:", filePath)
+		http.Error(w, "File not found in plan context: "+filePath, http.StatusNotFound)
+		return
+	}
+
+	// bodies are stored with triple backticks escaped for the model
+	body := strings.ReplaceAll(fileContext.Body, "\\`\\`\\`", "```")
+
+	// ServeContent handles Range, Content-Length, and sniffs Content-Type from the name and content
+	http.ServeContent(w, r, path.Base(filePath), fileContext.UpdatedAt, strings.NewReader(body))
+
+	log.Println("Successfully served plan file", filePath)
+}
+
+// cleanPlanFilePath rejects empty, absolute, and parent-escaping paths
+func cleanPlanFilePath(p string) (string, bool) {
+	if p == "" {
+		return "", false
+	}
+
+	p = filepath.ToSlash(p)
+	if path.IsAbs(p) || filepath.IsAbs(p) || filepath.VolumeName(p) != "" {
+		return "", false
+	}
+
+	cleaned := path.Clean(p)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", false
+	}
+
+	return cleaned, true
+}
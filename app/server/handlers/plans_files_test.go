@@ -0,0 +1,28 @@
+package handlers
+
+import "testing"
+
+func TestCleanPlanFilePath(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"main.go", "main.go", true},
+		{"src/./lib/util.go", "src/lib/util.go", true},
+		{"src/../main.go", "main.go", true},
+		{"", "", false},
+		{".", "", false},
+		{"..", "", false},
+		{"../secrets", "", false},
+		{"src/../../secrets", "", false},
+		{"/etc/passwd", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := cleanPlanFilePath(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("cleanPlanFilePath(%q) = (%q, %v), want (%q, %v)", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"plandex-server/db"
+	"plandex-server/logger"
+	"plandex-server/types"
+
+	"github.com/gorilla/mux"
+	"github.com/plandex/plandex/shared"
+)
+
+// ImportPlanFromPathHandler creates a plan in the project from a dir on the server, laid out
+// like a plan in an export archive. It's for self-hosted servers, and only dirs inside
+// PLANDEX_IMPORT_ROOTS can be imported, after symlinks are resolved.
+func ImportPlanFromPathHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for ImportPlanFromPathHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	projectId := vars["projectId"]
+
+	log.Println("projectId: ", projectId)
+
+	if os.Getenv("IS_CLOUD") != "" || len(db.PlanImportRoots) == 0 {
+		log.Println("Importing plans from a path isn't enabled")
+		http.Error(w, db.ErrPlanImportDisabled.Error(), http.StatusNotFound)
+		return
+	}
+
+	if !auth.HasPermission(types.PermissionImportPlans) {
+		log.Println("User does not have permission to import plans")
+		http.Error(w, "User does not have permission to import plans", http.StatusForbidden)
+		return
+	}
+
+	if !authorizeProject(w, projectId, auth) {
+		return
+	}
+
+	var req shared.ImportPlanFromPathRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Error parsing request body: %v\n", err)
+		http.Error(w, "Error parsing request body", http.StatusBadRequest)
+		return
+	}
+
+	dir, err := db.ResolvePlanImportPath(db.PlanImportRoots, req.Path)
+
+	if errors.Is(err, db.ErrPlanImportPathNotAllowed) {
+		log.Printf("Import path %s not allowed\n", req.Path)
+		http.Error(w, "path must be an existing dir inside an allowed import root", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		log.Printf("Error resolving import path: %v\n", err)
+		http.Error(w, "Error resolving import path: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	name := req.Name
+	if name == "" {
+		meta, err := db.ReadPlanImportMeta(dir)
+
+		if errors.Is(err, db.ErrInvalidPlanImport) {
+			log.Printf("Invalid plan metadata: %v\n", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err != nil {
+			log.Printf("Error reading plan metadata: %v\n", err)
+			http.Error(w, "Error reading plan metadata: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if meta != nil {
+			name = meta.Name
+		}
+	}
+	if name == "" {
+		name = filepath.Base(dir)
+	}
+
+	if name == "draft" {
+		log.Println("Can't import a plan as a draft")
+		http.Error(w, "Plans can't be imported as drafts. Pass a name.", http.StatusBadRequest)
+		return
+	}
+
+	org, err := db.GetOrg(auth.OrgId)
+
+	if err != nil {
+		log.Printf("Error getting org: %v\n", err)
+		http.Error(w, "Error getting org: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	name, err = db.ApplyPlanNamePrefix(org, name, true)
+
+	if err != nil {
+		log.Printf("Error applying plan name prefix: %v\n", err)
+		http.Error(w, "Error applying plan name prefix: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	plan, _ := createPlan(w, org, projectId, auth.User.Id, "", name, false, db.PlanCreation{ActorId: auth.User.Id})
+	if plan == nil {
+		// an error response has already been written
+		return
+	}
+
+	importRes, err := db.ImportPlanFromDir(dir, plan, auth.User.Id)
+
+	if errors.Is(err, db.ErrInvalidPlanImport) {
+		log.Printf("Invalid plan import: %v\n", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		deleteCreatedPlan(plan)
+		return
+	}
+
+	if err != nil {
+		log.Printf("Error importing plan: %v\n", err)
+		http.Error(w, "Error importing plan: "+err.Error(), http.StatusInternalServerError)
+		deleteCreatedPlan(plan)
+		return
+	}
+
+	res := shared.ImportPlanFromPathResponse{
+		PlanId:           plan.Id,
+		Name:             plan.Name,
+		NumContexts:      importRes.NumContexts,
+		NumConvoMessages: importRes.NumConvoMessages,
+	}
+
+	bytes, err := json.Marshal(res)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Printf("Successfully imported plan %s from %s\n", plan.Id, dir)
+}
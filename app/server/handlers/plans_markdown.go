@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"plandex-server/db"
+	"plandex-server/logger"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/plandex/plandex/shared"
+)
+
+// ExportPlanMarkdownHandler renders a branch's conversation, context, and pending changes as
+// a Markdown document for sharing in PR descriptions or wikis
+func ExportPlanMarkdownHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for ExportPlanMarkdownHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+
+	log.Println("planId: ", planId)
+
+	branch := r.URL.Query().Get("branch")
+	if branch == "" {
+		branch = "main"
+	}
+
+	plan := authorizePlan(w, planId, auth)
+	if plan == nil {
+		return
+	}
+
+	var err error
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepoBranch(w, auth, planId, branch, db.LockScopeRead, ctx, cancel)
+	if unlockFn == nil {
+		return
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	convo, err := db.GetPlanConvo(auth.OrgId, planId)
+
+	if err != nil {
+		log.Printf("Error getting plan convo: %v\n", err)
+		http.Error(w, "Error getting plan convo: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	contexts, err := db.GetPlanContexts(auth.OrgId, planId, true)
+
+	if err != nil {
+		log.Printf("Error getting contexts: %v\n", err)
+		http.Error(w, "Error getting contexts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	planState, err := db.GetCurrentPlanState(db.CurrentPlanStateParams{
+		OrgId:    auth.OrgId,
+		PlanId:   planId,
+		Contexts: contexts,
+	})
+
+	if err != nil {
+		log.Printf("Error getting current plan state: %v\n", err)
+		http.Error(w, "Error getting current plan state: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s.md\"", markdownFileName(plan.Name)))
+
+	bw := bufio.NewWriter(w)
+	writePlanMarkdown(bw, plan.Name, branch, contexts, convo, planState)
+
+	// once writing starts the status can't change, so a failure here only truncates the document
+	if err := bw.Flush(); err != nil {
+		log.Printf("Error writing markdown export: %v\n", err)
+		return
+	}
+
+	log.Printf("Successfully exported plan %s as markdown\n", planId)
+}
+
+func writePlanMarkdown(w io.Writer, name, branch string, contexts []*db.Context, convo []*db.ConvoMessage, planState *shared.CurrentPlanState) {
+	fmt.Fprintf(w, "# %s\n\n", name)
+	if branch != "main" {
+		fmt.Fprintf(w, "Branch: `%s`\n\n", branch)
+	}
+
+	fmt.Fprint(w, "## Context\n\n")
+	if len(contexts) == 0 {
+		fmt.Fprint(w, "No context loaded.\n\n")
+	} else {
+		for _, c := range contexts {
+			label := c.Name
+			switch {
+			case c.FilePath != "":
+				label = "`" + c.FilePath + "`"
+			case c.Url != "":
+				label = c.Url
+			}
+			fmt.Fprintf(w, "- %s (%s, %d tokens)\n", label, c.ContextType, c.NumTokens)
+		}
+		fmt.Fprint(w, "\n")
+	}
+
+	fmt.Fprint(w, "## Conversation\n\n")
+	if len(convo) == 0 {
+		fmt.Fprint(w, "No messages yet.\n\n")
+	}
+	for _, msg := range convo {
+		who := "User"
+		if msg.Role == "assistant" {
+			who = "Plandex"
+		}
+		fmt.Fprintf(w, "### %s · %s\n\n", who, msg.CreatedAt.UTC().Format("2006-01-02 15:04 UTC"))
+		// messages are already Markdown, so they're written as is
+		fmt.Fprintf(w, "%s\n\n", strings.TrimSpace(msg.Message))
+		if msg.Stopped {
+			fmt.Fprint(w, "_Stopped early._\n\n")
+		}
+	}
+
+	fmt.Fprint(w, "## Pending changes\n\n")
+	pendingPaths := pendingChangePaths(planState)
+	if len(pendingPaths) == 0 {
+		fmt.Fprint(w, "No pending changes.\n")
+		return
+	}
+	for _, p := range pendingPaths {
+		fmt.Fprintf(w, "### `%s`\n\n", p)
+		writeCodeFence(w, p, planState.CurrentPlanFiles.Files[p])
+	}
+}
+
+// pendingChangePaths returns the paths with changes that haven't been applied or rejected, in
+// the order they were planned
+func pendingChangePaths(planState *shared.CurrentPlanState) []string {
+	var paths []string
+	if planState.PlanResult == nil || planState.CurrentPlanFiles == nil {
+		return paths
+	}
+
+	for _, p := range planState.PlanResult.SortedPaths {
+		for _, res := range planState.PlanResult.FileResultsByPath[p] {
+			if res.IsPending() {
+				paths = append(paths, p)
+				break
+			}
+		}
+	}
+
+	return paths
+}
+
+var backtickRunRegex = regexp.MustCompile("`{3,}")
+
+// writeCodeFence uses a fence longer than any backtick run in the content, so files that contain
+// fences themselves, like Markdown, don't end the block early
+func writeCodeFence(w io.Writer, filePath, content string) {
+	fence := "```"
+	for _, run := range backtickRunRegex.FindAllString(content, -1) {
+		if len(run) >= len(fence) {
+			fence = strings.Repeat("`", len(run)+1)
+		}
+	}
+
+	lang := strings.TrimPrefix(path.Ext(filePath), ".")
+	fmt.Fprintf(w, "%s%s\n%s", fence, lang, content)
+	if !strings.HasSuffix(content, "\n") {
+		fmt.Fprint(w, "\n")
+	}
+	fmt.Fprintf(w, "%s\n\n", fence)
+}
+
+var unsafeFileNameRegex = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func markdownFileName(planName string) string {
+	name := strings.Trim(unsafeFileNameRegex.ReplaceAllString(planName, "-"), "-.")
+	if name == "" {
+		return "plan"
+	}
+	return name
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"bytes"
+	"plandex-server/db"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plandex/plandex/shared"
+)
+
+func TestWriteCodeFence(t *testing.T) {
+	var buf bytes.Buffer
+	writeCodeFence(&buf, "README.md", "# Title\n\n```go\nfmt.Println()\n```\n")
+
+	want := "````md\n# Title\n\n```go\nfmt.Println()\n```\n````\n\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	writeCodeFence(&buf, "main.go", "package main")
+	if buf.String() != "```go\npackage main\n```\n\n" {
+		t.Errorf("unexpected fence without trailing newline: %q", buf.String())
+	}
+}
+
+func TestWritePlanMarkdown(t *testing.T) {
+	now := time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)
+
+	planState := &shared.CurrentPlanState{
+		PlanResult: &shared.PlanResult{
+			SortedPaths: []string{"applied.go", "main.go"},
+			FileResultsByPath: shared.PlanFileResultsByPath{
+				"applied.go": {{Path: "applied.go", Content: "x", AppliedAt: &now}},
+				"main.go":    {{Path: "main.go", Content: "package main\n"}},
+			},
+		},
+		CurrentPlanFiles: &shared.CurrentPlanFiles{Files: map[string]string{
+			"applied.go": "x",
+			"main.go":    "package main\n",
+		}},
+	}
+
+	var buf bytes.Buffer
+	writePlanMarkdown(&buf, "my plan", "main",
+		[]*db.Context{{ContextType: shared.ContextFileType, FilePath: "main.go", NumTokens: 3}},
+		[]*db.ConvoMessage{
+			{Role: "user", Message: "add a main func", CreatedAt: now},
+			{Role: "assistant", Message: "Here it is.", CreatedAt: now},
+		},
+		planState,
+	)
+
+	got := buf.String()
+	for _, s := range []string{
+		"# my plan\n",
+		"- `main.go` (file, 3 tokens)\n",
+		"### User · 2024-04-30 12:00 UTC\n\nadd a main func\n",
+		"### Plandex · 2024-04-30 12:00 UTC\n\nHere it is.\n",
+		"### `main.go`\n\n```go\npackage main\n```\n",
+	} {
+		if !strings.Contains(got, s) {
+			t.Errorf("expected markdown to contain %q, got:\n%s", s, got)
+		}
+	}
+
+	if strings.Contains(got, "applied.go") {
+		t.Errorf("expected applied changes to be left out, got:\n%s", got)
+	}
+}
+
+func TestMarkdownFileName(t *testing.T) {
+	if got := markdownFileName("fix: auth/login bug"); got != "fix-auth-login-bug" {
+		t.Errorf("got %q", got)
+	}
+	if got := markdownFileName("../"); got != "plan" {
+		t.Errorf("got %q", got)
+	}
+}
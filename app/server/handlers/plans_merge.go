@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"plandex-server/db"
+	"plandex-server/logger"
+	"plandex-server/types"
+	"sort"
+
+	"github.com/gorilla/mux"
+	"github.com/plandex/plandex/shared"
+)
+
+func ListDuplicatePlanNamesHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for ListDuplicatePlanNamesHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	if !auth.HasPermission(types.PermissionUpdateAnyPlan) {
+		log.Println("User does not have permission to list duplicate plan names")
+		http.Error(w, "User does not have permission to list duplicate plan names", http.StatusForbidden)
+		return
+	}
+
+	vars := mux.Vars(r)
+	projectId := vars["projectId"]
+
+	log.Println("projectId: ", projectId)
+
+	if !authorizeProject(w, projectId, auth) {
+		return
+	}
+
+	plans, err := db.ListProjectPlans(projectId, false)
+
+	if err != nil {
+		log.Printf("Error listing plans: %v\n", err)
+		http.Error(w, "Error listing plans: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// plans owned by different users never collide, so group per owner
+	plansByOwner := map[string][]*db.Plan{}
+	for _, plan := range plans {
+		plansByOwner[plan.OwnerId] = append(plansByOwner[plan.OwnerId], plan)
+	}
+
+	res := shared.ListDuplicatePlanNamesResponse{
+		Groups: []*shared.PlanNameGroup{},
+	}
+
+	for _, ownerPlans := range plansByOwner {
+		for baseName, group := range db.GroupPlansByBaseName(ownerPlans) {
+			apiGroup := &shared.PlanNameGroup{BaseName: baseName}
+			for _, plan := range group {
+				apiGroup.Plans = append(apiGroup.Plans, plan.ToApi())
+			}
+			res.Groups = append(res.Groups, apiGroup)
+		}
+	}
+
+	sort.Slice(res.Groups, func(i, j int) bool {
+		if res.Groups[i].BaseName == res.Groups[j].BaseName {
+			return res.Groups[i].Plans[0].OwnerId < res.Groups[j].Plans[0].OwnerId
+		}
+		return res.Groups[i].BaseName < res.Groups[j].BaseName
+	})
+
+	bytes, err := json.Marshal(res)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Println("Successfully processed ListDuplicatePlanNamesHandler request")
+}
+
+func MergePlansHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for MergePlansHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	if !auth.HasPermission(types.PermissionUpdateAnyPlan) || !auth.HasPermission(types.PermissionArchiveAnyPlan) {
+		log.Println("User does not have permission to merge plans")
+		http.Error(w, "User does not have permission to merge plans", http.StatusForbidden)
+		return
+	}
+
+	vars := mux.Vars(r)
+	projectId := vars["projectId"]
+
+	log.Println("projectId: ", projectId)
+
+	if !authorizeProject(w, projectId, auth) {
+		return
+	}
+
+	var req shared.MergePlansRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Error parsing request body: %v\n", err)
+		http.Error(w, "Error parsing request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.TargetPlanId == "" || len(req.SourcePlanIds) == 0 {
+		log.Println("Missing target or source plans")
+		http.Error(w, "targetPlanId and sourcePlanIds are required", http.StatusBadRequest)
+		return
+	}
+
+	target, err := db.GetPlan(req.TargetPlanId)
+	if err != nil || target.OrgId != auth.OrgId || target.ProjectId != projectId {
+		log.Printf("Target plan not found: %v\n", err)
+		http.Error(w, "Target plan not found", http.StatusNotFound)
+		return
+	}
+
+	var sources []*db.Plan
+	seen := map[string]bool{target.Id: true}
+	for _, sourceId := range req.SourcePlanIds {
+		if seen[sourceId] {
+			log.Println("Duplicate or target plan in sources")
+			http.Error(w, "sourcePlanIds must be unique and can't include the target plan", http.StatusBadRequest)
+			return
+		}
+		seen[sourceId] = true
+
+		source, err := db.GetPlan(sourceId)
+		if err != nil || source.OrgId != auth.OrgId || source.ProjectId != projectId {
+			log.Printf("Source plan %s not found: %v\n", sourceId, err)
+			http.Error(w, "Source plan not found: "+sourceId, http.StatusNotFound)
+			return
+		}
+
+		sources = append(sources, source)
+	}
+
+	branch := "main"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepoBranch(w, auth, target.Id, branch, db.LockScopeWrite, ctx, cancel)
+	if unlockFn == nil {
+		return
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	mergeRes, err := db.MergePlansIntoTarget(db.MergePlansParams{
+		OrgId:   auth.OrgId,
+		Target:  target,
+		Sources: sources,
+		Branch:  branch,
+	})
+
+	if err != nil {
+		log.Printf("Error merging plans: %v\n", err)
+		http.Error(w, "Error merging plans: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var sourceIds []string
+	for _, source := range sources {
+		sourceIds = append(sourceIds, source.Id)
+	}
+
+	err = db.ArchivePlans(sources)
+
+	if err != nil {
+		log.Printf("Error archiving merged plans: %v\n", err)
+		http.Error(w, "Error archiving merged plans: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res := shared.MergePlansResponse{
+		TargetPlanId:     target.Id,
+		ArchivedPlanIds:  sourceIds,
+		SnapshotSha:      mergeRes.SnapshotSha,
+		NumContexts:      mergeRes.NumContexts,
+		NumConvoMessages: mergeRes.NumConvoMessages,
+	}
+
+	bytes, err := json.Marshal(res)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Println("Successfully merged plans into", target.Id)
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"plandex-server/db"
+	"plandex-server/logger"
+	"plandex-server/types"
+
+	"github.com/gorilla/mux"
+	"github.com/plandex/plandex/shared"
+)
+
+// MigratePlanHandler copies a plan into another org's project with a new id, for moving a team
+// between orgs. The source plan is left as it is. Only the main branch is copied.
+func MigratePlanHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for MigratePlanHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	if !auth.HasPermission(types.PermissionMigratePlans) {
+		log.Println("User does not have permission to migrate plans")
+		http.Error(w, "User does not have permission to migrate plans", http.StatusForbidden)
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+
+	log.Println("planId: ", planId)
+
+	// admins can migrate any plan in the org, not just ones they can access
+	plan, err := db.GetPlan(planId)
+	if err != nil || plan.OrgId != auth.OrgId {
+		log.Printf("Plan not found: %v\n", err)
+		http.Error(w, "Plan not found", http.StatusNotFound)
+		return
+	}
+
+	var req shared.MigratePlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Error parsing request body: %v\n", err)
+		http.Error(w, "Error parsing request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.TargetOrgId == "" || req.TargetProjectId == "" {
+		log.Println("Missing target org or project")
+		http.Error(w, "targetOrgId and targetProjectId are required", http.StatusBadRequest)
+		return
+	}
+
+	if req.TargetOrgId == auth.OrgId {
+		log.Println("Target org is the plan's org")
+		http.Error(w, "targetOrgId must be a different org", http.StatusBadRequest)
+		return
+	}
+
+	if plan.Name == "draft" {
+		log.Println("Can't migrate a draft plan")
+		http.Error(w, "Draft plans can't be migrated. Rename the plan first.", http.StatusBadRequest)
+		return
+	}
+
+	if !authorizeMigrateTarget(w, auth, req.TargetOrgId, req.TargetProjectId) {
+		return
+	}
+
+	for sourceUserId, targetUserId := range req.UserIdMap {
+		isMember, err := db.ValidateOrgMembership(targetUserId, req.TargetOrgId)
+
+		if err != nil {
+			log.Printf("Error validating org membership: %v\n", err)
+			http.Error(w, "Error validating org membership: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if !isMember {
+			log.Printf("Mapped user %s isn't a member of the target org\n", targetUserId)
+			http.Error(w, "userIdMap maps "+sourceUserId+" to a user who isn't a member of the target org", http.StatusBadRequest)
+			return
+		}
+	}
+
+	targetOrg, err := db.GetOrg(req.TargetOrgId)
+
+	if err != nil {
+		log.Printf("Error getting target org: %v\n", err)
+		http.Error(w, "Error getting target org: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// the name is server-chosen here, so add a required prefix rather than rejecting it
+	name, err := db.ApplyPlanNamePrefix(targetOrg, plan.Name, true)
+
+	if err != nil {
+		log.Printf("Error applying plan name prefix: %v\n", err)
+		http.Error(w, "Error applying plan name prefix: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepoBranch(w, auth, plan.Id, "main", db.LockScopeRead, ctx, cancel)
+	if unlockFn == nil {
+		return
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	ownerId := db.MapMigratedUserId(req.UserIdMap, plan.OwnerId, auth.User.Id)
+
+	target, _ := createPlan(w, targetOrg, req.TargetProjectId, ownerId, "", name, false, db.PlanCreation{ActorId: auth.User.Id})
+	if target == nil {
+		// an error response has already been written
+		return
+	}
+
+	migrateRes, err := db.MigratePlanToOrg(db.MigratePlanParams{
+		Source:        plan,
+		Target:        target,
+		UserIds:       req.UserIdMap,
+		DefaultUserId: auth.User.Id,
+	})
+
+	if err != nil {
+		log.Printf("Error migrating plan: %v\n", err)
+		http.Error(w, "Error migrating plan: "+err.Error(), http.StatusInternalServerError)
+		deleteCreatedPlan(target)
+		return
+	}
+
+	res := shared.MigratePlanResponse{
+		PlanId:           target.Id,
+		Name:             target.Name,
+		OwnerId:          target.OwnerId,
+		NumContexts:      migrateRes.NumContexts,
+		NumConvoMessages: migrateRes.NumConvoMessages,
+	}
+
+	bytes, err := json.Marshal(res)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Printf("Successfully migrated plan %s to %s in org %s\n", plan.Id, target.Id, targetOrg.Id)
+}
+
+// authorizeMigrateTarget checks that the user can migrate plans into the target org and that the
+// project is in it. The user's auth only covers the source org, so the target is checked here.
+func authorizeMigrateTarget(w http.ResponseWriter, auth *types.ServerAuth, orgId, projectId string) bool {
+	isMember, err := db.ValidateOrgMembership(auth.User.Id, orgId)
+
+	if err != nil {
+		log.Printf("Error validating org membership: %v\n", err)
+		http.Error(w, "Error validating org membership: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+
+	if !isMember {
+		log.Println("User isn't a member of the target org")
+		http.Error(w, "User does not have permission to migrate plans into the target org", http.StatusForbidden)
+		return false
+	}
+
+	permissions, err := db.GetUserPermissions(auth.User.Id, orgId)
+
+	if err != nil {
+		log.Printf("Error getting user permissions: %v\n", err)
+		http.Error(w, "Error getting user permissions: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+
+	hasPermission := false
+	for _, permission := range permissions {
+		if types.Permission(permission) == types.PermissionMigratePlans {
+			hasPermission = true
+			break
+		}
+	}
+
+	if !hasPermission {
+		log.Println("User does not have permission to migrate plans into the target org")
+		http.Error(w, "User does not have permission to migrate plans into the target org", http.StatusForbidden)
+		return false
+	}
+
+	projectExists, err := db.ProjectExists(orgId, projectId)
+
+	if err != nil {
+		log.Printf("Error validating project: %v\n", err)
+		http.Error(w, "Error validating project: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+
+	if !projectExists {
+		log.Println("Target project not found")
+		http.Error(w, "Target project not found", http.StatusNotFound)
+		return false
+	}
+
+	return true
+}
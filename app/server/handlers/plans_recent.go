@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"plandex-server/db"
+	"plandex-server/logger"
+	"plandex-server/types"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/plandex/plandex/shared"
+)
+
+// ListRecentOrgPlansHandler is a feed of plans created across the org's projects in the last
+// ?hours, newest first. Users only see plans they own or that are shared with the org, unless
+// they can list any plan. Pages are continued with ?before.
+func ListRecentOrgPlansHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for ListRecentOrgPlansHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	orgId := vars["orgId"]
+
+	log.Println("orgId: ", orgId)
+
+	if orgId != auth.OrgId {
+		log.Println("Org id doesn't match the authenticated org")
+		http.Error(w, "Can only list plans in the current org", http.StatusForbidden)
+		return
+	}
+
+	q := r.URL.Query()
+
+	hours, ok := parseRecentPlansParam(w, q.Get("hours"), "hours", shared.DefaultRecentPlansHours, shared.MaxRecentPlansHours)
+	if !ok {
+		return
+	}
+
+	limit, ok := parseRecentPlansParam(w, q.Get("limit"), "limit", shared.DefaultRecentPlansLimit, shared.MaxRecentPlansLimit)
+	if !ok {
+		return
+	}
+
+	before := q.Get("before")
+	if before != "" {
+		if _, err := uuid.Parse(before); err != nil {
+			log.Printf("Invalid before: %s\n", before)
+			http.Error(w, "before must be a plan id", http.StatusBadRequest)
+			return
+		}
+	}
+
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+	plans, hasMore, err := db.ListRecentOrgPlans(auth.OrgId, auth.User.Id, auth.HasPermission(types.PermissionListAnyPlan), since, before, limit)
+
+	if err != nil {
+		log.Printf("Error listing recent plans: %v\n", err)
+		http.Error(w, "Error listing recent plans: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := shared.ListRecentOrgPlansResponse{
+		Plans:        plansToApi(plans),
+		ProjectsById: map[string]*shared.Project{},
+	}
+
+	if hasMore {
+		resp.NextBefore = plans[len(plans)-1].Id
+	}
+
+	if len(plans) > 0 {
+		err = addPlanOwners(resp.Plans)
+
+		if err != nil {
+			log.Printf("Error getting plan owners: %v\n", err)
+			http.Error(w, "Error getting plan owners: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		projects, err := db.ListOrgProjects(auth.OrgId)
+
+		if err != nil {
+			log.Printf("Error listing projects: %v\n", err)
+			http.Error(w, "Error listing projects: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		withPlans := map[string]bool{}
+		for _, plan := range plans {
+			withPlans[plan.ProjectId] = true
+		}
+
+		for _, project := range projects {
+			if withPlans[project.Id] {
+				resp.ProjectsById[project.Id] = project.ToApi()
+			}
+		}
+	}
+
+	bytes, err := json.Marshal(resp)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Printf("Successfully listed %d recent plans\n", len(resp.Plans))
+}
+
+func parseRecentPlansParam(w http.ResponseWriter, s, name string, defaultVal, maxVal int) (int, bool) {
+	if s == "" {
+		return defaultVal, true
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > maxVal {
+		log.Printf("Invalid %s: %s\n", name, s)
+		http.Error(w, fmt.Sprintf("%s must be between 1 and %d", name, maxVal), http.StatusBadRequest)
+		return 0, false
+	}
+
+	return n, true
+}
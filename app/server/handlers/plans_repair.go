@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"plandex-server/db"
+	"plandex-server/logger"
+	"plandex-server/types"
+
+	"github.com/gorilla/mux"
+	"github.com/plandex/plandex/shared"
+)
+
+func RepairPlanHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for RepairPlanHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+
+	log.Println("planId: ", planId)
+
+	if authorizePlanUpdate(w, planId, auth) == nil {
+		return
+	}
+
+	// the dir and git repo have to be in place before the repo can be locked
+	fixes, err := db.RepairPlanDir(auth.OrgId, planId)
+
+	if err != nil {
+		log.Printf("Error repairing plan dir: %v\n", err)
+		http.Error(w, "Error repairing plan dir: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	warnings, err := checkPlanGitBranches(auth.OrgId, planId)
+
+	if err != nil {
+		log.Printf("Error checking plan branches: %v\n", err)
+		http.Error(w, "Error checking plan branches: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	contextFixes, ok := reconcilePlanContexts(w, auth, planId)
+	if !ok {
+		return
+	}
+	fixes = append(fixes, contextFixes...)
+
+	res := shared.RepairPlanResponse{
+		Fixes:    fixes,
+		Warnings: warnings,
+	}
+
+	bytes, err := json.Marshal(res)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Printf("Successfully repaired plan %s, %d fixes applied\n", planId, len(fixes))
+}
+
+// reconcilePlanContexts removes broken context files on main and commits the result
+func reconcilePlanContexts(w http.ResponseWriter, auth *types.ServerAuth, planId string) ([]string, bool) {
+	var err error
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepoBranch(w, auth, planId, "main", db.LockScopeWrite, ctx, cancel)
+	if unlockFn == nil {
+		return nil, false
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	fixes, err := db.ReconcilePlanContexts(auth.OrgId, planId)
+
+	if err != nil {
+		log.Printf("Error reconciling plan contexts: %v\n", err)
+		http.Error(w, "Error reconciling plan contexts: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if len(fixes) == 0 {
+		return nil, true
+	}
+
+	err = db.SyncPlanTokens(auth.OrgId, planId, "main")
+
+	if err != nil {
+		log.Printf("Error syncing plan tokens: %v\n", err)
+		http.Error(w, "Error syncing plan tokens: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	// removed files may never have been committed, in which case there's nothing to record
+	hasChanges, err := db.GitHasChanges(auth.OrgId, planId)
+
+	if err != nil {
+		log.Printf("Error checking for changes: %v\n", err)
+		http.Error(w, "Error checking for changes: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if hasChanges {
+		err = db.GitAddAndCommit(auth.OrgId, planId, "main", "🔧 Repaired plan context")
+
+		if err != nil {
+			log.Printf("Error committing repair: %v\n", err)
+			http.Error(w, "Error committing repair: "+err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
+	}
+
+	return fixes, true
+}
+
+// checkPlanGitBranches reports branches that exist in the db but not in the plan's git repo,
+// which happens when the repo had to be recreated. Their history can't be recovered.
+func checkPlanGitBranches(orgId, planId string) ([]string, error) {
+	dbBranches, err := db.ListPlanBranches(orgId, planId)
+	if err != nil {
+		return nil, fmt.Errorf("error listing plan branches: %v", err)
+	}
+
+	gitBranches, err := db.GitListBranches(orgId, planId)
+	if err != nil {
+		return nil, fmt.Errorf("error listing git branches: %v", err)
+	}
+
+	inGit := map[string]bool{}
+	for _, branch := range gitBranches {
+		inGit[branch] = true
+	}
+
+	var warnings []string
+	for _, branch := range dbBranches {
+		if !inGit[branch.Name] {
+			warnings = append(warnings, fmt.Sprintf("branch '%s' is missing from the git repository and its history can't be recovered", branch.Name))
+		}
+	}
+
+	return warnings, nil
+}
+
+// CompactPlanHandler reclaims the space a plan's dir uses for things nothing can reach anymore.
+// Only the owner can compact a plan, and not while it's running.
+func CompactPlanHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for CompactPlanHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+
+	log.Println("planId: ", planId)
+
+	plan := authorizePlan(w, planId, auth)
+	if plan == nil {
+		return
+	}
+
+	if plan.OwnerId != auth.User.Id {
+		log.Println("Only the plan owner can compact a plan")
+		http.Error(w, "Only the plan owner can compact a plan", http.StatusForbidden)
+		return
+	}
+
+	var err error
+
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepoBranch(w, auth, planId, "main", db.LockScopeWrite, ctx, cancel)
+	if unlockFn == nil {
+		return
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	branches, err := db.ListBranchesForPlans(auth.OrgId, []string{planId})
+
+	if err != nil {
+		log.Printf("Error getting branches: %v\n", err)
+		http.Error(w, "Error getting branches: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if getPlanRunStatus(branches, isBranchActive) == shared.PlanRunStatusRunning {
+		log.Println("Plan is running")
+		http.Error(w, "Can't compact a plan while it's running", http.StatusConflict)
+		return
+	}
+
+	res, err := db.CompactPlan(auth.OrgId, planId)
+
+	if err != nil {
+		log.Printf("Error compacting plan: %v\n", err)
+		http.Error(w, "Error compacting plan: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	bytes, err := json.Marshal(res)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Printf("Successfully compacted plan %s, reclaimed %d bytes\n", planId, res.BytesReclaimed)
+}
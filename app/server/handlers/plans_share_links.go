@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"plandex-server/db"
+	"plandex-server/logger"
+	"plandex-server/types"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/plandex/plandex/shared"
+)
+
+func CreatePlanShareLinkHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for CreatePlanShareLinkHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+
+	log.Println("planId: ", planId)
+
+	plan := authorizePlanShareManage(w, planId, auth)
+	if plan == nil {
+		return
+	}
+
+	var req shared.CreatePlanShareLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Error parsing request body: %v\n", err)
+		http.Error(w, "Error parsing request body", http.StatusBadRequest)
+		return
+	}
+
+	expiresInHours := req.ExpiresInHours
+	if expiresInHours == 0 {
+		expiresInHours = shared.DefaultPlanShareLinkHours
+	}
+
+	if expiresInHours < 0 || expiresInHours > shared.MaxPlanShareLinkHours {
+		log.Printf("Invalid share link expiration: %d hours\n", expiresInHours)
+		http.Error(w, fmt.Sprintf("expiresInHours must be between 1 and %d", shared.MaxPlanShareLinkHours), http.StatusBadRequest)
+		return
+	}
+
+	expiresAt := time.Now().Add(time.Duration(expiresInHours) * time.Hour)
+
+	link, token, err := db.CreatePlanShareLink(auth.OrgId, plan.Id, auth.User.Id, expiresAt)
+
+	if err != nil {
+		log.Printf("Error creating share link: %v\n", err)
+		http.Error(w, "Error creating share link: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := shared.CreatePlanShareLinkResponse{
+		Link:  link.ToApi(),
+		Token: token,
+	}
+
+	bytes, err := json.Marshal(resp)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Println("Successfully created share link for plan", plan.Id)
+}
+
+func ListPlanShareLinksHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for ListPlanShareLinksHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+
+	log.Println("planId: ", planId)
+
+	plan := authorizePlanShareManage(w, planId, auth)
+	if plan == nil {
+		return
+	}
+
+	links, err := db.ListActivePlanShareLinks(plan.Id)
+
+	if err != nil {
+		log.Printf("Error listing share links: %v\n", err)
+		http.Error(w, "Error listing share links: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apiLinks := []*shared.PlanShareLink{}
+	for _, link := range links {
+		apiLinks = append(apiLinks, link.ToApi())
+	}
+
+	bytes, err := json.Marshal(apiLinks)
+
+	if err != nil {
+		log.Printf("Error marshalling share links: %v\n", err)
+		http.Error(w, "Error marshalling share links: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+}
+
+func RevokePlanShareLinkHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for RevokePlanShareLinkHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+	linkId := vars["linkId"]
+
+	log.Println("planId: ", planId, "linkId: ", linkId)
+
+	plan := authorizePlanShareManage(w, planId, auth)
+	if plan == nil {
+		return
+	}
+
+	revoked, err := db.RevokePlanShareLink(plan.Id, linkId)
+
+	if err != nil {
+		log.Printf("Error revoking share link: %v\n", err)
+		http.Error(w, "Error revoking share link: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !revoked {
+		log.Println("Share link not found")
+		http.Error(w, "Share link not found", http.StatusNotFound)
+		return
+	}
+
+	log.Println("Successfully revoked share link", linkId)
+}
+
+func authorizePlanShareManage(w http.ResponseWriter, planId string, auth *types.ServerAuth) *db.Plan {
+	plan := authorizePlan(w, planId, auth)
+
+	if plan == nil {
+		return nil
+	}
+
+	if plan.OwnerId != auth.User.Id && !auth.HasPermission(types.PermissionManageAnyPlanShares) {
+		log.Println("User does not have permission to manage plan share links")
+		http.Error(w, "User does not have permission to manage plan share links", http.StatusForbidden)
+		return nil
+	}
+
+	return plan
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"plandex-server/db"
+	"plandex-server/logger"
+	modelPlan "plandex-server/model/plan"
+
+	"github.com/google/uuid"
+	"github.com/plandex/plandex/shared"
+)
+
+const maxPlanStatusIds = 500
+
+// GetPlanStatusesHandler returns the overall status of each requested plan, so clients polling
+// many plans don't need a request per plan. All branches are loaded in one query.
+func GetPlanStatusesHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for GetPlanStatusesHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	var req shared.GetPlanStatusesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Error parsing request body: %v\n", err)
+		http.Error(w, "Error parsing request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.PlanIds) > maxPlanStatusIds {
+		log.Printf("Too many plan ids: %d\n", len(req.PlanIds))
+		http.Error(w, fmt.Sprintf("At most %d plan ids can be requested at once", maxPlanStatusIds), http.StatusBadRequest)
+		return
+	}
+
+	var planIds []string
+	seen := map[string]bool{}
+
+	for _, planId := range req.PlanIds {
+		if seen[planId] {
+			continue
+		}
+		seen[planId] = true
+
+		if _, err := uuid.Parse(planId); err != nil {
+			continue
+		}
+
+		plan, err := db.ValidatePlanAccessCached(planId, auth.User.Id, auth.OrgId)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+
+		// one plan that can't be loaded is left out rather than failing the batch
+		if err != nil {
+			log.Printf("Error validating plan access for %s, skipping: %v\n", planId, err)
+			continue
+		}
+
+		if plan != nil {
+			planIds = append(planIds, plan.Id)
+		}
+	}
+
+	res := shared.GetPlanStatusesResponse{}
+
+	if len(planIds) > 0 {
+		branches, err := db.ListBranchesForPlans(auth.OrgId, planIds)
+
+		if err != nil {
+			log.Printf("Error getting branches: %v\n", err)
+			http.Error(w, "Error getting branches: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		branchesByPlanId := map[string][]*db.Branch{}
+		for _, branch := range branches {
+			branchesByPlanId[branch.PlanId] = append(branchesByPlanId[branch.PlanId], branch)
+		}
+
+		for _, planId := range planIds {
+			res[planId] = getPlanRunStatus(branchesByPlanId[planId], isBranchActive)
+		}
+	}
+
+	bytes, err := json.Marshal(res)
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Printf("Successfully got statuses for %d plans\n", len(res))
+}
+
+func isBranchActive(planId, branch string) bool {
+	return modelPlan.GetActivePlan(planId, branch) != nil
+}
+
+// getPlanRunStatus is running if any branch is running, either on this host or, by its stored
+// status, on another one. Otherwise it follows the most recently updated branch.
+func getPlanRunStatus(branches []*db.Branch, isActive func(planId, branch string) bool) shared.PlanRunStatus {
+	current, running := getPlanCurrentBranch(branches, isActive)
+
+	if running {
+		return shared.PlanRunStatusRunning
+	}
+
+	if current == nil {
+		return shared.PlanRunStatusIdle
+	}
+
+	switch current.Status {
+	case shared.PlanStatusError, shared.PlanStatusInterrupted:
+		return shared.PlanRunStatusError
+	case shared.PlanStatusFinished:
+		return shared.PlanRunStatusCompleted
+	}
+
+	return shared.PlanRunStatusIdle
+}
+
+// getPlanCurrentBranch returns the first running branch, or if none is running, the most recently
+// updated one. Deleted branches are skipped. Nil if there are no branches.
+func getPlanCurrentBranch(branches []*db.Branch, isActive func(planId, branch string) bool) (*db.Branch, bool) {
+	var latest *db.Branch
+
+	for _, branch := range branches {
+		if branch.DeletedAt != nil {
+			continue
+		}
+
+		if isActive(branch.PlanId, branch.Name) {
+			return branch, true
+		}
+
+		switch branch.Status {
+		case shared.PlanStatusReplying, shared.PlanStatusDescribing, shared.PlanStatusBuilding, shared.PlanStatusMissingFile:
+			return branch, true
+		}
+
+		if latest == nil || branch.UpdatedAt.After(latest.UpdatedAt) {
+			latest = branch
+		}
+	}
+
+	return latest, false
+}
+
+// setPlanRunStates sets the status and current branch of each plan from branches, which are for
+// the whole batch of plans
+func setPlanRunStates(apiPlans []*shared.Plan, branches []*db.Branch, isActive func(planId, branch string) bool, includeStatus, includeBranch bool) {
+	branchesByPlanId := map[string][]*db.Branch{}
+	for _, branch := range branches {
+		branchesByPlanId[branch.PlanId] = append(branchesByPlanId[branch.PlanId], branch)
+	}
+
+	for _, apiPlan := range apiPlans {
+		planBranches := branchesByPlanId[apiPlan.Id]
+
+		if includeStatus {
+			apiPlan.Status = getPlanRunStatus(planBranches, isActive)
+		}
+
+		if includeBranch {
+			if current, _ := getPlanCurrentBranch(planBranches, isActive); current != nil {
+				apiPlan.Branch = current.ToApi()
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"plandex-server/db"
+	"testing"
+	"time"
+
+	"github.com/plandex/plandex/shared"
+)
+
+func TestGetPlanRunStatus(t *testing.T) {
+	now := time.Now()
+	notActive := func(planId, branch string) bool { return false }
+
+	branch := func(name string, status shared.PlanStatus, updatedAt time.Time) *db.Branch {
+		return &db.Branch{PlanId: "plan", Name: name, Status: status, UpdatedAt: updatedAt}
+	}
+
+	tests := []struct {
+		name     string
+		branches []*db.Branch
+		isActive func(planId, branch string) bool
+		want     shared.PlanRunStatus
+	}{
+		{"no branches", nil, notActive, shared.PlanRunStatusIdle},
+		{"draft", []*db.Branch{branch("main", shared.PlanStatusDraft, now)}, notActive, shared.PlanRunStatusIdle},
+		{"finished", []*db.Branch{branch("main", shared.PlanStatusFinished, now)}, notActive, shared.PlanRunStatusCompleted},
+		{"interrupted", []*db.Branch{branch("main", shared.PlanStatusInterrupted, now)}, notActive, shared.PlanRunStatusError},
+		{
+			"latest branch wins",
+			[]*db.Branch{
+				branch("main", shared.PlanStatusError, now.Add(-time.Hour)),
+				branch("other", shared.PlanStatusFinished, now),
+			},
+			notActive,
+			shared.PlanRunStatusCompleted,
+		},
+		{
+			"any running branch",
+			[]*db.Branch{
+				branch("main", shared.PlanStatusBuilding, now.Add(-time.Hour)),
+				branch("other", shared.PlanStatusFinished, now),
+			},
+			notActive,
+			shared.PlanRunStatusRunning,
+		},
+		{
+			"active on this host",
+			[]*db.Branch{branch("main", shared.PlanStatusFinished, now)},
+			func(planId, branch string) bool { return branch == "main" },
+			shared.PlanRunStatusRunning,
+		},
+	}
+
+	for _, tt := range tests {
+		if got := getPlanRunStatus(tt.branches, tt.isActive); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSetPlanRunStates(t *testing.T) {
+	now := time.Now()
+	notActive := func(planId, branch string) bool { return false }
+
+	branches := []*db.Branch{
+		{PlanId: "a", Name: "main", Status: shared.PlanStatusFinished, UpdatedAt: now.Add(-time.Hour)},
+		{PlanId: "a", Name: "other", Status: shared.PlanStatusError, UpdatedAt: now},
+		{PlanId: "b", Name: "main", Status: shared.PlanStatusBuilding, UpdatedAt: now.Add(-time.Hour)},
+		{PlanId: "b", Name: "other", Status: shared.PlanStatusFinished, UpdatedAt: now},
+	}
+
+	apiPlans := []*shared.Plan{{Id: "a"}, {Id: "b"}, {Id: "c"}}
+	setPlanRunStates(apiPlans, branches, notActive, true, true)
+
+	want := []struct {
+		status shared.PlanRunStatus
+		branch string
+	}{
+		{shared.PlanRunStatusError, "other"},
+		{shared.PlanRunStatusRunning, "main"},
+		{shared.PlanRunStatusIdle, ""},
+	}
+
+	for i, apiPlan := range apiPlans {
+		if apiPlan.Status != want[i].status {
+			t.Errorf("%s: got status %s, want %s", apiPlan.Id, apiPlan.Status, want[i].status)
+		}
+
+		var branch string
+		if apiPlan.Branch != nil {
+			branch = apiPlan.Branch.Name
+		}
+		if branch != want[i].branch {
+			t.Errorf("%s: got branch %q, want %q", apiPlan.Id, branch, want[i].branch)
+		}
+	}
+
+	// includes are independent
+	apiPlans = []*shared.Plan{{Id: "a"}}
+	setPlanRunStates(apiPlans, branches, notActive, false, true)
+
+	if apiPlans[0].Status != "" || apiPlans[0].Branch == nil {
+		t.Errorf("branch only: got status %q, branch %v", apiPlans[0].Status, apiPlans[0].Branch)
+	}
+}
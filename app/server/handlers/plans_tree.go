@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"plandex-server/db"
+	"plandex-server/logger"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+func GetPlanFileTreeHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for GetPlanFileTreeHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+
+	log.Println("planId: ", planId)
+
+	branch := r.URL.Query().Get("branch")
+	if branch == "" {
+		branch = "main"
+	}
+
+	depth := 0
+	if depthStr := r.URL.Query().Get("depth"); depthStr != "" {
+		var err error
+		depth, err = strconv.Atoi(depthStr)
+		if err != nil || depth < 1 {
+			log.Println("Invalid depth param")
+			http.Error(w, "depth must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	filter := db.PlanFileTreeFilter{
+		Glob: r.URL.Query().Get("glob"),
+		Type: r.URL.Query().Get("type"),
+	}
+
+	if extStr := r.URL.Query().Get("ext"); extStr != "" {
+		for _, ext := range strings.Split(extStr, ",") {
+			ext = strings.TrimSpace(ext)
+			if ext == "" {
+				continue
+			}
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			filter.Exts = append(filter.Exts, ext)
+		}
+	}
+
+	if filter.Glob != "" {
+		if err := db.ValidateTreeGlob(filter.Glob); err != nil {
+			log.Printf("Invalid glob param: %v\n", err)
+			http.Error(w, "Invalid glob: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if filter.Type != "" && filter.Type != "file" && filter.Type != "dir" {
+		log.Println("Invalid type param")
+		http.Error(w, "type must be 'file' or 'dir'", http.StatusBadRequest)
+		return
+	}
+
+	if authorizePlan(w, planId, auth) == nil {
+		return
+	}
+
+	var err error
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepoBranch(w, auth, planId, branch, db.LockScopeRead, ctx, cancel)
+	if unlockFn == nil {
+		return
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	entries, err := db.GetPlanFileTree(auth.OrgId, planId, depth, filter)
+
+	if err != nil {
+		log.Printf("Error getting plan file tree: %v\n", err)
+		http.Error(w, "Error getting plan file tree: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// write the array an entry at a time so large trees don't need to be marshalled in one buffer
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+
+	w.Write([]byte("["))
+	for i, entry := range entries {
+		if i > 0 {
+			w.Write([]byte(","))
+		}
+		if err := enc.Encode(entry); err != nil {
+			log.Printf("Error writing tree entry: %v\n", err)
+			return
+		}
+		if flusher != nil && i > 0 && i%500 == 0 {
+			flusher.Flush()
+		}
+	}
+	w.Write([]byte("]"))
+
+	log.Println("Successfully processed GetPlanFileTreeHandler request")
+}
@@ -7,13 +7,14 @@ import (
 	"log"
 	"net/http"
 	"plandex-server/db"
+	"plandex-server/logger"
 
 	"github.com/gorilla/mux"
 	"github.com/plandex/plandex/shared"
 )
 
 func ListLogsHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for ListLogsHandler")
+	logger.Debugln("Received request for ListLogsHandler")
 
 	auth := authenticate(w, r, true)
 	if auth == nil {
@@ -68,7 +69,7 @@ func ListLogsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func RewindPlanHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for RewindPlanHandler")
+	logger.Debugln("Received request for RewindPlanHandler")
 
 	auth := authenticate(w, r, true)
 	if auth == nil {
@@ -152,3 +153,131 @@ func RewindPlanHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Println("Successfully processed request for RewindPlanHandler")
 }
+
+func ListPlanVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for ListPlanVersionsHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+	branch := vars["branch"]
+
+	log.Println("planId: ", planId, "branch: ", branch)
+
+	if authorizePlan(w, planId, auth) == nil {
+		return
+	}
+
+	var err error
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepo(w, r, auth, db.LockScopeRead, ctx, cancel, true)
+	if unlockFn == nil {
+		return
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	versions, err := db.ListPlanVersions(auth.OrgId, planId)
+
+	if err != nil {
+		log.Printf("Error listing plan versions: %v\n", err)
+		http.Error(w, "Error listing plan versions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	bytes, err := json.Marshal(versions)
+
+	if err != nil {
+		log.Printf("Error marshalling plan versions: %v\n", err)
+		http.Error(w, "Error marshalling plan versions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Println("Successfully processed request for ListPlanVersionsHandler")
+}
+
+// RestorePlanVersionHandler is a non-destructive alternative to RewindPlanHandler. The plan goes
+// back to the chosen version as a new commit, so later versions stay in the history.
+func RestorePlanVersionHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for RestorePlanVersionHandler")
+
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	planId := vars["planId"]
+	branch := vars["branch"]
+
+	log.Println("planId: ", planId, "branch: ", branch)
+
+	if authorizePlanUpdate(w, planId, auth) == nil {
+		return
+	}
+
+	var req shared.RestorePlanVersionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Error parsing request body: %v\n", err)
+		http.Error(w, "Error parsing request body", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	ctx, cancel := context.WithCancel(context.Background())
+	unlockFn := lockRepo(w, r, auth, db.LockScopeWrite, ctx, cancel, true)
+	if unlockFn == nil {
+		return
+	} else {
+		defer func() {
+			(*unlockFn)(err)
+		}()
+	}
+
+	version, changed, err := db.RestorePlanVersion(auth.OrgId, planId, req.Sha)
+
+	if err == db.ErrUnknownCommit {
+		log.Printf("Unknown version: %s\n", req.Sha)
+		http.Error(w, "Version not found: "+req.Sha, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		log.Printf("Error restoring plan version: %v\n", err)
+		http.Error(w, "Error restoring plan version: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if changed {
+		err = db.SyncPlanTokens(auth.OrgId, planId, branch)
+
+		if err != nil {
+			log.Printf("Error syncing plan tokens: %v\n", err)
+			http.Error(w, "Error syncing plan tokens: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	bytes, err := json.Marshal(shared.RestorePlanVersionResponse{
+		Changed: changed,
+		Version: version,
+	})
+
+	if err != nil {
+		log.Printf("Error marshalling response: %v\n", err)
+		http.Error(w, "Error marshalling response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+	log.Println("Successfully processed request for RestorePlanVersionHandler")
+}
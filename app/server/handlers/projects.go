@@ -6,13 +6,14 @@ import (
 	"log"
 	"net/http"
 	"plandex-server/db"
+	"plandex-server/logger"
 
 	"github.com/gorilla/mux"
 	"github.com/plandex/plandex/shared"
 )
 
 func CreateProjectHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for CreateProjectHandler")
+	logger.Debugln("Received request for CreateProjectHandler")
 
 	auth := authenticate(w, r, true)
 	if auth == nil {
@@ -93,7 +94,7 @@ func CreateProjectHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func ListProjectsHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for ListProjectsHandler")
+	logger.Debugln("Received request for ListProjectsHandler")
 
 	auth := authenticate(w, r, true)
 	if auth == nil {
@@ -132,7 +133,7 @@ func ListProjectsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func ProjectSetPlanHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for UpdateProjectSetPlanHandler")
+	logger.Debugln("Received request for UpdateProjectSetPlanHandler")
 	auth := authenticate(w, r, true)
 	if auth == nil {
 		return
@@ -181,7 +182,7 @@ func ProjectSetPlanHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func RenameProjectHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for RenameProjectHandler")
+	logger.Debugln("Received request for RenameProjectHandler")
 	auth := authenticate(w, r, true)
 	if auth == nil {
 		return
@@ -243,3 +244,55 @@ func RenameProjectHandler(w http.ResponseWriter, r *http.Request) {
 	log.Println("Successfully renamed project", projectId)
 
 }
+
+func UpdateProjectSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Debugln("Received request for UpdateProjectSettingsHandler")
+	auth := authenticate(w, r, true)
+	if auth == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	projectId := vars["projectId"]
+
+	log.Println("projectId: ", projectId)
+
+	if !authorizeProjectSettings(w, projectId, auth) {
+		return
+	}
+
+	var requestBody shared.UpdateProjectSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		log.Printf("Error parsing request body: %v\n", err)
+		http.Error(w, "Error parsing request body", http.StatusBadRequest)
+		return
+	}
+
+	if requestBody.DefaultPlanVisibility == nil {
+		log.Println("No settings to update")
+		http.Error(w, "No settings to update", http.StatusBadRequest)
+		return
+	}
+
+	if err := validatePlanVisibility(*requestBody.DefaultPlanVisibility); err != nil {
+		log.Printf("Invalid default plan visibility: %v\n", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	found, err := db.SetProjectDefaultPlanVisibility(auth.OrgId, projectId, *requestBody.DefaultPlanVisibility)
+
+	if err != nil {
+		log.Printf("Error updating project settings: %v\n", err)
+		http.Error(w, "Error updating project settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !found {
+		log.Printf("Project not found: %v\n", projectId)
+		http.Error(w, "Project not found: "+projectId, http.StatusNotFound)
+		return
+	}
+
+	log.Println("Successfully updated project settings", projectId)
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/google/uuid"
+	"github.com/plandex/plandex/shared"
+)
+
+const requestIdHeader = "X-Request-Id"
+
+// RecoverMiddleware turns a panic in a handler into a logged stack trace and a 500 ApiError
+// instead of a dropped connection. Each request gets a request id (taken from X-Request-Id if
+// the client sent one) that's echoed in the response header and included in the log and error.
+// Panics in goroutines started by a handler aren't caught here.
+func RecoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId := r.Header.Get(requestIdHeader)
+		if requestId == "" {
+			requestId = uuid.New().String()
+		}
+		w.Header().Set(requestIdHeader, requestId)
+
+		rw := &recoverResponseWriter{ResponseWriter: w}
+
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+
+			// used by net/http to abort a response on purpose, so let it through
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			log.Printf("Recovered from panic in %s %s, request id: %s: %v\n", r.Method, r.URL.Path, requestId, rec)
+			log.Printf("Stack trace: %s\n", debug.Stack())
+
+			if rw.wroteHeader {
+				// too late to change the status, so the client just sees a truncated response
+				log.Printf("Response already started for request id %s, can't write error\n", requestId)
+				return
+			}
+
+			writeApiError(rw, shared.ApiError{
+				Type:   shared.ApiErrorTypeOther,
+				Status: http.StatusInternalServerError,
+				Msg:    fmt.Sprintf("Internal server error (request id: %s)", requestId),
+			})
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+type recoverResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *recoverResponseWriter) WriteHeader(status int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recoverResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// streaming handlers type-assert http.Flusher, so pass it through
+func (w *recoverResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wroteHeader = true
+		flusher.Flush()
+	}
+}
+
+func (w *recoverResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/plandex/plandex/shared"
+)
+
+func TestRecoverMiddleware(t *testing.T) {
+	handler := RecoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]int
+		m["boom"] = 1
+	}))
+
+	req := httptest.NewRequest("GET", "/plans", nil)
+	req.Header.Set(requestIdHeader, "req-1")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", rec.Code)
+	}
+
+	if got := rec.Header().Get(requestIdHeader); got != "req-1" {
+		t.Errorf("expected request id header req-1, got %q", got)
+	}
+
+	var apiErr shared.ApiError
+	err := json.Unmarshal(rec.Body.Bytes(), &apiErr)
+	if err != nil {
+		t.Fatalf("error unmarshalling response: %v", err)
+	}
+
+	if apiErr.Status != http.StatusInternalServerError || apiErr.Type != shared.ApiErrorTypeOther {
+		t.Errorf("unexpected api error: %+v", apiErr)
+	}
+}
+
+func TestRecoverMiddlewareAfterWrite(t *testing.T) {
+	handler := RecoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic("boom")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/plans", nil))
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "partial" {
+		t.Errorf("expected the partial response to be left alone, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	if rec.Header().Get(requestIdHeader) == "" {
+		t.Errorf("expected a generated request id")
+	}
+}
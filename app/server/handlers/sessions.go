@@ -9,13 +9,14 @@ import (
 	"net/http"
 	"plandex-server/db"
 	"plandex-server/email"
+	"plandex-server/logger"
 	"strings"
 
 	"github.com/plandex/plandex/shared"
 )
 
 func CreateEmailVerificationHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for CreateEmailVerificationHandler")
+	logger.Debugln("Received request for CreateEmailVerificationHandler")
 
 	// read the request body
 	body, err := io.ReadAll(r.Body)
@@ -96,7 +97,7 @@ func CreateEmailVerificationHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func SignInHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for SignInHandler")
+	logger.Debugln("Received request for SignInHandler")
 
 	// read the request body
 	body, err := io.ReadAll(r.Body)
@@ -224,7 +225,7 @@ func SignInHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func SignOutHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for SignOutHandler")
+	logger.Debugln("Received request for SignOutHandler")
 
 	auth := authenticate(w, r, false)
 	if auth == nil {
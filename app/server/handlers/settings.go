@@ -7,6 +7,7 @@ import (
 	"log"
 	"net/http"
 	"plandex-server/db"
+	"plandex-server/logger"
 	"reflect"
 	"strings"
 
@@ -15,7 +16,7 @@ import (
 )
 
 func GetSettingsHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for GetSettingsHandler")
+	logger.Debugln("Received request for GetSettingsHandler")
 
 	auth := authenticate(w, r, true)
 	if auth == nil {
@@ -66,7 +67,7 @@ func GetSettingsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func UpdateSettingsHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Received request for UpdateSettingsHandler")
+	logger.Debugln("Received request for UpdateSettingsHandler")
 
 	auth := authenticate(w, r, true)
 	if auth == nil {
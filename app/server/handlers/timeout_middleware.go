@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// handlerTimeouts are the per-handler limits on how long a request can take, by handler name.
+// Handlers not listed get defaultHandlerTimeout. A 0 is no limit, which streaming handlers need
+// even when there's a default.
+//
+// PLANDEX_HANDLER_TIMEOUT sets the default, which is no limit. PLANDEX_HANDLER_TIMEOUTS
+// overrides these with comma-separated name=duration pairs, like
+// "ListPlansHandler=5s,ExportPlansHandler=0".
+var handlerTimeouts = map[string]time.Duration{
+	// quick reads that should never take long
+	"ListPlansHandler":                15 * time.Second,
+	"GetPlanHandler":                  15 * time.Second,
+	"GetPlanStatusesHandler":          10 * time.Second,
+	"GetCurrentBranchByPlanIdHandler": 10 * time.Second,
+	"ListBranchesHandler":             15 * time.Second,
+	"GetSettingsHandler":              10 * time.Second,
+
+	// streams that can run for as long as a plan does, or as long as a large export takes
+	"TellPlanHandler":        0,
+	"BuildPlanHandler":       0,
+	"ConnectPlanHandler":     0,
+	"StreamPlanConvoHandler": 0,
+	"SubscribePlansHandler":  0,
+	"ExportPlansHandler":     0,
+	"ExportPlansCSVHandler":  0,
+	"UploadContextHandler":   0,
+}
+
+var defaultHandlerTimeout time.Duration
+
+func init() {
+	if s := os.Getenv("PLANDEX_HANDLER_TIMEOUT"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			panic(fmt.Errorf("PLANDEX_HANDLER_TIMEOUT must be a duration >= 0, got: %s", s))
+		}
+		defaultHandlerTimeout = d
+	}
+
+	if s := os.Getenv("PLANDEX_HANDLER_TIMEOUTS"); s != "" {
+		overrides, err := parseHandlerTimeouts(s)
+		if err != nil {
+			panic(fmt.Errorf("invalid PLANDEX_HANDLER_TIMEOUTS: %v", err))
+		}
+		for name, d := range overrides {
+			handlerTimeouts[name] = d
+		}
+	}
+}
+
+// parseHandlerTimeouts parses comma-separated name=duration pairs
+func parseHandlerTimeouts(s string) (map[string]time.Duration, error) {
+	res := map[string]time.Duration{}
+
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		name, durStr, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("expected name=duration, got '%s'", pair)
+		}
+
+		d, err := time.ParseDuration(strings.TrimSpace(durStr))
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid duration for %s: '%s'", name, durStr)
+		}
+
+		res[name] = d
+	}
+
+	return res, nil
+}
+
+// TimeoutMiddleware limits each request to its handler's timeout. The request's context is
+// cancelled and writes fail once it passes, so the client sees the response cut off. A handler's
+// name is its route's name if it has one, otherwise its function's name.
+func TimeoutMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout := defaultHandlerTimeout
+		if route := mux.CurrentRoute(r); route != nil {
+			if d, ok := handlerTimeouts[routeHandlerName(route)]; ok {
+				timeout = d
+			}
+		}
+
+		if timeout == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout))
+		if err != nil {
+			log.Printf("Error setting write deadline for %s: %v\n", r.URL.Path, err)
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+var routeHandlerNames sync.Map
+
+func routeHandlerName(route *mux.Route) string {
+	if name := route.GetName(); name != "" {
+		return name
+	}
+
+	if name, ok := routeHandlerNames.Load(route); ok {
+		return name.(string)
+	}
+
+	name := ""
+	if handler := route.GetHandler(); handler != nil {
+		if v := reflect.ValueOf(handler); v.Kind() == reflect.Func {
+			// like "plandex-server/handlers.ListPlansHandler"
+			fullName := runtime.FuncForPC(v.Pointer()).Name()
+			name = fullName[strings.LastIndex(fullName, ".")+1:]
+		}
+	}
+
+	routeHandlerNames.Store(route, name)
+
+	return name
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseHandlerTimeouts(t *testing.T) {
+	got, err := parseHandlerTimeouts(" ListPlansHandler = 5s, ExportPlansHandler=0,,")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 timeouts, got %d", len(got))
+	}
+	if got["ListPlansHandler"] != 5*time.Second {
+		t.Errorf("expected ListPlansHandler=5s, got %v", got["ListPlansHandler"])
+	}
+	if d, ok := got["ExportPlansHandler"]; !ok || d != 0 {
+		t.Errorf("expected ExportPlansHandler=0, got %v", d)
+	}
+
+	for _, s := range []string{"ListPlansHandler", "=5s", "ListPlansHandler=soon", "ListPlansHandler=-1s"} {
+		if _, err := parseHandlerTimeouts(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
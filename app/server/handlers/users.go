@@ -200,5 +200,7 @@ func DeleteOrgUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	db.InvalidateOrgUserAuthCache(auth.OrgId, userId)
+
 	log.Println("Successfully processed request for DeleteOrgUserHandler")
 }
@@ -0,0 +1,92 @@
+package logger
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[string]Level{
+	"debug": LevelDebug,
+	"info":  LevelInfo,
+	"warn":  LevelWarn,
+	"error": LevelError,
+}
+
+var level atomic.Int32
+
+// PLANDEX_LOG_LEVEL sets the minimum level that's written. It defaults to debug in development
+// and info otherwise. Output goes through the standard logger, like the rest of the server's
+// logs, which are written regardless of level.
+func init() {
+	l := LevelInfo
+	if os.Getenv("GOENV") == "development" {
+		l = LevelDebug
+	}
+
+	if s := os.Getenv("PLANDEX_LOG_LEVEL"); s != "" {
+		var err error
+		l, err = ParseLevel(s)
+		if err != nil {
+			panic(fmt.Errorf("PLANDEX_LOG_LEVEL %v", err))
+		}
+	}
+
+	SetLevel(l)
+}
+
+func ParseLevel(s string) (Level, error) {
+	l, ok := levelNames[strings.ToLower(strings.TrimSpace(s))]
+	if !ok {
+		return 0, fmt.Errorf("must be one of debug, info, warn, or error, got: %s", s)
+	}
+	return l, nil
+}
+
+func SetLevel(l Level) {
+	level.Store(int32(l))
+}
+
+func Enabled(l Level) bool {
+	return l >= Level(level.Load())
+}
+
+func Debugln(v ...any) { logln(LevelDebug, v...) }
+
+func Debugf(format string, v ...any) { logf(LevelDebug, format, v...) }
+
+func Infoln(v ...any) { logln(LevelInfo, v...) }
+
+func Infof(format string, v ...any) { logf(LevelInfo, format, v...) }
+
+func Warnln(v ...any) { logln(LevelWarn, v...) }
+
+func Warnf(format string, v ...any) { logf(LevelWarn, format, v...) }
+
+func Errorln(v ...any) { logln(LevelError, v...) }
+
+func Errorf(format string, v ...any) { logf(LevelError, format, v...) }
+
+func logln(l Level, v ...any) {
+	if Enabled(l) {
+		// 3 skips logln and the level func, so log.Lshortfile points at the caller
+		log.Default().Output(3, fmt.Sprintln(v...))
+	}
+}
+
+func logf(l Level, format string, v ...any) {
+	if Enabled(l) {
+		log.Default().Output(3, fmt.Sprintf(format, v...))
+	}
+}
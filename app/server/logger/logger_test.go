@@ -0,0 +1,46 @@
+package logger
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	for s, want := range map[string]Level{"debug": LevelDebug, "INFO": LevelInfo, " warn ": LevelWarn, "error": LevelError} {
+		got, err := ParseLevel(s)
+		if err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Errorf("expected an error for an unknown level")
+	}
+}
+
+func TestLevelFiltering(t *testing.T) {
+	var buf bytes.Buffer
+	out, flags, prev := log.Writer(), log.Flags(), Level(level.Load())
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(out)
+		log.SetFlags(flags)
+		SetLevel(prev)
+	}()
+
+	SetLevel(LevelInfo)
+	Debugln("hidden")
+	Infof("shown %d", 1)
+	Errorln("shown", 2)
+
+	got := buf.String()
+	if strings.Contains(got, "hidden") {
+		t.Errorf("debug line written at info level: %q", got)
+	}
+	if got != "shown 1\nshown 2\n" {
+		t.Errorf("unexpected output: %q", got)
+	}
+}
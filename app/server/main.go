@@ -9,6 +9,7 @@ import (
 	"plandex-server/db"
 	"plandex-server/host"
 	"plandex-server/model/plan"
+	"plandex-server/notify"
 	"syscall"
 	"time"
 
@@ -31,6 +32,25 @@ func main() {
 		log.Fatal("Error running migrations: ", err)
 	}
 
+	numMoved, err := db.RelayoutPlanDirs()
+	if err != nil {
+		log.Fatal("Error moving plan dirs into the configured layout: ", err)
+	}
+	if numMoved > 0 {
+		log.Printf("Moved %d plan dirs into the configured layout\n", numMoved)
+	}
+
+	numReconciled, err := db.ReconcileInterruptedPlans(host.Ip)
+	if err != nil {
+		log.Fatal("Error reconciling interrupted plans: ", err)
+	}
+	log.Printf("Reconciled %d interrupted plan branches\n", numReconciled)
+
+	db.StartPlanRetentionJob()
+	db.StartCacheStatsLogger()
+	notify.StartPlanNotifier()
+	notify.StartPlanAuditNotifier()
+
 	if os.Getenv("GOENV") == "development" {
 		log.Println("In development mode.")
 	}
@@ -0,0 +1,14 @@
+ALTER TABLE orgs ADD COLUMN default_project_id UUID REFERENCES projects(id) ON DELETE SET NULL;
+
+INSERT INTO permissions (name, description) VALUES
+  ('manage_org_settings', 'Manage an org''s settings');
+
+INSERT INTO org_roles_permissions (org_role_id, permission_id)
+SELECT
+    r.id AS org_role_id,
+    p.id AS permission_id
+FROM
+    org_roles r, permissions p
+WHERE
+    r.org_id IS NULL AND r.name IN ('owner', 'admin')
+    AND p.name = 'manage_org_settings';
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS plan_share_links (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  org_id UUID NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+  plan_id UUID NOT NULL REFERENCES plans(id) ON DELETE CASCADE,
+  creator_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  token_hash VARCHAR(64) NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  revoked_at TIMESTAMP,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX plan_share_links_token_idx ON plan_share_links(token_hash);
+CREATE INDEX plan_share_links_plan_idx ON plan_share_links(plan_id, revoked_at, expires_at);
@@ -0,0 +1 @@
+ALTER TABLE orgs DROP COLUMN max_plan_name_suffix;
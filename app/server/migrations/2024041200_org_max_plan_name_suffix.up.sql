@@ -0,0 +1 @@
+ALTER TABLE orgs ADD COLUMN max_plan_name_suffix INTEGER;
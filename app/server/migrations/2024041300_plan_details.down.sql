@@ -0,0 +1,3 @@
+ALTER TABLE plans DROP COLUMN pinned;
+ALTER TABLE plans DROP COLUMN tags;
+ALTER TABLE plans DROP COLUMN description;
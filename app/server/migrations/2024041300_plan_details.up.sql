@@ -0,0 +1,3 @@
+ALTER TABLE plans ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE plans ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE plans ADD COLUMN pinned BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS plans_archived_at_idx;
+DROP INDEX IF EXISTS plans_updated_at_idx;
+
+ALTER TABLE orgs DROP COLUMN auto_delete_after_days;
+ALTER TABLE orgs DROP COLUMN auto_archive_after_days;
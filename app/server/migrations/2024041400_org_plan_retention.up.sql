@@ -0,0 +1,5 @@
+ALTER TABLE orgs ADD COLUMN auto_archive_after_days INTEGER;
+ALTER TABLE orgs ADD COLUMN auto_delete_after_days INTEGER;
+
+CREATE INDEX plans_updated_at_idx ON plans(updated_at);
+CREATE INDEX plans_archived_at_idx ON plans(archived_at);
@@ -0,0 +1,2 @@
+ALTER TABLE orgs DROP COLUMN auto_prefix;
+ALTER TABLE orgs DROP COLUMN required_name_prefix;
@@ -0,0 +1,2 @@
+ALTER TABLE orgs ADD COLUMN required_name_prefix VARCHAR(255);
+ALTER TABLE orgs ADD COLUMN auto_prefix BOOLEAN NOT NULL DEFAULT FALSE;
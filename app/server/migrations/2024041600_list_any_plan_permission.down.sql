@@ -0,0 +1 @@
+DELETE FROM permissions WHERE name = 'list_any_plan';
@@ -0,0 +1,8 @@
+DROP TRIGGER update_plans_modtime ON plans;
+CREATE TRIGGER update_plans_modtime BEFORE UPDATE ON plans FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+DROP INDEX IF EXISTS plans_name_case_insensitive_idx;
+
+ALTER TABLE plans DROP COLUMN case_insensitive_name;
+
+ALTER TABLE orgs DROP COLUMN case_insensitive_plan_names;
@@ -0,0 +1,12 @@
+ALTER TABLE orgs ADD COLUMN case_insensitive_plan_names BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- copied from the org setting when a plan is created, and for all of an org's plans when the setting changes, so the index below only applies to orgs that opted in
+ALTER TABLE plans ADD COLUMN case_insensitive_name BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE UNIQUE INDEX plans_name_case_insensitive_idx ON plans(project_id, owner_id, LOWER(name)) WHERE case_insensitive_name AND name != 'draft';
+
+-- flipping the flag for an org's plans shouldn't count as touching them (retention uses updated_at)
+DROP TRIGGER update_plans_modtime ON plans;
+CREATE TRIGGER update_plans_modtime BEFORE UPDATE ON plans FOR EACH ROW
+WHEN (OLD.case_insensitive_name = NEW.case_insensitive_name)
+EXECUTE FUNCTION update_updated_at_column();
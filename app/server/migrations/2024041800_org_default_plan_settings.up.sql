@@ -0,0 +1 @@
+ALTER TABLE orgs ADD COLUMN default_plan_settings JSONB;
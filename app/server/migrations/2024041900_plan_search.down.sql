@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS plans_search_vector_idx;
+DROP TRIGGER IF EXISTS plans_search_vector_trigger ON plans;
+DROP FUNCTION IF EXISTS plans_search_vector_update();
+ALTER TABLE plans DROP COLUMN search_vector;
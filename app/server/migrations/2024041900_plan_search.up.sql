@@ -0,0 +1,22 @@
+ALTER TABLE plans ADD COLUMN search_vector tsvector;
+
+CREATE OR REPLACE FUNCTION plans_search_vector_update() RETURNS trigger AS $$
+BEGIN
+  NEW.search_vector :=
+    setweight(to_tsvector('simple', coalesce(NEW.name, '')), 'A') ||
+    setweight(to_tsvector('simple', coalesce(array_to_string(NEW.tags, ' '), '')), 'B') ||
+    setweight(to_tsvector('simple', coalesce(NEW.description, '')), 'C');
+  RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER plans_search_vector_trigger
+BEFORE INSERT OR UPDATE OF name, description, tags ON plans
+FOR EACH ROW EXECUTE FUNCTION plans_search_vector_update();
+
+-- backfill existing rows via the trigger, without bumping updated_at
+ALTER TABLE plans DISABLE TRIGGER update_plans_modtime;
+UPDATE plans SET name = name;
+ALTER TABLE plans ENABLE TRIGGER update_plans_modtime;
+
+CREATE INDEX plans_search_vector_idx ON plans USING GIN(search_vector);
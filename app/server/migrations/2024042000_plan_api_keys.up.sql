@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS plan_api_keys (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  org_id UUID NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+  plan_id UUID NOT NULL REFERENCES plans(id) ON DELETE CASCADE,
+  creator_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name VARCHAR(255) NOT NULL DEFAULT '',
+  scopes VARCHAR(32)[] NOT NULL,
+  token_hash VARCHAR(64) NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  revoked_at TIMESTAMP,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX plan_api_keys_token_idx ON plan_api_keys(token_hash);
+CREATE INDEX plan_api_keys_plan_idx ON plan_api_keys(plan_id, revoked_at, expires_at);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS plans_one_draft_idx;
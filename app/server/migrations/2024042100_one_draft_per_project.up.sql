@@ -0,0 +1,13 @@
+-- archive all but the most recently updated draft for each project and owner before enforcing one
+UPDATE plans SET archived_at = NOW()
+WHERE id IN (
+  SELECT id FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY org_id, project_id, owner_id ORDER BY updated_at DESC, created_at DESC) AS rn
+    FROM plans
+    WHERE name = 'draft' AND archived_at IS NULL
+  ) ranked
+  WHERE rn > 1
+);
+
+-- archived drafts are left out so that normalizing never has to delete anything
+CREATE UNIQUE INDEX plans_one_draft_idx ON plans(org_id, project_id, owner_id) WHERE name = 'draft' AND archived_at IS NULL;
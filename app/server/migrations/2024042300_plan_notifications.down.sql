@@ -0,0 +1,4 @@
+ALTER TABLE plans DROP COLUMN notify_webhook_url;
+ALTER TABLE plans DROP COLUMN notify_channel;
+ALTER TABLE plans DROP COLUMN notify_on_error;
+ALTER TABLE plans DROP COLUMN notify_on_complete;
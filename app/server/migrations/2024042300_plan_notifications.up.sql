@@ -0,0 +1,5 @@
+ALTER TABLE plans ADD COLUMN notify_on_complete BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE plans ADD COLUMN notify_on_error BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE plans ADD COLUMN notify_channel VARCHAR(16) NOT NULL DEFAULT 'email';
+-- only set for the webhook channel; email goes to the plan owner
+ALTER TABLE plans ADD COLUMN notify_webhook_url TEXT;
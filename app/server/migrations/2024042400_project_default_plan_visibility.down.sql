@@ -0,0 +1 @@
+ALTER TABLE projects DROP COLUMN default_plan_visibility;
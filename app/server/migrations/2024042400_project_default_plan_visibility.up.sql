@@ -0,0 +1 @@
+ALTER TABLE projects ADD COLUMN default_plan_visibility VARCHAR(16) NOT NULL DEFAULT 'private';
@@ -0,0 +1 @@
+ALTER TABLE orgs DROP COLUMN max_plans_per_name;
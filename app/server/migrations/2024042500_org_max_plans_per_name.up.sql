@@ -0,0 +1 @@
+ALTER TABLE orgs ADD COLUMN max_plans_per_name INTEGER;
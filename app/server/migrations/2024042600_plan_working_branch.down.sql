@@ -0,0 +1 @@
+ALTER TABLE plans DROP COLUMN working_branch;
@@ -0,0 +1 @@
+ALTER TABLE plans ADD COLUMN working_branch VARCHAR(255);
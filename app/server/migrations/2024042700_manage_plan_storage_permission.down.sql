@@ -0,0 +1 @@
+DELETE FROM permissions WHERE name = 'manage_plan_storage';
@@ -0,0 +1,11 @@
+DROP TRIGGER update_plans_modtime ON plans;
+CREATE TRIGGER update_plans_modtime BEFORE UPDATE ON plans FOR EACH ROW
+WHEN (OLD.case_insensitive_name = NEW.case_insensitive_name)
+EXECUTE FUNCTION update_updated_at_column();
+
+DROP INDEX IF EXISTS plans_name_project_scoped_case_insensitive_idx;
+DROP INDEX IF EXISTS plans_name_project_scoped_idx;
+
+ALTER TABLE plans DROP COLUMN project_scoped_name;
+
+ALTER TABLE orgs DROP COLUMN project_scoped_plan_names;
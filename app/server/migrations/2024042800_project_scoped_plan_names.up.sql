@@ -0,0 +1,12 @@
+ALTER TABLE orgs ADD COLUMN project_scoped_plan_names BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- copied from the org setting like case_insensitive_name, so the indexes below only apply to orgs that opted in
+ALTER TABLE plans ADD COLUMN project_scoped_name BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE UNIQUE INDEX plans_name_project_scoped_idx ON plans(project_id, name) WHERE project_scoped_name AND name != 'draft';
+CREATE UNIQUE INDEX plans_name_project_scoped_case_insensitive_idx ON plans(project_id, LOWER(name)) WHERE project_scoped_name AND case_insensitive_name AND name != 'draft';
+
+DROP TRIGGER update_plans_modtime ON plans;
+CREATE TRIGGER update_plans_modtime BEFORE UPDATE ON plans FOR EACH ROW
+WHEN (OLD.case_insensitive_name = NEW.case_insensitive_name AND OLD.project_scoped_name = NEW.project_scoped_name)
+EXECUTE FUNCTION update_updated_at_column();
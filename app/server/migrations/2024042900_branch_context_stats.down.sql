@@ -0,0 +1,2 @@
+ALTER TABLE branches DROP COLUMN context_bytes;
+ALTER TABLE branches DROP COLUMN context_files;
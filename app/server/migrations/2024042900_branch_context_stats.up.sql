@@ -0,0 +1,3 @@
+-- kept up to date alongside context_tokens; existing branches start at 0 and are corrected the next time their context changes
+ALTER TABLE branches ADD COLUMN context_files INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE branches ADD COLUMN context_bytes BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+DROP INDEX plans_org_created_at_idx;
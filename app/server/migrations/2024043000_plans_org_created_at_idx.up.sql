@@ -0,0 +1,2 @@
+-- for the org-wide recent plans feed
+CREATE INDEX plans_org_created_at_idx ON plans(org_id, created_at DESC, id DESC);
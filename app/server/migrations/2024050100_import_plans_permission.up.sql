@@ -0,0 +1,12 @@
+INSERT INTO permissions (name, description) VALUES
+  ('import_plans', 'Import plans from a directory on the server');
+
+INSERT INTO org_roles_permissions (org_role_id, permission_id)
+SELECT
+    r.id AS org_role_id,
+    p.id AS permission_id
+FROM
+    org_roles r, permissions p
+WHERE
+    r.org_id IS NULL AND r.name IN ('owner', 'admin')
+    AND p.name = 'import_plans';
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS deleted_plans (
+  plan_id UUID PRIMARY KEY,
+  org_id UUID NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+  deleted_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  deleted_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX deleted_plans_deleted_at_idx ON deleted_plans(deleted_at);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS plan_seen (
+  plan_id UUID NOT NULL REFERENCES plans(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  seen_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (plan_id, user_id)
+);
+
+CREATE INDEX plan_seen_user_idx ON plan_seen(user_id);
@@ -0,0 +1 @@
+ALTER TABLE orgs DROP COLUMN IF EXISTS audit_webhook_url;
@@ -0,0 +1 @@
+ALTER TABLE orgs ADD COLUMN audit_webhook_url TEXT;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS plans_external_key_idx;
+
+ALTER TABLE plans DROP COLUMN IF EXISTS external_key;
@@ -0,0 +1,3 @@
+ALTER TABLE plans ADD COLUMN external_key VARCHAR(255);
+
+CREATE UNIQUE INDEX plans_external_key_idx ON plans(project_id, external_key) WHERE external_key IS NOT NULL;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS plans_name_unique_idx;
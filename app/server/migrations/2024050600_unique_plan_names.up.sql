@@ -0,0 +1,13 @@
+-- archive all but the oldest of any unarchived plans that share a name for the same project and owner, left by concurrent creates, before enforcing unique names
+UPDATE plans SET archived_at = NOW()
+WHERE id IN (
+  SELECT id FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY project_id, owner_id, name ORDER BY created_at ASC, id ASC) AS rn
+    FROM plans
+    WHERE name != 'draft' AND archived_at IS NULL
+  ) ranked
+  WHERE rn > 1
+);
+
+-- drafts have plans_one_draft_idx, and deleted plans are moved out of the table, so only archived plans need leaving out
+CREATE UNIQUE INDEX plans_name_unique_idx ON plans(project_id, owner_id, name) WHERE name != 'draft' AND archived_at IS NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE plans DROP COLUMN IF EXISTS notify_webhook_secret;
+ALTER TABLE orgs DROP COLUMN IF EXISTS audit_webhook_secret;
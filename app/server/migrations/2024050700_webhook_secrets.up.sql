@@ -0,0 +1,3 @@
+-- set on first use, so webhooks configured before this migration get a secret too
+ALTER TABLE plans ADD COLUMN notify_webhook_secret TEXT;
+ALTER TABLE orgs ADD COLUMN audit_webhook_secret TEXT;
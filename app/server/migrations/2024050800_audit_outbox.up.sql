@@ -0,0 +1,14 @@
+-- audit events waiting to be posted to their org's audit webhook. Rows are written in the same
+-- transaction as the change they record and deleted once delivered, so no event is lost if the
+-- receiver is down or the server restarts. No plan foreign key: the event outlives the plan.
+CREATE TABLE IF NOT EXISTS audit_outbox (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  org_id UUID NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+  event JSONB NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  last_error TEXT,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX audit_outbox_next_attempt_idx ON audit_outbox(next_attempt_at);
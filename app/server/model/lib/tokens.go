@@ -0,0 +1,58 @@
+package lib
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+
+	"github.com/plandex/plandex/shared"
+)
+
+// maximum number of token counts kept in memory; each entry is just a hash and an int
+const tokenCacheSize = 10000
+
+type tokenCacheEntry struct {
+	hash      string
+	numTokens int
+}
+
+var tokenCacheMu sync.Mutex
+var tokenCacheEntries = map[string]*list.Element{}
+var tokenCacheLru = list.New()
+
+// GetNumTokensCached is shared.GetNumTokens with results cached by a hash of the text, so
+// unchanged context bodies aren't tokenized again
+func GetNumTokensCached(text string) (int, error) {
+	sum := sha256.Sum256([]byte(text))
+	hash := hex.EncodeToString(sum[:])
+
+	tokenCacheMu.Lock()
+	if el, ok := tokenCacheEntries[hash]; ok {
+		tokenCacheLru.MoveToFront(el)
+		numTokens := el.Value.(*tokenCacheEntry).numTokens
+		tokenCacheMu.Unlock()
+		return numTokens, nil
+	}
+	tokenCacheMu.Unlock()
+
+	// tokenize outside the lock since it's the slow part
+	numTokens, err := shared.GetNumTokens(text)
+	if err != nil {
+		return 0, err
+	}
+
+	tokenCacheMu.Lock()
+	defer tokenCacheMu.Unlock()
+
+	if _, ok := tokenCacheEntries[hash]; !ok {
+		tokenCacheEntries[hash] = tokenCacheLru.PushFront(&tokenCacheEntry{hash: hash, numTokens: numTokens})
+
+		for tokenCacheLru.Len() > tokenCacheSize {
+			oldest := tokenCacheLru.Remove(tokenCacheLru.Back()).(*tokenCacheEntry)
+			delete(tokenCacheEntries, oldest.hash)
+		}
+	}
+
+	return numTokens, nil
+}
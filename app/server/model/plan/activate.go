@@ -1,6 +1,7 @@
 package plan
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"plandex-server/db"
@@ -15,7 +16,7 @@ func activatePlan(client *openai.Client, plan *db.Plan, branch string, auth *typ
 	active := GetActivePlan(plan.Id, branch)
 	if active != nil {
 		log.Printf("Tell: Active plan found for plan ID %s on branch %s\n", plan.Id, branch) // Log if an active plan is found
-		return nil, fmt.Errorf("plan %s branch %s already has an active stream on this host", plan.Id, branch)
+		return nil, fmt.Errorf("plan %s branch %s already has an active stream on this host: %w", plan.Id, branch, db.ErrPlanBusy)
 	}
 
 	modelStream, err := db.GetActiveModelStream(plan.Id, branch)
@@ -26,10 +27,14 @@ func activatePlan(client *openai.Client, plan *db.Plan, branch string, auth *typ
 
 	if modelStream != nil {
 		log.Printf("Tell: Active model stream found for plan ID %s on branch %s on host %s\n", plan.Id, branch, modelStream.InternalIp) // Log if an active model stream is found
-		return nil, fmt.Errorf("plan %s branch %s already has an active stream on host %s", plan.Id, branch, modelStream.InternalIp)
+		return nil, fmt.Errorf("plan %s branch %s already has an active stream on host %s: %w", plan.Id, branch, modelStream.InternalIp, db.ErrPlanBusy)
 	}
 
-	active = CreateActivePlan(plan.Id, branch, prompt, buildOnly)
+	active, err = CreateActivePlan(plan.Id, branch, auth.User.Id, prompt, buildOnly)
+	if err != nil {
+		log.Printf("Tell: %v\n", err)
+		return nil, err
+	}
 
 	modelStream = &db.ModelStream{
 		OrgId:      auth.OrgId,
@@ -43,9 +48,16 @@ func activatePlan(client *openai.Client, plan *db.Plan, branch string, auth *typ
 		log.Printf("Error storing model stream: %v\n", err)
 		log.Printf("Tell: Error storing model stream: %v\n", err) // Log error storing model stream
 
+		// another run, possibly on another host, started first. Its status is left alone and the
+		// caller reports the plan busy.
+		if errors.Is(err, db.ErrPlanBusy) {
+			DiscardActivePlan(active)
+			return nil, fmt.Errorf("plan %s branch %s already has an active stream: %w", plan.Id, branch, err)
+		}
+
 		active.StreamDoneCh <- &shared.ApiError{Msg: fmt.Sprintf("Error storing model stream: %v", err)}
 
-		return nil, fmt.Errorf("error storing model stream: %v", err)
+		return nil, fmt.Errorf("error storing model stream: %w", err)
 	}
 
 	active.ModelStreamId = modelStream.Id
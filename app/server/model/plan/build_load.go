@@ -20,6 +20,7 @@ func (state *activeBuildStreamState) loadPendingBuilds() (map[string][]*types.Ac
 
 	if err != nil {
 		log.Printf("Error activating plan: %v\n", err)
+		return nil, err
 	}
 
 	repoLockId, err := db.LockRepo(
@@ -0,0 +1,50 @@
+package plan
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// MaxRunningPlansPerUser caps how many plans a user can have streaming at once on this host.
+// Set with PLANDEX_MAX_RUNNING_PLANS_PER_USER; 0 means no limit.
+var MaxRunningPlansPerUser = 0
+
+var runningLimitMu sync.Mutex
+
+type TooManyRunningError struct {
+	Running    int
+	MaxRunning int
+}
+
+func (e *TooManyRunningError) Error() string {
+	return fmt.Sprintf("user has %d running plans, max is %d", e.Running, e.MaxRunning)
+}
+
+func init() {
+	s := os.Getenv("PLANDEX_MAX_RUNNING_PLANS_PER_USER")
+	if s == "" {
+		return
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		panic(fmt.Errorf("PLANDEX_MAX_RUNNING_PLANS_PER_USER must be an integer >= 0, got: %s", s))
+	}
+
+	MaxRunningPlansPerUser = n
+}
+
+func checkRunningLimit(userId string) error {
+	if MaxRunningPlansPerUser == 0 {
+		return nil
+	}
+
+	running := NumActivePlansForUser(userId)
+	if running >= MaxRunningPlansPerUser {
+		return &TooManyRunningError{Running: running, MaxRunning: MaxRunningPlansPerUser}
+	}
+
+	return nil
+}
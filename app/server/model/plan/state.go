@@ -1,6 +1,7 @@
 package plan
 
 import (
+	"fmt"
 	"log"
 	"plandex-server/db"
 	"plandex-server/types"
@@ -18,11 +19,30 @@ func GetActivePlan(planId, branch string) *types.ActivePlan {
 	return activePlans.Get(strings.Join([]string{planId, branch}, "|"))
 }
 
-func CreateActivePlan(planId, branch, prompt string, buildOnly bool) *types.ActivePlan {
-	activePlan := types.NewActivePlan(planId, branch, prompt, buildOnly)
+// GetActiveBranchesSnapshot returns a check for whether a branch is active on this host, from one
+// read of the active plans, for checking a batch of plans without locking for each
+func GetActiveBranchesSnapshot() func(planId, branch string) bool {
+	active := map[string]bool{}
+	for _, key := range activePlans.Keys() {
+		active[key] = true
+	}
+
+	return func(planId, branch string) bool {
+		return active[strings.Join([]string{planId, branch}, "|")]
+	}
+}
+
+// CreateActivePlan registers a new active plan for the branch. Registering is atomic, so of two
+// concurrent starts on this host, the second gets db.ErrPlanBusy and the first keeps the entry.
+func CreateActivePlan(planId, branch, userId, prompt string, buildOnly bool) (*types.ActivePlan, error) {
+	activePlan := types.NewActivePlan(planId, branch, userId, prompt, buildOnly)
 	key := strings.Join([]string{planId, branch}, "|")
 
-	activePlans.Set(key, activePlan)
+	if !activePlans.SetIfAbsent(key, activePlan) {
+		activePlan.CancelFn()
+		activePlan.SummaryCancelFn()
+		return nil, fmt.Errorf("plan %s branch %s already has an active stream on this host: %w", planId, branch, db.ErrPlanBusy)
+	}
 
 	go func() {
 		for {
@@ -37,6 +57,16 @@ func CreateActivePlan(planId, branch, prompt string, buildOnly bool) *types.Acti
 
 				DeleteActivePlan(planId, branch)
 
+				return
+			case <-activePlan.DiscardCh:
+				log.Printf("case <-activePlan.DiscardCh: %s\n", planId)
+
+				// the plan never started, so its status belongs to whichever run holds the branch
+				// and isn't touched
+				activePlans.DeleteIf(key, func(ap *types.ActivePlan) bool { return ap == activePlan })
+				activePlan.CancelFn()
+				activePlan.SummaryCancelFn()
+
 				return
 			case apiErr := <-activePlan.StreamDoneCh:
 				log.Printf("case apiErr := <-activePlan.StreamDoneCh: %s\n", planId)
@@ -77,7 +107,13 @@ func CreateActivePlan(planId, branch, prompt string, buildOnly bool) *types.Acti
 		}
 	}()
 
-	return activePlan
+	return activePlan, nil
+}
+
+// DiscardActivePlan drops an active plan that was created but couldn't start, without updating
+// the plan's status
+func DiscardActivePlan(activePlan *types.ActivePlan) {
+	close(activePlan.DiscardCh)
 }
 
 func DeleteActivePlan(planId, branch string) {
@@ -117,3 +153,14 @@ func UnsubscribePlan(planId, branch, subscriptionId string) {
 func NumActivePlans() int {
 	return activePlans.Len()
 }
+
+func NumActivePlansForUser(userId string) int {
+	n := 0
+	for _, key := range activePlans.Keys() {
+		active := activePlans.Get(key)
+		if active != nil && active.UserId == userId {
+			n++
+		}
+	}
+	return n
+}
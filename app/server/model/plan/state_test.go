@@ -0,0 +1,54 @@
+package plan
+
+import (
+	"errors"
+	"plandex-server/db"
+	"testing"
+	"time"
+)
+
+func TestCreateActivePlanBusy(t *testing.T) {
+	first, err := CreateActivePlan("busy-plan", "main", "user", "", false)
+	if err != nil {
+		t.Fatalf("error creating active plan: %v", err)
+	}
+
+	// a concurrent start on this host loses without touching the first start's entry
+	second, err := CreateActivePlan("busy-plan", "main", "user", "", false)
+	if !errors.Is(err, db.ErrPlanBusy) || second != nil {
+		t.Fatalf("expected ErrPlanBusy for the second start, got %v", err)
+	}
+
+	if GetActivePlan("busy-plan", "main") != first {
+		t.Errorf("expected the first start to stay registered")
+	}
+
+	DiscardActivePlan(first)
+}
+
+func TestDiscardActivePlan(t *testing.T) {
+	active, err := CreateActivePlan("discard-plan", "main", "user", "", false)
+	if err != nil {
+		t.Fatalf("error creating active plan: %v", err)
+	}
+
+	DiscardActivePlan(active)
+
+	select {
+	case <-active.Ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("expected the discarded plan's context to be canceled")
+	}
+
+	// the listener removes the plan before canceling it, so once it's canceled it's gone
+	if GetActivePlan("discard-plan", "main") != nil {
+		t.Errorf("expected the discarded plan to be removed")
+	}
+
+	// the branch can be started again
+	again, err := CreateActivePlan("discard-plan", "main", "user", "", false)
+	if err != nil {
+		t.Fatalf("expected the branch to be free after the discard, got %v", err)
+	}
+	DiscardActivePlan(again)
+}
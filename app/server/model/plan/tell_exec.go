@@ -20,7 +20,13 @@ import (
 func Tell(client *openai.Client, plan *db.Plan, branch string, auth *types.ServerAuth, req *shared.TellPlanRequest) error {
 	log.Printf("Tell: Called with plan ID %s on branch %s\n", plan.Id, branch)
 
-	_, err := activatePlan(client, plan, branch, auth, req.Prompt, false)
+	// hold the lock from the limit check until the plan is registered so concurrent tells can't both slip under the limit
+	runningLimitMu.Lock()
+	err := checkRunningLimit(auth.User.Id)
+	if err == nil {
+		_, err = activatePlan(client, plan, branch, auth, req.Prompt, false)
+	}
+	runningLimitMu.Unlock()
 
 	if err != nil {
 		log.Printf("Error activating plan: %v\n", err)
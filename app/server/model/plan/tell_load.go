@@ -81,6 +81,23 @@ func (state *activeTellStreamState) loadTellPlan() error {
 				return
 			}
 
+			org, err := db.GetOrg(plan.OrgId)
+
+			if err != nil {
+				log.Printf("Error getting org: %v\n", err)
+				errCh <- fmt.Errorf("error getting org: %v", err)
+				return
+			}
+
+			// generated names always get the org's prefix
+			name, err = db.ApplyPlanNamePrefix(org, name, true)
+
+			if err != nil {
+				log.Printf("Error applying plan name prefix: %v\n", err)
+				errCh <- fmt.Errorf("error applying plan name prefix: %v", err)
+				return
+			}
+
 			tx, err := db.Conn.Begin()
 			if err != nil {
 				log.Printf("Error starting transaction: %v\n", err)
@@ -120,6 +137,12 @@ func (state *activeTellStreamState) loadTellPlan() error {
 				errCh <- fmt.Errorf("error committing transaction: %v", err)
 				return
 			}
+
+			db.InvalidatePlanCache(planId)
+
+			renamed := *plan
+			renamed.Name = name
+			db.PublishPlanRenamed(&renamed)
 		}
 
 		errCh <- nil
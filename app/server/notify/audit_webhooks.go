@@ -0,0 +1,157 @@
+package notify
+
+import (
+	"fmt"
+	"log"
+	"plandex-server/db"
+	"time"
+
+	"github.com/plandex/plandex/shared"
+)
+
+const auditDeliveryInterval = 10 * time.Second
+const auditDeliveryBatchSize = 10
+
+// events in a batch are posted one at a time, so the lease covers every post timing out, plus a
+// margin for the queries around them. Otherwise another host could claim the end of the batch
+// while it's still being delivered.
+const auditDeliveryLease = auditDeliveryBatchSize*webhookTimeout + 1*time.Minute
+
+const auditRetryBaseDelay = 30 * time.Second
+const auditRetryMaxDelay = 1 * time.Hour
+
+// StartPlanAuditNotifier posts every created plan to its org's audit webhook, if the org has one.
+// Events come from the audit outbox, which plan creation writes to in its transaction, so none
+// are lost to a full event buffer, a restart, or a receiver that's down: failed deliveries are
+// retried with backoff until they succeed. Created events on this host's event bus only trigger
+// an early delivery round; any host can deliver any event.
+func StartPlanAuditNotifier() {
+	_, ch := db.SubscribePlanEvents("")
+
+	wake := make(chan struct{}, 1)
+
+	go func() {
+		for event := range ch {
+			if event.Type != shared.PlanEventCreated {
+				continue
+			}
+
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(auditDeliveryInterval)
+		defer ticker.Stop()
+
+		for {
+			deliverDueAuditEvents()
+
+			select {
+			case <-ticker.C:
+			case <-wake:
+			}
+		}
+	}()
+}
+
+func deliverDueAuditEvents() {
+	for {
+		events, err := db.ClaimDueAuditEvents(auditDeliveryBatchSize, auditDeliveryLease)
+		if err != nil {
+			log.Printf("Error claiming audit events: %v\n", err)
+			return
+		}
+
+		for _, event := range events {
+			err := postAuditEvent(event)
+
+			if err != nil {
+				log.Printf("Error posting audit event %s, attempt %d: %v\n", event.Id, event.Attempts+1, err)
+
+				err = db.RetryAuditEvent(event.Id, err, auditRetryDelay(event.Attempts))
+				if err != nil {
+					log.Printf("Error scheduling retry for audit event %s: %v\n", event.Id, err)
+				}
+				continue
+			}
+
+			err = db.DeleteAuditEvent(event.Id)
+			if err != nil {
+				// it will be posted again once its lease is up, so delivery is at least once
+				log.Printf("Error deleting delivered audit event %s: %v\n", event.Id, err)
+			}
+		}
+
+		if len(events) < auditDeliveryBatchSize {
+			return
+		}
+	}
+}
+
+// auditRetryDelay doubles from auditRetryBaseDelay with each failed attempt, up to auditRetryMaxDelay
+func auditRetryDelay(attempts int) time.Duration {
+	delay := auditRetryBaseDelay
+	for i := 0; i < attempts && delay < auditRetryMaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > auditRetryMaxDelay {
+		delay = auditRetryMaxDelay
+	}
+
+	return delay
+}
+
+func postAuditEvent(outboxEvent *db.AuditOutboxEvent) error {
+	event, err := outboxEvent.PlanEvent()
+	if err != nil {
+		return err
+	}
+
+	org, err := db.GetOrg(outboxEvent.OrgId)
+	if err != nil {
+		return fmt.Errorf("error getting org: %v", err)
+	}
+
+	// the webhook was removed after the event was queued, so there's nowhere to send it
+	if org.AuditWebhookUrl == nil {
+		log.Printf("Org %s no longer has an audit webhook, dropping audit event %s\n", org.Id, outboxEvent.Id)
+		return nil
+	}
+
+	secret, err := db.GetOrCreateOrgAuditWebhookSecret(org.Id)
+	if err != nil {
+		return fmt.Errorf("error getting audit webhook secret: %v", err)
+	}
+
+	return postWebhook(*org.AuditWebhookUrl, secret, planCreatedAuditEvent(event))
+}
+
+func planCreatedAuditEvent(event *shared.PlanEvent) *shared.PlanCreatedAuditEvent {
+	res := &shared.PlanCreatedAuditEvent{
+		SchemaVersion: shared.PlanCreatedAuditSchemaVersion,
+		Event:         shared.AuditEventPlanCreated,
+		PlanId:        event.PlanId,
+		Name:          event.Name,
+		ProjectId:     event.ProjectId,
+		OrgId:         event.OrgId,
+		ActorId:       event.ActorId,
+		CreatedAt:     event.CreatedAt.UTC(),
+	}
+
+	// creating a plan for yourself doesn't need to say who did it
+	if res.ActorId == "" {
+		res.ActorId = event.OwnerId
+	}
+
+	if event.ExternalKey != "" {
+		externalKey := event.ExternalKey
+		res.ExternalKey = &externalKey
+	}
+
+	return res
+}
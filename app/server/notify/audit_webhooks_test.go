@@ -0,0 +1,70 @@
+package notify
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/plandex/plandex/shared"
+)
+
+func TestPlanCreatedAuditEventSchema(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	event := &shared.PlanEvent{
+		Type:        shared.PlanEventCreated,
+		OrgId:       "org",
+		ProjectId:   "project",
+		PlanId:      "plan",
+		OwnerId:     "owner",
+		Name:        "name",
+		CreatedAt:   createdAt,
+		ActorId:     "actor",
+		ExternalKey: "TICKET-1",
+	}
+
+	bytes, err := json.Marshal(planCreatedAuditEvent(event))
+	if err != nil {
+		t.Fatalf("error marshalling: %v", err)
+	}
+
+	// the schema is a contract with external parsers, so check the exact keys and values
+	want := `{"schema_version":1,"event":"plan.created","plan_id":"plan","name":"name","project_id":"project","org_id":"org","actor_id":"actor","created_at":"2024-05-01T12:00:00Z","external_key":"TICKET-1"}`
+	if string(bytes) != want {
+		t.Errorf("got %s\nwant %s", bytes, want)
+	}
+
+	event.ActorId = ""
+	event.ExternalKey = ""
+
+	res := planCreatedAuditEvent(event)
+	if res.ActorId != "owner" {
+		t.Errorf("expected the owner as actor without one, got %s", res.ActorId)
+	}
+
+	bytes, _ = json.Marshal(res)
+	var decoded map[string]interface{}
+	json.Unmarshal(bytes, &decoded)
+	if v, ok := decoded["external_key"]; !ok || v != nil {
+		t.Errorf("expected external_key to be null, got %v", v)
+	}
+}
+
+func TestAuditRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, auditRetryBaseDelay},
+		{1, 2 * auditRetryBaseDelay},
+		{3, 8 * auditRetryBaseDelay},
+		{20, auditRetryMaxDelay},
+		{1000, auditRetryMaxDelay},
+	}
+
+	for _, tt := range tests {
+		if got := auditRetryDelay(tt.attempts); got != tt.want {
+			t.Errorf("attempts %d: got %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
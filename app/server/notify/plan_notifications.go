@@ -0,0 +1,148 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"plandex-server/db"
+	"plandex-server/email"
+	"time"
+
+	"github.com/plandex/plandex/shared"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// StartPlanNotifier sends the notifications plans have opted into when they finish or fail. It
+// listens on the plan event bus, which only carries events from this host, so each status change
+// is notified once, by the host running the plan.
+func StartPlanNotifier() {
+	_, ch := db.SubscribePlanEvents("")
+
+	go func() {
+		for event := range ch {
+			if event.Type != shared.PlanEventStatus {
+				continue
+			}
+
+			if event.Status != shared.PlanStatusFinished && event.Status != shared.PlanStatusError {
+				continue
+			}
+
+			// sending can be slow, and a full buffer drops events
+			go func(event *shared.PlanEvent) {
+				err := notifyPlanStatus(event)
+				if err != nil {
+					log.Printf("Error sending notification for plan %s: %v\n", event.PlanId, err)
+				}
+			}(event)
+		}
+	}()
+}
+
+func notifyPlanStatus(event *shared.PlanEvent) error {
+	plan, err := db.GetPlan(event.PlanId)
+	if err != nil {
+		return fmt.Errorf("error getting plan: %v", err)
+	}
+
+	if !shouldNotify(plan, event.Status) {
+		return nil
+	}
+
+	switch plan.NotifyChannel {
+	case shared.PlanNotifyChannelWebhook:
+		if plan.NotifyWebhookUrl == nil {
+			return fmt.Errorf("webhook channel without a webhook url")
+		}
+
+		secret, err := db.GetOrCreatePlanWebhookSecret(plan.Id)
+		if err != nil {
+			return fmt.Errorf("error getting webhook secret: %v", err)
+		}
+
+		return postWebhook(*plan.NotifyWebhookUrl, secret, &shared.PlanNotification{
+			Event:     shared.PlanNotificationEventStatus,
+			PlanId:    plan.Id,
+			Name:      plan.Name,
+			Branch:    event.Branch,
+			Status:    event.Status,
+			Error:     event.Error,
+			CreatedAt: event.CreatedAt,
+		})
+
+	default:
+		owner, err := db.GetUser(plan.OwnerId)
+		if err != nil {
+			return fmt.Errorf("error getting plan owner: %v", err)
+		}
+
+		errStr := ""
+		if event.Status == shared.PlanStatusError {
+			errStr = event.Error
+			if errStr == "" {
+				errStr = "Unknown error"
+			}
+		}
+
+		return email.SendPlanNotificationEmail(owner.Email, plan.Name, event.Branch, errStr)
+	}
+}
+
+func shouldNotify(plan *db.Plan, status shared.PlanStatus) bool {
+	switch status {
+	case shared.PlanStatusFinished:
+		return plan.NotifyOnComplete
+	case shared.PlanStatusError:
+		return plan.NotifyOnError
+	}
+	return false
+}
+
+func postWebhook(url, secret string, payload interface{}) error {
+	statusCode, err := deliverWebhook(url, secret, payload)
+	if err != nil {
+		return err
+	}
+
+	if statusCode < 200 || statusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", statusCode)
+	}
+
+	return nil
+}
+
+// deliverWebhook signs the body with secret and returns the receiver's status code, whatever it
+// is. Errors are for requests that didn't get a response.
+func deliverWebhook(url, secret string, payload interface{}) (int, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("error marshalling webhook payload: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("error creating webhook request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(shared.WebhookSignatureHeader, signWebhookBody(secret, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error posting webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
+
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,78 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"plandex-server/db"
+	"testing"
+
+	"github.com/plandex/plandex/shared"
+)
+
+func TestShouldNotify(t *testing.T) {
+	plan := &db.Plan{NotifyOnError: true}
+
+	if shouldNotify(plan, shared.PlanStatusFinished) {
+		t.Errorf("shouldn't notify on complete when only errors are on")
+	}
+
+	if !shouldNotify(plan, shared.PlanStatusError) {
+		t.Errorf("should notify on error")
+	}
+
+	if shouldNotify(plan, shared.PlanStatusStopped) {
+		t.Errorf("shouldn't notify for other statuses")
+	}
+}
+
+func TestPostWebhook(t *testing.T) {
+	allowLoopbackWebhooks(t)
+
+	var received shared.PlanNotification
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assertWebhookSignature(t, r, "secret", body)
+
+		if err := json.Unmarshal(body, &received); err != nil {
+			t.Errorf("error decoding webhook body: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	err := postWebhook(server.URL, "secret", &shared.PlanNotification{PlanId: "plan", Status: shared.PlanStatusError, Error: "boom"})
+	if err != nil {
+		t.Fatalf("error posting webhook: %v", err)
+	}
+
+	if received.PlanId != "plan" || received.Error != "boom" {
+		t.Errorf("unexpected webhook body: %+v", received)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	if err := postWebhook(failing.URL, "secret", &shared.PlanNotification{}); err == nil {
+		t.Errorf("expected an error for a non-2xx response")
+	}
+}
+
+// assertWebhookSignature checks the signature header the way a receiver would
+func assertWebhookSignature(t *testing.T, r *http.Request, secret string, body []byte) {
+	t.Helper()
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if got := r.Header.Get(shared.WebhookSignatureHeader); !hmac.Equal([]byte(got), []byte(want)) {
+		t.Errorf("got signature %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,126 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// webhooks are posted to user-supplied urls, so loopback, private, link-local (including cloud
+// metadata at 169.254.169.254) and other non-public addresses are refused, both when the url is
+// saved and when each request dials. Checking at dial time means a host that resolves to a public
+// address when it's saved and a private one later still can't get through.
+//
+// Set PLANDEX_ALLOW_PRIVATE_WEBHOOKS on self-hosted instances that post to receivers on their own
+// network.
+var allowPrivateWebhooks = os.Getenv("PLANDEX_ALLOW_PRIVATE_WEBHOOKS") != ""
+
+var ErrWebhookAddressNotAllowed = errors.New("webhook url must resolve to a public address")
+
+const webhookLookupTimeout = 3 * time.Second
+
+var lookupWebhookHost = net.DefaultResolver.LookupIPAddr
+
+// carrier-grade NAT isn't covered by net.IP.IsPrivate
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+var webhookClient = &http.Client{
+	Timeout: webhookTimeout,
+	Transport: &http.Transport{
+		// no proxy: the dial check has to see the receiver's address, not the proxy's
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: webhookTimeout,
+			Control: webhookDialControl,
+		}).DialContext,
+		TLSHandshakeTimeout: webhookTimeout,
+	},
+}
+
+// ValidateWebhookHost rejects a webhook host that is, or currently resolves to, a non-public
+// address. A host that can't be resolved is let through; delivering to it fails, and any address
+// it resolves to later is still checked when dialing.
+func ValidateWebhookHost(host string) error {
+	if allowPrivateWebhooks {
+		return nil
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrWebhookAddressNotAllowed
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if !isPublicIP(ip) {
+			return ErrWebhookAddressNotAllowed
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookLookupTimeout)
+	defer cancel()
+
+	addrs, err := lookupWebhookHost(ctx, host)
+	if err != nil {
+		return nil
+	}
+
+	for _, addr := range addrs {
+		if !isPublicIP(addr.IP) {
+			return ErrWebhookAddressNotAllowed
+		}
+	}
+
+	return nil
+}
+
+// webhookDialControl runs after resolution with the address actually being dialed
+func webhookDialControl(network, address string, c syscall.RawConn) error {
+	if allowPrivateWebhooks {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("error parsing webhook address: %v", err)
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return ErrWebhookAddressNotAllowed
+	}
+
+	return nil
+}
+
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() {
+		return false
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		// 0.0.0.0/8 and broadcast
+		if ip4[0] == 0 || ip4.Equal(net.IPv4bcast) {
+			return false
+		}
+
+		if sharedAddressSpace.Contains(ip4) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// allowLoopbackWebhooks lets a test post to an httptest server, which listens on loopback
+func allowLoopbackWebhooks(t *testing.T) {
+	allowPrivateWebhooks = true
+	t.Cleanup(func() { allowPrivateWebhooks = false })
+}
+
+func TestIsPublicIP(t *testing.T) {
+	for _, addr := range []string{"8.8.8.8", "1.1.1.1", "2606:4700:4700::1111"} {
+		if !isPublicIP(net.ParseIP(addr)) {
+			t.Errorf("expected %s to be public", addr)
+		}
+	}
+
+	for _, addr := range []string{
+		"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "0.0.0.0",
+		"100.64.0.1", "255.255.255.255", "::1", "fd00:ec2::254", "fe80::1", "::ffff:127.0.0.1",
+	} {
+		if isPublicIP(net.ParseIP(addr)) {
+			t.Errorf("expected %s to be rejected", addr)
+		}
+	}
+}
+
+func TestValidateWebhookHost(t *testing.T) {
+	lookupWebhookHost = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		switch host {
+		case "internal.example.com":
+			return []net.IPAddr{{IP: net.ParseIP("93.184.216.34")}, {IP: net.ParseIP("10.0.0.5")}}, nil
+		case "public.example.com":
+			return []net.IPAddr{{IP: net.ParseIP("93.184.216.34")}}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	t.Cleanup(func() { lookupWebhookHost = net.DefaultResolver.LookupIPAddr })
+
+	for _, host := range []string{"public.example.com", "unresolvable.example.com", "8.8.8.8"} {
+		if err := ValidateWebhookHost(host); err != nil {
+			t.Errorf("expected %s to be allowed, got %v", host, err)
+		}
+	}
+
+	for _, host := range []string{"internal.example.com", "localhost", "api.localhost", "169.254.169.254", "::1"} {
+		if err := ValidateWebhookHost(host); !errors.Is(err, ErrWebhookAddressNotAllowed) {
+			t.Errorf("expected %s to be rejected, got %v", host, err)
+		}
+	}
+}
+
+func TestWebhookClientRefusesLoopback(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	_, err := deliverWebhook(server.URL, "secret", map[string]string{})
+	if !errors.Is(err, ErrWebhookAddressNotAllowed) {
+		t.Errorf("expected the dial to be refused, got %v", err)
+	}
+
+	if called {
+		t.Errorf("expected the receiver not to be reached")
+	}
+}
@@ -0,0 +1,86 @@
+package notify
+
+import (
+	"errors"
+	"plandex-server/db"
+	"sync"
+	"time"
+
+	"github.com/plandex/plandex/shared"
+)
+
+// each plan's webhook can be tested once per cooldown, so the endpoint can't be used to flood
+// an arbitrary url
+const webhookTestCooldown = 30 * time.Second
+
+var ErrWebhookTestRateLimited = errors.New("webhook was tested too recently")
+
+var ErrNoPlanWebhook = errors.New("plan doesn't have a webhook configured")
+
+// swapped out in tests, which don't have a database
+var getPlanWebhookSecret = db.GetOrCreatePlanWebhookSecret
+
+var webhookTestMu sync.Mutex
+var lastWebhookTestAt = map[string]time.Time{}
+
+// TestPlanWebhook sends a signed ping to the plan's webhook and reports how delivery went. A failed
+// delivery is reported in the result rather than returned as an error. If the plan was tested
+// within webhookTestCooldown, returns ErrWebhookTestRateLimited with the time left.
+func TestPlanWebhook(plan *db.Plan) (*shared.TestPlanWebhookResponse, time.Duration, error) {
+	if plan.NotifyChannel != shared.PlanNotifyChannelWebhook || plan.NotifyWebhookUrl == nil {
+		return nil, 0, ErrNoPlanWebhook
+	}
+
+	if wait := reserveWebhookTest(plan.Id, time.Now()); wait > 0 {
+		return nil, wait, ErrWebhookTestRateLimited
+	}
+
+	secret, err := getPlanWebhookSecret(plan.Id)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	start := time.Now()
+	statusCode, err := deliverWebhook(*plan.NotifyWebhookUrl, secret, &shared.PlanNotification{
+		Event:     shared.PlanNotificationEventPing,
+		PlanId:    plan.Id,
+		Name:      plan.Name,
+		CreatedAt: start,
+	})
+
+	res := &shared.TestPlanWebhookResponse{
+		StatusCode: statusCode,
+		LatencyMs:  time.Since(start).Milliseconds(),
+		Ok:         err == nil && statusCode >= 200 && statusCode < 300,
+	}
+
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	return res, 0, nil
+}
+
+// reserveWebhookTest records a test at now and returns 0, or returns how long until the plan
+// can be tested again
+func reserveWebhookTest(planId string, now time.Time) time.Duration {
+	webhookTestMu.Lock()
+	defer webhookTestMu.Unlock()
+
+	if last, ok := lastWebhookTestAt[planId]; ok {
+		if wait := webhookTestCooldown - now.Sub(last); wait > 0 {
+			return wait
+		}
+	}
+
+	// drop expired entries so the map doesn't grow with every plan ever tested
+	for id, last := range lastWebhookTestAt {
+		if now.Sub(last) >= webhookTestCooldown {
+			delete(lastWebhookTestAt, id)
+		}
+	}
+
+	lastWebhookTestAt[planId] = now
+
+	return 0
+}
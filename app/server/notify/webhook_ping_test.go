@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"plandex-server/db"
+	"testing"
+	"time"
+
+	"github.com/plandex/plandex/shared"
+)
+
+func TestReserveWebhookTest(t *testing.T) {
+	now := time.Now()
+
+	if wait := reserveWebhookTest("reserve-plan", now); wait != 0 {
+		t.Fatalf("expected the first test to be allowed, got wait %v", wait)
+	}
+
+	if wait := reserveWebhookTest("reserve-plan", now.Add(time.Second)); wait <= 0 {
+		t.Errorf("expected a second test within the cooldown to be limited")
+	}
+
+	if wait := reserveWebhookTest("reserve-other-plan", now.Add(time.Second)); wait != 0 {
+		t.Errorf("expected other plans not to be limited, got wait %v", wait)
+	}
+
+	if wait := reserveWebhookTest("reserve-plan", now.Add(webhookTestCooldown)); wait != 0 {
+		t.Errorf("expected a test after the cooldown to be allowed, got wait %v", wait)
+	}
+}
+
+func TestTestPlanWebhook(t *testing.T) {
+	allowLoopbackWebhooks(t)
+
+	var received shared.PlanNotification
+
+	getPlanWebhookSecret = func(planId string) (string, error) { return "ping-secret", nil }
+	t.Cleanup(func() { getPlanWebhookSecret = db.GetOrCreatePlanWebhookSecret })
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assertWebhookSignature(t, r, "ping-secret", body)
+
+		if err := json.Unmarshal(body, &received); err != nil {
+			t.Errorf("error decoding webhook body: %v", err)
+		}
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer server.Close()
+
+	url := server.URL
+	plan := &db.Plan{Id: "ping-plan", Name: "ping", NotifyChannel: shared.PlanNotifyChannelWebhook, NotifyWebhookUrl: &url}
+
+	res, _, err := TestPlanWebhook(plan)
+	if err != nil {
+		t.Fatalf("error testing webhook: %v", err)
+	}
+
+	if res.Ok || res.StatusCode != http.StatusTeapot {
+		t.Errorf("expected a non-ok 418 result, got %+v", res)
+	}
+
+	if received.Event != shared.PlanNotificationEventPing || received.PlanId != "ping-plan" {
+		t.Errorf("unexpected ping body: %+v", received)
+	}
+
+	if _, _, err := TestPlanWebhook(plan); err != ErrWebhookTestRateLimited {
+		t.Errorf("expected ErrWebhookTestRateLimited, got %v", err)
+	}
+
+	if _, _, err := TestPlanWebhook(&db.Plan{Id: "email-plan", NotifyChannel: shared.PlanNotifyChannelEmail}); err != ErrNoPlanWebhook {
+		t.Errorf("expected ErrNoPlanWebhook, got %v", err)
+	}
+}
@@ -11,6 +11,8 @@ import (
 
 func routes() *mux.Router {
 	r := mux.NewRouter()
+	r.Use(handlers.RecoverMiddleware)
+	r.Use(handlers.TimeoutMiddleware)
 
 	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprint(w, "OK")
@@ -38,9 +40,17 @@ func routes() *mux.Router {
 	r.HandleFunc("/orgs/session", handlers.GetOrgSessionHandler).Methods("GET")
 	r.HandleFunc("/orgs", handlers.ListOrgsHandler).Methods("GET")
 	r.HandleFunc("/orgs", handlers.CreateOrgHandler).Methods("POST")
+	r.HandleFunc("/orgs/default_project", handlers.SetOrgDefaultProjectHandler).Methods("PUT")
+	r.HandleFunc("/orgs/settings", handlers.GetOrgSettingsHandler).Methods("GET")
+	r.HandleFunc("/orgs/settings", handlers.UpdateOrgSettingsHandler).Methods("PUT")
 
 	r.HandleFunc("/users", handlers.ListUsersHandler).Methods("GET")
 	r.HandleFunc("/orgs/users/{userId}", handlers.DeleteOrgUserHandler).Methods("DELETE")
+	r.HandleFunc("/orgs/{orgId}/users/{userId}/plans", handlers.ListUserPlansHandler).Methods("GET")
+	r.HandleFunc("/orgs/{orgId}/plans/recent", handlers.ListRecentOrgPlansHandler).Methods("GET")
+	r.HandleFunc("/orgs/normalize_drafts", handlers.NormalizeDraftsHandler).Methods("POST")
+	r.HandleFunc("/orgs/orphaned_plan_dirs", handlers.ListOrphanedPlanDirsHandler).Methods("GET")
+	r.HandleFunc("/orgs/orphaned_plan_dirs/reap", handlers.ReapOrphanedPlanDirsHandler).Methods("POST")
 	r.HandleFunc("/orgs/roles", handlers.ListOrgRolesHandler).Methods("GET")
 
 	r.HandleFunc("/invites", handlers.InviteUserHandler).Methods("POST")
@@ -53,21 +63,65 @@ func routes() *mux.Router {
 	r.HandleFunc("/projects", handlers.ListProjectsHandler).Methods("GET")
 	r.HandleFunc("/projects/{projectId}/set_plan", handlers.ProjectSetPlanHandler).Methods("PUT")
 	r.HandleFunc("/projects/{projectId}/rename", handlers.RenameProjectHandler).Methods("PUT")
+	r.HandleFunc("/projects/{projectId}/settings", handlers.UpdateProjectSettingsHandler).Methods("PATCH")
 
+	r.HandleFunc("/projects/{projectId}/plans.csv", handlers.ExportPlansCSVHandler).Methods("GET")
 	r.HandleFunc("/projects/{projectId}/plans/current_branches", handlers.GetCurrentBranchByPlanIdHandler).Methods("POST")
 
 	r.HandleFunc("/plans", handlers.ListPlansHandler).Methods("GET")
 	r.HandleFunc("/plans/archive", handlers.ListArchivedPlansHandler).Methods("GET")
 	r.HandleFunc("/plans/ps", handlers.ListPlansRunningHandler).Methods("GET")
+	r.HandleFunc("/plans/status", handlers.GetPlanStatusesHandler).Methods("POST")
 
+	r.HandleFunc("/plans", handlers.CreatePlanHandler).Methods("POST")
 	r.HandleFunc("/projects/{projectId}/plans", handlers.CreatePlanHandler).Methods("POST")
+	r.HandleFunc("/projects/{projectId}/plans/can_create", handlers.GetCreatePlanEligibilityHandler).Methods("GET")
+	r.HandleFunc("/projects/{projectId}/plans/events", handlers.SubscribePlansHandler).Methods("GET")
+	r.HandleFunc("/projects/{projectId}/plans/duplicate_names", handlers.ListDuplicatePlanNamesHandler).Methods("GET")
+	r.HandleFunc("/projects/{projectId}/plans/merge", handlers.MergePlansHandler).Methods("POST")
+	r.HandleFunc("/projects/{projectId}/plans/export", handlers.ExportPlansHandler).Methods("POST")
+	r.HandleFunc("/projects/{projectId}/plans/import_path", handlers.ImportPlanFromPathHandler).Methods("POST")
 
-	r.HandleFunc("/projects/{projectId}/plans", handlers.CreatePlanHandler).Methods("DELETE")
+	r.HandleFunc("/projects/{projectId}/plans", handlers.DeleteAllPlansHandler).Methods("DELETE")
+	r.HandleFunc("/projects/{projectId}/plans/delete_by_filter", handlers.DeletePlansByFilterHandler).Methods("POST")
 
 	r.HandleFunc("/plans/{planId}", handlers.GetPlanHandler).Methods("GET")
 	r.HandleFunc("/plans/{planId}", handlers.DeletePlanHandler).Methods("DELETE")
+	r.HandleFunc("/plans/{planId}/export.md", handlers.ExportPlanMarkdownHandler).Methods("GET")
+	r.HandleFunc("/plans/{planId}", handlers.UpdatePlanHandler).Methods("PATCH")
+	r.HandleFunc("/plans/{planId}/touch", handlers.TouchPlanHandler).Methods("POST")
+	r.HandleFunc("/plans/{planId}/seen", handlers.MarkPlanSeenHandler).Methods("POST")
+	r.HandleFunc("/plans/{planId}/notifications/test_webhook", handlers.TestPlanWebhookHandler).Methods("POST")
+	r.HandleFunc("/plans/{planId}/reset", handlers.ResetPlanHandler).Methods("POST")
+
+	r.HandleFunc("/plans/{planId}/tree", handlers.GetPlanFileTreeHandler).Methods("GET")
+	r.HandleFunc("/plans/{planId}/changes", handlers.GetPlanChangesHandler).Methods("GET")
+	r.HandleFunc("/plans/{planId}/apply", handlers.ApplyPlanChangesHandler).Methods("POST")
+	r.HandleFunc("/plans/{planId}/reject", handlers.RejectPlanChangesHandler).Methods("POST")
+	r.HandleFunc("/plans/{planId}/files", handlers.GetPlanFileHandler).Methods("GET")
+	r.HandleFunc("/plans/{planId}/tokens", handlers.GetPlanContextTokensHandler).Methods("GET")
+	r.HandleFunc("/plans/{planId}/repair", handlers.RepairPlanHandler).Methods("POST")
+	r.HandleFunc("/plans/{planId}/compact", handlers.CompactPlanHandler).Methods("POST")
+	r.HandleFunc("/plans/{planId}/migrate", handlers.MigratePlanHandler).Methods("POST")
+	r.HandleFunc("/plans/{planId}/copy", handlers.CopyPlanHandler).Methods("POST")
+	r.HandleFunc("/plans/{planId}/copy_settings", handlers.CopyPlanSettingsHandler).Methods("POST")
+
+	r.HandleFunc("/plans/{planId}/share_links", handlers.CreatePlanShareLinkHandler).Methods("POST")
+	r.HandleFunc("/plans/{planId}/share_links", handlers.ListPlanShareLinksHandler).Methods("GET")
+	r.HandleFunc("/plans/{planId}/share_links/{linkId}", handlers.RevokePlanShareLinkHandler).Methods("DELETE")
+
+	r.HandleFunc("/plans/{planId}/api_keys", handlers.CreatePlanApiKeyHandler).Methods("POST")
+	r.HandleFunc("/plans/{planId}/api_keys", handlers.ListPlanApiKeysHandler).Methods("GET")
+	r.HandleFunc("/plans/{planId}/api_keys/{keyId}", handlers.RevokePlanApiKeyHandler).Methods("DELETE")
+
+	// registered before the /plans/{planId}/{branch}/... routes, which would otherwise match
+	// renaming or deleting a branch named like one of their actions, e.g. "archive"
+	r.HandleFunc("/plans/{planId}/branches", handlers.ListBranchesHandler).Methods("GET")
+	r.HandleFunc("/plans/{planId}/branches/{branch}", handlers.RenameBranchHandler).Methods("PATCH")
+	r.HandleFunc("/plans/{planId}/branches/{branch}", handlers.DeleteBranchHandler).Methods("DELETE")
 
 	r.HandleFunc("/plans/{planId}/{branch}/tell", handlers.TellPlanHandler).Methods("POST")
+	r.HandleFunc("/plans/{planId}/{branch}/estimate_cost", handlers.EstimatePlanCostHandler).Methods("POST")
 
 	r.HandleFunc("/plans/{planId}/{branch}/respond_missing_file", handlers.RespondMissingFileHandler).Methods("POST")
 
@@ -76,22 +130,30 @@ func routes() *mux.Router {
 	r.HandleFunc("/plans/{planId}/{branch}/stop", handlers.StopPlanHandler).Methods("DELETE")
 
 	r.HandleFunc("/plans/{planId}/{branch}/current_plan", handlers.CurrentPlanHandler).Methods("GET")
+	r.HandleFunc("/plans/{planId}/{branch}/diff", handlers.GetPlanDiffHandler).Methods("GET")
 	r.HandleFunc("/plans/{planId}/{branch}/apply", handlers.ApplyPlanHandler).Methods("PATCH")
 	r.HandleFunc("/plans/{planId}/{branch}/archive", handlers.ArchivePlanHandler).Methods("PATCH")
+	r.HandleFunc("/plans/{planId}/{branch}/unarchive", handlers.UnarchivePlanHandler).Methods("PATCH")
 	r.HandleFunc("/plans/{planId}/{branch}/reject_all", handlers.RejectAllChangesHandler).Methods("PATCH")
 	r.HandleFunc("/plans/{planId}/{branch}/reject_file", handlers.RejectFileHandler).Methods("PATCH")
 
 	r.HandleFunc("/plans/{planId}/{branch}/context", handlers.ListContextHandler).Methods("GET")
 	r.HandleFunc("/plans/{planId}/{branch}/context", handlers.LoadContextHandler).Methods("POST")
+	r.HandleFunc("/plans/{planId}/{branch}/context/upload", handlers.UploadContextHandler).Methods("POST")
 	r.HandleFunc("/plans/{planId}/{branch}/context", handlers.UpdateContextHandler).Methods("PUT")
+	r.HandleFunc("/plans/{planId}/{branch}/context", handlers.PatchContextHandler).Methods("PATCH")
 	r.HandleFunc("/plans/{planId}/{branch}/context", handlers.DeleteContextHandler).Methods("DELETE")
 
 	r.HandleFunc("/plans/{planId}/{branch}/convo", handlers.ListConvoHandler).Methods("GET")
+	r.HandleFunc("/plans/{planId}/{branch}/convo/stream", handlers.StreamPlanConvoHandler).Methods("GET")
+	r.HandleFunc("/plans/{planId}/{branch}/convo/messages", handlers.GetPlanConvoHandler).Methods("GET")
+	r.HandleFunc("/plans/{planId}/{branch}/convo/{messageId}", handlers.UpdateConvoMessageHandler).Methods("PATCH")
+	r.HandleFunc("/plans/{planId}/{branch}/convo/{messageId}", handlers.DeleteConvoMessageHandler).Methods("DELETE")
 	r.HandleFunc("/plans/{planId}/{branch}/rewind", handlers.RewindPlanHandler).Methods("PATCH")
 	r.HandleFunc("/plans/{planId}/{branch}/logs", handlers.ListLogsHandler).Methods("GET")
+	r.HandleFunc("/plans/{planId}/{branch}/versions", handlers.ListPlanVersionsHandler).Methods("GET")
+	r.HandleFunc("/plans/{planId}/{branch}/versions/restore", handlers.RestorePlanVersionHandler).Methods("POST")
 
-	r.HandleFunc("/plans/{planId}/branches", handlers.ListBranchesHandler).Methods("GET")
-	r.HandleFunc("/plans/{planId}/branches/{branch}", handlers.DeleteBranchHandler).Methods("DELETE")
 	r.HandleFunc("/plans/{planId}/{branch}/branches", handlers.CreateBranchHandler).Methods("POST")
 
 	r.HandleFunc("/plans/{planId}/{branch}/settings", handlers.GetSettingsHandler).Methods("GET")
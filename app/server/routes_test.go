@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestBranchRoutesMatchBeforeBranchActions(t *testing.T) {
+	r := routes()
+
+	for _, method := range []string{"PATCH", "DELETE"} {
+		for _, branch := range []string{"archive", "apply", "context", "stop"} {
+			req := httptest.NewRequest(method, "/plans/plan-id/branches/"+branch, nil)
+
+			var match mux.RouteMatch
+			if !r.Match(req, &match) {
+				t.Errorf("%s %s: no route matched", method, req.URL.Path)
+				continue
+			}
+
+			template, _ := match.Route.GetPathTemplate()
+			if template != "/plans/{planId}/branches/{branch}" || match.Vars["branch"] != branch {
+				t.Errorf("%s %s: matched %s with vars %v", method, req.URL.Path, template, match.Vars)
+			}
+		}
+	}
+
+	// the action routes still work for other branches
+	req := httptest.NewRequest("PATCH", "/plans/plan-id/main/archive", nil)
+	var match mux.RouteMatch
+	if !r.Match(req, &match) {
+		t.Fatalf("archive route didn't match")
+	}
+	if template, _ := match.Route.GetPathTemplate(); template != "/plans/{planId}/{branch}/archive" {
+		t.Errorf("expected the archive route, got %s", template)
+	}
+}
@@ -38,6 +38,7 @@ type subscription struct {
 
 type ActivePlan struct {
 	Id                      string
+	UserId                  string
 	CurrentStreamingReplyId string
 	CurrentReplyDoneCh      chan bool
 	Branch                  string
@@ -60,18 +61,20 @@ type ActivePlan struct {
 	BuildQueuesByPath       map[string][]*ActiveBuild
 	RepliesFinished         bool
 	StreamDoneCh            chan *shared.ApiError
-	ModelStreamId           string
-	MissingFilePath         string
-	MissingFileResponseCh   chan shared.RespondMissingFileChoice
-	AllowOverwritePaths     map[string]bool
-	SkippedPaths            map[string]bool
-	StoredReplyIds          []string
-	streamCh                chan string
-	subscriptions           map[string]*subscription
-	subscriptionMu          sync.Mutex
+	// closed to drop a plan that was registered but never started running
+	DiscardCh             chan struct{}
+	ModelStreamId         string
+	MissingFilePath       string
+	MissingFileResponseCh chan shared.RespondMissingFileChoice
+	AllowOverwritePaths   map[string]bool
+	SkippedPaths          map[string]bool
+	StoredReplyIds        []string
+	streamCh              chan string
+	subscriptions         map[string]*subscription
+	subscriptionMu        sync.Mutex
 }
 
-func NewActivePlan(planId, branch, prompt string, buildOnly bool) *ActivePlan {
+func NewActivePlan(planId, branch, userId, prompt string, buildOnly bool) *ActivePlan {
 	ctx, cancel := context.WithCancel(context.Background())
 	// child context for model stream so we can cancel it separately if needed
 	modelStreamCtx, cancelModelStream := context.WithCancel(ctx)
@@ -81,6 +84,7 @@ func NewActivePlan(planId, branch, prompt string, buildOnly bool) *ActivePlan {
 
 	active := ActivePlan{
 		Id:                    planId,
+		UserId:                userId,
 		BuildOnly:             buildOnly,
 		Branch:                branch,
 		Prompt:                prompt,
@@ -97,6 +101,7 @@ func NewActivePlan(planId, branch, prompt string, buildOnly bool) *ActivePlan {
 		BuiltFiles:            map[string]bool{},
 		IsBuildingByPath:      map[string]bool{},
 		StreamDoneCh:          make(chan *shared.ApiError),
+		DiscardCh:             make(chan struct{}),
 		MissingFileResponseCh: make(chan shared.RespondMissingFileChoice),
 		AllowOverwritePaths:   map[string]bool{},
 		SkippedPaths:          map[string]bool{},
@@ -10,6 +10,9 @@ type ServerAuth struct {
 	User        *db.User
 	OrgId       string
 	Permissions map[Permission]bool
+	// set when the request used a plan api key instead of a user token. It acts as the user who
+	// created it, limited to the key's plan and scopes.
+	PlanApiKey *db.PlanApiKey
 }
 
 func (a *ServerAuth) HasPermission(permission Permission) bool {
@@ -46,4 +49,9 @@ const (
 	PermissionDeleteAnyPlan         Permission = "delete_any_plan"
 	PermissionUpdateAnyPlan         Permission = "update_any_plan"
 	PermissionArchiveAnyPlan        Permission = "archive_any_plan"
+	PermissionManageOrgSettings     Permission = "manage_org_settings"
+	PermissionListAnyPlan           Permission = "list_any_plan"
+	PermissionMigratePlans          Permission = "migrate_plans"
+	PermissionManagePlanStorage     Permission = "manage_plan_storage"
+	PermissionImportPlans           Permission = "import_plans"
 )
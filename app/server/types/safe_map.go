@@ -29,6 +29,27 @@ func (sm *SafeMap[V]) Delete(key string) {
 	delete(sm.items, key)
 }
 
+// SetIfAbsent sets the item at key and returns true, or returns false without changing anything
+// if key is already set
+func (sm *SafeMap[V]) SetIfAbsent(key string, value V) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if _, ok := sm.items[key]; ok {
+		return false
+	}
+	sm.items[key] = value
+	return true
+}
+
+// DeleteIf deletes the item at key only if fn returns true for it
+func (sm *SafeMap[V]) DeleteIf(key string, fn func(V) bool) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if item, ok := sm.items[key]; ok && fn(item) {
+		delete(sm.items, key)
+	}
+}
+
 func (sm *SafeMap[V]) Update(key string, fn func(V)) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
@@ -73,6 +73,17 @@ var PlannerModelConfigByName = map[string]PlannerModelConfig{
 	},
 }
 
+// OpenAI's list prices. Models without an entry, like custom ones, can't be cost estimated.
+var ModelPricingByName = map[string]ModelPricing{
+	openai.GPT4TurboPreview:  {InputPerMillion: 10, OutputPerMillion: 30},
+	openai.GPT4Turbo0125:     {InputPerMillion: 10, OutputPerMillion: 30},
+	openai.GPT4Turbo1106:     {InputPerMillion: 10, OutputPerMillion: 30},
+	openai.GPT4:              {InputPerMillion: 30, OutputPerMillion: 60},
+	openai.GPT3Dot5Turbo:     {InputPerMillion: 0.5, OutputPerMillion: 1.5},
+	openai.GPT3Dot5Turbo0125: {InputPerMillion: 0.5, OutputPerMillion: 1.5},
+	openai.GPT3Dot5Turbo1106: {InputPerMillion: 1, OutputPerMillion: 2},
+}
+
 var TaskModelConfigByName = map[string]TaskModelConfig{
 	openai.GPT4TurboPreview: {
 		OpenAIResponseFormat: &openai.ChatCompletionResponseFormat{Type: "json_object"},
@@ -0,0 +1,35 @@
+package shared
+
+import "time"
+
+const AuditEventPlanCreated = "plan.created"
+
+// PlanCreatedAuditSchemaVersion is bumped whenever a field of PlanCreatedAuditEvent is removed,
+// renamed, or changes meaning. Adding a field doesn't bump it, so parsers should ignore fields
+// they don't know.
+const PlanCreatedAuditSchemaVersion = 1
+
+// PlanCreatedAuditEvent is the body posted to an org's audit webhook for every plan created in
+// the org, drafts included. Failed posts are retried, so an event can arrive more than once;
+// use plan_id to dedupe. Schema version 1:
+//
+//	schema_version  int     always 1
+//	event           string  always "plan.created"
+//	plan_id         string  uuid
+//	name            string  the plan's name when it was created; "draft" for unnamed plans
+//	project_id      string  uuid
+//	org_id          string  uuid
+//	actor_id        string  uuid of the user who created the plan
+//	created_at      string  RFC 3339 timestamp in UTC
+//	external_key    string  the externalKey given at creation, or null
+type PlanCreatedAuditEvent struct {
+	SchemaVersion int       `json:"schema_version"`
+	Event         string    `json:"event"`
+	PlanId        string    `json:"plan_id"`
+	Name          string    `json:"name"`
+	ProjectId     string    `json:"project_id"`
+	OrgId         string    `json:"org_id"`
+	ActorId       string    `json:"actor_id"`
+	CreatedAt     time.Time `json:"created_at"`
+	ExternalKey   *string   `json:"external_key"`
+}
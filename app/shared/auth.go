@@ -15,6 +15,13 @@ const (
 
 	ApiErrorTypeContinueNoMessages ApiErrorType = "continue_no_messages"
 
+	ApiErrorTypePlanNameExhausted      ApiErrorType = "plan_name_exhausted"
+	ApiErrorTypePlanNamePrefixRequired ApiErrorType = "plan_name_prefix_required"
+	ApiErrorTypePlanNameCapReached     ApiErrorType = "plan_name_cap_reached"
+
+	ApiErrorTypeTooManyRunning ApiErrorType = "too_many_running"
+	ApiErrorTypePlanBusy       ApiErrorType = "plan_busy"
+
 	ApiErrorTypeOther ApiErrorType = "other"
 )
 
@@ -26,6 +33,27 @@ type TrialMessagesExceededError struct {
 	MaxReplies int `json:"maxMessages"`
 }
 
+type PlanNameExhaustedError struct {
+	Name      string `json:"name"`
+	MaxSuffix int    `json:"maxSuffix"`
+}
+
+type PlanNameCapReachedError struct {
+	Name     string `json:"name"`
+	Count    int    `json:"count"`
+	MaxPlans int    `json:"maxPlans"`
+}
+
+type PlanNamePrefixRequiredError struct {
+	Name   string `json:"name"`
+	Prefix string `json:"prefix"`
+}
+
+type TooManyRunningError struct {
+	Running    int `json:"running"`
+	MaxRunning int `json:"maxRunning"`
+}
+
 type ApiError struct {
 	Type   ApiErrorType `json:"type"`
 	Status int          `json:"status"`
@@ -36,4 +64,16 @@ type ApiError struct {
 
 	// only used for trial messages exceeded error
 	TrialMessagesExceededError *TrialMessagesExceededError `json:"trialMessagesExceededError,omitempty"`
+
+	// only used for plan name exhausted error
+	PlanNameExhaustedError *PlanNameExhaustedError `json:"planNameExhaustedError,omitempty"`
+
+	// only used for plan name cap reached error
+	PlanNameCapReachedError *PlanNameCapReachedError `json:"planNameCapReachedError,omitempty"`
+
+	// only used for plan name prefix required error
+	PlanNamePrefixRequiredError *PlanNamePrefixRequiredError `json:"planNamePrefixRequiredError,omitempty"`
+
+	// only used for too many running error
+	TooManyRunningError *TooManyRunningError `json:"tooManyRunningError,omitempty"`
 }
@@ -143,6 +143,27 @@ func SummaryForLoadContext(contexts []*Context, tokensAdded, totalTokens int) st
 	return msg
 }
 
+func SummaryForPatchContext(numAdded, numUpdated, numRemoved, tokensDiff, totalTokens int) string {
+	var changes []string
+	if numAdded > 0 {
+		changes = append(changes, fmt.Sprintf("%d added", numAdded))
+	}
+	if numUpdated > 0 {
+		changes = append(changes, fmt.Sprintf("%d updated", numUpdated))
+	}
+	if numRemoved > 0 {
+		changes = append(changes, fmt.Sprintf("%d removed", numRemoved))
+	}
+
+	action := "added"
+	if tokensDiff < 0 {
+		action = "removed"
+	}
+	absTokenDiff := int(math.Abs(float64(tokensDiff)))
+
+	return fmt.Sprintf("Patched context files: %s | %s → %d 🪙 | total → %d 🪙", strings.Join(changes, ", "), action, absTokenDiff, totalTokens)
+}
+
 func TableForRemoveContext(contexts []*Context) string {
 	tableString := &strings.Builder{}
 	table := tablewriter.NewWriter(tableString)
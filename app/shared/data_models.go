@@ -41,6 +41,8 @@ type Invite struct {
 type Project struct {
 	Id   string `json:"id"`
 	Name string `json:"name"`
+	// applied to new plans that don't set a visibility
+	DefaultPlanVisibility PlanVisibility `json:"defaultPlanVisibility,omitempty"`
 }
 
 type Plan struct {
@@ -48,12 +50,111 @@ type Plan struct {
 	OwnerId         string     `json:"ownerId"`
 	ProjectId       string     `json:"projectId"`
 	Name            string     `json:"name"`
-	SharedWithOrgAt *time.Time `json:"sharedWithOrgAt,omitempty"`
+	Description     string     `json:"description,omitempty"`
+	Tags            []string   `json:"tags,omitempty"`
+	Pinned          bool       `json:"pinned,omitempty"`
+	SharedWithOrgAt *Timestamp `json:"sharedWithOrgAt,omitempty"`
 	TotalReplies    int        `json:"totalReplies"`
 	ActiveBranches  int        `json:"activeBranches"`
-	ArchivedAt      *time.Time `json:"archivedAt,omitempty"`
-	CreatedAt       time.Time  `json:"createdAt"`
-	UpdatedAt       time.Time  `json:"updatedAt"`
+	ArchivedAt      *Timestamp `json:"archivedAt,omitempty"`
+	CreatedAt       Timestamp  `json:"createdAt"`
+	UpdatedAt       Timestamp  `json:"updatedAt"`
+
+	// only set when listing plans for all users
+	Owner *User `json:"owner,omitempty"`
+
+	// only set by GetPlanHandler
+	Settings *PlanSettings `json:"settings,omitempty"`
+
+	// nil if no notifications are on
+	Notifications *PlanNotifications `json:"notifications,omitempty"`
+
+	// the git branch in the user's repo that the plan's changes are applied to, if it's pinned
+	// to one. Unrelated to the plan's own branches.
+	WorkingBranch string `json:"workingBranch,omitempty"`
+
+	// the externalKey the plan was created with, if any
+	ExternalKey string `json:"externalKey,omitempty"`
+
+	// only set when listing plans, if the plan couldn't be fully loaded, like when its directory
+	// is missing. RepairPlanHandler can usually fix it.
+	Error string `json:"error,omitempty"`
+
+	// only set when listing plans with include=status
+	Status PlanRunStatus `json:"status,omitempty"`
+
+	// only set when listing plans with include=branch: the running branch, or if none is running,
+	// the most recently updated one
+	Branch *Branch `json:"branch,omitempty"`
+}
+
+type PlanNotifyChannel string
+
+const (
+	// emails the plan owner
+	PlanNotifyChannelEmail   PlanNotifyChannel = "email"
+	PlanNotifyChannelWebhook PlanNotifyChannel = "webhook"
+)
+
+type PlanNotifications struct {
+	OnComplete bool              `json:"onComplete"`
+	OnError    bool              `json:"onError"`
+	Channel    PlanNotifyChannel `json:"channel"`
+	// required for the webhook channel
+	WebhookUrl string `json:"webhookUrl,omitempty"`
+	// the key each webhook body is signed with; see WebhookSignatureHeader. Only returned to
+	// users who can update the plan, and ignored in requests.
+	WebhookSecret string `json:"webhookSecret,omitempty"`
+}
+
+// WebhookSignatureHeader is set on every webhook request to "sha256=" followed by the hex
+// HMAC-SHA256 of the raw body, keyed with the webhook's secret
+const WebhookSignatureHeader = "X-Plandex-Signature"
+
+// PlanNotification is the body posted to a plan's notification webhook
+type PlanNotificationEvent string
+
+const (
+	PlanNotificationEventStatus PlanNotificationEvent = "status"
+	// sent by the webhook test endpoint; only Event, PlanId, Name, and CreatedAt are set
+	PlanNotificationEventPing PlanNotificationEvent = "ping"
+)
+
+type PlanNotification struct {
+	Event     PlanNotificationEvent `json:"event"`
+	PlanId    string                `json:"planId"`
+	Name      string                `json:"name"`
+	Branch    string                `json:"branch"`
+	Status    PlanStatus            `json:"status"`
+	Error     string                `json:"error,omitempty"`
+	CreatedAt time.Time             `json:"createdAt"`
+}
+
+type PlanShareLink struct {
+	Id        string    `json:"id"`
+	PlanId    string    `json:"planId"`
+	CreatorId string    `json:"creatorId"`
+	ExpiresAt Timestamp `json:"expiresAt"`
+	CreatedAt Timestamp `json:"createdAt"`
+}
+
+type PlanApiKeyScope string
+
+const (
+	// read the plan, its context, convo, and settings
+	PlanApiKeyScopeRead PlanApiKeyScope = "read"
+	// send prompts, build, and stream or stop the plan
+	PlanApiKeyScopeRun PlanApiKeyScope = "run"
+)
+
+type PlanApiKey struct {
+	Id        string            `json:"id"`
+	PlanId    string            `json:"planId"`
+	CreatorId string            `json:"creatorId"`
+	Name      string            `json:"name"`
+	Scopes    []PlanApiKeyScope `json:"scopes"`
+	ExpiresAt Timestamp         `json:"expiresAt"`
+	CreatedAt Timestamp         `json:"createdAt"`
 }
 
 type Branch struct {
@@ -199,6 +300,16 @@ type BaseModelConfig struct {
 	MaxTokens int           `json:"maxTokens"`
 }
 
+// USD per million tokens
+type ModelPricing struct {
+	InputPerMillion  float64 `json:"inputPerMillion"`
+	OutputPerMillion float64 `json:"outputPerMillion"`
+}
+
+func (p ModelPricing) Cost(inputTokens, outputTokens int) float64 {
+	return (float64(inputTokens)*p.InputPerMillion + float64(outputTokens)*p.OutputPerMillion) / 1e6
+}
+
 type PlannerModelConfig struct {
 	MaxConvoTokens       int `json:"maxConvoTokens"`
 	ReservedOutputTokens int `json:"maxOutputTokens"`
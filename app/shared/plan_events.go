@@ -0,0 +1,32 @@
+package shared
+
+import "time"
+
+type PlanEventType string
+
+const (
+	PlanEventCreated    PlanEventType = "created"
+	PlanEventDeleted    PlanEventType = "deleted"
+	PlanEventRenamed    PlanEventType = "renamed"
+	PlanEventArchived   PlanEventType = "archived"
+	PlanEventUnarchived PlanEventType = "unarchived"
+	PlanEventStatus     PlanEventType = "status"
+)
+
+type PlanEvent struct {
+	Type      PlanEventType `json:"type"`
+	OrgId     string        `json:"orgId"`
+	ProjectId string        `json:"projectId"`
+	PlanId    string        `json:"planId"`
+	OwnerId   string        `json:"ownerId"`
+	Name      string        `json:"name,omitempty"`
+	Branch    string        `json:"branch,omitempty"`
+	Status    PlanStatus    `json:"status,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	CreatedAt time.Time     `json:"createdAt"`
+
+	// only set on created events. ActorId is the user who created the plan, who isn't the owner
+	// when a plan is migrated in for someone else.
+	ActorId     string `json:"actorId,omitempty"`
+	ExternalKey string `json:"externalKey,omitempty"`
+}
@@ -0,0 +1,11 @@
+package shared
+
+import "time"
+
+type PlanFileTreeEntry struct {
+	Path      string     `json:"path"`
+	IsDir     bool       `json:"isDir"`
+	Size      int64      `json:"size,omitempty"`
+	Sha       string     `json:"sha,omitempty"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+}
@@ -11,4 +11,16 @@ const (
 	PlanStatusFinished    PlanStatus = "finished"
 	PlanStatusStopped     PlanStatus = "stopped"
 	PlanStatusError       PlanStatus = "error"
+	// set on startup for plans whose server process died mid-run
+	PlanStatusInterrupted PlanStatus = "interrupted"
+)
+
+// PlanRunStatus is a plan's overall status across its branches
+type PlanRunStatus string
+
+const (
+	PlanRunStatusRunning   PlanRunStatus = "running"
+	PlanRunStatusIdle      PlanRunStatus = "idle"
+	PlanRunStatusError     PlanRunStatus = "error"
+	PlanRunStatusCompleted PlanRunStatus = "completed"
 )
@@ -62,6 +62,108 @@ type InviteRequest struct {
 	OrgRoleId string `json:"orgRoleId"`
 }
 
+type SetOrgDefaultProjectRequest struct {
+	// an empty ProjectId clears the default project
+	ProjectId string `json:"projectId"`
+}
+
+type OrgSettings struct {
+	DefaultProjectId  *string `json:"defaultProjectId,omitempty"`
+	MaxPlanNameSuffix int     `json:"maxPlanNameSuffix"`
+	// caps how many plans can share a name, counting "name" and its ".N" variants, within the
+	// same scope as name uniqueness; nil means no cap
+	MaxPlansPerName *int `json:"maxPlansPerName,omitempty"`
+
+	// plans untouched for this many days are archived; nil disables
+	AutoArchiveAfterDays *int `json:"autoArchiveAfterDays,omitempty"`
+	// archived plans are deleted this many days after being archived; nil disables
+	AutoDeleteAfterDays *int `json:"autoDeleteAfterDays,omitempty"`
+
+	// non-draft plan names must start with this; nil means no requirement
+	RequiredNamePrefix *string `json:"requiredNamePrefix,omitempty"`
+	// prepend RequiredNamePrefix to names that are missing it instead of rejecting them
+	AutoPrefix bool `json:"autoPrefix"`
+	// treat plan names that differ only by case as the same name
+	CaseInsensitivePlanNames bool `json:"caseInsensitivePlanNames"`
+	// plan names are unique within a project rather than per owner within a project
+	ProjectScopedPlanNames bool `json:"projectScopedPlanNames"`
+	// copied into new plans' settings when they're created; nil means new plans use the server defaults
+	DefaultPlanSettings *PlanSettings `json:"defaultPlanSettings,omitempty"`
+	// every plan created in the org is posted here as a PlanCreatedAuditEvent; nil disables
+	AuditWebhookUrl *string `json:"auditWebhookUrl,omitempty"`
+	// the key audit webhook bodies are signed with; only returned to users who can manage org settings
+	AuditWebhookSecret *string `json:"auditWebhookSecret,omitempty"`
+}
+
+// nil fields are left unchanged
+type UpdateOrgSettingsRequest struct {
+	// 0 resets to the server default
+	MaxPlanNameSuffix *int `json:"maxPlanNameSuffix,omitempty"`
+	// 0 removes the cap
+	MaxPlansPerName *int `json:"maxPlansPerName,omitempty"`
+
+	// 0 disables
+	AutoArchiveAfterDays *int `json:"autoArchiveAfterDays,omitempty"`
+	AutoDeleteAfterDays  *int `json:"autoDeleteAfterDays,omitempty"`
+
+	// "" removes the requirement
+	RequiredNamePrefix *string `json:"requiredNamePrefix,omitempty"`
+	AutoPrefix         *bool   `json:"autoPrefix,omitempty"`
+
+	// enabling fails with a 409 if any owner already has plans whose names differ only by case
+	CaseInsensitivePlanNames *bool `json:"caseInsensitivePlanNames,omitempty"`
+	// enabling fails with a 409 if two owners already have plans with the same name in a project
+	ProjectScopedPlanNames *bool `json:"projectScopedPlanNames,omitempty"`
+
+	DefaultPlanSettings *PlanSettings `json:"defaultPlanSettings,omitempty"`
+	// removes the org's default plan settings; takes precedence over DefaultPlanSettings
+	ClearDefaultPlanSettings bool `json:"clearDefaultPlanSettings,omitempty"`
+
+	// "" disables the audit webhook
+	AuditWebhookUrl *string `json:"auditWebhookUrl,omitempty"`
+}
+
+// a plan dir with no plan row, left behind by a failed create or delete
+type OrphanedPlanDir struct {
+	PlanId     string    `json:"planId"`
+	Bytes      int64     `json:"bytes"`
+	ModifiedAt time.Time `json:"modifiedAt"`
+}
+
+type CompactPlanResponse struct {
+	BytesBefore    int64 `json:"bytesBefore"`
+	BytesAfter     int64 `json:"bytesAfter"`
+	BytesReclaimed int64 `json:"bytesReclaimed"`
+	// context bodies left behind without their metadata, like from an interrupted upload
+	RemovedContextBodies int `json:"removedContextBodies"`
+}
+
+type ListOrphanedPlanDirsResponse struct {
+	Dirs       []*OrphanedPlanDir `json:"dirs"`
+	TotalBytes int64              `json:"totalBytes"`
+}
+
+type ReapOrphanedPlanDirsRequest struct {
+	// lists what would be deleted without deleting anything
+	DryRun bool `json:"dryRun"`
+}
+
+type ReapOrphanedPlanDirsResponse struct {
+	DryRun bool `json:"dryRun"`
+	// the dirs that were deleted, or with DryRun, would be
+	Dirs       []*OrphanedPlanDir `json:"dirs"`
+	TotalBytes int64              `json:"totalBytes"`
+}
+
+type TestPlanWebhookResponse struct {
+	// true if the receiver responded with a 2xx status
+	Ok bool `json:"ok"`
+	// 0 if the request didn't get a response
+	StatusCode int    `json:"statusCode"`
+	LatencyMs  int64  `json:"latencyMs"`
+	Error      string `json:"error,omitempty"`
+}
+
 type CreateProjectRequest struct {
 	Name string `json:"name"`
 }
@@ -78,19 +180,388 @@ type RenameProjectRequest struct {
 	Name string `json:"name"`
 }
 
+type UpdateProjectSettingsRequest struct {
+	DefaultPlanVisibility *PlanVisibility `json:"defaultPlanVisibility,omitempty"`
+}
+
 type CreatePlanRequest struct {
 	Name string `json:"name"`
+
+	// optional caller-chosen id; must be a lowercase hyphenated uuid that isn't already in use
+	Id string `json:"id,omitempty"`
+
+	// loaded into the new plan's main branch; if any fail to load, the plan isn't created
+	Contexts LoadContextRequest `json:"contexts,omitempty"`
+
+	// defaults to the project's default plan visibility
+	Visibility *PlanVisibility `json:"visibility,omitempty"`
+
+	// pins the plan to a git branch in the user's repo, stored as the plan's WorkingBranch. This
+	// isn't one of the plan's own branches.
+	Branch string `json:"branch,omitempty"`
+
+	// only create the plan if the project has no named plans yet, archived ones included. If it
+	// has any, nothing is created and the response has ProjectHasPlans set. For setup scripts that
+	// should only bootstrap a project once.
+	CreateIfProjectEmpty bool `json:"createIfProjectEmpty,omitempty"`
+
+	// an opaque caller-chosen key, like a ticket id, so the plan can be matched up with the
+	// caller's records. It's stored on the plan, must be unique in the project, and is passed
+	// through to the org's audit webhook.
+	ExternalKey string `json:"externalKey,omitempty"`
+
+	// what to do if a plan in the project already has ExternalKey. Defaults to
+	// PlanExternalKeyConflictReturnExisting.
+	OnConflict PlanExternalKeyConflict `json:"onConflict,omitempty"`
+
+	// sent to the new plan's main branch once it's created, after any Contexts are loaded.
+	// ConnectStream is ignored; connect to the branch's stream to follow the reply.
+	InitialPrompt *TellPlanRequest `json:"initialPrompt,omitempty"`
+}
+
+type InitialPromptResult struct {
+	// false if the plan was created but the prompt couldn't be started, with the reason in Error
+	Started bool `json:"started"`
+	// the branch to connect to for the reply's stream
+	Branch string    `json:"branch"`
+	Error  *ApiError `json:"error,omitempty"`
+}
+
+type PlanExternalKeyConflict string
+
+const (
+	// responds with the existing plan, with Existing set, and creates nothing
+	PlanExternalKeyConflictReturnExisting PlanExternalKeyConflict = "return_existing"
+	// responds with a 409
+	PlanExternalKeyConflictError PlanExternalKeyConflict = "error"
+	// renames the existing plan to the requested name, then responds like return_existing
+	PlanExternalKeyConflictUpdateName PlanExternalKeyConflict = "update_name"
+)
+
+type GetCreatePlanEligibilityResponse struct {
+	Allowed bool `json:"allowed"`
+	// why the user can't create a plan; empty if Allowed
+	Reason string `json:"reason,omitempty"`
+	// only set on cloud. PlansLimit is omitted for users without a limit.
+	PlansUsed  *int `json:"plansUsed,omitempty"`
+	PlansLimit *int `json:"plansLimit,omitempty"`
+}
+
+// set on plan creation responses on cloud. PlansLimitHeader is omitted for users without a limit.
+const PlansUsedHeader = "X-Plans-Used"
+const PlansLimitHeader = "X-Plans-Limit"
+
+// set on convo stream responses. "true" if there are more messages past the page in the
+// requested order.
+const ConvoHasMoreHeader = "X-Has-More"
+
+const DefaultConvoStreamLimit = 100
+const MaxConvoStreamLimit = 1000
+
+const DefaultConvoPageLimit = 50
+const MaxConvoPageLimit = 200
+
+// a convo message as the paged convo endpoint returns it, for rendering a chat
+type PlanConvoMessage struct {
+	Id        string    `json:"id"`
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"createdAt"`
+	Tokens    int       `json:"tokens"`
+}
+
+type GetPlanConvoResponse struct {
+	Messages []*PlanConvoMessage `json:"messages"`
+	// number of messages in the whole convo
+	Total  int `json:"total"`
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+type UpdateConvoMessageRequest struct {
+	Content string `json:"content"`
+}
+
+type UpdateConvoMessageResponse struct {
+	Message *PlanConvoMessage `json:"message"`
+	// the branch's commit from before the edit, to undo it with a rewind
+	PreviousSha string `json:"previousSha"`
+}
+
+type DeleteConvoMessageResponse struct {
+	DeletedIds  []string `json:"deletedIds"`
+	PreviousSha string   `json:"previousSha"`
 }
 
 type CreatePlanResponse struct {
 	Id   string `json:"id"`
 	Name string `json:"name"`
+
+	// set when the requested name was taken and Name has a ".N" suffix added. RequestedName is
+	// the name as requested, without the org's auto prefix.
+	WasRenamed    bool   `json:"wasRenamed,omitempty"`
+	RequestedName string `json:"requestedName,omitempty"`
+
+	// only set if the request included contexts
+	LoadContextRes *LoadContextResponse `json:"loadContextRes,omitempty"`
+
+	// set when CreateIfProjectEmpty was requested and the project already has plans. Id and Name
+	// are the project's oldest plan, or empty if the user can't access it.
+	ProjectHasPlans bool `json:"projectHasPlans,omitempty"`
+
+	// set when a plan with the requested ExternalKey already existed, in which case Id and Name
+	// are that plan's and nothing was created
+	Existing bool `json:"existing,omitempty"`
+
+	// only set if the request included an InitialPrompt
+	InitialPrompt *InitialPromptResult `json:"initialPrompt,omitempty"`
+}
+
+type NormalizeDraftsResponse struct {
+	ArchivedPlanIds []string `json:"archivedPlanIds"`
+}
+
+type ArchivePlanResponse struct {
+	// false if the plan was already in the requested state
+	Changed bool `json:"changed"`
+}
+
+type ResetPlanResponse struct {
+	Plan *Plan `json:"plan"`
+	// the plan's state before the reset, which can be restored as a version
+	SnapshotSha string `json:"snapshotSha"`
+	// false if the plan was already empty
+	Changed bool `json:"changed"`
+}
+
+type TouchPlanResponse struct {
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type MarkPlanSeenResponse struct {
+	SeenAt time.Time `json:"seenAt"`
+}
+
+type DeleteAllPlansResponse struct {
+	DeletedCount int      `json:"deletedCount"`
+	DeletedIds   []string `json:"deletedIds"`
+
+	// only set for dry runs, in which case the counts and ids are what would be deleted
+	DryRun     bool                 `json:"dryRun,omitempty"`
+	Plans      []*DeletePlanSummary `json:"plans,omitempty"`
+	TotalBytes int64                `json:"totalBytes,omitempty"`
+}
+
+type DeletePlansByFilterRequest struct {
+	// nil matches both archived and unarchived plans
+	Archived *bool `json:"archived,omitempty"`
+	// plans last updated before this time
+	OlderThan  *time.Time `json:"olderThan,omitempty"`
+	NamePrefix *string    `json:"namePrefix,omitempty"`
+
+	DryRun bool `json:"dryRun,omitempty"`
+	// from a dry run with the same filter; required unless DryRun is set
+	ConfirmationToken string `json:"confirmationToken,omitempty"`
+}
+
+type DeletePlansByFilterResponse struct {
+	DeletedCount int                  `json:"deletedCount"`
+	Plans        []*DeletePlanSummary `json:"plans"`
+	// set when more plans match than can be deleted in one request
+	HasMore bool `json:"hasMore,omitempty"`
+
+	// only set for dry runs, in which case Plans is what would be deleted
+	DryRun            bool   `json:"dryRun,omitempty"`
+	ConfirmationToken string `json:"confirmationToken,omitempty"`
+	TotalBytes        int64  `json:"totalBytes,omitempty"`
+}
+
+type DeletePlanSummary struct {
+	Id    string `json:"id"`
+	Name  string `json:"name"`
+	Bytes int64  `json:"bytes"`
+}
+
+const DefaultRecentPlansHours = 24
+const MaxRecentPlansHours = 24 * 30
+const DefaultRecentPlansLimit = 50
+const MaxRecentPlansLimit = 200
+
+type ListRecentOrgPlansResponse struct {
+	// newest first, with Owner set
+	Plans        []*Plan             `json:"plans"`
+	ProjectsById map[string]*Project `json:"projectsById"`
+	// pass as before to get the next page; empty on the last page
+	NextBefore string `json:"nextBefore,omitempty"`
+}
+
+type ListUserPlansResponse struct {
+	Plans        []*Plan             `json:"plans"`
+	ProjectsById map[string]*Project `json:"projectsById"`
+}
+
+type PlanNameGroup struct {
+	BaseName string  `json:"baseName"`
+	Plans    []*Plan `json:"plans"`
+}
+
+type ListDuplicatePlanNamesResponse struct {
+	Groups []*PlanNameGroup `json:"groups"`
+}
+
+type MergePlansRequest struct {
+	TargetPlanId  string   `json:"targetPlanId"`
+	SourcePlanIds []string `json:"sourcePlanIds"`
+}
+
+type MergePlansResponse struct {
+	TargetPlanId    string   `json:"targetPlanId"`
+	ArchivedPlanIds []string `json:"archivedPlanIds"`
+	// rewind or restore the target plan to this sha and unarchive the sources to undo the merge
+	SnapshotSha      string `json:"snapshotSha"`
+	NumContexts      int    `json:"numContexts"`
+	NumConvoMessages int    `json:"numConvoMessages"`
+}
+
+type CopyPlanSettingsRequest struct {
+	// defaults to the source plan's name, with a ".N" suffix added if it's taken
+	Name string `json:"name"`
+}
+
+type CopyPlanRequest struct {
+	// defaults to the source plan's name, with a ".N" suffix added if it's taken
+	Name string `json:"name"`
+	// "full" (the default), "none", or "last:N" to keep only the N most recent messages
+	ConvoMode string `json:"convoMode"`
+}
+
+type CopyPlanResponse struct {
+	Id               string `json:"id"`
+	Name             string `json:"name"`
+	WasRenamed       bool   `json:"wasRenamed,omitempty"`
+	RequestedName    string `json:"requestedName,omitempty"`
+	NumContexts      int    `json:"numContexts"`
+	NumConvoMessages int    `json:"numConvoMessages"`
+}
+
+type MigratePlanRequest struct {
+	TargetOrgId     string `json:"targetOrgId"`
+	TargetProjectId string `json:"targetProjectId"`
+	// maps user ids in the source org to user ids in the target org. Users without a mapping are
+	// replaced by the migrating user.
+	UserIdMap map[string]string `json:"userIdMap"`
+}
+
+type MigratePlanResponse struct {
+	PlanId           string `json:"planId"`
+	Name             string `json:"name"`
+	OwnerId          string `json:"ownerId"`
+	NumContexts      int    `json:"numContexts"`
+	NumConvoMessages int    `json:"numConvoMessages"`
+}
+
+type ImportPlanFromPathRequest struct {
+	// an absolute path on the server, inside one of the dirs in PLANDEX_IMPORT_ROOTS
+	Path string `json:"path"`
+	// defaults to the name in the dir's plan.json, then the dir's name
+	Name string `json:"name"`
+}
+
+type ImportPlanFromPathResponse struct {
+	PlanId           string `json:"planId"`
+	Name             string `json:"name"`
+	NumContexts      int    `json:"numContexts"`
+	NumConvoMessages int    `json:"numConvoMessages"`
+}
+
+type ExportPlansRequest struct {
+	// defaults to all of the user's unarchived plans in the project
+	PlanIds []string `json:"planIds"`
+}
+
+// ExportPlansManifestPath is where the manifest goes in a plans export archive. Each exported
+// plan is in a directory named for its id.
+const ExportPlansManifestPath = "manifest.json"
+
+type ExportPlansManifest struct {
+	ExportedAt time.Time            `json:"exportedAt"`
+	Plans      []*ExportedPlan      `json:"plans"`
+	Skipped    []*SkippedExportPlan `json:"skipped"`
+}
+
+type ExportedPlan struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	Dir  string `json:"dir"`
+}
+
+type SkippedExportPlan struct {
+	Id     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+type CreatePlanShareLinkRequest struct {
+	// defaults to DefaultPlanShareLinkHours if not set
+	ExpiresInHours int `json:"expiresInHours"`
+}
+
+type CreatePlanShareLinkResponse struct {
+	Link *PlanShareLink `json:"link"`
+	// only returned on creation -- the server stores a hash
+	Token string `json:"token"`
+}
+
+const DefaultPlanShareLinkHours = 24 * 7
+const MaxPlanShareLinkHours = 24 * 30
+
+type CreatePlanApiKeyRequest struct {
+	Name   string            `json:"name"`
+	Scopes []PlanApiKeyScope `json:"scopes"`
+	// defaults to DefaultPlanApiKeyHours if not set
+	ExpiresInHours int `json:"expiresInHours"`
+}
+
+type CreatePlanApiKeyResponse struct {
+	Key *PlanApiKey `json:"key"`
+	// only returned on creation -- the server stores a hash. Send it as the token in the auth header.
+	Token string `json:"token"`
+}
+
+const DefaultPlanApiKeyHours = 24 * 30
+const MaxPlanApiKeyHours = 24 * 365
+
+type PlanVisibility string
+
+const (
+	PlanVisibilityPrivate PlanVisibility = "private"
+	PlanVisibilityOrg     PlanVisibility = "org"
+)
+
+// nil fields are left unchanged -- use a pointer to an empty value to clear a field
+type UpdatePlanRequest struct {
+	Name        *string         `json:"name,omitempty"`
+	Description *string         `json:"description,omitempty"`
+	Tags        *[]string       `json:"tags,omitempty"`
+	Pinned      *bool           `json:"pinned,omitempty"`
+	Visibility  *PlanVisibility `json:"visibility,omitempty"`
+	// replaces the plan's notification settings; turn both events off to disable them
+	Notifications *PlanNotifications `json:"notifications,omitempty"`
+
+	// if set, the update is rejected with a 409 if the plan was updated since
+	IfUpdatedAt *time.Time `json:"ifUpdatedAt,omitempty"`
 }
 
 type GetCurrentBranchByPlanIdRequest struct {
 	CurrentBranchByPlanId map[string]string `json:"currentBranchByPlanId"`
 }
 
+type GetPlanStatusesRequest struct {
+	PlanIds []string `json:"planIds"`
+}
+
+// plan ids the user can't access are left out
+type GetPlanStatusesResponse map[string]PlanRunStatus
+
 type ListPlansRunningResponse struct {
 	Branches                   []*Branch            `json:"branches"`
 	StreamStartedAtByBranchId  map[string]time.Time `json:"streamStartedAtByBranchId"`
@@ -157,6 +628,38 @@ type LoadContextResponse struct {
 	Msg               string `json:"msg"`
 }
 
+type ContextTokens struct {
+	Id          string      `json:"id"`
+	ContextType ContextType `json:"contextType"`
+	Name        string      `json:"name"`
+	FilePath    string      `json:"filePath,omitempty"`
+	Url         string      `json:"url,omitempty"`
+	NumTokens   int         `json:"numTokens"`
+}
+
+type GetPlanContextTokensResponse struct {
+	Contexts    []*ContextTokens `json:"contexts"`
+	TotalTokens int              `json:"totalTokens"`
+	MaxTokens   int              `json:"maxTokens"`
+}
+
+type EstimatePlanCostRequest struct {
+	Prompt string `json:"prompt"`
+}
+
+// estimates the planner call for one prompt. Builds and other model roles aren't included.
+type EstimatePlanCostResponse struct {
+	ModelName string `json:"modelName"`
+	// context, prompt, and conversation up to max-convo-tokens, after which it's summarized
+	InputTokens int `json:"inputTokens"`
+	// the reply can be anywhere from empty up to the planner's reserved output tokens
+	MinOutputTokens int `json:"minOutputTokens"`
+	MaxOutputTokens int `json:"maxOutputTokens"`
+	// in USD; nil if there's no pricing for the model
+	MinCost *float64 `json:"minCost,omitempty"`
+	MaxCost *float64 `json:"maxCost,omitempty"`
+}
+
 type UpdateContextParams struct {
 	Body string `json:"body"`
 }
@@ -175,6 +678,99 @@ type DeleteContextResponse struct {
 	Msg           string `json:"msg"`
 }
 
+type ContextPatchOp string
+
+const (
+	ContextPatchOpAdd    ContextPatchOp = "add"
+	ContextPatchOpUpdate ContextPatchOp = "update"
+	ContextPatchOpRemove ContextPatchOp = "remove"
+)
+
+// ContextPatchOperation targets a file context by its path. Content is ignored for removes.
+type ContextPatchOperation struct {
+	Op      ContextPatchOp `json:"op"`
+	Path    string         `json:"path"`
+	Content string         `json:"content,omitempty"`
+}
+
+// operations are applied together, so either all of them succeed or none do
+type PatchContextRequest struct {
+	Operations []*ContextPatchOperation `json:"operations"`
+}
+
+type PatchContextResponse struct {
+	// every context on the branch after the patch, without bodies
+	Contexts          []*Context `json:"contexts"`
+	TokensDiff        int        `json:"tokensDiff"`
+	TotalTokens       int        `json:"totalTokens"`
+	MaxTokensExceeded bool       `json:"maxTokensExceeded"`
+	MaxTokens         int        `json:"maxTokens"`
+	Msg               string     `json:"msg"`
+}
+
+// one line of the NDJSON plan diff response
+type PlanFileDiff struct {
+	Path string `json:"path"`
+	// unified diff against the file at the requested commit. Empty if Truncated and the diff
+	// size budget was already used up.
+	Diff string `json:"diff"`
+	// the file wasn't in context at the requested commit
+	Added     bool `json:"added"`
+	Truncated bool `json:"truncated"`
+}
+
+type PlanFileChangeStatus string
+
+const (
+	PlanFileChangeAdded    PlanFileChangeStatus = "added"
+	PlanFileChangeModified PlanFileChangeStatus = "modified"
+)
+
+// one file with pending changes. Plans only create or update files, so there's no deleted status.
+type PlanFileChange struct {
+	Path   string               `json:"path"`
+	Status PlanFileChangeStatus `json:"status"`
+	// the file as it was loaded into context. Nil for added files.
+	Old *string `json:"old,omitempty"`
+	// the file with the plan's pending changes applied
+	New string `json:"new"`
+}
+
+type PlanChangesSummary struct {
+	Added    int `json:"added"`
+	Modified int `json:"modified"`
+}
+
+type GetPlanChangesResponse struct {
+	Summary PlanChangesSummary `json:"summary"`
+	Files   []*PlanFileChange  `json:"files"`
+}
+
+type ApplyPlanChangesRequest struct {
+	// if set, only these files' pending changes are applied. Each must have pending changes.
+	Paths []string `json:"paths,omitempty"`
+}
+
+type ApplyPlanChangesResponse struct {
+	// the branch's latest commit before applying. Rewinding to it undoes the apply.
+	PreviousSha string             `json:"previousSha"`
+	Sha         string             `json:"sha"`
+	Summary     PlanChangesSummary `json:"summary"`
+	// paths of the files the apply changed, sorted
+	Files []string `json:"files"`
+	// paths of the files with changes that are still pending, sorted
+	Pending []string `json:"pending"`
+}
+
+type RejectPlanChangesResponse struct {
+	NumDiscarded int `json:"numDiscarded"`
+	// paths of the files whose pending changes were discarded, sorted
+	Files []string `json:"files"`
+	// the branch's latest commit before discarding, which still has the discarded changes. Empty
+	// if there was nothing to discard.
+	PreviousSha string `json:"previousSha,omitempty"`
+}
+
 type RejectFileRequest struct {
 	FilePath string `json:"filePath"`
 }
@@ -188,6 +784,28 @@ type RewindPlanResponse struct {
 	LatestCommit string `json:"latestCommit"`
 }
 
+type PlanVersion struct {
+	Sha       string    `json:"sha"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type RestorePlanVersionRequest struct {
+	Sha string `json:"sha"`
+}
+
+type RestorePlanVersionResponse struct {
+	// false if the plan already matched the restored version, in which case no version is added
+	Changed bool `json:"changed"`
+	// the plan's latest version after the restore
+	Version *PlanVersion `json:"version"`
+}
+
+type RepairPlanResponse struct {
+	Fixes    []string `json:"fixes"`
+	Warnings []string `json:"warnings"`
+}
+
 type LogResponse struct {
 	Shas []string `json:"shas"`
 	Body string   `json:"body"`
@@ -197,6 +815,10 @@ type CreateBranchRequest struct {
 	Name string `json:"name"`
 }
 
+type RenameBranchRequest struct {
+	Name string `json:"name"`
+}
+
 type UpdateSettingsRequest struct {
 	Settings *PlanSettings `json:"settings"`
 }
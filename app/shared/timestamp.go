@@ -0,0 +1,55 @@
+package shared
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// TimestampFormat is RFC3339 in UTC with fixed microsecond precision, matching what postgres stores
+const TimestampFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// Timestamp serializes as TimestampFormat regardless of the location or precision of the underlying time,
+// so clients always get the same format whether a value came from postgres or from time.Now().
+type Timestamp struct {
+	time.Time
+}
+
+func NewTimestamp(t time.Time) Timestamp {
+	return Timestamp{Time: t}
+}
+
+func NewTimestampPtr(t *time.Time) *Timestamp {
+	if t == nil {
+		return nil
+	}
+	ts := NewTimestamp(*t)
+	return &ts
+}
+
+func (t Timestamp) format() string {
+	return t.UTC().Round(time.Microsecond).Format(TimestampFormat)
+}
+
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + t.format() + `"`), nil
+}
+
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	if len(data) < 2 || data[0] != '"' || data[len(data)-1] != '"' {
+		return fmt.Errorf("invalid timestamp: %s", data)
+	}
+
+	// RFC3339Nano accepts any fractional precision, including none
+	parsed, err := time.Parse(time.RFC3339Nano, string(data[1:len(data)-1]))
+	if err != nil {
+		return fmt.Errorf("invalid timestamp: %v", err)
+	}
+
+	t.Time = parsed.UTC()
+	return nil
+}
@@ -0,0 +1,81 @@
+package shared
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTimestampMarshalJSON(t *testing.T) {
+	est := time.FixedZone("EST", -5*60*60)
+
+	tests := []struct {
+		name string
+		in   time.Time
+		want string
+	}{
+		{"utc whole seconds", time.Date(2024, 4, 10, 12, 30, 0, 0, time.UTC), `"2024-04-10T12:30:00.000000Z"`},
+		{"normalizes to utc", time.Date(2024, 4, 10, 7, 30, 0, 0, est), `"2024-04-10T12:30:00.000000Z"`},
+		{"rounds nanoseconds", time.Date(2024, 4, 10, 12, 30, 0, 123456789, time.UTC), `"2024-04-10T12:30:00.123457Z"`},
+		{"pads short fractions", time.Date(2024, 4, 10, 12, 30, 0, 5000000, time.UTC), `"2024-04-10T12:30:00.005000Z"`},
+	}
+
+	for _, tt := range tests {
+		got, err := json.Marshal(NewTimestamp(tt.in))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTimestampPlanFields(t *testing.T) {
+	ts := time.Date(2024, 4, 10, 12, 30, 0, 0, time.UTC)
+
+	got, err := json.Marshal(&Plan{
+		Id:         "plan",
+		ArchivedAt: NewTimestampPtr(&ts),
+		CreatedAt:  NewTimestamp(ts),
+		UpdatedAt:  NewTimestamp(ts),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := `{"id":"plan","ownerId":"","projectId":"","name":"","totalReplies":0,"activeBranches":0,` +
+		`"archivedAt":"2024-04-10T12:30:00.000000Z","createdAt":"2024-04-10T12:30:00.000000Z","updatedAt":"2024-04-10T12:30:00.000000Z"}`
+
+	if string(got) != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestTimestampUnmarshalJSON(t *testing.T) {
+	for _, in := range []string{
+		`"2024-04-10T12:30:00.000000Z"`,
+		`"2024-04-10T12:30:00Z"`,
+		`"2024-04-10T07:30:00-05:00"`,
+	} {
+		var ts Timestamp
+		if err := json.Unmarshal([]byte(in), &ts); err != nil {
+			t.Fatalf("%s: unexpected error: %v", in, err)
+		}
+
+		want := time.Date(2024, 4, 10, 12, 30, 0, 0, time.UTC)
+		if !ts.Time.Equal(want) || ts.Location() != time.UTC {
+			t.Errorf("%s: got %v, want %v", in, ts.Time, want)
+		}
+	}
+
+	var ts *Timestamp
+	if err := json.Unmarshal([]byte("null"), &ts); err != nil || ts != nil {
+		t.Errorf("null: got %v, %v", ts, err)
+	}
+
+	var bad Timestamp
+	if err := json.Unmarshal([]byte(`"yesterday"`), &bad); err == nil {
+		t.Error("expected error for invalid timestamp")
+	}
+}